@@ -0,0 +1,19 @@
+package events
+
+import (
+	"github.com/abibby/salusa/event"
+	"github.com/abibby/salusa/event/cron"
+)
+
+// AnalyzeBooksEvent decodes the pages of every book that hasn't been analysed
+// by the current version of the analysis job.
+type AnalyzeBooksEvent struct {
+	cron.CronEvent
+}
+
+var _ event.Event = (*AnalyzeBooksEvent)(nil)
+
+// Type implements event.Event.
+func (a *AnalyzeBooksEvent) Type() event.EventType {
+	return "comicbox:analyze_books"
+}
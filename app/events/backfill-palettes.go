@@ -0,0 +1,19 @@
+package events
+
+import (
+	"github.com/abibby/salusa/event"
+	"github.com/abibby/salusa/event/cron"
+)
+
+// BackfillPalettesEvent extracts the palette of every book and series cover
+// that doesn't have one yet.
+type BackfillPalettesEvent struct {
+	cron.CronEvent
+}
+
+var _ event.Event = (*BackfillPalettesEvent)(nil)
+
+// Type implements event.Event.
+func (b *BackfillPalettesEvent) Type() event.EventType {
+	return "comicbox:backfill_palettes"
+}
@@ -0,0 +1,22 @@
+package events
+
+import (
+	"github.com/abibby/comicbox-3/server/repack"
+	"github.com/abibby/salusa/event"
+	"github.com/abibby/salusa/event/cron"
+)
+
+// RepackEvent rewrites the archives of a series with their pages converted to
+// a smaller format.
+type RepackEvent struct {
+	cron.CronEvent
+	SeriesSlug string
+	Options    repack.Options
+}
+
+var _ event.Event = (*RepackEvent)(nil)
+
+// Type implements event.Event.
+func (r *RepackEvent) Type() event.EventType {
+	return "comicbox:repack"
+}
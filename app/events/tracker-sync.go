@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/salusa/di"
+	"github.com/abibby/salusa/event"
+	"github.com/abibby/salusa/event/cron"
+	"github.com/google/uuid"
+)
+
+// TrackerSyncEvent syncs lists and progress with the reading trackers of
+// every user that has linked one, or only UserID when it is set. SeriesSlug
+// limits the sync to one series.
+type TrackerSyncEvent struct {
+	cron.CronEvent
+	UserID     uuid.UUID
+	SeriesSlug string
+}
+
+var _ event.Event = (*TrackerSyncEvent)(nil)
+
+// Type implements event.Event.
+func (a *TrackerSyncEvent) Type() event.EventType {
+	return "comicbox:tracker_sync"
+}
+
+func RegisterTrackerSync(ctx context.Context) error {
+	queue, err := di.Resolve[event.Queue](ctx)
+	if err != nil {
+		return err
+	}
+	di.RegisterSingleton(ctx, func() models.BookReadHandler {
+		return func(ctx context.Context, uid uuid.UUID, seriesSlug string) error {
+			return queue.Push(&TrackerSyncEvent{
+				UserID:     uid,
+				SeriesSlug: seriesSlug,
+			})
+		}
+	})
+
+	if config.TrackerSyncInterval == "" {
+		return nil
+	}
+	cronService, err := di.Resolve[*cron.CronService](ctx)
+	if err != nil {
+		return err
+	}
+	cronService.Schedule(config.TrackerSyncInterval, &TrackerSyncEvent{})
+	return nil
+}
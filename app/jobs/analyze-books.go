@@ -0,0 +1,203 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"sync"
+
+	"github.com/abibby/comicbox-3/app/events"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/archive"
+	"github.com/abibby/comicbox-3/server/classify"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/abibby/comicbox-3/server/middleware"
+	"github.com/abibby/comicbox-3/server/pagerules"
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/event"
+	"github.com/abibby/salusa/extra/sets"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// analysisVersion must be incremented whenever analyzeBook calculates
+// something new so existing books are backfilled.
+const analysisVersion = 4
+
+var analyzeMtx = &sync.Mutex{}
+
+type AnalyzeBooksHandler struct {
+	DB     *sqlx.DB        `inject:""`
+	Update database.Update `inject:""`
+	Log    *slog.Logger    `inject:""`
+}
+
+var _ event.Handler[*events.AnalyzeBooksEvent] = (*AnalyzeBooksHandler)(nil)
+
+type pageAnalysis struct {
+	BlurHash string
+	Crop     *models.CropBox
+	Hash     imaging.Hash
+	Blank    bool
+	Left     imaging.Edge
+	Right    imaging.Edge
+}
+
+// Handle implements event.Handler.
+func (h *AnalyzeBooksHandler) Handle(ctx context.Context, event *events.AnalyzeBooksEvent) error {
+	analyzeMtx.Lock()
+	defer analyzeMtx.Unlock()
+
+	ids := []uuid.UUID{}
+	err := models.BookQuery(ctx).
+		Select("id").
+		Where("analysis_version", "<", analysisVersion).
+		OrderBy("sort").
+		Load(h.DB, &ids)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	h.Log.Info("Starting book analysis", "total", len(ids))
+	defer h.Log.Info("Finished book analysis")
+
+	series := sets.New[string]()
+	for i, id := range ids {
+		slug, err := h.analyzeBook(ctx, id)
+		if err != nil {
+			h.Log.Warn("failed to analyze book", "book", id, "err", err)
+			continue
+		}
+		archive.Invalidate(id)
+		// Thumbnails, slices and sprites cached before the analysis aren't
+		// cropped.
+		err = middleware.ClearCache(path.Join("/api/books", id.String()))
+		if err != nil {
+			h.Log.Warn("failed to clear book cache", "book", id, "err", err)
+		}
+		series.Add(slug)
+		if (i+1)%100 == 0 {
+			h.Log.Info("Analyzing books", "total", len(ids), "remaining", len(ids)-i-1)
+		}
+	}
+
+	for slug := range series.All() {
+		err = h.updateSeries(ctx, slug)
+		if err != nil {
+			h.Log.Warn("failed to update series pages", "series", slug, "err", err)
+		}
+		archive.InvalidateSeries(slug)
+	}
+	return nil
+}
+
+// updateSeries classifies the pages of every book in a series and marks pages
+// deleted now that its new books have page hashes to compare.
+func (h *AnalyzeBooksHandler) updateSeries(ctx context.Context, slug string) error {
+	return h.Update(func(tx *sqlx.Tx) error {
+		series, err := models.SeriesQuery(ctx).Find(tx, slug)
+		if err != nil {
+			return err
+		}
+		if series == nil {
+			return nil
+		}
+
+		books, err := models.BookQuery(ctx).
+			Where("series", "=", slug).
+			Get(tx)
+		if err != nil {
+			return err
+		}
+		known := classify.NewSeries(books)
+		for _, book := range books {
+			if !classify.Classify(book, known) {
+				continue
+			}
+			book.UpdateField("pages")
+			err = model.SaveContext(ctx, tx, book)
+			if err != nil {
+				return err
+			}
+		}
+
+		count, err := pagerules.Apply(ctx, tx, series)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			h.Log.Info("Marked pages deleted", "series", slug, "count", count)
+		}
+		return nil
+	})
+}
+
+// analyzeBook analyses the pages of a book and returns its series.
+func (h *AnalyzeBooksHandler) analyzeBook(ctx context.Context, id uuid.UUID) (string, error) {
+	a, err := archive.Open(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer a.Release()
+
+	pages := make([]*pageAnalysis, len(a.Images()))
+	for i := range a.Images() {
+		img, err := a.DecodePage(ctx, i)
+		if err != nil {
+			h.Log.Warn("failed to decode page", "book", id, "page", i, "err", err)
+			continue
+		}
+		pages[i] = &pageAnalysis{
+			BlurHash: imaging.BlurHash(img),
+			Hash:     imaging.DHash(img),
+			Blank:    imaging.IsBlank(img),
+		}
+		pages[i].Left, pages[i].Right = imaging.Edges(img)
+		if box, ok := imaging.TrimBox(img); ok {
+			box = box.Sub(img.Bounds().Min)
+			pages[i].Crop = &models.CropBox{
+				X:      box.Min.X,
+				Y:      box.Min.Y,
+				Width:  box.Dx(),
+				Height: box.Dy(),
+			}
+		}
+	}
+
+	slug := ""
+	err = h.Update(func(tx *sqlx.Tx) error {
+		book, err := models.BookQuery(ctx).Find(tx, id)
+		if err != nil {
+			return err
+		}
+		if book == nil {
+			return nil
+		}
+		slug = book.SeriesSlug
+
+		for i, page := range book.Pages {
+			if i >= len(pages) || pages[i] == nil {
+				continue
+			}
+			page.BlurHash = pages[i].BlurHash
+			page.Crop = pages[i].Crop
+			page.Hash = pages[i].Hash.String()
+			page.Blank = pages[i].Blank
+			page.Seam = nil
+			if i+1 < len(pages) && pages[i+1] != nil {
+				page.Seam = &models.Seam{
+					LeftToRight: imaging.Continuity(pages[i].Right, pages[i+1].Left),
+					RightToLeft: imaging.Continuity(pages[i].Left, pages[i+1].Right),
+				}
+			}
+		}
+		book.AnalysisVersion = analysisVersion
+
+		return model.SaveContext(ctx, tx, book)
+	})
+	return slug, err
+}
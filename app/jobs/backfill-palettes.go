@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/abibby/comicbox-3/app/events"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/archive"
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/event"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var paletteMtx = &sync.Mutex{}
+
+type BackfillPalettesHandler struct {
+	DB     *sqlx.DB        `inject:""`
+	Update database.Update `inject:""`
+	Log    *slog.Logger    `inject:""`
+}
+
+var _ event.Handler[*events.BackfillPalettesEvent] = (*BackfillPalettesHandler)(nil)
+
+// Handle implements event.Handler.
+func (h *BackfillPalettesHandler) Handle(ctx context.Context, event *events.BackfillPalettesEvent) error {
+	paletteMtx.Lock()
+	defer paletteMtx.Unlock()
+
+	ids := []uuid.UUID{}
+	err := models.BookQuery(ctx).
+		Select("id").
+		Where("palette", "=", nil).
+		Load(h.DB, &ids)
+	if err != nil {
+		return err
+	}
+
+	slugs := []string{}
+	err = models.SeriesQuery(ctx).
+		Select("name").
+		Where("palette", "=", nil).
+		Where("cover_image_path", "!=", "").
+		Load(h.DB, &slugs)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 && len(slugs) == 0 {
+		return nil
+	}
+
+	h.Log.Info("Starting palette backfill", "books", len(ids), "series", len(slugs))
+	defer h.Log.Info("Finished palette backfill")
+
+	for _, id := range ids {
+		err = h.bookPalette(ctx, id)
+		if err != nil {
+			h.Log.Warn("failed to extract book palette", "book", id, "err", err)
+		}
+	}
+	for _, slug := range slugs {
+		err = h.seriesPalette(ctx, slug)
+		if err != nil {
+			h.Log.Warn("failed to extract series palette", "series", slug, "err", err)
+		}
+	}
+	return nil
+}
+
+func (h *BackfillPalettesHandler) bookPalette(ctx context.Context, id uuid.UUID) error {
+	book, err := models.BookQuery(ctx).Find(h.DB, id)
+	if err != nil || book == nil {
+		return err
+	}
+
+	// Covers that can't be read get an empty palette so they aren't tried
+	// again on every sync.
+	palette := &models.Palette{}
+	a, err := archive.Open(ctx, id)
+	if err != nil {
+		h.Log.Warn("failed to open book", "book", id, "err", err)
+	} else {
+		img, err := a.DecodePage(ctx, book.CoverPage())
+		a.Release()
+		if err != nil {
+			h.Log.Warn("failed to decode book cover", "book", id, "err", err)
+		} else {
+			palette = models.NewPalette(img)
+		}
+	}
+
+	return h.Update(func(tx *sqlx.Tx) error {
+		book, err := models.BookQuery(ctx).Find(tx, id)
+		if err != nil || book == nil {
+			return err
+		}
+		book.Palette = palette
+		return model.SaveContext(ctx, tx, book)
+	})
+}
+
+func (h *BackfillPalettesHandler) seriesPalette(ctx context.Context, slug string) error {
+	return h.Update(func(tx *sqlx.Tx) error {
+		series, err := models.SeriesQuery(ctx).Find(tx, slug)
+		if err != nil || series == nil {
+			return err
+		}
+		series.Palette, err = models.DecodePalette(ctx, series.CoverImagePath())
+		if err != nil {
+			h.Log.Warn("failed to decode series cover", "series", slug, "err", err)
+			series.Palette = &models.Palette{}
+		}
+		return model.SaveContext(ctx, tx, series)
+	})
+}
@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"sync"
+
+	"github.com/abibby/comicbox-3/app/events"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/archive"
+	"github.com/abibby/comicbox-3/server/middleware"
+	"github.com/abibby/comicbox-3/server/repack"
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/event"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var repackMtx = &sync.Mutex{}
+
+type RepackHandler struct {
+	DB     *sqlx.DB        `inject:""`
+	Update database.Update `inject:""`
+	Log    *slog.Logger    `inject:""`
+}
+
+var _ event.Handler[*events.RepackEvent] = (*RepackHandler)(nil)
+
+// Handle implements event.Handler.
+func (h *RepackHandler) Handle(ctx context.Context, event *events.RepackEvent) error {
+	repackMtx.Lock()
+	defer repackMtx.Unlock()
+
+	// Sync also rewrites page entries, running both at once could save the
+	// entries of the old archive.
+	syncMtx.Lock()
+	defer syncMtx.Unlock()
+
+	opts := event.Options.WithDefaults()
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
+	ids := []uuid.UUID{}
+	err = models.BookQuery(ctx).
+		Select("id").
+		Where("series", "=", event.SeriesSlug).
+		Load(h.DB, &ids)
+	if err != nil {
+		return err
+	}
+
+	h.Log.Info("Starting repack", "series", event.SeriesSlug, "books", len(ids), "format", opts.Format, "quality", opts.Quality)
+	var saved int64
+	for _, id := range ids {
+		result, err := h.repackBook(ctx, id, opts)
+		if err != nil {
+			h.Log.Warn("failed to repack book", "book", id, "err", err)
+			continue
+		}
+		saved += result.OriginalSize - result.Size
+	}
+	h.Log.Info("Finished repack", "series", event.SeriesSlug, "saved", saved)
+	return nil
+}
+
+func (h *RepackHandler) repackBook(ctx context.Context, id uuid.UUID, opts repack.Options) (*repack.Result, error) {
+	book, err := models.BookQuery(ctx).Find(h.DB, id)
+	if err != nil || book == nil {
+		return &repack.Result{}, err
+	}
+
+	result, err := repack.Rewrite(ctx, book.FilePath(), opts)
+	if err != nil {
+		return nil, err
+	}
+	if result.Converted == 0 {
+		return result, nil
+	}
+	archive.Invalidate(id)
+
+	err = h.Update(func(tx *sqlx.Tx) error {
+		book, err := models.BookQuery(ctx).Find(tx, id)
+		if err != nil || book == nil {
+			return err
+		}
+		err = repack.Refresh(book)
+		if err != nil {
+			return err
+		}
+		return model.SaveContext(ctx, tx, book)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = middleware.ClearCache(path.Join("/api/books", id.String()))
+	if err != nil {
+		h.Log.Warn("failed to clear book cache", "book", id, "err", err)
+	}
+	h.Log.Info("Repacked book", "book", id, "file", book.File, "converted", result.Converted, "size", result.Size, "original_size", result.OriginalSize)
+	return result, nil
+}
@@ -23,6 +23,10 @@ import (
 	"github.com/abibby/comicbox-3/config"
 	"github.com/abibby/comicbox-3/database"
 	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/archive"
+	"github.com/abibby/comicbox-3/server/bookrules"
+	"github.com/abibby/comicbox-3/server/classify"
+	"github.com/abibby/comicbox-3/server/imaging"
 	"github.com/abibby/nulls"
 	"github.com/abibby/salusa/database/model"
 	"github.com/abibby/salusa/event"
@@ -39,6 +43,8 @@ type SyncHandler struct {
 	Queue event.Queue `inject:""`
 
 	seriesCache map[string]*models.Series
+	// rules are the book rules applied to books as they are added.
+	rules []*models.BookRule
 }
 
 var _ event.Handler[*events.SyncEvent] = (*SyncHandler)(nil)
@@ -79,19 +85,36 @@ func (h *SyncHandler) Handle(ctx context.Context, event *events.SyncEvent) error
 		}
 	}
 
+	removedIDs := []uuid.UUID{}
 	err = database.UpdateTx(ctx, func(tx *sqlx.Tx) error {
 		for chunk := range slices.Chunk(removedFiles, 100) {
-			err := models.BookQuery(ctx).WhereIn("file", chunk).Delete(tx)
+			ids := []uuid.UUID{}
+			err := models.BookQuery(ctx).Select("id").WhereIn("file", chunk).Load(tx, &ids)
+			if err != nil {
+				return err
+			}
+			removedIDs = append(removedIDs, ids...)
+
+			err = models.BookQuery(ctx).WhereIn("file", chunk).Delete(tx)
 			if err != nil {
 				return err
 			}
 		}
 		return nil
 	})
+	archive.Invalidate(removedIDs...)
 	if err != nil {
 		log.Printf("Failed to remove books from the library: %v", err)
 	}
 
+	err = database.ReadTx(ctx, func(tx *sqlx.Tx) error {
+		h.rules, err = bookrules.Load(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
 	count := 0
 	for file := range bookFiles.All() {
 		count++
@@ -106,7 +129,16 @@ func (h *SyncHandler) Handle(ctx context.Context, event *events.SyncEvent) error
 	}
 
 	log.Print("Finished sync")
-	return nil
+
+	err = h.Queue.Push(&events.BackfillPalettesEvent{})
+	if err != nil {
+		return err
+	}
+
+	// Analysing pages is much slower than adding books so it runs after the
+	// sync has finished. It also picks up books added before the analysis
+	// existed.
+	return h.Queue.Push(&events.AnalyzeBooksEvent{})
 }
 
 func (h *SyncHandler) createSeries(ctx context.Context, tx *sqlx.Tx, name string, book *models.Book) (*models.Series, error) {
@@ -163,7 +195,7 @@ func getBookFiles(ctx context.Context, libraryPath string) (sets.Set[string], er
 }
 
 func (h *SyncHandler) addBook(ctx context.Context, tx *sqlx.Tx, file string) error {
-	book, err := h.loadBookData(file)
+	book, err := h.loadBookData(ctx, file)
 	if errors.Is(err, zip.ErrFormat) {
 		return nil
 	} else if err != nil {
@@ -174,20 +206,24 @@ func (h *SyncHandler) addBook(ctx context.Context, tx *sqlx.Tx, file string) err
 	seriesName := book.SeriesSlug
 	book.SeriesSlug = models.Slug(book.SeriesSlug)
 
-	err = model.SaveContext(ctx, tx, book)
+	series, err := h.createSeries(ctx, tx, seriesName, book)
 	if err != nil {
-		return err
+		return fmt.Errorf("could not create series: %w", err)
 	}
+	series.ApplyDefaults(book)
 
-	_, err = h.createSeries(ctx, tx, seriesName, book)
+	err = model.SaveContext(ctx, tx, book)
 	if err != nil {
-		return fmt.Errorf("could not create series: %w", err)
+		return err
 	}
 
-	return nil
+	// Books already in the library only change when the rules do, which
+	// applies them to every book then.
+	_, err = bookrules.ApplyBooks(ctx, tx, h.rules, series, []*models.Book{book})
+	return err
 }
 
-func (h *SyncHandler) loadBookData(file string) (*models.Book, error) {
+func (h *SyncHandler) loadBookData(ctx context.Context, file string) (*models.Book, error) {
 	book := &models.Book{}
 
 	reader, err := zip.OpenReader(file)
@@ -195,19 +231,30 @@ func (h *SyncHandler) loadBookData(file string) (*models.Book, error) {
 		return nil, errors.Wrap(err, "could not open zip file")
 	}
 
-	imgs, err := models.ZippedImages(reader)
+	imgs, err := models.ZippedImages(&reader.Reader)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not list page images from zip file")
 	}
 
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not stat zip file")
+	}
+	err = book.SetPageEntries(imgs, info)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read page offsets from zip file")
+	}
+
 	book.Pages = make([]*models.Page, len(imgs))
 	for i, img := range imgs {
-		p, err := buildPage(img, i)
+		p, err := buildPage(img)
 		if err != nil {
 			return nil, err
 		}
 		book.Pages[i] = p
 	}
+	classify.Classify(book, nil)
+	book.LongStrip = classify.LongStrip(book.Pages)
 
 	parseFileName(book, file)
 
@@ -221,35 +268,47 @@ func (h *SyncHandler) loadBookData(file string) (*models.Book, error) {
 		return nil, err
 	}
 
+	if cover := book.CoverPage(); cover < len(imgs) {
+		book.Palette = coverPalette(ctx, imgs[cover])
+	}
+
 	book.File = strings.Replace(file, config.LibraryPath, "", 1)
 	return book, nil
 }
 
-func buildPage(img *zip.File, pageNumber int) (*models.Page, error) {
-
+// coverPalette returns the palette of a cover, or an empty palette if it
+// can't be decoded so it isn't tried again.
+func coverPalette(ctx context.Context, img *zip.File) *models.Palette {
 	f, err := img.Open()
 	if err != nil {
-		return nil, err
+		return &models.Palette{}
 	}
 	defer f.Close()
 
-	cfg, _, err := image.DecodeConfig(f)
+	decoded, _, err := imaging.Decode(ctx, f)
+	if err != nil {
+		return &models.Palette{}
+	}
+	return models.NewPalette(decoded)
+}
+
+func buildPage(img *zip.File) (*models.Page, error) {
+	f, err := img.Open()
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	typ := models.PageTypeStory
-	if pageNumber == 0 {
-		typ = models.PageTypeFrontCover
-	} else {
-		if cfg.Height < cfg.Width {
-			typ = models.PageTypeSpread
-		}
+	// A page that can't be read is kept without a size so the rest of the
+	// book can still be read.
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		log.Printf("failed to read the size of %s: %v", img.Name, err)
+		return &models.Page{}, nil
 	}
 
 	return &models.Page{
 		BasePage: models.BasePage{
-			Type:   typ,
 			Width:  cfg.Width,
 			Height: cfg.Height,
 		},
@@ -314,6 +373,25 @@ func parseBookJSON(book *models.Book, f fs.File) error {
 		tmpBook.Chapter = tmpBook.Number
 	}
 
+	// Pages from book.json are treated like a manual edit so the classifier
+	// doesn't replace them.
+	pages := struct {
+		Pages json.RawMessage `json:"pages"`
+	}{}
+	err = json.Unmarshal(b, &pages)
+	if err != nil {
+		return fmt.Errorf("parsing book.json: %v", err)
+	}
+	if pages.Pages != nil {
+		for _, page := range book.Pages {
+			page.Confidence = 1
+		}
+		book.TypeConfidence = 1
+		book.UpdateMap = map[string]string{
+			"pages": strconv.FormatInt(time.Now().UnixMilli(), 10),
+		}
+	}
+
 	tmpBook.File = ""
 	return nil
 }
@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/abibby/comicbox-3/app/events"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/tracker"
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/event"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// trackerSyncDelay is how long a sync for one series waits for more, so
+// reading several books in a row only updates the trackers once.
+var trackerSyncDelay = 10 * time.Second
+
+// pendingTrackerSync is the series waiting to be synced for a user, nil
+// slugs syncs every series.
+type pendingTrackerSync struct {
+	slugs map[string]struct{}
+}
+
+var (
+	trackerSyncMtx    = &sync.Mutex{}
+	trackerPendingMtx = &sync.Mutex{}
+	trackerPending    = map[uuid.UUID]*pendingTrackerSync{}
+)
+
+type TrackerSyncHandler struct {
+	Read   database.Read   `inject:""`
+	Update database.Update `inject:""`
+	Log    *slog.Logger    `inject:""`
+}
+
+var _ event.Handler[*events.TrackerSyncEvent] = (*TrackerSyncHandler)(nil)
+
+// Handle implements event.Handler.
+func (h *TrackerSyncHandler) Handle(ctx context.Context, event *events.TrackerSyncEvent) error {
+	if event.UserID == uuid.Nil {
+		return h.sync(ctx, uuid.Nil, nil)
+	}
+
+	trackerPendingMtx.Lock()
+	p, waiting := trackerPending[event.UserID]
+	if !waiting {
+		p = &pendingTrackerSync{slugs: map[string]struct{}{}}
+		trackerPending[event.UserID] = p
+	}
+	if event.SeriesSlug == "" {
+		p.slugs = nil
+	} else if p.slugs != nil {
+		p.slugs[event.SeriesSlug] = struct{}{}
+	}
+	trackerPendingMtx.Unlock()
+	if waiting {
+		return nil
+	}
+
+	if event.SeriesSlug != "" {
+		select {
+		case <-time.After(trackerSyncDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	trackerPendingMtx.Lock()
+	delete(trackerPending, event.UserID)
+	trackerPendingMtx.Unlock()
+
+	var slugs []string
+	if p.slugs != nil {
+		slugs = make([]string, 0, len(p.slugs))
+		for slug := range p.slugs {
+			slugs = append(slugs, slug)
+		}
+	}
+	return h.sync(ctx, event.UserID, slugs)
+}
+
+func (h *TrackerSyncHandler) sync(ctx context.Context, uid uuid.UUID, slugs []string) error {
+	trackerSyncMtx.Lock()
+	defer trackerSyncMtx.Unlock()
+
+	accounts, err := database.Value(h.Read, func(tx *sqlx.Tx) ([]*models.UserTracker, error) {
+		q := models.UserTrackerQuery(ctx).
+			WithoutGlobalScope(models.UserScoped).
+			Where("access_token", "!=", "")
+		if uid != uuid.Nil {
+			q = q.Where("user_id", "=", uid)
+		}
+		return q.Get(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		t := tracker.Find(account.Service)
+		if t == nil {
+			continue
+		}
+		result, err := tracker.Sync(ctx, h.Read, h.Update, t, account, slugs)
+		if err != nil {
+			h.Log.Warn("failed to sync with tracker", "user", account.UserID, "tracker", account.Service, "err", err)
+			continue
+		}
+		h.Log.Info("Synced with tracker", "user", account.UserID, "tracker", account.Service, "pushed", result.Pushed, "pulled", result.Pulled)
+	}
+	return nil
+}
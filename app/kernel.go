@@ -49,6 +49,7 @@ var Kernel = kernel.New(
 
 		database.Init,
 		events.RegisterSync,
+		events.RegisterTrackerSync,
 		providers.Register,
 	),
 	kernel.APIDocumentation(
@@ -67,6 +68,10 @@ var Kernel = kernel.New(
 		event.Service(
 			event.NewListener[*jobs.SyncHandler](),
 			event.NewListener[*jobs.UpdateMetadataHandler](),
+			event.NewListener[*jobs.AnalyzeBooksHandler](),
+			event.NewListener[*jobs.BackfillPalettesHandler](),
+			event.NewListener[*jobs.RepackHandler](),
+			event.NewListener[*jobs.TrackerSyncHandler](),
 		),
 	),
 	kernel.InitRoutes(server.InitRouter),
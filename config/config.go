@@ -43,7 +43,7 @@ func envBool(key string, def bool) bool {
 	return str != "false" && str != "0"
 }
 func envInt(key string, def int) int {
-	value, err := strconv.Atoi(env("PORT", fmt.Sprint(def)))
+	value, err := strconv.Atoi(env(key, fmt.Sprint(def)))
 	if err != nil {
 		return def
 	}
@@ -51,23 +51,37 @@ func envInt(key string, def int) int {
 }
 
 var (
-	AppKey              []byte
-	BaseURL             string
-	DBPath              string
-	CachePath           string
-	LibraryPath         string
-	Port                int
-	Verbose             bool
-	PublicUserCreate    bool
-	AnilistClientID     string
-	AnilistClientSecret string
-	ScanOnStartup       bool
-	ScanInterval        string
-	Logger              string
-	LokiURL             string
-	LokiTenantID        string
-	FilePath            string
-	ComicVineAPIKey     string
+	AppKey                  []byte
+	BaseURL                 string
+	DBPath                  string
+	CachePath               string
+	LibraryPath             string
+	Port                    int
+	Verbose                 bool
+	PublicUserCreate        bool
+	AnilistClientID         string
+	AnilistClientSecret     string
+	AnilistURL              string
+	AnilistAPIURL           string
+	MyAnimeListClientID     string
+	MyAnimeListClientSecret string
+	MyAnimeListURL          string
+	MyAnimeListAPIURL       string
+	KitsuClientID           string
+	KitsuClientSecret       string
+	KitsuURL                string
+	TrackerSyncInterval     string
+	ScanOnStartup           bool
+	ScanInterval            string
+	Logger                  string
+	LokiURL                 string
+	LokiTenantID            string
+	FilePath                string
+	ComicVineAPIKey         string
+	ArchiveCacheSize        int
+	ImageDecoder            string
+	ImageEncoder            string
+	WebDAVPath              string
 )
 
 var PublicConfig map[string]any
@@ -88,9 +102,41 @@ func Init(ctx context.Context) error {
 	PublicUserCreate = envBool("PUBLIC_USER_CREATE", true)
 	ScanOnStartup = envBool("SCAN_ON_STARTUP", true)
 	ScanInterval = env("SCAN_INTERVAL", "0 * * * *")
+	ArchiveCacheSize = envInt("ARCHIVE_CACHE_SIZE", 32)
+	// ImageDecoder is a command that reads an AVIF, HEIC or JPEG XL image on
+	// stdin and writes it as a PNG to stdout, e.g. "magick - png:-".
+	ImageDecoder = env("IMAGE_DECODER", "")
+	// ImageEncoder is a command used when repacking books. It reads an image
+	// on stdin and writes it to stdout with {format} and {quality} replaced,
+	// e.g. "magick - -quality {quality} {format}:-".
+	ImageEncoder = env("IMAGE_ENCODER", "")
+	// WebDAVPath is where the read-only WebDAV view of the library is served.
+	// Setting it to an empty string turns WebDAV off.
+	WebDAVPath = env("WEBDAV_PATH", "/dav")
 
 	AnilistClientID = env("ANILIST_CLIENT_ID", "")
 	AnilistClientSecret = env("ANILIST_CLIENT_SECRET", "")
+	// AnilistURL and AnilistAPIURL are where Anilist's OAuth and GraphQL
+	// APIs are, they only need changing to point at a stand-in server.
+	AnilistURL = env("ANILIST_URL", "https://anilist.co")
+	AnilistAPIURL = env("ANILIST_API_URL", "https://graphql.anilist.co")
+
+	// MyAnimeList logs in with PKCE so the secret is only needed for apps
+	// registered as "web".
+	MyAnimeListClientID = env("MYANIMELIST_CLIENT_ID", "")
+	MyAnimeListClientSecret = env("MYANIMELIST_CLIENT_SECRET", "")
+	MyAnimeListURL = env("MYANIMELIST_URL", "https://myanimelist.net")
+	MyAnimeListAPIURL = env("MYANIMELIST_API_URL", "https://api.myanimelist.net")
+
+	// Kitsu logs in with the user's Kitsu username and password.
+	KitsuClientID = env("KITSU_CLIENT_ID", "")
+	KitsuClientSecret = env("KITSU_CLIENT_SECRET", "")
+	KitsuURL = env("KITSU_URL", "https://kitsu.app")
+
+	// TrackerSyncInterval is the cron schedule lists and progress are synced
+	// with reading trackers on. Setting it to an empty string turns the
+	// scheduled sync off, finished books are still synced.
+	TrackerSyncInterval = env("TRACKER_SYNC_INTERVAL", "*/30 * * * *")
 
 	Verbose = envBool("VERBOSE", false)
 
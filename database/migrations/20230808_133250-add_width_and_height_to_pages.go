@@ -39,7 +39,7 @@ func init() {
 						continue
 					}
 
-					imgs, err := models.ZippedImages(reader)
+					imgs, err := models.ZippedImages(&reader.Reader)
 					if err != nil {
 						log.Print(err)
 						continue
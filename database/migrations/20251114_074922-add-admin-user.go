@@ -2,12 +2,14 @@ package migrations
 
 import (
 	"context"
+	"time"
 
 	"github.com/abibby/comicbox-3/models"
 	"github.com/abibby/salusa/database"
 	"github.com/abibby/salusa/database/migrate"
-	"github.com/abibby/salusa/database/model"
 	"github.com/abibby/salusa/database/schema"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func init() {
@@ -23,11 +25,18 @@ func init() {
 				return nil
 			}
 
-			return model.SaveContext(ctx, tx, &models.User{
-				Username: "admin",
-				Password: []byte("admin"),
-				RoleID:   models.RoleAdminID,
-			})
+			// The user is inserted directly so later columns on the user
+			// model don't need to exist yet.
+			hash, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
+			if err != nil {
+				return err
+			}
+			now := time.Now().UTC().Format(time.RFC3339Nano)
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO users (created_at, updated_at, update_map, id, username, password, role_id)
+				VALUES (?, ?, '{}', ?, 'admin', ?, ?)
+			`, now, now, uuid.New(), hash, models.RoleAdminID)
+			return err
 		}),
 		Down: schema.Run(func(ctx context.Context, tx database.DB) error {
 			return nil
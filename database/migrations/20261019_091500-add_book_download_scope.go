@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"context"
+	"slices"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_091500-add_book_download_scope",
+		Up: schema.Run(func(ctx context.Context, tx database.DB) error {
+			roles, err := models.RoleQuery(ctx).
+				WhereIn("id", []any{models.RoleReaderID, models.RoleEditorID}).
+				Get(tx)
+			if err != nil {
+				return err
+			}
+			for _, r := range roles {
+				if slices.Contains(r.Scopes, auth.ScopeBookDownload) {
+					continue
+				}
+				r.Scopes = append(r.Scopes, auth.ScopeBookDownload)
+				err = model.SaveContext(ctx, tx, r)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		Down: schema.Run(func(ctx context.Context, tx database.DB) error {
+			return nil
+		}),
+	})
+}
@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_101200-Book",
+		Up: schema.Table("books", func(table *schema.Blueprint) {
+			table.JSON("page_entries").Nullable()
+			table.Int64("file_size").Default(0)
+			table.DateTime("file_mod_time").Nullable()
+		}),
+		Down: schema.Table("books", func(table *schema.Blueprint) {
+			table.DropColumn("page_entries")
+			table.DropColumn("file_size")
+			table.DropColumn("file_mod_time")
+		}),
+	})
+}
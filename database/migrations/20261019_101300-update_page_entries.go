@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/salusa/clog"
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_101300-update_page_entries",
+		Up: schema.Run(func(ctx context.Context, tx database.DB) error {
+			books, err := models.BookQuery(ctx).Where("page_entries", "=", nil).Get(tx)
+			if err != nil {
+				return err
+			}
+			total := len(books)
+			current := 0
+			for _, book := range books {
+				if current%1000 == 0 {
+					fmt.Printf("%d / %d %f%%\n", current, total, float64(current)/float64(total)*100)
+				}
+				current++
+				err = book.CalculatePageEntries()
+				if err != nil {
+					clog.Use(ctx).Warn("failed to calculate page entries", "file", book.File, "err", err)
+					continue
+				}
+				_, err = tx.ExecContext(ctx,
+					`UPDATE books SET page_entries=?, file_size=?, file_mod_time=? WHERE id=?`,
+					book.PageEntries, book.FileSize, book.FileModTime, book.ID,
+				)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		Down: schema.Run(func(ctx context.Context, tx database.DB) error {
+			return nil
+		}),
+	})
+}
@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_111000-Book",
+		Up: schema.Table("books", func(table *schema.Blueprint) {
+			table.Int("analysis_version").Default(0)
+		}),
+		Down: schema.Table("books", func(table *schema.Blueprint) {
+			table.DropColumn("analysis_version")
+		}),
+	})
+}
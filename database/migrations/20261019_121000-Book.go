@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_121000-Book",
+		Up: schema.Table("books", func(table *schema.Blueprint) {
+			table.Bool("auto_crop").Nullable()
+		}),
+		Down: schema.Table("books", func(table *schema.Blueprint) {
+			table.DropColumn("auto_crop")
+		}),
+	})
+}
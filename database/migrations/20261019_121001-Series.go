@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_121001-Series",
+		Up: schema.Table("series", func(table *schema.Blueprint) {
+			table.Bool("auto_crop").Default(false)
+		}),
+		Down: schema.Table("series", func(table *schema.Blueprint) {
+			table.DropColumn("auto_crop")
+		}),
+	})
+}
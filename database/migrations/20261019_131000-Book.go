@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_131000-Book",
+		Up: schema.Table("books", func(table *schema.Blueprint) {
+			table.Bool("split_spreads").Default(false)
+		}),
+		Down: schema.Table("books", func(table *schema.Blueprint) {
+			table.DropColumn("split_spreads")
+		}),
+	})
+}
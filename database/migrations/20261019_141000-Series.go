@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_141000-Series",
+		Up: schema.Table("series", func(table *schema.Blueprint) {
+			table.Bool("auto_delete_recurring").Default(false)
+			table.Bool("auto_delete_blank").Default(false)
+		}),
+		Down: schema.Table("series", func(table *schema.Blueprint) {
+			table.DropColumn("auto_delete_recurring")
+			table.DropColumn("auto_delete_blank")
+		}),
+	})
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/classify"
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_161000-detect_long_strips",
+		Up: schema.Run(func(ctx context.Context, tx database.DB) error {
+			books, err := models.BookQuery(ctx).Where("long_strip", "=", false).Get(tx)
+			if err != nil {
+				return err
+			}
+			for _, book := range books {
+				if book.UpdatedByUser("long_strip") || !classify.LongStrip(book.Pages) {
+					continue
+				}
+				_, err = tx.ExecContext(ctx, `UPDATE books SET long_strip=? WHERE id=?`, true, book.ID)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		Down: schema.Run(func(ctx context.Context, tx database.DB) error {
+			return nil
+		}),
+	})
+}
@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_171000-Series",
+		Up: schema.Table("series", func(table *schema.Blueprint) {
+			table.Bool("rtl").Nullable()
+			table.Bool("long_strip").Nullable()
+			table.Bool("split_spreads").Nullable()
+		}),
+		Down: schema.Table("series", func(table *schema.Blueprint) {
+			table.DropColumn("rtl")
+			table.DropColumn("long_strip")
+			table.DropColumn("split_spreads")
+		}),
+	})
+}
@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_181000-Series",
+		Up: schema.Table("series", func(table *schema.Blueprint) {
+			table.String("publisher").Default("")
+			table.String("country").Default("")
+		}),
+		Down: schema.Table("series", func(table *schema.Blueprint) {
+			table.DropColumn("publisher")
+			table.DropColumn("country")
+		}),
+	})
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_181001-BookRule",
+		Up: schema.Create("book_rules", func(table *schema.Blueprint) {
+			table.Blob("id").Primary()
+			table.String("name")
+			table.Int("priority").Default(0)
+			table.Bool("enabled").Default(true)
+			table.JSON("conditions")
+			table.JSON("actions")
+		}),
+		Down: schema.DropIfExists("book_rules"),
+	})
+}
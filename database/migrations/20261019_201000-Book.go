@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_201000-Book",
+		Up: schema.Table("books", func(table *schema.Blueprint) {
+			table.String("file_digest").Default("").Index()
+		}),
+		Down: schema.Table("books", func(table *schema.Blueprint) {
+			table.DropColumn("file_digest")
+		}),
+	})
+}
@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_201001-UserBook",
+		Up: schema.Table("user_books", func(table *schema.Blueprint) {
+			table.JSON("kosync").Nullable()
+		}),
+		Down: schema.Table("user_books", func(table *schema.Blueprint) {
+			table.DropColumn("kosync")
+		}),
+	})
+}
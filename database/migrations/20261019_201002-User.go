@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_201002-User",
+		Up: schema.Table("users", func(table *schema.Blueprint) {
+			table.Blob("kosync_key").Nullable()
+		}),
+		Down: schema.Table("users", func(table *schema.Blueprint) {
+			table.DropColumn("kosync_key")
+		}),
+	})
+}
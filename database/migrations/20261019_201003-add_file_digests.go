@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/kosync"
+	"github.com/abibby/salusa/clog"
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_201003-add_file_digests",
+		Up: schema.Run(func(ctx context.Context, tx database.DB) error {
+			books, err := models.BookQuery(ctx).Where("file_digest", "=", "").Get(tx)
+			if err != nil {
+				return err
+			}
+			for _, book := range books {
+				digest, err := kosync.DigestFile(book.FilePath())
+				if err != nil {
+					clog.Use(ctx).Warn("failed to calculate file digest", "file", book.File, "err", err)
+					continue
+				}
+				_, err = tx.ExecContext(ctx, `UPDATE books SET file_digest=? WHERE id=?`, digest, book.ID)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		Down: schema.Run(func(ctx context.Context, tx database.DB) error {
+			return nil
+		}),
+	})
+}
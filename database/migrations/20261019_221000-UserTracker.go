@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_221000-UserTracker",
+		Up: schema.Create("user_trackers", func(table *schema.Blueprint) {
+			table.DateTime("created_at")
+			table.DateTime("updated_at")
+			table.DateTime("deleted_at").Nullable()
+			table.JSON("update_map")
+			table.Blob("user_id")
+			table.String("service")
+			table.String("remote_user_id")
+			table.String("username")
+			table.String("access_token")
+			table.String("refresh_token")
+			table.DateTime("expires_at").Nullable()
+			table.String("verifier")
+			table.ForeignKey("user_id", "users", "id")
+			table.PrimaryKey("user_id", "service")
+		}),
+		Down: schema.DropIfExists("user_trackers"),
+	})
+}
@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_221001-move_anilist_tokens",
+		Up: schema.Run(func(ctx context.Context, tx database.DB) error {
+			_, err := tx.ExecContext(ctx, `
+				insert into user_trackers (
+					created_at,
+					updated_at,
+					update_map,
+					user_id,
+					service,
+					remote_user_id,
+					username,
+					access_token,
+					refresh_token,
+					expires_at,
+					verifier
+				)
+				select
+					created_at,
+					updated_at,
+					'{}',
+					id,
+					'anilist',
+					anilist_user_id,
+					'',
+					anilist_token,
+					'',
+					anilist_expires_at,
+					''
+				from
+					users
+				where
+					anilist_token is not null
+					and anilist_user_id is not null
+			`)
+			return err
+		}),
+		Down: schema.Run(func(ctx context.Context, tx database.DB) error {
+			_, err := tx.ExecContext(ctx, `
+				update
+					users
+				set
+					anilist_token = user_trackers.access_token,
+					anilist_expires_at = user_trackers.expires_at,
+					anilist_user_id = cast(user_trackers.remote_user_id as integer)
+				from
+					user_trackers
+				where
+					user_trackers.user_id = users.id
+					and user_trackers.service = 'anilist'
+			`)
+			return err
+		}),
+	})
+}
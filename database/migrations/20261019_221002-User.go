@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_221002-User",
+		Up: schema.Table("users", func(table *schema.Blueprint) {
+			table.DropColumn("anilist_grant")
+			table.DropColumn("anilist_token")
+			table.DropColumn("anilist_expires_at")
+			table.DropColumn("anilist_user_id")
+		}),
+		Down: schema.Table("users", func(table *schema.Blueprint) {
+			table.String("anilist_grant").Nullable()
+			table.String("anilist_token").Nullable()
+			table.DateTime("anilist_expires_at").Nullable()
+			table.Int("anilist_user_id").Nullable()
+		}),
+	})
+}
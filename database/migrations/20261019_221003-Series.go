@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/abibby/salusa/database/migrate"
+	"github.com/abibby/salusa/database/schema"
+)
+
+func init() {
+	migrations.Add(&migrate.Migration{
+		Name: "20261019_221003-Series",
+		Up: schema.Table("series", func(table *schema.Blueprint) {
+			table.JSON("tracker_ids").Default("{}")
+		}),
+		Down: schema.Table("series", func(table *schema.Blueprint) {
+			table.DropColumn("tracker_ids")
+		}),
+	})
+}
@@ -10,8 +10,11 @@ import (
 	"strings"
 
 	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/bookrules"
 	"github.com/abibby/comicbox-3/server/controllers"
 	"github.com/abibby/comicbox-3/server/metadata"
+	"github.com/abibby/comicbox-3/server/pagerules"
+	"github.com/abibby/comicbox-3/server/repack"
 	"github.com/abibby/salusa/database/builder"
 )
 
@@ -37,11 +40,17 @@ func main() {
 	m := []interface{}{
 		models.Book{},
 		models.Page{},
+		models.CropBox{},
+		models.Seam{},
+		models.Palette{},
 		models.Series{},
 		models.User{},
 		models.UserBook{},
 		models.UserSeries{},
 		models.Role{},
+		models.BookRule{},
+		models.RuleCondition{},
+		models.RuleAction{},
 		metadata.Staff{},
 		metadata.SeriesMetadata{},
 		metadata.DistanceMetadata{},
@@ -50,12 +59,29 @@ func main() {
 		controllers.BookUpdateRequest{},
 		controllers.SeriesUpdateRequest{},
 		controllers.PageUpdate{},
+		controllers.SpriteManifest{},
+		controllers.SpriteTile{},
+		controllers.SliceManifest{},
+		controllers.PageSlice{},
+		controllers.SeriesAutoDeleteResponse{},
+		controllers.SeriesApplyDefaultsResponse{},
+		pagerules.DeletedPage{},
+		controllers.BookRuleBody{},
+		controllers.BookRuleDryRunResponse{},
+		bookrules.BookChange{},
+		controllers.SeriesRepackEstimateResponse{},
+		repack.BookEstimate{},
 	}
 	enums := []models.Enum{
 		models.PageType(""),
 		models.List(""),
+		models.TrackerService(""),
 		controllers.SeriesOrder(""),
 		metadata.StaffRole(""),
+		pagerules.DeleteReason(""),
+		models.RuleField(""),
+		models.RuleOperator(""),
+		models.RuleActionField(""),
 	}
 	ts := "// This file is autogenerated do not edit it\n/* eslint-disable */\n\n"
 	for _, model := range m {
@@ -111,7 +137,12 @@ func generateTsType(t reflect.Type, allowNull bool) string {
 		return "Array<" + generateTsType(t.Elem(), false) + ">"
 	}
 	if t.Kind() == reflect.Map {
-		return fmt.Sprintf("Record<%s, %s>", generateTsType(t.Key(), false), generateTsType(t.Elem(), false))
+		key := generateTsType(t.Key(), false)
+		if key != "string" {
+			// Maps keyed by an enum don't have every key.
+			return fmt.Sprintf("Partial<Record<%s, %s>>", key, generateTsType(t.Elem(), false))
+		}
+		return fmt.Sprintf("Record<%s, %s>", key, generateTsType(t.Elem(), false))
 	}
 
 	suffix := ""
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+
+	"github.com/abibby/comicbox-3/app/providers"
+	"github.com/abibby/salusa/database/builder"
+	"github.com/abibby/salusa/database/jsoncolumn"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/database/model/modeldi"
+	"github.com/google/uuid"
+)
+
+// BookRule sets book fields on every book that matches all of its conditions.
+// Rules run in priority order so later rules win.
+//
+//go:generate spice generate:migration
+type BookRule struct {
+	model.BaseModel
+
+	ID         uuid.UUID                        `json:"id"         db:"id,primary"`
+	Name       string                           `json:"name"       db:"name"`
+	Priority   int                              `json:"priority"   db:"priority"`
+	Enabled    bool                             `json:"enabled"    db:"enabled"`
+	Conditions jsoncolumn.Slice[*RuleCondition] `json:"conditions" db:"conditions"`
+	Actions    jsoncolumn.Slice[*RuleAction]    `json:"actions"    db:"actions"`
+}
+
+type RuleField string
+
+func (f RuleField) Options() map[string]string {
+	return map[string]string{
+		"SeriesName":      string(RuleFieldSeriesName),
+		"SeriesGenres":    string(RuleFieldSeriesGenres),
+		"SeriesTags":      string(RuleFieldSeriesTags),
+		"SeriesPublisher": string(RuleFieldSeriesPublisher),
+		"SeriesCountry":   string(RuleFieldSeriesCountry),
+		"SeriesYear":      string(RuleFieldSeriesYear),
+		"BookTitle":       string(RuleFieldBookTitle),
+		"BookAuthors":     string(RuleFieldBookAuthors),
+		"BookPath":        string(RuleFieldBookPath),
+		"PageCount":       string(RuleFieldPageCount),
+		"PageMinAspect":   string(RuleFieldPageMinAspect),
+		"PageMaxAspect":   string(RuleFieldPageMaxAspect),
+	}
+}
+
+const (
+	RuleFieldSeriesName      = RuleField("series.name")
+	RuleFieldSeriesGenres    = RuleField("series.genres")
+	RuleFieldSeriesTags      = RuleField("series.tags")
+	RuleFieldSeriesPublisher = RuleField("series.publisher")
+	RuleFieldSeriesCountry   = RuleField("series.country")
+	RuleFieldSeriesYear      = RuleField("series.year")
+	RuleFieldBookTitle       = RuleField("book.title")
+	RuleFieldBookAuthors     = RuleField("book.authors")
+	RuleFieldBookPath        = RuleField("book.path")
+	RuleFieldPageCount       = RuleField("pages.count")
+	// RuleFieldPageMinAspect and RuleFieldPageMaxAspect are the smallest and
+	// largest height to width ratio of the book's pages.
+	RuleFieldPageMinAspect = RuleField("pages.min_aspect")
+	RuleFieldPageMaxAspect = RuleField("pages.max_aspect")
+)
+
+type RuleOperator string
+
+func (o RuleOperator) Options() map[string]string {
+	return map[string]string{
+		"Equals":      string(RuleOperatorEquals),
+		"Contains":    string(RuleOperatorContains),
+		"Matches":     string(RuleOperatorMatches),
+		"GreaterThan": string(RuleOperatorGreaterThan),
+		"LessThan":    string(RuleOperatorLessThan),
+	}
+}
+
+const (
+	RuleOperatorEquals      = RuleOperator("equals")
+	RuleOperatorContains    = RuleOperator("contains")
+	RuleOperatorMatches     = RuleOperator("matches")
+	RuleOperatorGreaterThan = RuleOperator("gt")
+	RuleOperatorLessThan    = RuleOperator("lt")
+)
+
+// RuleCondition compares a field of a book or its series to a value. Fields
+// with several values, like genres, match if any of them do.
+type RuleCondition struct {
+	Field    RuleField    `json:"field"`
+	Operator RuleOperator `json:"operator"`
+	Value    string       `json:"value"`
+	Not      bool         `json:"not"`
+}
+
+type RuleActionField string
+
+func (f RuleActionField) Options() map[string]string {
+	return map[string]string{
+		"RightToLeft":  string(RuleActionRightToLeft),
+		"LongStrip":    string(RuleActionLongStrip),
+		"SplitSpreads": string(RuleActionSplitSpreads),
+		"AutoCrop":     string(RuleActionAutoCrop),
+	}
+}
+
+const (
+	RuleActionRightToLeft  = RuleActionField("rtl")
+	RuleActionLongStrip    = RuleActionField("long_strip")
+	RuleActionSplitSpreads = RuleActionField("split_spreads")
+	RuleActionAutoCrop     = RuleActionField("auto_crop")
+)
+
+// RuleAction sets a book field.
+type RuleAction struct {
+	Field RuleActionField `json:"field"`
+	Value bool            `json:"value"`
+}
+
+func init() {
+	providers.Add(modeldi.Register[*BookRule])
+}
+
+func BookRuleQuery(ctx context.Context) *builder.ModelBuilder[*BookRule] {
+	return builder.From[*BookRule]().WithContext(ctx)
+}
@@ -4,11 +4,17 @@ import (
 	"archive/zip"
 	"context"
 	"fmt"
+	"image"
+	"io/fs"
+	"os"
 	"path"
 	"sort"
 	"strings"
 
 	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/abibby/comicbox-3/server/kosync"
 	"github.com/abibby/comicbox-3/server/router"
 	"github.com/abibby/nulls"
 	"github.com/abibby/salusa/clog"
@@ -25,9 +31,16 @@ var (
 )
 
 type BasePage struct {
-	Type   PageType `json:"type"`
-	Height int      `json:"height"`
-	Width  int      `json:"width"`
+	Type     PageType `json:"type"`
+	Height   int      `json:"height"`
+	Width    int      `json:"width"`
+	BlurHash string   `json:"blur_hash"`
+	Crop     *CropBox `json:"crop"`
+	Hash     string   `json:"hash"`
+	Blank    bool     `json:"blank"`
+	Seam     *Seam    `json:"seam"`
+	// Confidence is how sure the page classifier is of Type, from 0 to 1.
+	Confidence float64 `json:"confidence"`
 }
 type Page struct {
 	BasePage
@@ -35,6 +48,44 @@ type Page struct {
 	ThumbnailURL string `json:"thumbnail_url"`
 }
 
+// CropBox is the part of a page left after trimming uniform borders, in page
+// pixels.
+type CropBox struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Seam scores how well the edges of a page continue into the next page, from
+// -1 to 1. Pages that score close to 1 are most likely halves of one spread.
+type Seam struct {
+	// LeftToRight compares the right edge of the page to the left edge of the
+	// next page.
+	LeftToRight float64 `json:"ltr"`
+	// RightToLeft compares the left edge of the page to the right edge of the
+	// next page.
+	RightToLeft float64 `json:"rtl"`
+}
+
+func (c *CropBox) Rect() image.Rectangle {
+	return image.Rect(c.X, c.Y, c.X+c.Width, c.Y+c.Height)
+}
+
+// PageEntry records where a page's bytes live inside the book archive so that
+// stored pages can be served straight from the file without opening the zip.
+type PageEntry struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Method uint16 `json:"method"`
+}
+
+// Stored reports whether the entry is saved uncompressed in the archive.
+func (e *PageEntry) Stored() bool {
+	return e.Method == zip.Store
+}
+
 type PageType string
 
 func (pt PageType) Options() map[string]string {
@@ -68,11 +119,30 @@ type Book struct {
 	PageCount    int                      `json:"page_count"    db:"page_count"`
 	RightToLeft  bool                     `json:"rtl"           db:"rtl"`
 	LongStrip    bool                     `json:"long_strip"    db:"long_strip"`
+	AutoCrop     *bool                    `json:"auto_crop"     db:"auto_crop"`
+	SplitSpreads bool                     `json:"split_spreads" db:"split_spreads"`
 	Sort         string                   `json:"sort"          db:"sort,index"`
 	File         string                   `json:"file"          db:"file"`
 	CoverURL     string                   `json:"cover_url"     db:"-"`
 	DownloadSize int                      `json:"download_size" db:"download_size"`
 
+	CoverBlurHash string   `json:"cover_blur_hash" db:"-"`
+	Palette       *Palette `json:"palette"         db:"palette"`
+
+	// AnalysisVersion is the version of the page analysis job that last
+	// processed the book. Books with an older version are analysed again.
+	AnalysisVersion int `json:"-" db:"analysis_version"`
+	// TypeConfidence is the lowest confidence of the book's page types.
+	TypeConfidence float64 `json:"type_confidence" db:"type_confidence"`
+
+	PageEntries jsoncolumn.Slice[*PageEntry] `json:"-" db:"page_entries"`
+	FileSize    int64                        `json:"-" db:"file_size"`
+	FileModTime *database.Time               `json:"-" db:"file_mod_time"`
+
+	// FileDigest is KOReader's partial MD5 of the archive, used to match
+	// books synced from KOReader.
+	FileDigest string `json:"-" db:"file_digest,index"`
+
 	UserBook   *builder.HasOne[*UserBook]   `json:"user_book" db:"-"`
 	UserSeries *builder.HasOne[*UserSeries] `json:"-"         db:"-" local:"series" foreign:"series_name"`
 	Series     *builder.BelongsTo[*Series]  `json:"series"    db:"-" foreign:"series" owner:"name"`
@@ -104,6 +174,22 @@ func (b *Book) BeforeSave(ctx context.Context, tx salusadb.DB) error {
 		}
 	}
 
+	if b.PageEntries == nil {
+		err := b.CalculatePageEntries()
+		if err != nil {
+			clog.Use(ctx).Warn("failed to calculate page entries", "err", err)
+		}
+	}
+
+	if b.FileDigest == "" {
+		digest, err := kosync.DigestFile(b.FilePath())
+		if err != nil {
+			clog.Use(ctx).Warn("failed to calculate file digest", "err", err)
+		} else {
+			b.FileDigest = digest
+		}
+	}
+
 	basePages := make([]*BasePage, len(b.Pages))
 	if b.Pages != nil {
 		for i, page := range b.Pages {
@@ -111,7 +197,7 @@ func (b *Book) BeforeSave(ctx context.Context, tx salusadb.DB) error {
 		}
 	}
 
-	b.PageCount = len(b.Pages)
+	b.PageCount = len(b.PageRefs())
 
 	volume := float64(999_999_999.999)
 	if !b.Volume.IsNull() {
@@ -177,7 +263,7 @@ func (b *Book) calculateDownloadSize() (int, error) {
 		return 0, err
 	}
 
-	imgs, err := ZippedImages(reader)
+	imgs, err := ZippedImages(&reader.Reader)
 	if err != nil {
 		return 0, err
 	}
@@ -191,13 +277,74 @@ func (b *Book) calculateDownloadSize() (int, error) {
 	return totalSize, nil
 }
 
+// CalculatePageEntries reads the location of each page image from the
+// book's archive.
+func (b *Book) CalculatePageEntries() error {
+	reader, err := zip.OpenReader(b.FilePath())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	imgs, err := ZippedImages(&reader.Reader)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(b.FilePath())
+	if err != nil {
+		return err
+	}
+
+	return b.SetPageEntries(imgs, info)
+}
+
+// SetPageEntries records the location of each page image in the archive
+// along with the size and modification time of the archive they were read
+// from.
+func (b *Book) SetPageEntries(imgs []*zip.File, info fs.FileInfo) error {
+	entries := make(jsoncolumn.Slice[*PageEntry], len(imgs))
+	for i, img := range imgs {
+		offset, err := img.DataOffset()
+		if err != nil {
+			return err
+		}
+		entries[i] = &PageEntry{
+			Name:   img.Name,
+			Offset: offset,
+			Size:   int64(img.CompressedSize64),
+			Method: img.Method,
+		}
+	}
+	b.PageEntries = entries
+	b.FileSize = info.Size()
+	b.FileModTime = database.TimePtr(info.ModTime())
+	return nil
+}
+
+// PageEntry returns the archive entry for a page if it is still valid for the
+// file described by info.
+func (b *Book) PageEntry(page int, info fs.FileInfo) (*PageEntry, bool) {
+	if page < 0 || page >= len(b.PageEntries) {
+		return nil, false
+	}
+	if b.FileSize != info.Size() || !b.FileModTime.Time().Equal(info.ModTime()) {
+		return nil, false
+	}
+	return b.PageEntries[page], true
+}
+
 func (b *Book) AfterLoad(ctx context.Context, tx salusadb.DB) error {
 	for i, page := range b.Pages {
 		page.URL = router.MustURL(ctx, "book.page", "id", b.ID.String(), "page", fmt.Sprint(i))
 		page.ThumbnailURL = router.MustURL(ctx, "book.thumbnail", "id", b.ID.String(), "page", fmt.Sprint(i))
 	}
 
-	b.CoverURL = router.MustURL(ctx, "book.thumbnail", "id", b.ID.String(), "page", fmt.Sprint(b.CoverPage()))
+	cover := b.CoverPage()
+	b.CoverURL = router.MustURL(ctx, "book.thumbnail", "id", b.ID.String(), "page", fmt.Sprint(cover))
+	if cover < len(b.Pages) {
+		b.CoverBlurHash = b.Pages[cover].BlurHash
+	}
 	b.updateOriginals()
 	return nil
 }
@@ -224,21 +371,14 @@ func (b *Book) FilePath() string {
 	return path.Join(config.LibraryPath, b.File)
 }
 
-func ZippedImages(reader *zip.ReadCloser) ([]*zip.File, error) {
+func ZippedImages(reader *zip.Reader) ([]*zip.File, error) {
 	sort.Slice(reader.File, func(i, j int) bool {
 		return strings.Compare(reader.File[i].Name, reader.File[j].Name) < 0
 	})
 
 	imageFiles := reader.File[:0]
 	for _, x := range reader.File {
-		lowerName := strings.ToLower(x.Name)
-		if strings.HasSuffix(lowerName, ".jpg") ||
-			strings.HasSuffix(lowerName, ".jpeg") ||
-			strings.HasSuffix(lowerName, ".png") ||
-			strings.HasSuffix(lowerName, ".bmp") ||
-			strings.HasSuffix(lowerName, ".gif") ||
-			strings.HasSuffix(lowerName, ".webp") ||
-			strings.HasSuffix(lowerName, ".tiff") {
+		if imaging.IsImage(x.Name) {
 			imageFiles = append(imageFiles, x)
 		}
 	}
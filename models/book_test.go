@@ -1,7 +1,11 @@
 package models_test
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/abibby/comicbox-3/models"
@@ -65,3 +69,57 @@ func TestBook_save(t *testing.T) {
 
 	})
 }
+
+func TestBook_SetPageEntries(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "book.cbz")
+
+	pages := map[string][]byte{
+		"001.jpg": []byte("stored page"),
+		"002.png": bytes.Repeat([]byte("deflated page "), 100),
+	}
+
+	f, err := os.Create(file)
+	assert.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, name := range []string{"001.jpg", "002.png"} {
+		method := zip.Store
+		if name == "002.png" {
+			method = zip.Deflate
+		}
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		assert.NoError(t, err)
+		_, err = fw.Write(pages[name])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+
+	reader, err := zip.OpenReader(file)
+	assert.NoError(t, err)
+	defer reader.Close()
+	imgs, err := models.ZippedImages(&reader.Reader)
+	assert.NoError(t, err)
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+
+	b := &models.Book{}
+	assert.NoError(t, b.SetPageEntries(imgs, info))
+	assert.Len(t, b.PageEntries, 2)
+
+	entry, ok := b.PageEntry(0, info)
+	assert.True(t, ok)
+	assert.True(t, entry.Stored())
+
+	raw, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, pages["001.jpg"], raw[entry.Offset:entry.Offset+entry.Size])
+
+	entry, ok = b.PageEntry(1, info)
+	assert.True(t, ok)
+	assert.False(t, entry.Stored())
+
+	b.FileSize++
+	_, ok = b.PageEntry(0, info)
+	assert.False(t, ok)
+}
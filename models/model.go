@@ -40,6 +40,13 @@ func (b *BaseModel) UpdateField(name string) {
 	}
 }
 
+// UpdatedByUser reports whether a client, rather than the server, last
+// changed the field.
+func (b *BaseModel) UpdatedByUser(name string) bool {
+	v := b.UpdateMap[name]
+	return v != "" && !strings.Contains(v, "-SERVER-")
+}
+
 func (*BaseModel) Scopes() []*builder.Scope {
 	return []*builder.Scope{
 		SoftDeleteScope,
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"image"
+	"os"
+
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/abibby/salusa/database/jsoncolumn"
+)
+
+// Palette holds colours from a cover as CSS hex colours for theming the UI. An
+// empty palette means the cover couldn't be read.
+type Palette struct {
+	Dominant string `json:"dominant"`
+	Vibrant  string `json:"vibrant"`
+	Muted    string `json:"muted"`
+}
+
+// NewPalette extracts the palette of a cover image.
+func NewPalette(img image.Image) *Palette {
+	dominant, vibrant, muted := imaging.Palette(img)
+	return &Palette{
+		Dominant: imaging.Hex(dominant),
+		Vibrant:  imaging.Hex(vibrant),
+		Muted:    imaging.Hex(muted),
+	}
+}
+
+func (p *Palette) Scan(src any) error {
+	return jsoncolumn.Scan(p, src)
+}
+
+func (p Palette) Value() (driver.Value, error) {
+	return jsoncolumn.Value(p)
+}
+
+// DecodePalette extracts the palette of the image file at path.
+func DecodePalette(ctx context.Context, path string) (*Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := imaging.Decode(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return NewPalette(img), nil
+}
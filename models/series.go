@@ -33,9 +33,25 @@ type Series struct {
 	Genres            jsoncolumn.Slice[string] `json:"genres"        db:"genres"`
 	Tags              jsoncolumn.Slice[string] `json:"tags"          db:"tags"`
 	Year              *nulls.Int               `json:"year"          db:"year"`
+	Publisher         string                   `json:"publisher"     db:"publisher"`
+	Country           string                   `json:"country"       db:"country"`
 	CoverImage        string                   `json:"-"             db:"cover_image_path"`
 	MetadataUpdatedAt *database.Time           `json:"-"             db:"metadata_updated_at"`
 	LockedFields      jsoncolumn.Slice[string] `json:"locked_fields" db:"locked_fields"`
+	AutoCrop          bool                     `json:"auto_crop"     db:"auto_crop"`
+	Palette           *Palette                 `json:"palette"       db:"palette"`
+
+	AutoDeleteRecurring bool `json:"auto_delete_recurring" db:"auto_delete_recurring"`
+	AutoDeleteBlank     bool `json:"auto_delete_blank"     db:"auto_delete_blank"`
+
+	// Reading settings given to new books in the series. Null leaves the
+	// value detected for each book.
+	RightToLeft  *bool `json:"rtl"           db:"rtl"`
+	LongStrip    *bool `json:"long_strip"    db:"long_strip"`
+	SplitSpreads *bool `json:"split_spreads" db:"split_spreads"`
+
+	// TrackerIDs are the series' IDs on reading trackers, keyed by service.
+	TrackerIDs jsoncolumn.Map[TrackerService, string] `json:"tracker_ids" db:"tracker_ids"`
 
 	UserSeries *builder.HasOne[*UserSeries] `json:"user_series" db:"-" local:"name" foreign:"series_name"`
 }
@@ -44,6 +60,22 @@ func init() {
 	providers.Add(modeldi.Register[*Series])
 }
 
+// ApplyDefaults sets the series' reading settings on book and returns the
+// fields that changed.
+func (s *Series) ApplyDefaults(book *Book) []string {
+	changed := []string{}
+	apply := func(field string, def *bool, value *bool) {
+		if def != nil && *value != *def {
+			*value = *def
+			changed = append(changed, field)
+		}
+	}
+	apply("rtl", s.RightToLeft, &book.RightToLeft)
+	apply("long_strip", s.LongStrip, &book.LongStrip)
+	apply("split_spreads", s.SplitSpreads, &book.SplitSpreads)
+	return changed
+}
+
 type MetadataID string
 type MetadataService string
 
@@ -82,6 +114,20 @@ func (m *MetadataID) IntID() (MetadataService, int) {
 	return service, id
 }
 
+// TrackerID returns the series' ID on the tracker, Anilist falls back to the
+// Anilist metadata ID.
+func (s *Series) TrackerID(service TrackerService) string {
+	if id, ok := s.TrackerIDs[service]; ok && id != "" {
+		return id
+	}
+	if service == TrackerAnilist && s.MetadataID != nil {
+		if metaService, id := s.MetadataID.ID(); metaService == MetadataServiceAnilist {
+			return id
+		}
+	}
+	return ""
+}
+
 func SeriesQuery(ctx context.Context) *builder.ModelBuilder[*Series] {
 	return builder.From[*Series]().WithContext(ctx)
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/abibby/comicbox-3/models"
+	"github.com/stretchr/testify/assert"
 )
 
 func FromSeries(s *models.Series) func(us *models.UserSeries) {
@@ -68,3 +69,19 @@ func TestSlug(t *testing.T) {
 		})
 	}
 }
+
+func TestSeries_ApplyDefaults(t *testing.T) {
+	rtl, longStrip := true, false
+	s := &models.Series{
+		RightToLeft: &rtl,
+		LongStrip:   &longStrip,
+	}
+	b := &models.Book{LongStrip: false, SplitSpreads: true}
+
+	assert.Equal(t, []string{"rtl"}, s.ApplyDefaults(b))
+	assert.True(t, b.RightToLeft)
+	assert.False(t, b.LongStrip)
+	assert.True(t, b.SplitSpreads)
+
+	assert.Empty(t, s.ApplyDefaults(b))
+}
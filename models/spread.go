@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"net/url"
+
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+)
+
+type PageHalf string
+
+const (
+	PageHalfLeft  = PageHalf("left")
+	PageHalfRight = PageHalf("right")
+)
+
+// Rect returns the half of bounds covered by h. An empty half covers all of
+// bounds.
+func (h PageHalf) Rect(bounds image.Rectangle) image.Rectangle {
+	mid := bounds.Min.X + bounds.Dx()/2
+	switch h {
+	case PageHalfLeft:
+		return image.Rect(bounds.Min.X, bounds.Min.Y, mid, bounds.Max.Y)
+	case PageHalfRight:
+		return image.Rect(mid, bounds.Min.Y, bounds.Max.X, bounds.Max.Y)
+	}
+	return bounds
+}
+
+// PageRef identifies the archive page, or half of one, shown as a page of a
+// book.
+type PageRef struct {
+	Index int
+	Half  PageHalf
+}
+
+// PageRefs returns the pages of the book in reading order. When SplitSpreads
+// is set every spread is shown as two pages, right half first for right to
+// left books.
+func (b *Book) PageRefs() []PageRef {
+	refs := make([]PageRef, 0, len(b.Pages))
+	for i, page := range b.Pages {
+		if !b.SplitSpreads || page.Type != PageTypeSpread {
+			refs = append(refs, PageRef{Index: i})
+			continue
+		}
+		first, second := PageHalfLeft, PageHalfRight
+		if b.RightToLeft {
+			first, second = second, first
+		}
+		refs = append(refs, PageRef{Index: i, Half: first}, PageRef{Index: i, Half: second})
+	}
+	return refs
+}
+
+// TranslatePage converts a page number from the layout in from, as returned by
+// an earlier call to PageRefs, to the book's current layout. Pages that were a
+// half of a spread map to the whole spread and whole spreads map to their
+// first half.
+func (b *Book) TranslatePage(page int, from []PageRef) int {
+	if len(from) == 0 {
+		return page
+	}
+	ref := from[min(max(page, 0), len(from)-1)]
+	for i, r := range b.PageRefs() {
+		if r.Index == ref.Index && (r.Half == ref.Half || r.Half == "" || ref.Half == "") {
+			return i
+		}
+	}
+	return page
+}
+
+// TranslateProgress moves every reader's current page of the book from
+// oldLayout to the book's current page layout so they stay on the same page.
+func (b *Book) TranslateProgress(ctx context.Context, tx salusadb.DB, oldLayout []PageRef) error {
+	userBooks, err := UserBookQuery(ctx).
+		WithoutGlobalScope(UserScoped).
+		Where("book_id", "=", b.ID).
+		Get(tx)
+	if err != nil {
+		return err
+	}
+	for _, ub := range userBooks {
+		page := b.TranslatePage(ub.CurrentPage, oldLayout)
+		if page == ub.CurrentPage {
+			continue
+		}
+		ub.SetCurrentPage(page)
+		err = model.SaveContext(ctx, tx, ub)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPageTypes updates the type of each page in reading order. A split spread
+// only changes when both of its halves are given the same new type.
+func (b *Book) SetPageTypes(types []PageType) error {
+	refs := b.PageRefs()
+	if len(refs) != len(types) {
+		return fmt.Errorf("expected %d pages, received %d", len(refs), len(types))
+	}
+
+	halves := map[int][]PageType{}
+	for i, ref := range refs {
+		if ref.Half == "" {
+			b.Pages[ref.Index].Type = types[i]
+			continue
+		}
+		halves[ref.Index] = append(halves[ref.Index], types[i])
+	}
+	for index, t := range halves {
+		if len(t) == 2 && t[0] == t[1] && t[0] != PageTypeSpreadSplit {
+			b.Pages[index].Type = t[0]
+		}
+	}
+	return nil
+}
+
+// displayPages returns the pages of the book the way they are shown to the
+// reader.
+func (b *Book) displayPages() []*Page {
+	if !b.SplitSpreads {
+		return b.Pages
+	}
+	refs := b.PageRefs()
+	pages := make([]*Page, len(refs))
+	for i, ref := range refs {
+		page := b.Pages[ref.Index]
+		if ref.Half == "" {
+			pages[i] = page
+			continue
+		}
+
+		half := ref.Half.Rect(image.Rect(0, 0, page.Width, page.Height))
+		p := &Page{
+			BasePage: BasePage{
+				Type:     PageTypeSpreadSplit,
+				Width:    half.Dx(),
+				Height:   half.Dy(),
+				BlurHash: page.BlurHash,
+				Crop:     page.Crop.Half(ref.Half, page.Width, page.Height),
+
+				Confidence: page.Confidence,
+			},
+			URL:          withHalf(page.URL, ref.Half),
+			ThumbnailURL: withHalf(page.ThumbnailURL, ref.Half),
+		}
+		pages[i] = p
+	}
+	return pages
+}
+
+func withHalf(rawURL string, half PageHalf) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	q.Set("half", string(half))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Half returns the part of the crop box inside one half of a page, relative to
+// that half.
+func (c *CropBox) Half(half PageHalf, width, height int) *CropBox {
+	if c == nil {
+		return nil
+	}
+	h := half.Rect(image.Rect(0, 0, width, height))
+	r := c.Rect().Intersect(h).Sub(h.Min)
+	if r.Empty() {
+		return nil
+	}
+	return &CropBox{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// MarshalJSON implements json.Marshaler. Split spreads are sent as separate
+// pages while the stored pages always match the archive.
+func (b *Book) MarshalJSON() ([]byte, error) {
+	type book Book
+	return json.Marshal(struct {
+		*book
+		Pages []*Page `json:"pages"`
+	}{
+		book:  (*book)(b),
+		Pages: b.displayPages(),
+	})
+}
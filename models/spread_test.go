@@ -0,0 +1,105 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func spreadBook() *models.Book {
+	page := func(t models.PageType, w, h int) *models.Page {
+		return &models.Page{
+			BasePage: models.BasePage{Type: t, Width: w, Height: h},
+			URL:      "http://localhost/page",
+		}
+	}
+	return &models.Book{
+		Pages: []*models.Page{
+			page(models.PageTypeFrontCover, 400, 600),
+			page(models.PageTypeSpread, 800, 600),
+			page(models.PageTypeStory, 400, 600),
+		},
+	}
+}
+
+func TestBook_PageRefs(t *testing.T) {
+	b := spreadBook()
+	assert.Equal(t, []models.PageRef{{Index: 0}, {Index: 1}, {Index: 2}}, b.PageRefs())
+
+	b.SplitSpreads = true
+	assert.Equal(t, []models.PageRef{
+		{Index: 0},
+		{Index: 1, Half: models.PageHalfLeft},
+		{Index: 1, Half: models.PageHalfRight},
+		{Index: 2},
+	}, b.PageRefs())
+
+	b.RightToLeft = true
+	assert.Equal(t, models.PageHalfRight, b.PageRefs()[1].Half)
+}
+
+func TestBook_TranslatePage(t *testing.T) {
+	b := spreadBook()
+	whole := b.PageRefs()
+	b.SplitSpreads = true
+	split := b.PageRefs()
+
+	assert.Equal(t, 1, b.TranslatePage(1, whole))
+	assert.Equal(t, 3, b.TranslatePage(2, whole))
+
+	b.SplitSpreads = false
+	assert.Equal(t, 1, b.TranslatePage(2, split))
+	assert.Equal(t, 2, b.TranslatePage(3, split))
+}
+
+func TestBook_SetPageTypes(t *testing.T) {
+	b := spreadBook()
+	b.SplitSpreads = true
+
+	err := b.SetPageTypes([]models.PageType{
+		models.PageTypeFrontCover,
+		models.PageTypeDeleted,
+		models.PageTypeSpreadSplit,
+		models.PageTypeDeleted,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, models.PageTypeSpread, b.Pages[1].Type)
+	assert.Equal(t, models.PageTypeDeleted, b.Pages[2].Type)
+
+	err = b.SetPageTypes([]models.PageType{
+		models.PageTypeFrontCover,
+		models.PageTypeDeleted,
+		models.PageTypeDeleted,
+		models.PageTypeStory,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, models.PageTypeDeleted, b.Pages[1].Type)
+
+	assert.Error(t, b.SetPageTypes([]models.PageType{models.PageTypeStory}))
+}
+
+func TestBook_MarshalJSON(t *testing.T) {
+	b := spreadBook()
+	b.SplitSpreads = true
+	b.Pages[1].Crop = &models.CropBox{X: 10, Y: 10, Width: 780, Height: 580}
+
+	data, err := json.Marshal(b)
+	assert.NoError(t, err)
+
+	out := struct {
+		Pages []*models.Page `json:"pages"`
+	}{}
+	assert.NoError(t, json.Unmarshal(data, &out))
+	assert.Len(t, out.Pages, 4)
+	assert.Len(t, b.Pages, 3)
+
+	left, right := out.Pages[1], out.Pages[2]
+	assert.Equal(t, models.PageTypeSpreadSplit, left.Type)
+	assert.Equal(t, 400, left.Width)
+	assert.Equal(t, "http://localhost/page?half=left", left.URL)
+	assert.Equal(t, "http://localhost/page?half=right", right.URL)
+	assert.Equal(t, &models.CropBox{X: 10, Y: 10, Width: 390, Height: 580}, left.Crop)
+	assert.Equal(t, &models.CropBox{X: 0, Y: 10, Width: 390, Height: 580}, right.Crop)
+}
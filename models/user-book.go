@@ -2,9 +2,15 @@ package models
 
 import (
 	"context"
+	"database/sql/driver"
+	"errors"
 
 	salusadb "github.com/abibby/salusa/database"
 	"github.com/abibby/salusa/database/builder"
+	"github.com/abibby/salusa/database/jsoncolumn"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/database/model/mixins"
+	"github.com/abibby/salusa/di"
 	"github.com/google/uuid"
 )
 
@@ -15,14 +21,78 @@ type UserBook struct {
 	UserID      uuid.UUID `json:"-"            db:"user_id,primary"`
 	CurrentPage int       `json:"current_page" db:"current_page"`
 
+	// Kosync is the last position KOReader synced. It is only reported back
+	// while the current page hasn't been changed by another reader.
+	Kosync *KosyncPosition `json:"-" db:"kosync"`
+
 	Book *builder.BelongsTo[*Book] `json:"-"`
 	User *builder.BelongsTo[*User] `json:"-"`
 }
 
+// KosyncPosition is a reading position as KOReader sends it.
+type KosyncPosition struct {
+	Progress    string  `json:"progress"`
+	Percentage  float64 `json:"percentage"`
+	Device      string  `json:"device"`
+	DeviceID    string  `json:"device_id"`
+	CurrentPage int     `json:"current_page"`
+}
+
+func (p *KosyncPosition) Scan(src any) error {
+	return jsoncolumn.Scan(p, src)
+}
+
+func (p KosyncPosition) Value() (driver.Value, error) {
+	return jsoncolumn.Value(p)
+}
+
 func UserBookQuery(ctx context.Context) *builder.ModelBuilder[*UserBook] {
 	return builder.From[*UserBook]().WithContext(ctx)
 }
 
+// FindUserBook returns a user's progress in a book, including progress that
+// was deleted, or a new user book if they haven't started it. ctx must act as
+// the user.
+func FindUserBook(ctx context.Context, tx salusadb.DB, uid, bookID uuid.UUID) (*UserBook, error) {
+	ub, err := UserBookQuery(ctx).
+		Where("book_id", "=", bookID).
+		WithoutGlobalScope(mixins.SoftDeleteScope).
+		First(tx)
+	if err != nil {
+		return nil, err
+	}
+	if ub == nil {
+		ub = &UserBook{UserID: uid, BookID: bookID}
+	}
+	if ub.UpdateMap == nil {
+		ub.UpdateMap = map[string]string{}
+	}
+	return ub, nil
+}
+
+// AdvanceUserBook moves a user's progress in a book forward to page and saves
+// it. Progress is never moved backwards, progress that was deleted is
+// replaced. ctx must act as the user.
+func AdvanceUserBook(ctx context.Context, tx salusadb.DB, uid, bookID uuid.UUID, page int) error {
+	ub, err := FindUserBook(ctx, tx, uid, bookID)
+	if err != nil {
+		return err
+	}
+	if ub.DeletedAt == nil && ub.CurrentPage >= page {
+		return nil
+	}
+	ub.SetCurrentPage(page)
+	return model.SaveContext(ctx, tx, ub)
+}
+
+// SetCurrentPage moves the user to page, restoring progress that was
+// deleted.
+func (ub *UserBook) SetCurrentPage(page int) {
+	ub.CurrentPage = page
+	ub.UpdateField("current_page")
+	ub.DeletedAt = nil
+}
+
 var _ builder.Scoper = &UserBook{}
 
 func (b *UserBook) Scopes() []*builder.Scope {
@@ -42,6 +112,39 @@ func (ub *UserBook) AfterSave(ctx context.Context, tx salusadb.DB) error {
 		if err != nil {
 			return err
 		}
+		if ub.DeletedAt == nil && ub.CurrentPage >= b.PageCount-1 {
+			err = queueTrackerSync(ctx, tx, ub.UserID, b.SeriesSlug)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
+
+// BookReadHandler is called when a user with a reading tracker finishes a
+// book in the series.
+type BookReadHandler func(ctx context.Context, uid uuid.UUID, seriesSlug string) error
+
+// queueTrackerSync syncs the series with the user's reading trackers once
+// they finish a book.
+func queueTrackerSync(ctx context.Context, tx salusadb.DB, uid uuid.UUID, seriesSlug string) error {
+	trackers, err := UserTrackerQuery(ctx).
+		WithoutGlobalScope(UserScoped).
+		Where("user_id", "=", uid).
+		Where("access_token", "!=", "").
+		Count(tx)
+	if err != nil {
+		return err
+	}
+	if trackers == 0 {
+		return nil
+	}
+	onRead, err := di.Resolve[BookReadHandler](ctx)
+	if errors.Is(err, di.ErrNotRegistered) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return onRead(ctx, uid, seriesSlug)
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/salusa/database/builder"
+	"github.com/abibby/salusa/request"
+	"github.com/google/uuid"
+)
+
+type TrackerService string
+
+var _ request.Validator = TrackerService("")
+
+const (
+	TrackerAnilist     = TrackerService("anilist")
+	TrackerMyAnimeList = TrackerService("myanimelist")
+	TrackerKitsu       = TrackerService("kitsu")
+)
+
+func (s TrackerService) Valid() error {
+	switch s {
+	case TrackerAnilist, TrackerMyAnimeList, TrackerKitsu:
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid tracker", s)
+	}
+}
+
+func (s TrackerService) Options() map[string]string {
+	return map[string]string{
+		"Anilist":     string(TrackerAnilist),
+		"MyAnimeList": string(TrackerMyAnimeList),
+		"Kitsu":       string(TrackerKitsu),
+	}
+}
+
+// UserTracker is a user's account on a reading tracker.
+//
+//go:generate spice generate:migration
+type UserTracker struct {
+	BaseModel
+	UserID  uuid.UUID      `json:"-"       db:"user_id,primary"`
+	Service TrackerService `json:"service" db:"service,primary"`
+	// RemoteUserID and Username are the user's account on the tracker.
+	RemoteUserID string         `json:"-"          db:"remote_user_id"`
+	Username     string         `json:"username"   db:"username"`
+	AccessToken  string         `json:"-"          db:"access_token"`
+	RefreshToken string         `json:"-"          db:"refresh_token"`
+	ExpiresAt    *database.Time `json:"expires_at" db:"expires_at"`
+	// Verifier is the PKCE code verifier of a login that hasn't finished.
+	Verifier string `json:"-" db:"verifier"`
+
+	User *builder.BelongsTo[*User] `json:"-"`
+}
+
+func UserTrackerQuery(ctx context.Context) *builder.ModelBuilder[*UserTracker] {
+	return builder.From[*UserTracker]().WithContext(ctx)
+}
+
+var _ builder.Scoper = &UserTracker{}
+
+func (t *UserTracker) Scopes() []*builder.Scope {
+	return []*builder.Scope{
+		UserScoped,
+	}
+}
+
+// Linked reports whether the user has finished logging in.
+func (t *UserTracker) Linked() bool {
+	return t.AccessToken != ""
+}
@@ -4,8 +4,7 @@ import (
 	"context"
 	"strings"
 
-	"github.com/abibby/comicbox-3/database"
-	"github.com/abibby/nulls"
+	"github.com/abibby/comicbox-3/server/kosync"
 	salusadb "github.com/abibby/salusa/database"
 	"github.com/abibby/salusa/database/builder"
 	"github.com/abibby/salusa/database/hooks"
@@ -17,14 +16,12 @@ import (
 //go:generate spice generate:migration
 type User struct {
 	BaseModel
-	ID               uuid.UUID      `json:"id"         db:"id,primary"`
-	Username         string         `json:"username"   db:"username"`
-	Password         []byte         `json:"-"          db:"-"`
-	PasswordHash     []byte         `json:"-"          db:"password"`
-	AnilistGrant     *nulls.String  `json:"-"          db:"anilist_grant"`
-	AnilistToken     *nulls.String  `json:"-"          db:"anilist_token"`
-	AnilistExpiresAt *database.Time `json:"-"          db:"anilist_expires_at"`
-	RoleID           int            `json:"-"          db:"role_id"`
+	ID            uuid.UUID `json:"id"         db:"id,primary"`
+	Username      string    `json:"username"   db:"username"`
+	Password      []byte    `json:"-"          db:"-"`
+	PasswordHash  []byte    `json:"-"          db:"password"`
+	KosyncKeyHash []byte    `json:"-"          db:"kosync_key"`
+	RoleID        int       `json:"-"          db:"role_id"`
 
 	Role *builder.BelongsTo[*Role] `json:"role"`
 }
@@ -44,9 +41,26 @@ func (u *User) BeforeSave(ctx context.Context, tx salusadb.DB) error {
 			return errors.Wrap(err, "could not hash password")
 		}
 		u.PasswordHash = hash
+
+		err = u.SetKosyncKey(kosync.Key(string(u.Password)))
+		if err != nil {
+			return err
+		}
 	}
 
 	u.Username = strings.ToLower(u.Username)
 
 	return nil
 }
+
+// SetKosyncKey stores the key KOReader signs in with, the MD5 of the user's
+// password. Only the password's bcrypt hash is kept, so the key is set
+// whenever the password is seen in plain text.
+func (u *User) SetKosyncKey(key string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "could not hash kosync key")
+	}
+	u.KosyncKeyHash = hash
+	return nil
+}
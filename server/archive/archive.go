@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	// Registers the decoders for every supported page format.
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrNotFound = errors.New("book not found")
+var ErrPageNotFound = models.ErrPageNotFound
+
+// Archive is an open book archive shared between requests. Every call to Open
+// must be paired with a call to Release.
+type Archive struct {
+	book    *models.Book
+	file    *os.File
+	info    os.FileInfo
+	reader  *zip.Reader
+	images  []*zip.File
+	cache   *Cache
+	refs    int
+	evicted bool
+}
+
+func openArchive(book *models.Book) (*Archive, error) {
+	f, err := os.Open(book.FilePath())
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	reader, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	images, err := models.ZippedImages(reader)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Archive{
+		book:   book,
+		file:   f,
+		info:   info,
+		reader: reader,
+		images: images,
+	}, nil
+}
+
+// Book returns the book the archive was opened for, with its series. It is
+// kept until the archive is invalidated so it can be used in place of reading
+// the book for every page.
+func (a *Archive) Book() *models.Book {
+	return a.book
+}
+
+// Images returns the page images in the archive in page order.
+func (a *Archive) Images() []*zip.File {
+	return a.images
+}
+
+// ModTime returns the modification time of the archive when it was opened.
+func (a *Archive) ModTime() time.Time {
+	return a.info.ModTime()
+}
+
+// Page opens the image for a page. The archive stays open until the returned
+// reader is closed.
+func (a *Archive) Page(page int) (io.ReadCloser, error) {
+	if page < 0 || page >= len(a.images) {
+		return nil, ErrPageNotFound
+	}
+	f, err := a.images[page].Open()
+	if err != nil {
+		return nil, err
+	}
+	a.retain()
+	return &pageReader{ReadCloser: f, archive: a}, nil
+}
+
+// DecodePage opens and decodes the image for a page.
+func (a *Archive) DecodePage(ctx context.Context, page int) (image.Image, error) {
+	f, err := a.Page(page)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := imaging.Decode(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// StoredPage returns a reader over the raw bytes of a page if it was stored
+// in the archive without compression. The archive stays open until the
+// returned reader is closed.
+func (a *Archive) StoredPage(page int) (io.ReadSeekCloser, *models.PageEntry, bool) {
+	entry, ok := a.book.PageEntry(page, a.info)
+	if !ok || !entry.Stored() {
+		return nil, nil, false
+	}
+	a.retain()
+	return &storedPageReader{
+		SectionReader: io.NewSectionReader(a.file, entry.Offset, entry.Size),
+		archive:       a,
+	}, entry, true
+}
+
+func (a *Archive) retain() {
+	a.cache.mtx.Lock()
+	defer a.cache.mtx.Unlock()
+	a.refs++
+}
+
+// Release marks the archive as no longer in use by the caller. The file is
+// closed once it has been evicted from the cache and every user has released
+// it.
+func (a *Archive) Release() {
+	a.cache.mtx.Lock()
+	defer a.cache.mtx.Unlock()
+	a.refs--
+	a.closeIfUnused()
+}
+
+func (a *Archive) closeIfUnused() {
+	if a.evicted && a.refs <= 0 {
+		a.file.Close()
+	}
+}
+
+type pageReader struct {
+	io.ReadCloser
+	archive *Archive
+	once    sync.Once
+}
+
+func (r *pageReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.archive.Release)
+	return err
+}
+
+type storedPageReader struct {
+	*io.SectionReader
+	archive *Archive
+	once    sync.Once
+}
+
+func (r *storedPageReader) Close() error {
+	r.once.Do(r.archive.Release)
+	return nil
+}
+
+func findBook(ctx context.Context, id string) (*models.Book, error) {
+	var book *models.Book
+	err := database.ReadTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		book, err = models.BookQuery(ctx).With("Series").Find(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if book == nil {
+		return nil, ErrNotFound
+	}
+	return book, nil
+}
@@ -0,0 +1,158 @@
+package archive
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/google/uuid"
+)
+
+// Cache keeps a bounded number of book archives open so that paging through a
+// book doesn't re-read the zip central directory on every request.
+type Cache struct {
+	mtx     sync.Mutex
+	size    int
+	entries map[uuid.UUID]*list.Element
+	lru     *list.List
+}
+
+func New(size int) *Cache {
+	return &Cache{
+		size:    max(size, 1),
+		entries: map[uuid.UUID]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+var (
+	defaultCache *Cache
+	defaultOnce  sync.Once
+)
+
+// Default returns the process wide archive cache.
+func Default() *Cache {
+	defaultOnce.Do(func() {
+		defaultCache = New(config.ArchiveCacheSize)
+	})
+	return defaultCache
+}
+
+// Open returns the archive for a book from the default cache.
+func Open(ctx context.Context, id uuid.UUID) (*Archive, error) {
+	return Default().Open(ctx, id)
+}
+
+// Invalidate drops books from the default cache.
+func Invalidate(ids ...uuid.UUID) {
+	Default().Invalidate(ids...)
+}
+
+// InvalidateSeries drops the books in series from the default cache.
+func InvalidateSeries(slugs ...string) {
+	Default().InvalidateSeries(slugs...)
+}
+
+// Open returns the archive for a book, opening it if it is not cached or the
+// file has changed since it was cached. The caller must call Release on the
+// returned archive.
+func (c *Cache) Open(ctx context.Context, id uuid.UUID) (*Archive, error) {
+	a, ok := c.cached(id)
+	if ok {
+		return a, nil
+	}
+
+	book, err := findBook(ctx, id.String())
+	if err != nil {
+		return nil, err
+	}
+	a, err = openArchive(book)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	a.cache = c
+	a.refs = 1
+	if el, ok := c.entries[id]; ok {
+		c.evict(el)
+	}
+	c.entries[id] = c.lru.PushFront(a)
+	for c.lru.Len() > c.size {
+		c.evict(c.lru.Back())
+	}
+	return a, nil
+}
+
+func (c *Cache) cached(id uuid.UUID) (*Archive, bool) {
+	c.mtx.Lock()
+	el, ok := c.entries[id]
+	c.mtx.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	a := el.Value.(*Archive)
+	info, err := os.Stat(a.book.FilePath())
+	fresh := err == nil && info.Size() == a.info.Size() && info.ModTime().Equal(a.info.ModTime())
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.entries[id] != el {
+		return nil, false
+	}
+	if !fresh {
+		c.evict(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	a.refs++
+	return a, true
+}
+
+// Invalidate drops books from the cache. Archives that are still in use are
+// closed when they are released.
+func (c *Cache) Invalidate(ids ...uuid.UUID) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, id := range ids {
+		if el, ok := c.entries[id]; ok {
+			c.evict(el)
+		}
+	}
+}
+
+// InvalidateSeries drops the books in series from the cache, for changes to
+// series settings that affect how their pages are served.
+func (c *Cache) InvalidateSeries(slugs ...string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, el := range c.entries {
+		if slices.Contains(slugs, el.Value.(*Archive).book.SeriesSlug) {
+			c.evict(el)
+		}
+	}
+}
+
+// Len returns the number of cached archives.
+func (c *Cache) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache) evict(el *list.Element) {
+	a := el.Value.(*Archive)
+	c.lru.Remove(el)
+	delete(c.entries, a.book.ID)
+	a.evicted = true
+	a.closeIfUnused()
+}
@@ -0,0 +1,138 @@
+package archive_test
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/models/factory"
+	"github.com/abibby/comicbox-3/server/archive"
+	"github.com/abibby/comicbox-3/test"
+	"github.com/abibby/salusa/di"
+	"github.com/abibby/salusa/router"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func createArchive(t *testing.T, file string) {
+	f, err := os.Create(path.Join(config.LibraryPath, file))
+	assert.NoError(t, err)
+	w := zip.NewWriter(f)
+	fw, err := w.Create("001.jpg")
+	assert.NoError(t, err)
+	_, err = fw.Write([]byte("page"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+}
+
+func TestCache(t *testing.T) {
+	setup := func(ctx context.Context, t *testing.T, tx *sqlx.Tx) []*models.Book {
+		config.LibraryPath = t.TempDir()
+		database.SetTestTx(tx)
+		t.Cleanup(func() { database.SetTestTx(nil) })
+		di.RegisterSingleton(ctx, func() router.URLResolver {
+			return router.NewTestResolver()
+		})
+
+		i := 0
+		return factory.Book.State(func(b *models.Book) {
+			i++
+			b.SeriesSlug = "series"
+			b.File = "book-" + string(rune('a'+i)) + ".cbz"
+			createArchive(t, b.File)
+		}).Count(3).Create(tx)
+	}
+
+	test.Run(t, "reuses open archives", func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+		books := setup(ctx, t, tx)
+		c := archive.New(2)
+
+		a1, err := c.Open(ctx, books[0].ID)
+		assert.NoError(t, err)
+		a1.Release()
+
+		a2, err := c.Open(ctx, books[0].ID)
+		assert.NoError(t, err)
+		a2.Release()
+
+		assert.Same(t, a1, a2)
+		assert.Len(t, a1.Images(), 1)
+	})
+
+	test.Run(t, "evicts the least recently used archive", func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+		books := setup(ctx, t, tx)
+		c := archive.New(2)
+
+		first, err := c.Open(ctx, books[0].ID)
+		assert.NoError(t, err)
+		for _, b := range books[1:] {
+			a, err := c.Open(ctx, b.ID)
+			assert.NoError(t, err)
+			a.Release()
+		}
+		assert.Equal(t, 2, c.Len())
+
+		// evicted archives stay readable until they are released
+		f, err := first.Page(0)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		first.Release()
+
+		a, err := c.Open(ctx, books[0].ID)
+		assert.NoError(t, err)
+		a.Release()
+		assert.NotSame(t, first, a)
+	})
+
+	test.Run(t, "reopens changed files", func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+		books := setup(ctx, t, tx)
+		c := archive.New(2)
+
+		a1, err := c.Open(ctx, books[0].ID)
+		assert.NoError(t, err)
+		a1.Release()
+
+		later := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(books[0].FilePath(), later, later))
+
+		a2, err := c.Open(ctx, books[0].ID)
+		assert.NoError(t, err)
+		a2.Release()
+		assert.NotSame(t, a1, a2)
+	})
+
+	test.Run(t, "invalidates books", func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+		books := setup(ctx, t, tx)
+		c := archive.New(2)
+
+		a1, err := c.Open(ctx, books[0].ID)
+		assert.NoError(t, err)
+		a1.Release()
+
+		c.Invalidate(books[0].ID)
+		assert.Equal(t, 0, c.Len())
+	})
+
+	test.Run(t, "invalidates series", func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+		books := setup(ctx, t, tx)
+		c := archive.New(2)
+
+		for _, b := range books[:2] {
+			a, err := c.Open(ctx, b.ID)
+			assert.NoError(t, err)
+			a.Release()
+		}
+
+		c.InvalidateSeries("other")
+		assert.Equal(t, 2, c.Len())
+		c.InvalidateSeries("series")
+		assert.Equal(t, 0, c.Len())
+	})
+}
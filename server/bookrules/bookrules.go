@@ -0,0 +1,276 @@
+// Package bookrules applies the library wide rules admins set up to choose
+// reading settings, like right to left for every series from Japan, for books
+// that haven't been configured by hand.
+package bookrules
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/archive"
+	"github.com/abibby/comicbox-3/server/middleware"
+	"github.com/abibby/salusa/clog"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/google/uuid"
+)
+
+// BookChange is a book field a rule sets.
+type BookChange struct {
+	BookID     uuid.UUID              `json:"book_id"`
+	SeriesSlug string                 `json:"series_slug"`
+	File       string                 `json:"file"`
+	Field      models.RuleActionField `json:"field"`
+	Value      bool                   `json:"value"`
+	RuleID     uuid.UUID              `json:"rule_id"`
+
+	book *models.Book
+}
+
+// Load returns the enabled rules in the order they run.
+func Load(ctx context.Context, tx salusadb.DB) ([]*models.BookRule, error) {
+	return models.BookRuleQuery(ctx).
+		Where("enabled", "=", true).
+		OrderBy("priority").
+		OrderBy("name").
+		Get(tx)
+}
+
+// Validate checks that every condition and action of a rule can be evaluated.
+func Validate(rule *models.BookRule) error {
+	for i, c := range rule.Conditions {
+		if _, ok := fields[c.Field]; !ok {
+			return fmt.Errorf("condition %d: unknown field %q", i, c.Field)
+		}
+		switch c.Operator {
+		case models.RuleOperatorEquals, models.RuleOperatorContains:
+		case models.RuleOperatorMatches:
+			_, err := regexp.Compile(c.Value)
+			if err != nil {
+				return fmt.Errorf("condition %d: invalid pattern: %w", i, err)
+			}
+		case models.RuleOperatorGreaterThan, models.RuleOperatorLessThan:
+			_, err := strconv.ParseFloat(c.Value, 64)
+			if err != nil {
+				return fmt.Errorf("condition %d: %q is not a number", i, c.Value)
+			}
+		default:
+			return fmt.Errorf("condition %d: unknown operator %q", i, c.Operator)
+		}
+	}
+	if len(rule.Actions) == 0 {
+		return fmt.Errorf("a rule must have at least one action")
+	}
+	for i, a := range rule.Actions {
+		if !slices.Contains(actionFields, a.Field) {
+			return fmt.Errorf("action %d: unknown field %q", i, a.Field)
+		}
+	}
+	return nil
+}
+
+// Plan returns the changes rules make to the books of a series. Rules run in
+// order so a later rule overrides an earlier one. Fields set by a user on the
+// book or by a series default are left alone.
+func Plan(rules []*models.BookRule, series *models.Series, books []*models.Book) []*BookChange {
+	compiled := make([]*rule, 0, len(rules))
+	for _, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+
+	changes := []*BookChange{}
+	for _, book := range books {
+		planned := map[models.RuleActionField]*BookChange{}
+		for _, r := range compiled {
+			if !r.match(series, book) {
+				continue
+			}
+			for _, a := range r.Actions {
+				planned[a.Field] = &BookChange{
+					BookID:     book.ID,
+					SeriesSlug: book.SeriesSlug,
+					File:       book.File,
+					Field:      a.Field,
+					Value:      a.Value,
+					RuleID:     r.ID,
+					book:       book,
+				}
+			}
+		}
+		for _, field := range actionFields {
+			c, ok := planned[field]
+			if !ok || book.UpdatedByUser(string(field)) || seriesDefault(series, field) {
+				continue
+			}
+			if !differs(book, field, c.Value) {
+				continue
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// Preview returns the changes rules make to every book in the library.
+func Preview(ctx context.Context, tx salusadb.DB, rules []*models.BookRule) ([]*BookChange, error) {
+	allSeries, err := models.SeriesQuery(ctx).Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	books, err := models.BookQuery(ctx).OrderBy("sort").Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	bySeries := map[string][]*models.Book{}
+	for _, book := range books {
+		bySeries[book.SeriesSlug] = append(bySeries[book.SeriesSlug], book)
+	}
+
+	changes := []*BookChange{}
+	for _, series := range allSeries {
+		changes = append(changes, Plan(rules, series, bySeries[series.Slug])...)
+	}
+	return changes, nil
+}
+
+// ApplyAll runs the rules on every book in the library and returns the number
+// of books changed.
+func ApplyAll(ctx context.Context, tx salusadb.DB) (int, error) {
+	rules, err := Load(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if len(rules) == 0 {
+		return 0, nil
+	}
+	changes, err := Preview(ctx, tx, rules)
+	if err != nil {
+		return 0, err
+	}
+	return apply(ctx, tx, changes)
+}
+
+// ApplySeries runs the rules on the books of a series and returns the number
+// of books changed.
+func ApplySeries(ctx context.Context, tx salusadb.DB, series *models.Series) (int, error) {
+	rules, err := Load(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if len(rules) == 0 {
+		return 0, nil
+	}
+	books, err := models.BookQuery(ctx).Where("series", "=", series.Slug).Get(tx)
+	if err != nil {
+		return 0, err
+	}
+	return ApplyBooks(ctx, tx, rules, series, books)
+}
+
+// ApplyBooks runs rules on books from one series and returns the number of
+// books changed.
+func ApplyBooks(ctx context.Context, tx salusadb.DB, rules []*models.BookRule, series *models.Series, books []*models.Book) (int, error) {
+	if len(rules) == 0 {
+		return 0, nil
+	}
+	return apply(ctx, tx, Plan(rules, series, books))
+}
+
+func apply(ctx context.Context, tx salusadb.DB, changes []*BookChange) (int, error) {
+	byBook := map[*models.Book][]*BookChange{}
+	order := []*models.Book{}
+	for _, c := range changes {
+		if _, ok := byBook[c.book]; !ok {
+			order = append(order, c.book)
+		}
+		byBook[c.book] = append(byBook[c.book], c)
+	}
+
+	for _, book := range order {
+		oldLayout := book.PageRefs()
+		rerender := false
+		for _, c := range byBook[book] {
+			set(book, c.Field, c.Value)
+			book.UpdateField(string(c.Field))
+			if c.Field == models.RuleActionSplitSpreads || c.Field == models.RuleActionAutoCrop {
+				rerender = true
+			}
+		}
+		err := model.SaveContext(ctx, tx, book)
+		if err != nil {
+			return 0, err
+		}
+		if rerender {
+			err = book.TranslateProgress(ctx, tx, oldLayout)
+			if err != nil {
+				return 0, err
+			}
+			archive.Invalidate(book.ID)
+			err = middleware.ClearCache(path.Join("/api/books", book.ID.String()))
+			if err != nil {
+				clog.Use(ctx).Warn("failed to clear book cache", "book", book.ID, "err", err)
+			}
+		}
+	}
+	return len(order), nil
+}
+
+var actionFields = []models.RuleActionField{
+	models.RuleActionRightToLeft,
+	models.RuleActionLongStrip,
+	models.RuleActionSplitSpreads,
+	models.RuleActionAutoCrop,
+}
+
+func differs(book *models.Book, field models.RuleActionField, value bool) bool {
+	switch field {
+	case models.RuleActionRightToLeft:
+		return book.RightToLeft != value
+	case models.RuleActionLongStrip:
+		return book.LongStrip != value
+	case models.RuleActionSplitSpreads:
+		return book.SplitSpreads != value
+	case models.RuleActionAutoCrop:
+		// A book without its own value follows the series.
+		return book.AutoCrop == nil || *book.AutoCrop != value
+	}
+	return false
+}
+
+func set(book *models.Book, field models.RuleActionField, value bool) {
+	switch field {
+	case models.RuleActionRightToLeft:
+		book.RightToLeft = value
+	case models.RuleActionLongStrip:
+		book.LongStrip = value
+	case models.RuleActionSplitSpreads:
+		book.SplitSpreads = value
+	case models.RuleActionAutoCrop:
+		book.AutoCrop = &value
+	}
+}
+
+// seriesDefault reports whether the series sets field itself, which is more
+// specific than a library rule.
+func seriesDefault(series *models.Series, field models.RuleActionField) bool {
+	switch field {
+	case models.RuleActionRightToLeft:
+		return series.RightToLeft != nil
+	case models.RuleActionLongStrip:
+		return series.LongStrip != nil
+	case models.RuleActionSplitSpreads:
+		return series.SplitSpreads != nil
+	case models.RuleActionAutoCrop:
+		return series.UpdatedByUser("auto_crop")
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package bookrules_test
+
+import (
+	"testing"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/bookrules"
+	"github.com/abibby/nulls"
+	"github.com/stretchr/testify/assert"
+)
+
+func bookRule(priority int, conditions []*models.RuleCondition, actions ...*models.RuleAction) *models.BookRule {
+	return &models.BookRule{
+		Priority:   priority,
+		Enabled:    true,
+		Conditions: conditions,
+		Actions:    actions,
+	}
+}
+
+func sizedBook(file string, sizes ...[2]int) *models.Book {
+	b := &models.Book{File: file}
+	for _, s := range sizes {
+		b.Pages = append(b.Pages, &models.Page{
+			BasePage: models.BasePage{Width: s[0], Height: s[1]},
+		})
+	}
+	return b
+}
+
+func TestPlan(t *testing.T) {
+	rules := []*models.BookRule{
+		bookRule(0, []*models.RuleCondition{
+			{Field: models.RuleFieldSeriesCountry, Operator: models.RuleOperatorEquals, Value: "jp"},
+		}, &models.RuleAction{Field: models.RuleActionRightToLeft, Value: true}),
+		bookRule(0, []*models.RuleCondition{
+			{Field: models.RuleFieldPageMinAspect, Operator: models.RuleOperatorGreaterThan, Value: "3"},
+		}, &models.RuleAction{Field: models.RuleActionLongStrip, Value: true}),
+	}
+	series := &models.Series{Country: "JP"}
+	books := []*models.Book{
+		sizedBook("a.cbz", [2]int{800, 1200}),
+		sizedBook("b.cbz", [2]int{800, 20000}, [2]int{800, 2500}),
+	}
+
+	changes := bookrules.Plan(rules, series, books)
+	if assert.Len(t, changes, 3) {
+		assert.Equal(t, "a.cbz", changes[0].File)
+		assert.Equal(t, models.RuleActionRightToLeft, changes[0].Field)
+		assert.Equal(t, "b.cbz", changes[1].File)
+		assert.Equal(t, models.RuleActionRightToLeft, changes[1].Field)
+		assert.Equal(t, "b.cbz", changes[2].File)
+		assert.Equal(t, models.RuleActionLongStrip, changes[2].Field)
+	}
+
+	books[0].RightToLeft = true
+	assert.Len(t, bookrules.Plan(rules, series, books), 2, "books already set are unchanged")
+}
+
+func TestPlan_order(t *testing.T) {
+	rules := []*models.BookRule{
+		bookRule(0, nil, &models.RuleAction{Field: models.RuleActionSplitSpreads, Value: true}),
+		bookRule(1, []*models.RuleCondition{
+			{Field: models.RuleFieldSeriesGenres, Operator: models.RuleOperatorMatches, Value: "^web"},
+		}, &models.RuleAction{Field: models.RuleActionSplitSpreads, Value: false}),
+	}
+	books := []*models.Book{sizedBook("a.cbz")}
+
+	changes := bookrules.Plan(rules, &models.Series{Genres: []string{"Drama", "Webtoon"}}, books)
+	assert.Empty(t, changes, "the later rule wins")
+
+	changes = bookrules.Plan(rules, &models.Series{Genres: []string{"Drama"}}, books)
+	if assert.Len(t, changes, 1) {
+		assert.True(t, changes[0].Value)
+	}
+}
+
+func TestPlan_not(t *testing.T) {
+	rules := []*models.BookRule{
+		bookRule(0, []*models.RuleCondition{
+			{Field: models.RuleFieldSeriesYear, Operator: models.RuleOperatorLessThan, Value: "2000", Not: true},
+			{Field: models.RuleFieldBookPath, Operator: models.RuleOperatorContains, Value: "MANGA/"},
+		}, &models.RuleAction{Field: models.RuleActionAutoCrop, Value: false}),
+	}
+	books := []*models.Book{sizedBook("manga/a.cbz"), sizedBook("comics/b.cbz")}
+
+	changes := bookrules.Plan(rules, &models.Series{Year: nulls.NewInt(2010)}, books)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, "manga/a.cbz", changes[0].File)
+	}
+	assert.Empty(t, bookrules.Plan(rules, &models.Series{Year: nulls.NewInt(1990)}, books))
+}
+
+func TestPlan_overrides(t *testing.T) {
+	rules := []*models.BookRule{
+		bookRule(0, nil,
+			&models.RuleAction{Field: models.RuleActionRightToLeft, Value: true},
+			&models.RuleAction{Field: models.RuleActionLongStrip, Value: true},
+		),
+	}
+	books := []*models.Book{sizedBook("a.cbz"), sizedBook("b.cbz")}
+	books[0].UpdateMap = map[string]string{"rtl": "1-user"}
+	series := &models.Series{LongStrip: new(bool)}
+
+	changes := bookrules.Plan(rules, series, books)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, "b.cbz", changes[0].File)
+		assert.Equal(t, models.RuleActionRightToLeft, changes[0].Field)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	action := &models.RuleAction{Field: models.RuleActionRightToLeft, Value: true}
+	assert.NoError(t, bookrules.Validate(bookRule(0, nil, action)))
+	assert.Error(t, bookrules.Validate(bookRule(0, nil)), "no actions")
+	assert.Error(t, bookrules.Validate(bookRule(0, []*models.RuleCondition{
+		{Field: "series.colour", Operator: models.RuleOperatorEquals},
+	}, action)))
+	assert.Error(t, bookrules.Validate(bookRule(0, []*models.RuleCondition{
+		{Field: models.RuleFieldSeriesName, Operator: models.RuleOperatorMatches, Value: "("},
+	}, action)))
+	assert.Error(t, bookrules.Validate(bookRule(0, []*models.RuleCondition{
+		{Field: models.RuleFieldPageCount, Operator: models.RuleOperatorGreaterThan, Value: "many"},
+	}, action)))
+	assert.Error(t, bookrules.Validate(bookRule(0, nil, &models.RuleAction{Field: "title"})))
+}
@@ -0,0 +1,139 @@
+package bookrules
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/google/uuid"
+)
+
+// fields gets the values of each condition field for a book. Fields that
+// are not set return no values and never match.
+var fields = map[models.RuleField]func(s *models.Series, b *models.Book) []string{
+	models.RuleFieldSeriesName:      func(s *models.Series, b *models.Book) []string { return []string{s.Name} },
+	models.RuleFieldSeriesGenres:    func(s *models.Series, b *models.Book) []string { return s.Genres },
+	models.RuleFieldSeriesTags:      func(s *models.Series, b *models.Book) []string { return s.Tags },
+	models.RuleFieldSeriesPublisher: func(s *models.Series, b *models.Book) []string { return []string{s.Publisher} },
+	models.RuleFieldSeriesCountry:   func(s *models.Series, b *models.Book) []string { return []string{s.Country} },
+	models.RuleFieldSeriesYear: func(s *models.Series, b *models.Book) []string {
+		if year, ok := s.Year.Ok(); ok {
+			return []string{strconv.Itoa(year)}
+		}
+		return nil
+	},
+	models.RuleFieldBookTitle:   func(s *models.Series, b *models.Book) []string { return []string{b.Title} },
+	models.RuleFieldBookAuthors: func(s *models.Series, b *models.Book) []string { return b.Authors },
+	models.RuleFieldBookPath:    func(s *models.Series, b *models.Book) []string { return []string{b.File} },
+	models.RuleFieldPageCount: func(s *models.Series, b *models.Book) []string {
+		return []string{strconv.Itoa(len(b.Pages))}
+	},
+	models.RuleFieldPageMinAspect: func(s *models.Series, b *models.Book) []string {
+		return aspect(b, math.Min)
+	},
+	models.RuleFieldPageMaxAspect: func(s *models.Series, b *models.Book) []string {
+		return aspect(b, math.Max)
+	},
+}
+
+// aspect combines the height to width ratios of the pages that have a size.
+func aspect(b *models.Book, combine func(a, b float64) float64) []string {
+	result, found := 0.0, false
+	for _, page := range b.Pages {
+		if page.Width <= 0 {
+			continue
+		}
+		a := float64(page.Height) / float64(page.Width)
+		if !found {
+			result, found = a, true
+		} else {
+			result = combine(result, a)
+		}
+	}
+	if !found {
+		return nil
+	}
+	return []string{strconv.FormatFloat(result, 'f', -1, 64)}
+}
+
+type condition struct {
+	*models.RuleCondition
+	re     *regexp.Regexp
+	number float64
+}
+
+type rule struct {
+	ID         uuid.UUID
+	Conditions []*condition
+	Actions    []*models.RuleAction
+}
+
+func compile(r *models.BookRule) (*rule, error) {
+	err := Validate(r)
+	if err != nil {
+		return nil, err
+	}
+	c := &rule{
+		ID:         r.ID,
+		Conditions: make([]*condition, len(r.Conditions)),
+		Actions:    r.Actions,
+	}
+	for i, rc := range r.Conditions {
+		cond := &condition{RuleCondition: rc}
+		switch rc.Operator {
+		case models.RuleOperatorMatches:
+			cond.re, err = regexp.Compile("(?i)" + rc.Value)
+		case models.RuleOperatorGreaterThan, models.RuleOperatorLessThan:
+			cond.number, err = strconv.ParseFloat(rc.Value, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("condition %d: %w", i, err)
+		}
+		c.Conditions[i] = cond
+	}
+	return c, nil
+}
+
+// match reports whether every condition of the rule matches the book.
+func (r *rule) match(series *models.Series, book *models.Book) bool {
+	for _, c := range r.Conditions {
+		if c.match(fields[c.Field](series, book)) == c.Not {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether any of values matches the condition. Text comparisons
+// ignore case.
+func (c *condition) match(values []string) bool {
+	for _, v := range values {
+		switch c.Operator {
+		case models.RuleOperatorEquals:
+			if strings.EqualFold(v, c.Value) {
+				return true
+			}
+		case models.RuleOperatorContains:
+			if strings.Contains(strings.ToLower(v), strings.ToLower(c.Value)) {
+				return true
+			}
+		case models.RuleOperatorMatches:
+			if c.re.MatchString(v) {
+				return true
+			}
+		case models.RuleOperatorGreaterThan, models.RuleOperatorLessThan:
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			if c.Operator == models.RuleOperatorGreaterThan && n > c.number ||
+				c.Operator == models.RuleOperatorLessThan && n < c.number {
+				return true
+			}
+		}
+	}
+	return false
+}
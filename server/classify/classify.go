@@ -0,0 +1,210 @@
+// Package classify guesses the type of each page of a book from what is known
+// about its pages and the rest of its series.
+package classify
+
+import (
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/abibby/comicbox-3/server/pagerules"
+	"github.com/google/uuid"
+)
+
+const (
+	// ReviewThreshold is the confidence below which a guess should be checked
+	// by a person.
+	ReviewThreshold = 0.6
+
+	// spreadRatio is the width to height ratio above which a page is
+	// certainly a spread.
+	spreadRatio = 1.2
+	// coverWindow is the number of pages at the start of a book searched for
+	// the cover.
+	coverWindow = 3
+	// coverDistance is the hash distance at which a page stops looking
+	// anything like the other covers of the series.
+	coverDistance = 32
+	// pairThreshold is the seam score above which two pages are the halves
+	// of a spread.
+	pairThreshold = 0.75
+	// pairAmbiguous is the seam score above which two pages might be the
+	// halves of a spread.
+	pairAmbiguous = 0.5
+)
+
+// Series is what is known about the books in a series.
+type Series struct {
+	// Credits are the pages that recur across the series.
+	Credits []imaging.Hash
+
+	covers map[uuid.UUID]imaging.Hash
+}
+
+// NewSeries collects the covers and credit pages of books.
+func NewSeries(books []*models.Book) *Series {
+	covers := map[uuid.UUID]imaging.Hash{}
+	for _, book := range books {
+		if len(book.Pages) == 0 {
+			continue
+		}
+		if h, ok := pagerules.PageHash(book.Pages[book.CoverPage()]); ok {
+			covers[book.ID] = h
+		}
+	}
+	return &Series{
+		Credits: pagerules.Recurring(books),
+		covers:  covers,
+	}
+}
+
+// otherCovers returns the covers of every book in the series except book.
+func (s *Series) otherCovers(book *models.Book) []imaging.Hash {
+	covers := make([]imaging.Hash, 0, len(s.covers))
+	for id, h := range s.covers {
+		if id != book.ID {
+			covers = append(covers, h)
+		}
+	}
+	return covers
+}
+
+type guess struct {
+	typ        models.PageType
+	confidence float64
+}
+
+// Classify sets the type and confidence of every page of book and reports
+// whether anything changed. Books with page types set by a person are left
+// alone.
+func Classify(book *models.Book, series *Series) bool {
+	if book.UpdatedByUser("pages") {
+		return false
+	}
+	if series == nil {
+		series = &Series{}
+	}
+
+	guesses := make([]guess, len(book.Pages))
+	credits := make([]bool, len(book.Pages))
+	for i, page := range book.Pages {
+		guesses[i] = byAspect(page)
+		if h, ok := pagerules.PageHash(page); ok {
+			_, credits[i] = pagerules.Match(series.Credits, h)
+		}
+	}
+
+	cover := -1
+	if len(book.Pages) > 0 {
+		var confidence float64
+		cover, confidence = findCover(book.Pages, credits, series.otherCovers(book))
+		guesses[cover] = guess{models.PageTypeFrontCover, confidence}
+	}
+
+	pairSpreads(book, guesses, credits, cover+1)
+
+	changed := false
+	lowest := 1.0
+	for i, page := range book.Pages {
+		g := guesses[i]
+		if page.Type != g.typ || page.Confidence != g.confidence {
+			page.Type = g.typ
+			page.Confidence = g.confidence
+			changed = true
+		}
+		lowest = min(lowest, g.confidence)
+	}
+	if book.TypeConfidence != lowest {
+		book.TypeConfidence = lowest
+		changed = true
+	}
+	return changed
+}
+
+// byAspect guesses from the shape of the page alone.
+func byAspect(page *models.Page) guess {
+	if page.Width == 0 || page.Height == 0 {
+		return guess{models.PageTypeStory, 0.5}
+	}
+	ratio := float64(page.Width) / float64(page.Height)
+	switch {
+	case ratio >= spreadRatio:
+		return guess{models.PageTypeSpread, min(1, 0.7+ratio-spreadRatio)}
+	case ratio > 1:
+		return guess{models.PageTypeSpread, 0.5}
+	}
+	return guess{models.PageTypeStory, 0.9}
+}
+
+// findCover returns the first page near the start of the book that isn't a
+// credit or blank page, and how likely it is to be the cover.
+func findCover(pages []*models.Page, credits []bool, covers []imaging.Hash) (int, float64) {
+	skippedBlank := false
+	for i := range min(coverWindow, len(pages)) {
+		page := pages[i]
+		if credits[i] {
+			continue
+		}
+		if page.Blank {
+			skippedBlank = true
+			continue
+		}
+
+		confidence := 0.75
+		switch {
+		case page.Hash == "":
+			// Only the shape of the page is known until it is analysed.
+			confidence = 0.6
+		case skippedBlank:
+			confidence = 0.6
+		case i > 0:
+			confidence = 0.8
+		}
+
+		if h, ok := pagerules.PageHash(page); ok && len(covers) > 0 {
+			d, _ := pagerules.Match(covers, h)
+			similarity := max(0, 1-float64(d)/coverDistance)
+			confidence = max(confidence, 0.5+0.5*similarity)
+		}
+		return i, confidence
+	}
+	return 0, 0.3
+}
+
+// pairSpreads finds neighbouring pages, starting at start, whose facing edges
+// continue into each other and marks them as the two halves of a spread.
+func pairSpreads(book *models.Book, guesses []guess, credits []bool, start int) {
+	pairable := func(i int) bool {
+		return guesses[i].typ == models.PageTypeStory &&
+			!credits[i] &&
+			!book.Pages[i].Blank
+	}
+
+	for i := max(start, 0); i+1 < len(book.Pages); i++ {
+		a, b := book.Pages[i], book.Pages[i+1]
+		if a.Seam == nil || !pairable(i) || !pairable(i+1) || !sameSize(a, b) {
+			continue
+		}
+
+		score := a.Seam.LeftToRight
+		if book.RightToLeft {
+			score = a.Seam.RightToLeft
+		}
+
+		if score >= pairThreshold {
+			guesses[i] = guess{models.PageTypeSpreadSplit, score}
+			guesses[i+1] = guess{models.PageTypeSpreadSplit, score}
+			i++
+		} else if score >= pairAmbiguous {
+			guesses[i].confidence = min(guesses[i].confidence, 0.5)
+			guesses[i+1].confidence = min(guesses[i+1].confidence, 0.5)
+		}
+	}
+}
+
+// sameSize reports whether two pages are close enough in size to have been
+// cut from one image.
+func sameSize(a, b *models.Page) bool {
+	near := func(x, y int, tolerance float64) bool {
+		return float64(max(x-y, y-x)) <= float64(max(x, y))*tolerance
+	}
+	return near(a.Height, b.Height, 0.02) && near(a.Width, b.Width, 0.05)
+}
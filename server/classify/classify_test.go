@@ -0,0 +1,110 @@
+package classify_test
+
+import (
+	"testing"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/classify"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const credit = imaging.Hash(0xf0f0f0f00f0f0f0f)
+
+func page(w, h int, hash imaging.Hash) *models.Page {
+	p := &models.Page{BasePage: models.BasePage{Width: w, Height: h}}
+	if hash != 0 {
+		p.Hash = hash.String()
+	}
+	return p
+}
+
+func types(b *models.Book) []models.PageType {
+	t := make([]models.PageType, len(b.Pages))
+	for i, p := range b.Pages {
+		t[i] = p.Type
+	}
+	return t
+}
+
+func TestClassify_aspect(t *testing.T) {
+	b := &models.Book{Pages: []*models.Page{
+		page(400, 600, 0),
+		page(400, 600, 0),
+		page(800, 600, 0),
+	}}
+
+	assert.True(t, classify.Classify(b, nil))
+	assert.Equal(t, []models.PageType{
+		models.PageTypeFrontCover,
+		models.PageTypeStory,
+		models.PageTypeSpread,
+	}, types(b))
+	assert.Less(t, b.TypeConfidence, 0.9)
+	assert.False(t, classify.Classify(b, nil))
+}
+
+func TestClassify_credit_page(t *testing.T) {
+	b := &models.Book{Pages: []*models.Page{
+		page(400, 600, credit),
+		page(400, 600, 0x0123456789abcdef),
+		page(400, 600, 0xfedcba9876543210),
+	}}
+
+	classify.Classify(b, &classify.Series{Credits: []imaging.Hash{credit ^ 1}})
+	assert.Equal(t, []models.PageType{
+		models.PageTypeStory,
+		models.PageTypeFrontCover,
+		models.PageTypeStory,
+	}, types(b))
+	assert.GreaterOrEqual(t, b.Pages[1].Confidence, classify.ReviewThreshold)
+}
+
+func TestClassify_split_spread(t *testing.T) {
+	b := &models.Book{Pages: []*models.Page{
+		page(400, 600, 0),
+		page(400, 600, 0),
+		page(400, 600, 0),
+		page(400, 600, 0),
+	}}
+	b.Pages[1].Seam = &models.Seam{LeftToRight: 0.95, RightToLeft: 0.1}
+	b.Pages[2].Seam = &models.Seam{LeftToRight: 0.6, RightToLeft: 0.6}
+
+	classify.Classify(b, nil)
+	assert.Equal(t, []models.PageType{
+		models.PageTypeFrontCover,
+		models.PageTypeSpreadSplit,
+		models.PageTypeSpreadSplit,
+		models.PageTypeStory,
+	}, types(b))
+
+	b.RightToLeft = true
+	classify.Classify(b, nil)
+	assert.Equal(t, models.PageTypeStory, b.Pages[1].Type)
+	assert.Equal(t, 0.5, b.Pages[2].Confidence)
+	assert.Less(t, b.TypeConfidence, classify.ReviewThreshold)
+}
+
+func TestClassify_user_edits(t *testing.T) {
+	b := &models.Book{Pages: []*models.Page{page(800, 600, 0)}}
+	b.Pages[0].Type = models.PageTypeStory
+	b.UpdateMap = map[string]string{"pages": "1"}
+
+	assert.False(t, classify.Classify(b, nil))
+	assert.Equal(t, models.PageTypeStory, b.Pages[0].Type)
+}
+
+func TestClassify_series_cover(t *testing.T) {
+	cover := imaging.Hash(0x0123456789abcdef)
+	a := &models.Book{ID: uuid.New(), Pages: []*models.Page{page(400, 600, cover)}}
+	b := &models.Book{ID: uuid.New(), Pages: []*models.Page{page(400, 600, cover^0b101)}}
+	series := classify.NewSeries([]*models.Book{a, b})
+
+	classify.Classify(b, series)
+	assert.Greater(t, b.Pages[0].Confidence, 0.9)
+
+	// a book's own cover doesn't count
+	classify.Classify(a, classify.NewSeries([]*models.Book{a}))
+	assert.Equal(t, 0.75, a.Pages[0].Confidence)
+}
@@ -0,0 +1,41 @@
+package classify
+
+import (
+	"slices"
+
+	"github.com/abibby/comicbox-3/models"
+)
+
+const (
+	// stripRatio is the height to width ratio above which a page is a strip.
+	stripRatio = 2.5
+	// stripCoverage is the fraction of pages that must be strips for a book
+	// to be read as a long strip. It leaves room for a cover and credits.
+	stripCoverage = 0.6
+	// stripWidthTolerance is how far the width of a strip may be from the
+	// typical width of the strips in the book.
+	stripWidthTolerance = 0.05
+)
+
+// LongStrip reports whether a book is made of tall strips of the same width,
+// like most webtoons.
+func LongStrip(pages []*models.Page) bool {
+	widths := []int{}
+	for _, page := range pages {
+		if page.Width > 0 && float64(page.Height)/float64(page.Width) >= stripRatio {
+			widths = append(widths, page.Width)
+		}
+	}
+	if len(widths) == 0 || float64(len(widths)) < float64(len(pages))*stripCoverage {
+		return false
+	}
+
+	slices.Sort(widths)
+	median := widths[len(widths)/2]
+	for _, w := range widths {
+		if float64(max(w-median, median-w)) > float64(median)*stripWidthTolerance {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package classify_test
+
+import (
+	"testing"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/classify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLongStrip(t *testing.T) {
+	assert.True(t, classify.LongStrip([]*models.Page{
+		page(800, 1200, 0),
+		page(800, 20000, 0),
+		page(800, 12000, 0),
+		page(790, 9000, 0),
+	}))
+
+	assert.False(t, classify.LongStrip([]*models.Page{
+		page(400, 600, 0),
+		page(400, 600, 0),
+		page(800, 2400, 0),
+	}), "mostly regular pages")
+
+	assert.False(t, classify.LongStrip([]*models.Page{
+		page(800, 20000, 0),
+		page(400, 12000, 0),
+	}), "strips of different widths")
+
+	assert.False(t, classify.LongStrip(nil))
+}
@@ -2,11 +2,13 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/abibby/comicbox-3/config"
@@ -71,6 +73,14 @@ func Login(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(u.KosyncKeyHash) == 0 {
+		err = addKosyncKey(r.Context(), u, req.Password)
+		if err != nil {
+			sendError(rw, err)
+			return
+		}
+	}
+
 	resp, err := generateLoginResponse(u)
 	if err != nil {
 		sendError(rw, err)
@@ -283,3 +293,115 @@ func attachUser(r *http.Request) *http.Request {
 
 	return auth.WithClaims(r, claims)
 }
+
+// basicAuthTTL is how long a verified username and password are remembered.
+// Streaming readers send the same credentials with every page, checking the
+// bcrypt hash each time would make paging slow.
+const basicAuthTTL = 10 * time.Minute
+
+var (
+	basicAuthMtx    = &sync.Mutex{}
+	basicAuthLogins = map[[sha256.Size]byte]time.Time{}
+)
+
+// BasicAuthMiddleware lets clients that can't handle tokens, like OPDS
+// readers, sign in with HTTP Basic auth using their username and password.
+// Requests that already carry a token are passed through. Requests without
+// either are asked for credentials.
+func BasicAuthMiddleware() router.InlineMiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if _, ok := auth.GetClaims(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="comicbox", charset="UTF-8"`)
+			sendError(w, ErrUnauthorized)
+			return
+		}
+		claims, err := basicAuthClaims(r.Context(), username, password)
+		if err == ErrUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="comicbox", charset="UTF-8"`)
+			sendError(w, err)
+			return
+		} else if err != nil {
+			sendError(w, err)
+			return
+		}
+		next.ServeHTTP(w, auth.WithClaims(r, claims))
+	}
+}
+
+func basicAuthClaims(ctx context.Context, username, password string) (*auth.Claims, error) {
+	return credentialClaims(ctx, "basic", username, password, func(u *models.User) []byte {
+		return u.PasswordHash
+	})
+}
+
+// credentialClaims checks a username and secret against the bcrypt hash
+// returned by hash. The user and their role are loaded on every request, only
+// a successful comparison is remembered for basicAuthTTL. The hash is part of
+// the key so changing it forgets the old secret.
+func credentialClaims(ctx context.Context, kind, username, secret string, hash func(u *models.User) []byte) (*auth.Claims, error) {
+	var u *models.User
+	err := database.ReadTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		u, err = models.UserQuery(ctx).
+			Where("username", "=", strings.ToLower(username)).
+			With("Role").
+			First(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || len(hash(u)) == 0 {
+		return nil, ErrUnauthorized
+	}
+	role, ok := u.Role.Value()
+	if !ok {
+		return nil, fmt.Errorf("credentialClaims: role must be loaded on the user")
+	}
+
+	err = compareCachedHash(kind, hash(u), secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.WithScope(role.Scopes...)(&auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: u.ID.String()},
+	}), nil
+}
+
+// compareCachedHash compares secret with a bcrypt hash, skipping the
+// comparison if the same pair matched within basicAuthTTL.
+func compareCachedHash(kind string, hash []byte, secret string) error {
+	key := sha256.Sum256([]byte(kind + "\x00" + string(hash) + "\x00" + secret))
+
+	basicAuthMtx.Lock()
+	expires, ok := basicAuthLogins[key]
+	basicAuthMtx.Unlock()
+	if ok && time.Now().Before(expires) {
+		return nil
+	}
+
+	err := bcrypt.CompareHashAndPassword(hash, []byte(secret))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrUnauthorized
+	} else if err != nil {
+		return err
+	}
+
+	basicAuthMtx.Lock()
+	defer basicAuthMtx.Unlock()
+	now := time.Now()
+	for k, e := range basicAuthLogins {
+		if now.After(e) {
+			delete(basicAuthLogins, k)
+		}
+	}
+	basicAuthLogins[key] = now.Add(basicAuthTTL)
+	return nil
+}
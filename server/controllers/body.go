@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/abibby/salusa/router"
+)
+
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// MaxBodySize rejects requests with bodies larger than n bytes before they
+// are decoded.
+func MaxBodySize(n int64) router.InlineMiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, n))
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			sendError(w, NewHttpError(413, fmt.Errorf("%w, the limit is %d bytes", ErrBodyTooLarge, n)))
+			return
+		} else if err != nil {
+			sendError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	}
+}
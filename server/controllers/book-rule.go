@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/bookrules"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/request"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type BookRuleListRequest struct {
+	Read salusadb.Read `inject:""`
+
+	Ctx context.Context `inject:""`
+}
+
+var BookRuleList = request.Handler(func(r *BookRuleListRequest) ([]*models.BookRule, error) {
+	return salusadb.Value(r.Read, func(tx *sqlx.Tx) ([]*models.BookRule, error) {
+		return models.BookRuleQuery(r.Ctx).
+			OrderBy("priority").
+			OrderBy("name").
+			Get(tx)
+	})
+})
+
+type BookRuleBody struct {
+	Name       string                  `json:"name"     validate:"require"`
+	Priority   int                     `json:"priority"`
+	Enabled    *bool                   `json:"enabled"`
+	Conditions []*models.RuleCondition `json:"conditions"`
+	Actions    []*models.RuleAction    `json:"actions"`
+}
+
+// apply copies the body onto rule and checks that the result can run.
+func (b *BookRuleBody) apply(rule *models.BookRule) error {
+	rule.Name = b.Name
+	rule.Priority = b.Priority
+	if b.Enabled != nil {
+		rule.Enabled = *b.Enabled
+	}
+	rule.Conditions = b.Conditions
+	if rule.Conditions == nil {
+		rule.Conditions = []*models.RuleCondition{}
+	}
+	rule.Actions = b.Actions
+	err := bookrules.Validate(rule)
+	if err != nil {
+		return NewHttpError(422, err)
+	}
+	return nil
+}
+
+type BookRuleCreateRequest struct {
+	BookRuleBody
+
+	Update salusadb.Update `inject:""`
+	Ctx    context.Context `inject:""`
+}
+
+var BookRuleCreate = request.Handler(func(r *BookRuleCreateRequest) (*models.BookRule, error) {
+	rule := &models.BookRule{
+		ID:      uuid.New(),
+		Enabled: true,
+	}
+	err := r.apply(rule)
+	if err != nil {
+		return nil, err
+	}
+	return salusadb.Value(r.Update, func(tx *sqlx.Tx) (*models.BookRule, error) {
+		err := model.SaveContext(r.Ctx, tx, rule)
+		if err != nil {
+			return nil, err
+		}
+		_, err = bookrules.ApplyAll(r.Ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		return rule, nil
+	})
+})
+
+type BookRuleUpdateRequest struct {
+	ID uuid.UUID `path:"id"`
+	BookRuleBody
+
+	Update salusadb.Update `inject:""`
+	Ctx    context.Context `inject:""`
+}
+
+var BookRuleUpdate = request.Handler(func(r *BookRuleUpdateRequest) (*models.BookRule, error) {
+	return salusadb.Value(r.Update, func(tx *sqlx.Tx) (*models.BookRule, error) {
+		rule, err := models.BookRuleQuery(r.Ctx).Find(tx, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			return nil, Err404
+		}
+		err = r.apply(rule)
+		if err != nil {
+			return nil, err
+		}
+		err = model.SaveContext(r.Ctx, tx, rule)
+		if err != nil {
+			return nil, err
+		}
+		_, err = bookrules.ApplyAll(r.Ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		return rule, nil
+	})
+})
+
+type BookRuleDeleteRequest struct {
+	ID uuid.UUID `path:"id"`
+
+	Update salusadb.Update `inject:""`
+	Ctx    context.Context `inject:""`
+}
+type BookRuleDeleteResponse struct {
+	Success bool `json:"success"`
+}
+
+var BookRuleDelete = request.Handler(func(r *BookRuleDeleteRequest) (*BookRuleDeleteResponse, error) {
+	return salusadb.Value(r.Update, func(tx *sqlx.Tx) (*BookRuleDeleteResponse, error) {
+		rule, err := models.BookRuleQuery(r.Ctx).Find(tx, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			return nil, Err404
+		}
+		err = models.BookRuleQuery(r.Ctx).Where("id", "=", r.ID).Delete(tx)
+		if err != nil {
+			return nil, err
+		}
+		// Books keep what the rule set, other rules may still apply to them.
+		_, err = bookrules.ApplyAll(r.Ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		return &BookRuleDeleteResponse{Success: true}, nil
+	})
+})
+
+type BookRuleDryRunRequest struct {
+	// ID is the saved rule the body replaces, if any.
+	ID *uuid.UUID `json:"id"`
+	BookRuleBody
+
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+type BookRuleDryRunResponse struct {
+	Changes []*bookrules.BookChange `json:"changes"`
+}
+
+// BookRuleDryRun returns the changes saving a rule would make to the library,
+// taking the other saved rules into account, without changing anything.
+var BookRuleDryRun = request.Handler(func(r *BookRuleDryRunRequest) (*BookRuleDryRunResponse, error) {
+	rule := &models.BookRule{
+		ID:      uuid.New(),
+		Enabled: true,
+	}
+	if r.ID != nil {
+		rule.ID = *r.ID
+	}
+	err := r.apply(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return salusadb.Value(r.Read, func(tx *sqlx.Tx) (*BookRuleDryRunResponse, error) {
+		rules, err := bookrules.Load(r.Ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		rules = slices.DeleteFunc(rules, func(other *models.BookRule) bool {
+			return other.ID == rule.ID
+		})
+		if rule.Enabled {
+			rules = append(rules, rule)
+		}
+		slices.SortStableFunc(rules, func(a, b *models.BookRule) int {
+			return cmp.Or(cmp.Compare(a.Priority, b.Priority), cmp.Compare(a.Name, b.Name))
+		})
+
+		changes, err := bookrules.Preview(r.Ctx, tx, rules)
+		if err != nil {
+			return nil, err
+		}
+		return &BookRuleDryRunResponse{Changes: changes}, nil
+	})
+})
@@ -1,26 +1,29 @@
 package controllers
 
 import (
-	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"io"
 	"log/slog"
 	"math"
+	"mime"
 	"net/http"
 	"os"
+	"path"
+	"reflect"
 	"time"
 
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
-
-	_ "golang.org/x/image/webp"
-
 	"github.com/abibby/comicbox-3/database"
 	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/archive"
+	"github.com/abibby/comicbox-3/server/classify"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/abibby/comicbox-3/server/middleware"
 	"github.com/abibby/nulls"
+	"github.com/abibby/salusa/clog"
+	salusadb "github.com/abibby/salusa/database"
 	"github.com/abibby/salusa/database/builder"
 	"github.com/abibby/salusa/database/model"
 	"github.com/abibby/salusa/request"
@@ -105,34 +108,214 @@ var BookIndex = request.Handler(func(req *BookIndexRequest) (*PaginatedResponse[
 	return paginatedList(&req.PaginatedRequest, query)
 })
 
+type BookReviewRequest struct {
+	PaginatedRequest
+
+	SeriesSlug *nulls.String  `query:"series_slug"`
+	Below      *nulls.Float64 `query:"below" validate:"min:0|max:1"`
+}
+
+// BookReview lists the books with page types the classifier isn't sure about,
+// least sure first.
+var BookReview = request.Handler(func(req *BookReviewRequest) (*PaginatedResponse[*models.Book], error) {
+	below := classify.ReviewThreshold
+	if b, ok := req.Below.Ok(); ok {
+		below = b
+	}
+
+	query := models.BookQuery(req.Ctx).
+		Where("type_confidence", "<", below).
+		OrderBy("type_confidence").
+		OrderBy("sort")
+
+	if series, ok := req.SeriesSlug.Ok(); ok {
+		query = query.Where("series", "=", series)
+	}
+
+	return paginatedList(&req.PaginatedRequest, query)
+})
+
 type BookPageRequest struct {
-	ID     string `path:"id"   validate:"uuid"`
-	Page   int    `path:"page" validate:"min:0"`
+	ID     string `path:"id"    validate:"uuid"`
+	Page   int    `path:"page"  validate:"min:0"`
 	Encode bool   `query:"encode"`
+	Crop   *bool  `query:"crop"`
+	Half   string `query:"half"`
 
-	Ctx context.Context `inject:""`
+	Request *http.Request   `inject:""`
+	Ctx     context.Context `inject:""`
+}
+
+// pageView is the part of an archive page that is served.
+type pageView struct {
+	half models.PageHalf
+	crop *models.CropBox
+}
+
+// whole reports whether the page is served as it is stored in the archive.
+func (v *pageView) whole() bool {
+	return v.half == "" && v.crop == nil
+}
+
+func (v *pageView) apply(img image.Image) (image.Image, error) {
+	var err error
+	if v.half != "" {
+		img, err = cropImage(img, v.half.Rect(img.Bounds()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v.crop != nil {
+		img, err = cropPage(img, v.crop)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// size returns the size of page once the view is applied, using the size
+// stored on the book.
+func (v *pageView) size(page *models.Page) (int, int) {
+	if v.crop != nil {
+		return v.crop.Width, v.crop.Height
+	}
+	r := v.half.Rect(image.Rect(0, 0, page.Width, page.Height))
+	return r.Dx(), r.Dy()
+}
+
+// open opens the book's archive and returns the part of the requested page to
+// serve. The book is taken from the archive cache so paging through a book
+// doesn't read it from the database. The caller must release the archive.
+func (r *BookPageRequest) open() (*archive.Archive, *pageView, error) {
+	half := models.PageHalf(r.Half)
+	if half != "" && half != models.PageHalfLeft && half != models.PageHalfRight {
+		return nil, nil, Err404
+	}
+
+	a, err := openBookArchive(r.Ctx, r.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return a, &pageView{
+		half: half,
+		crop: pageCrop(a.Book(), models.PageRef{Index: r.Page, Half: half}, r.Crop),
+	}, nil
 }
 
-var BookPage = request.Handler(func(r *BookPageRequest) (http.Handler, error) {
-	f, err := bookPageFile(r.Ctx, r.ID, r.Page)
+var BookPage = request.Handler(bookPage).Docs(&spec.OperationProps{
+	Produces: []string{"image/jpeg", "image/png", "image/webp", "image/gif", "image/bmp", "image/tiff", "image/avif", "image/jxl", "image/heic"},
+	Responses: &spec.Responses{ResponsesProps: spec.ResponsesProps{
+		Default: spec.NewResponse().WithDescription("An image"),
+	}},
+})
+
+func bookPage(r *BookPageRequest) (http.Handler, error) {
+	a, view, err := r.open()
 	if err != nil {
 		return nil, err
 	}
+	defer a.Release()
+
+	// Formats only some clients can display are converted to JPEG for the
+	// rest, so the response depends on the Accept header.
+	contentType := ""
+	if r.Page < len(a.Images()) {
+		contentType = imaging.ContentType(a.Images()[r.Page].Name)
+	}
+	transcode := imaging.NeedsTranscode(contentType, r.Request.Header.Get("Accept"))
+	vary := ""
+	if imaging.Negotiated(contentType) {
+		vary = "Accept"
+	}
 
-	if r.Encode {
-		defer f.Close()
-		img, _, err := image.Decode(f)
+	if r.Encode || !view.whole() || transcode {
+		img, err := decodePage(r.Ctx, a, r.Page)
 		if err != nil {
 			return nil, err
 		}
-		return NewJpegHandler(img, time.Hour), nil
+		img, err = view.apply(img)
+		if err != nil {
+			return nil, err
+		}
+		h := NewJpegHandler(img, time.Hour)
+		if vary != "" {
+			h.AddHeader("Vary", vary)
+		}
+		return h, nil
 	}
 
-	return NewReaderHandler(f).AddHeaderCacheMaxAge(time.Hour), nil
+	content, entry, ok := a.StoredPage(r.Page)
+	if ok {
+		h := NewContentHandler(path.Base(entry.Name), a.ModTime(), content).
+			AddHeaderCacheMaxAge(time.Hour)
+		if contentType != "" {
+			h.AddHeader("Content-Type", contentType)
+		}
+		if vary != "" {
+			h.AddHeader("Vary", vary)
+		}
+		return h, nil
+	}
+
+	f, err := bookPageFile(a, r.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	h := NewReaderHandler(f).AddHeaderCacheMaxAge(time.Hour)
+	if contentType != "" {
+		h.AddHeader("Content-Type", contentType)
+	}
+	if vary != "" {
+		h.AddHeader("Vary", vary)
+	}
+	return h, nil
+}
+
+type BookDownloadRequest struct {
+	ID string `path:"id" validate:"uuid"`
+
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+
+var BookDownload = request.Handler(func(r *BookDownloadRequest) (*ContentHandler, error) {
+	book, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Book, error) {
+		return models.BookQuery(r.Ctx).Find(tx, r.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if book == nil {
+		return nil, Err404
+	}
+
+	f, err := os.Open(book.FilePath())
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	name := path.Base(book.File)
+
+	// The ETag lets clients resume with If-Range and start over if the
+	// archive was replaced between requests.
+	etag := fmt.Sprintf(`"%s-%x-%x"`, book.ID, info.ModTime().UnixNano(), info.Size())
+
+	return NewContentHandler(name, info.ModTime(), f).
+		AddHeader("Content-Type", "application/vnd.comicbook+zip").
+		AddHeader("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name})).
+		AddHeader("ETag", etag), nil
 }).Docs(&spec.OperationProps{
-	Produces: []string{"image/jpeg", "image/png", "image/webp", "image/gif"},
+	Produces: []string{"application/vnd.comicbook+zip"},
 	Responses: &spec.Responses{ResponsesProps: spec.ResponsesProps{
-		Default: spec.NewResponse().WithDescription("An image"),
+		Default: spec.NewResponse().WithDescription("The book archive"),
 	}},
 })
 
@@ -142,32 +325,89 @@ type BookThumbnailRequest struct {
 	Logger *slog.Logger `inject:""`
 }
 
-var BookThumbnail = request.Handler(func(r *BookThumbnailRequest) (*JpegHandler, error) {
-	f, err := bookPageFile(r.Ctx, r.ID, r.Page)
+var BookThumbnail = request.Handler(bookThumbnail)
+
+func bookThumbnail(r *BookThumbnailRequest) (*JpegHandler, error) {
+	a, view, err := r.open()
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	defer a.Release()
 
-	img, _, err := image.Decode(f)
+	img, err := decodePage(r.Ctx, a, r.Page)
 	if err != nil {
 		return nil, err
 	}
-	if img.Bounds().Dy() > img.Bounds().Dx()*2 {
-		img, err = cropImage(img, image.Rect(0, 0, img.Bounds().Dx(), int(float64(img.Bounds().Dx())*math.Phi)))
-		if err != nil {
-			return nil, err
-		}
+	img, err = view.apply(img)
+	if err != nil {
+		return nil, err
+	}
+	img, err = cropThumbnail(img)
+	if err != nil {
+		return nil, err
 	}
 
 	thumbHeight := 500
-	thumbWidth := int(float64(img.Bounds().Dx()) * (float64(thumbHeight) / float64(img.Bounds().Dy())))
+	thumbWidth := thumbnailWidth(img.Bounds().Dx(), img.Bounds().Dy(), thumbHeight)
 
 	dst := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
 	draw.BiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
 
 	return NewJpegHandler(dst, time.Hour), nil
-})
+}
+
+// autoCrop reports whether a book's pages should be trimmed. The request
+// overrides the book's setting, which overrides its series'.
+func autoCrop(book *models.Book, override *bool) bool {
+	if override != nil {
+		return *override
+	}
+	if book.AutoCrop != nil {
+		return *book.AutoCrop
+	}
+	series, ok := book.Series.Value()
+	return ok && series != nil && series.AutoCrop
+}
+
+// pageCrop returns the detected crop box of a page if the book should be
+// trimmed. For half pages the box is relative to the half.
+func pageCrop(book *models.Book, ref models.PageRef, override *bool) *models.CropBox {
+	if ref.Index < 0 || ref.Index >= len(book.Pages) || !autoCrop(book, override) {
+		return nil
+	}
+	page := book.Pages[ref.Index]
+	if ref.Half != "" {
+		return page.Crop.Half(ref.Half, page.Width, page.Height)
+	}
+	return page.Crop
+}
+
+// thumbnailBounds returns the size of the part of a page shown in thumbnails.
+// Very tall pages are cropped to a golden ratio box from the top.
+func thumbnailBounds(width, height int) (int, int) {
+	if height > width*2 {
+		return width, int(float64(width) * math.Phi)
+	}
+	return width, height
+}
+
+// thumbnailWidth returns the width of a thumbnail scaled to height.
+func thumbnailWidth(width, height, thumbHeight int) int {
+	return int(float64(width) * (float64(thumbHeight) / float64(height)))
+}
+
+func cropThumbnail(img image.Image) (image.Image, error) {
+	w, h := thumbnailBounds(img.Bounds().Dx(), img.Bounds().Dy())
+	if h == img.Bounds().Dy() {
+		return img, nil
+	}
+	return cropImage(img, image.Rect(0, 0, w, h).Add(img.Bounds().Min))
+}
+
+// cropPage trims a decoded page to its detected crop box.
+func cropPage(img image.Image, crop *models.CropBox) (image.Image, error) {
+	return cropImage(img, crop.Rect().Add(img.Bounds().Min))
+}
 
 // cropImage takes an image and crops it to the specified rectangle.
 // From https://stackoverflow.com/questions/32544927/cropping-and-creating-thumbnails-with-go
@@ -187,50 +427,52 @@ func cropImage(img image.Image, crop image.Rectangle) (image.Image, error) {
 	return simg.SubImage(crop), nil
 }
 
-func bookPageFile(ctx context.Context, id string, page int) (io.ReadCloser, error) {
-	var book *models.Book
-	err := database.ReadTx(ctx, func(tx *sqlx.Tx) error {
-		var err error
-		book, err = models.BookQuery(ctx).Find(tx, id)
-		return err
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	if book == nil {
+func decodePage(ctx context.Context, a *archive.Archive, page int) (image.Image, error) {
+	img, err := a.DecodePage(ctx, page)
+	if errors.Is(err, archive.ErrPageNotFound) {
 		return nil, Err404
-	}
-	reader, err := zip.OpenReader(book.FilePath())
-	if err != nil {
+	} else if err != nil {
 		return nil, err
 	}
+	return img, nil
+}
 
-	imgs, err := models.ZippedImages(reader)
+func openBookArchive(ctx context.Context, id string) (*archive.Archive, error) {
+	bookID, err := uuid.Parse(id)
 	if err != nil {
+		return nil, Err404
+	}
+	a, err := archive.Open(ctx, bookID)
+	if errors.Is(err, archive.ErrNotFound) {
+		return nil, Err404
+	} else if err != nil {
 		return nil, err
 	}
+	return a, nil
+}
 
-	if page < 0 || page >= len(imgs) {
+func bookPageFile(a *archive.Archive, page int) (io.ReadCloser, error) {
+	f, err := a.Page(page)
+	if errors.Is(err, archive.ErrPageNotFound) {
 		return nil, Err404
-	}
-	f, err := imgs[page].Open()
-	if err != nil {
+	} else if err != nil {
 		return nil, err
 	}
 	return f, nil
 }
 
 type BookUpdateRequest struct {
-	ID          string            `path:"id"          validate:"require|uuid"`
-	Title       string            `json:"title"`
-	SeriesSlug  string            `json:"series_slug" validate:"require"`
-	Volume      *nulls.Float64    `json:"volume"`
-	Chapter     *nulls.Float64    `json:"chapter"`
-	RightToLeft bool              `json:"rtl"        validate:"require"`
-	LongStrip   bool              `json:"long_strip" validate:"require"`
-	Pages       []PageUpdate      `json:"pages"      validate:"require"`
-	UpdateMap   map[string]string `json:"update_map" validate:"require"`
+	ID           string            `path:"id"          validate:"require|uuid"`
+	Title        string            `json:"title"`
+	SeriesSlug   string            `json:"series_slug" validate:"require"`
+	Volume       *nulls.Float64    `json:"volume"`
+	Chapter      *nulls.Float64    `json:"chapter"`
+	RightToLeft  bool              `json:"rtl"        validate:"require"`
+	LongStrip    bool              `json:"long_strip" validate:"require"`
+	AutoCrop     *bool             `json:"auto_crop"`
+	SplitSpreads bool              `json:"split_spreads"`
+	Pages        []PageUpdate      `json:"pages"      validate:"require"`
+	UpdateMap    map[string]string `json:"update_map" validate:"require"`
 
 	Ctx context.Context `inject:""`
 }
@@ -241,6 +483,7 @@ type PageUpdate struct {
 
 var BookUpdate = request.Handler(func(r *BookUpdateRequest) (*models.Book, error) {
 	book := &models.Book{}
+	clearCache := false
 	err := database.UpdateTx(r.Ctx, func(tx *sqlx.Tx) error {
 		var err error
 		book, err = models.BookQuery(r.Ctx).With("UserBook").Find(tx, r.ID)
@@ -266,26 +509,74 @@ var BookUpdate = request.Handler(func(r *BookUpdateRequest) (*models.Book, error
 		if shouldUpdate(book.UpdateMap, r.UpdateMap, "long_strip") {
 			book.LongStrip = r.LongStrip
 		}
+		if shouldUpdate(book.UpdateMap, r.UpdateMap, "auto_crop") {
+			clearCache = !reflect.DeepEqual(book.AutoCrop, r.AutoCrop)
+			book.AutoCrop = r.AutoCrop
+		}
 
 		if shouldUpdate(book.UpdateMap, r.UpdateMap, "pages") {
-			if len(book.Pages) != len(r.Pages) {
-				return NewHttpError(422, fmt.Errorf("expected %d pages, received %d", len(book.Pages), len(r.Pages)))
-			}
+			refs := book.PageRefs()
+			types := make([]models.PageType, len(r.Pages))
 			for i, page := range r.Pages {
 				if models.IsEnumValid(models.PageType(""), page.Type) {
-					book.Pages[i].Type = models.PageType(page.Type)
+					types[i] = models.PageType(page.Type)
+				} else if i < len(refs) {
+					types[i] = book.Pages[refs[i].Index].Type
 				}
 			}
+			err = book.SetPageTypes(types)
+			if err != nil {
+				return NewHttpError(422, err)
+			}
+			for _, page := range book.Pages {
+				page.Confidence = 1
+			}
+			book.TypeConfidence = 1
+		}
+
+		// The client's pages are in the layout it already had so split spreads
+		// are toggled after the pages are updated.
+		var oldLayout []models.PageRef
+		if shouldUpdate(book.UpdateMap, r.UpdateMap, "split_spreads") && book.SplitSpreads != r.SplitSpreads {
+			oldLayout = book.PageRefs()
+			book.SplitSpreads = r.SplitSpreads
+			clearCache = true
+		}
+
+		err = model.SaveContext(r.Ctx, tx, book)
+		if err != nil {
+			return err
 		}
 
-		return model.SaveContext(r.Ctx, tx, book)
+		if oldLayout != nil {
+			return book.TranslateProgress(r.Ctx, tx, oldLayout)
+		}
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+
+	if clearCache {
+		clearBookCache(r.Ctx, book.ID)
+	} else {
+		archive.Invalidate(book.ID)
+	}
 	return book, nil
 })
 
+// clearBookCache removes the cached archives, thumbnails and sprites of books
+// so they are rendered again with the books' current settings.
+func clearBookCache(ctx context.Context, ids ...uuid.UUID) {
+	archive.Invalidate(ids...)
+	for _, id := range ids {
+		err := middleware.ClearCache(path.Join("/api/books", id.String()))
+		if err != nil {
+			clog.Use(ctx).Warn("failed to clear book cache", "book", id, "err", err)
+		}
+	}
+}
+
 type BookDeleteRequest struct {
 	ID   string `path:"id" validate:"require|uuid"`
 	File bool   `json:"file"`
@@ -323,6 +614,8 @@ var BookDelete = request.Handler(func(r *BookDeleteRequest) (*BookDeleteResponse
 		return nil, err
 	}
 
+	archive.Invalidate(uuid.MustParse(r.ID))
+
 	return &BookDeleteResponse{
 		Success: true,
 	}, nil
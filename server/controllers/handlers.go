@@ -21,18 +21,31 @@ type Stater interface {
 func init() {
 	openapidoc.RegisterResponse[*JpegHandler](spec.NewResponse().WithDescription("A JPEG encoded image"))
 	openapidoc.RegisterContentType[*JpegHandler]("image/jpeg")
+	openapidoc.RegisterResponse[*ContentHandler](spec.NewResponse().WithDescription("The file contents"))
+	openapidoc.RegisterContentType[*ContentHandler]("application/octet-stream")
 }
 
 type JpegHandler struct {
 	img           image.Image
 	cacheLifetime time.Duration
+	header        http.Header
 }
 
 func NewJpegHandler(img image.Image, cacheLifetime time.Duration) *JpegHandler {
-	return &JpegHandler{img: img, cacheLifetime: cacheLifetime}
+	return &JpegHandler{img: img, cacheLifetime: cacheLifetime, header: http.Header{}}
+}
+
+func (h *JpegHandler) AddHeader(key, value string) *JpegHandler {
+	h.header.Add(key, value)
+	return h
 }
 
 func (h *JpegHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for k, vs := range h.header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
 	if h.cacheLifetime != 0 {
 		w.Header().Add("Cache-Control", fmt.Sprintf("max-age=%d", h.cacheLifetime/time.Second))
 	}
@@ -96,3 +109,46 @@ func (h *ReaderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		clog.Use(r.Context()).Warn("failed to write", "err", err)
 	}
 }
+
+// ContentHandler serves a seekable reader with http.ServeContent so Range,
+// If-Range and conditional requests are handled for us.
+type ContentHandler struct {
+	name    string
+	modtime time.Time
+	content io.ReadSeeker
+	header  http.Header
+}
+
+func NewContentHandler(name string, modtime time.Time, content io.ReadSeeker) *ContentHandler {
+	return &ContentHandler{
+		name:    name,
+		modtime: modtime,
+		content: content,
+		header:  http.Header{},
+	}
+}
+
+func (h *ContentHandler) AddHeaderCacheMaxAge(ttl time.Duration) *ContentHandler {
+	h.AddHeader("Cache-Control", fmt.Sprintf("max-age=%d", ttl/time.Second))
+	return h
+}
+func (h *ContentHandler) AddHeader(key, value string) *ContentHandler {
+	h.header.Add(key, value)
+	return h
+}
+
+func (h *ContentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if c, ok := h.content.(io.Closer); ok {
+			c.Close()
+		}
+	}()
+
+	for k, vs := range h.header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	http.ServeContent(w, r, h.name, h.modtime, h.content)
+}
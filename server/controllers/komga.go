@@ -0,0 +1,555 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	"github.com/abibby/comicbox-3/server/komga"
+	"github.com/abibby/nulls"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/builder"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/request"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// komgaLibraryID is the ID of the only library, Komga clients expect books to
+// be split into libraries.
+const komgaLibraryID = "comicbox"
+
+type KomgaPageRequest struct {
+	Page    int        `query:"page"    validate:"min:0"`
+	Size    *nulls.Int `query:"size"    validate:"min:1"`
+	Unpaged bool       `query:"unpaged"`
+	Sort    string     `query:"sort"`
+
+	Ctx  context.Context `inject:""`
+	Read salusadb.Read   `inject:""`
+}
+
+// komgaList runs a paginated query with Komga's page parameters, pages start
+// at 0 and unpaged returns every result.
+func komgaList[T model.Model, D any](r *KomgaPageRequest, query *builder.ModelBuilder[T], convert func(tx *sqlx.Tx, data []T, offset int) ([]D, error)) (*komga.Page[D], error) {
+	size := 20
+	if s, ok := r.Size.Ok(); ok {
+		size = s
+	}
+	page := r.Page
+	if r.Unpaged {
+		size = math.MaxInt32
+		page = 0
+	}
+	resp, err := paginatedList(&PaginatedRequest{
+		Page:     nulls.NewInt(page + 1),
+		PageSize: nulls.NewInt(size),
+		Ctx:      r.Ctx,
+		Read:     r.Read,
+	}, query)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) ([]D, error) {
+		return convert(tx, resp.Data, page*size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Unpaged {
+		size = max(resp.Total, len(content))
+	}
+	return komga.NewPage(content, page, size, resp.Total), nil
+}
+
+// komgaSeriesOrder applies a Komga sort parameter like "lastModified,desc"
+// to a series query.
+func komgaSeriesOrder(query *builder.ModelBuilder[*models.Series], sort string) *builder.ModelBuilder[*models.Series] {
+	field, dir, _ := strings.Cut(sort, ",")
+	column := "display_name"
+	switch field {
+	case "created":
+		column = "created_at"
+	case "lastModified":
+		column = "updated_at"
+	}
+	if strings.EqualFold(dir, "desc") {
+		return query.OrderByDesc(column)
+	}
+	return query.OrderBy(column)
+}
+
+// komgaReadingDirection returns the series' reading direction. Settings the
+// series leaves to be detected are taken from its first book.
+func komgaReadingDirection(series *models.Series, books []*models.Book) string {
+	longStrip, rtl := series.LongStrip, series.RightToLeft
+	if len(books) > 0 {
+		if longStrip == nil {
+			longStrip = &books[0].LongStrip
+		}
+		if rtl == nil {
+			rtl = &books[0].RightToLeft
+		}
+	}
+	switch {
+	case longStrip != nil && *longStrip:
+		return komga.Webtoon
+	case rtl != nil && *rtl:
+		return komga.RightToLeft
+	default:
+		return komga.LeftToRight
+	}
+}
+
+// komgaCompleted reports whether a book counts as read. It matches the
+// books UpdateUserSeriesLatestBookID skips.
+func komgaCompleted(book *models.Book, ub *models.UserBook) bool {
+	return ub != nil && ub.CurrentPage >= book.PageCount-1
+}
+
+func komgaAuthors(authors []string) []*komga.Author {
+	result := make([]*komga.Author, len(authors))
+	for i, a := range authors {
+		result[i] = &komga.Author{Name: a, Role: "writer"}
+	}
+	return result
+}
+
+// komgaSeriesList converts series along with the reading counts of their
+// books.
+func komgaSeriesList(ctx context.Context, tx *sqlx.Tx, series []*models.Series) ([]*komga.Series, error) {
+	slugs := make([]any, len(series))
+	for i, s := range series {
+		slugs[i] = s.Slug
+	}
+	books := []*models.Book{}
+	if len(slugs) > 0 {
+		var err error
+		books, err = models.BookQuery(ctx).
+			WhereIn("series", slugs).
+			With("UserBook").
+			OrderBy("sort").
+			Get(tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	booksBySeries := map[string][]*models.Book{}
+	for _, b := range books {
+		booksBySeries[b.SeriesSlug] = append(booksBySeries[b.SeriesSlug], b)
+	}
+
+	result := make([]*komga.Series, len(series))
+	for i, s := range series {
+		result[i] = komgaSeries(s, booksBySeries[s.Slug])
+	}
+	return result, nil
+}
+
+func komgaSeries(s *models.Series, books []*models.Book) *komga.Series {
+	created := komga.Time(s.CreatedAt.Time())
+	modified := komga.Time(s.UpdatedAt.Time())
+	result := &komga.Series{
+		ID:               s.Slug,
+		LibraryID:        komgaLibraryID,
+		Name:             s.Name,
+		URL:              s.Directory,
+		Created:          created,
+		LastModified:     modified,
+		FileLastModified: modified,
+		BooksCount:       len(books),
+		Metadata: &komga.SeriesMetadata{
+			Status:           "ONGOING",
+			Title:            s.Name,
+			TitleSort:        s.Name,
+			Summary:          s.Description,
+			ReadingDirection: komgaReadingDirection(s, books),
+			Publisher:        s.Publisher,
+			Genres:           nonNil(s.Genres),
+			Tags:             nonNil(s.Tags),
+			Created:          created,
+			LastModified:     modified,
+		},
+		BooksMetadata: &komga.BookMetadataAggregation{
+			Authors:      []*komga.Author{},
+			Tags:         []string{},
+			Summary:      s.Description,
+			Created:      created,
+			LastModified: modified,
+		},
+	}
+	if y, ok := s.Year.Ok(); ok {
+		date := fmt.Sprintf("%04d-01-01", y)
+		result.BooksMetadata.ReleaseDate = &date
+	}
+
+	authors := map[string]bool{}
+	for _, b := range books {
+		for _, a := range b.Authors {
+			if !authors[a] {
+				authors[a] = true
+				result.BooksMetadata.Authors = append(result.BooksMetadata.Authors, &komga.Author{Name: a, Role: "writer"})
+			}
+		}
+
+		ub, _ := b.UserBook.Value()
+		switch {
+		case komgaCompleted(b, ub):
+			result.BooksReadCount++
+		case ub != nil && ub.CurrentPage > 0:
+			result.BooksInProgressCount++
+		default:
+			result.BooksUnreadCount++
+		}
+	}
+	return result
+}
+
+// komgaBook converts a book. Books without a chapter or volume are numbered
+// by their position in the series.
+func komgaBook(book *models.Book, position int) *komga.Book {
+	number := float64(position)
+	if v, ok := book.Chapter.Ok(); ok {
+		number = v
+	} else if v, ok := book.Volume.Ok(); ok {
+		number = v
+	}
+
+	seriesTitle := book.SeriesSlug
+	if series, ok := book.Series.Value(); ok && series != nil {
+		seriesTitle = series.Name
+	}
+
+	created := komga.Time(book.CreatedAt.Time())
+	modified := komga.Time(book.UpdatedAt.Time())
+	fileModified := modified
+	if book.FileModTime != nil {
+		fileModified = komga.Time(book.FileModTime.Time())
+	}
+	result := &komga.Book{
+		ID:               book.ID.String(),
+		SeriesID:         book.SeriesSlug,
+		SeriesTitle:      seriesTitle,
+		LibraryID:        komgaLibraryID,
+		Name:             opdsBookTitle(book),
+		URL:              book.File,
+		Number:           number,
+		Created:          created,
+		LastModified:     modified,
+		FileLastModified: fileModified,
+		SizeBytes:        book.FileSize,
+		Size:             komga.FormatSize(book.FileSize),
+		FileHash:         book.FileDigest,
+		Media: &komga.Media{
+			Status:       "READY",
+			MediaType:    "application/zip",
+			MediaProfile: "DIVINA",
+			PagesCount:   len(opdsPages(book)),
+		},
+		Metadata: &komga.BookMetadata{
+			Title:        opdsBookTitle(book),
+			Number:       fmt.Sprint(number),
+			NumberSort:   number,
+			Authors:      komgaAuthors(book.Authors),
+			Tags:         []string{},
+			Created:      created,
+			LastModified: modified,
+		},
+	}
+
+	if ub, ok := book.UserBook.Value(); ok && ub != nil {
+		updated := komga.Time(ub.UpdatedAt.Time())
+		result.ReadProgress = &komga.ReadProgress{
+			Page:         min(opdsLastRead(book, ub.CurrentPage)+1, result.Media.PagesCount),
+			Completed:    komgaCompleted(book, ub),
+			ReadDate:     updated,
+			Created:      komga.Time(ub.CreatedAt.Time()),
+			LastModified: updated,
+		}
+	}
+	return result
+}
+
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+type KomgaLibrariesRequest struct{}
+
+var KomgaLibraries = request.Handler(func(r *KomgaLibrariesRequest) ([]*komga.Library, error) {
+	return []*komga.Library{
+		{ID: komgaLibraryID, Name: "comicbox"},
+	}, nil
+})
+
+type KomgaSeriesListRequest struct {
+	KomgaPageRequest
+	Search string `query:"search"`
+}
+
+// komgaSeriesIndex returns a handler listing series, sort is used when the
+// request doesn't set one.
+func komgaSeriesIndex(sort string) http.Handler {
+	return request.Handler(func(r *KomgaSeriesListRequest) (*komga.Page[*komga.Series], error) {
+		query := models.SeriesQuery(r.Ctx)
+		if search := strings.TrimSpace(r.Search); search != "" {
+			query = query.Where("display_name", "like", "%"+search+"%")
+		}
+		if r.Sort != "" {
+			sort = r.Sort
+		}
+		query = komgaSeriesOrder(query, sort)
+
+		return komgaList(&r.KomgaPageRequest, query, func(tx *sqlx.Tx, series []*models.Series, offset int) ([]*komga.Series, error) {
+			return komgaSeriesList(r.Ctx, tx, series)
+		})
+	})
+}
+
+var (
+	KomgaSeriesIndex   = komgaSeriesIndex("metadata.titleSort,asc")
+	KomgaSeriesNew     = komgaSeriesIndex("created,desc")
+	KomgaSeriesUpdated = komgaSeriesIndex("lastModified,desc")
+)
+
+type KomgaSeriesRequest struct {
+	Slug string `path:"seriesId"`
+
+	Ctx  context.Context `inject:""`
+	Read salusadb.Read   `inject:""`
+}
+
+var KomgaSeries = request.Handler(func(r *KomgaSeriesRequest) (*komga.Series, error) {
+	return salusadb.Value(r.Read, func(tx *sqlx.Tx) (*komga.Series, error) {
+		series, err := models.SeriesQuery(r.Ctx).Find(tx, r.Slug)
+		if err != nil {
+			return nil, err
+		}
+		if series == nil {
+			return nil, Err404
+		}
+		result, err := komgaSeriesList(r.Ctx, tx, []*models.Series{series})
+		if err != nil {
+			return nil, err
+		}
+		return result[0], nil
+	})
+})
+
+type KomgaSeriesBooksRequest struct {
+	KomgaPageRequest
+	Slug string `path:"seriesId"`
+}
+
+var KomgaSeriesBooks = request.Handler(func(r *KomgaSeriesBooksRequest) (*komga.Page[*komga.Book], error) {
+	query := opdsBookQuery(r.Ctx).
+		Where("series", "=", r.Slug)
+	if strings.HasSuffix(strings.ToLower(r.Sort), ",desc") {
+		query = query.OrderByDesc("sort")
+	} else {
+		query = query.OrderBy("sort")
+	}
+
+	return komgaList(&r.KomgaPageRequest, query, func(tx *sqlx.Tx, books []*models.Book, offset int) ([]*komga.Book, error) {
+		result := make([]*komga.Book, len(books))
+		for i, b := range books {
+			result[i] = komgaBook(b, offset+i+1)
+		}
+		return result, nil
+	})
+})
+
+type KomgaBookRequest struct {
+	ID uuid.UUID `path:"bookId"`
+
+	Ctx  context.Context `inject:""`
+	Read salusadb.Read   `inject:""`
+}
+
+var KomgaBook = request.Handler(func(r *KomgaBookRequest) (*komga.Book, error) {
+	return salusadb.Value(r.Read, func(tx *sqlx.Tx) (*komga.Book, error) {
+		book, err := opdsBookQuery(r.Ctx).Find(tx, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		if book == nil {
+			return nil, Err404
+		}
+		before, err := models.BookQuery(r.Ctx).
+			Where("series", "=", book.SeriesSlug).
+			Where("sort", "<", book.Sort).
+			Count(tx)
+		if err != nil {
+			return nil, err
+		}
+		return komgaBook(book, before+1), nil
+	})
+})
+
+var KomgaBookPages = request.Handler(func(r *KomgaBookRequest) ([]*komga.BookPage, error) {
+	book, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Book, error) {
+		return models.BookQuery(r.Ctx).With("Series").Find(tx, r.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if book == nil {
+		return nil, Err404
+	}
+
+	refs := opdsPages(book)
+	pages := make([]*komga.BookPage, len(refs))
+	for i, ref := range refs {
+		width, height := opdsPageSize(book, ref)
+		page := &komga.BookPage{
+			Number:    i + 1,
+			FileName:  fmt.Sprintf("%04d.jpg", i+1),
+			MediaType: opdsPageType(book, ref),
+			Width:     width,
+			Height:    height,
+		}
+		if ref.Index < len(book.PageEntries) {
+			entry := book.PageEntries[ref.Index]
+			page.FileName = path.Base(entry.Name)
+			if ref.Half == "" && pageCrop(book, ref, nil) == nil {
+				page.SizeBytes = entry.Size
+			}
+		}
+		pages[i] = page
+	}
+	return pages, nil
+})
+
+type KomgaBookPageRequest struct {
+	ID   uuid.UUID `path:"bookId"`
+	Page int       `path:"pageNumber" validate:"min:1"`
+
+	Request *http.Request   `inject:""`
+	Ctx     context.Context `inject:""`
+}
+
+// KomgaBookPage serves pages counted from 1, in the same order as OPDS page
+// streaming.
+var KomgaBookPage = request.Handler(func(r *KomgaBookPageRequest) (http.Handler, error) {
+	return opdsPage(&OPDSPageRequest{
+		ID:      r.ID,
+		Page:    r.Page - 1,
+		Request: r.Request,
+		Ctx:     r.Ctx,
+	})
+})
+
+var KomgaBookThumbnail = request.Handler(func(r *KomgaBookRequest) (*JpegHandler, error) {
+	a, err := openBookArchive(r.Ctx, r.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer a.Release()
+
+	return bookThumbnail(&BookThumbnailRequest{
+		BookPageRequest: BookPageRequest{
+			ID:   r.ID.String(),
+			Page: a.Book().CoverPage(),
+			Ctx:  r.Ctx,
+		},
+	})
+})
+
+type KomgaSeriesThumbnailRequest struct {
+	Slug string `path:"seriesId"`
+
+	Ctx  context.Context `inject:""`
+	Read salusadb.Read   `inject:""`
+}
+
+// KomgaSeriesThumbnail serves the series cover, or the cover of its first
+// book for series without one.
+var KomgaSeriesThumbnail = request.Handler(func(r *KomgaSeriesThumbnailRequest) (any, error) {
+	var book *models.Book
+	series, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Series, error) {
+		series, err := models.SeriesQuery(r.Ctx).Find(tx, r.Slug)
+		if err != nil || series == nil || series.CoverImage != "" {
+			return series, err
+		}
+		book, err = models.BookQuery(r.Ctx).Where("series", "=", r.Slug).OrderBy("sort").First(tx)
+		return series, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if series == nil {
+		return nil, Err404
+	}
+	if book == nil {
+		f, err := os.Open(series.CoverImagePath())
+		if err != nil {
+			return nil, err
+		}
+		return request.NewResponse(f), nil
+	}
+	return bookThumbnail(&BookThumbnailRequest{
+		BookPageRequest: BookPageRequest{
+			ID:   book.ID.String(),
+			Page: book.CoverPage(),
+			Ctx:  r.Ctx,
+		},
+	})
+})
+
+type KomgaReadProgressUpdateRequest struct {
+	ID        uuid.UUID `path:"bookId"`
+	Page      *int      `json:"page"      validate:"min:1"`
+	Completed *bool     `json:"completed"`
+
+	Ctx context.Context `inject:""`
+}
+
+// KomgaReadProgressUpdate saves the page a Komga client is at. Saving the
+// user book updates the series' latest book the same as the web app does.
+var KomgaReadProgressUpdate = request.Handler(func(r *KomgaReadProgressUpdateRequest) (*request.ResponseBuilder, error) {
+	uid, ok := auth.UserID(r.Ctx)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	err := database.UpdateTx(r.Ctx, func(tx *sqlx.Tx) error {
+		book, err := models.BookQuery(r.Ctx).Find(tx, r.ID)
+		if err != nil {
+			return err
+		}
+		if book == nil {
+			return Err404
+		}
+
+		ub, err := models.FindUserBook(r.Ctx, tx, uid, book.ID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case r.Completed != nil && *r.Completed:
+			ub.SetCurrentPage(max(book.PageCount-1, 0))
+		case r.Page != nil:
+			ub.SetCurrentPage(opdsCurrentPage(book, *r.Page-1))
+		case r.Completed != nil:
+			ub.SetCurrentPage(0)
+		default:
+			return nil
+		}
+		return model.SaveContext(r.Ctx, tx, ub)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request.NewResponse(http.NoBody).SetStatus(http.StatusNoContent), nil
+})
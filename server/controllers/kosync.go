@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	"github.com/abibby/comicbox-3/server/kosync"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/request"
+	"github.com/abibby/salusa/router"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// kosyncDevice is reported as the device for positions that weren't synced
+// from KOReader, so KOReader never mistakes them for its own.
+const kosyncDevice = "comicbox"
+
+// KosyncAuthMiddleware signs in KOReader with the x-auth-user and x-auth-key
+// headers. The key is the MD5 of the user's password.
+func KosyncAuthMiddleware() router.InlineMiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		username := r.Header.Get("x-auth-user")
+		key := r.Header.Get("x-auth-key")
+		if username == "" || key == "" {
+			sendError(w, kosync.ErrUnauthorized)
+			return
+		}
+		claims, err := credentialClaims(r.Context(), "kosync", username, key, func(u *models.User) []byte {
+			return u.KosyncKeyHash
+		})
+		if err == ErrUnauthorized {
+			sendError(w, kosync.ErrUnauthorized)
+			return
+		} else if err != nil {
+			sendError(w, err)
+			return
+		}
+		next.ServeHTTP(w, auth.WithClaims(r, claims))
+	}
+}
+
+// addKosyncKey saves the KOReader key for users created before KOReader sync
+// was supported, the first time their password is seen.
+func addKosyncKey(ctx context.Context, u *models.User, password string) error {
+	err := u.SetKosyncKey(kosync.Key(password))
+	if err != nil {
+		return err
+	}
+	return database.UpdateTx(ctx, func(tx *sqlx.Tx) error {
+		return model.SaveContext(ctx, tx, u)
+	})
+}
+
+type KosyncRegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	Ctx context.Context `inject:""`
+}
+type KosyncRegisterResponse struct {
+	Username string `json:"username"`
+}
+
+// KosyncRegister creates an account from KOReader. KOReader only sends the
+// MD5 of the password, so the web app password of these accounts is the key
+// itself until it is changed.
+var KosyncRegister = request.Handler(func(r *KosyncRegisterRequest) (*request.JSONResponse, error) {
+	if !config.PublicUserCreate {
+		return nil, kosync.ErrRegistrationDisabled
+	}
+	if r.Username == "" || r.Password == "" {
+		return nil, kosync.ErrInvalidRequest
+	}
+
+	u := &models.User{
+		ID:       uuid.New(),
+		Username: r.Username,
+		RoleID:   models.RoleReaderID,
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(r.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	u.PasswordHash = hash
+	err = u.SetKosyncKey(r.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.UpdateTx(r.Ctx, func(tx *sqlx.Tx) error {
+		count := 0
+		err := models.UserQuery(r.Ctx).
+			SelectFunction("count", "*").
+			Where("username", "=", strings.ToLower(u.Username)).
+			Load(tx, &count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return kosync.ErrUserExists
+		}
+		return model.SaveContext(r.Ctx, tx, u)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return request.NewJSONResponse(&KosyncRegisterResponse{Username: u.Username}).
+		SetStatus(http.StatusCreated), nil
+})
+
+type KosyncAuthRequest struct{}
+type KosyncAuthResponse struct {
+	Authorized string `json:"authorized"`
+}
+
+// KosyncAuth lets KOReader check its credentials, the middleware does the
+// checking.
+var KosyncAuth = request.Handler(func(r *KosyncAuthRequest) (*KosyncAuthResponse, error) {
+	return &KosyncAuthResponse{Authorized: "OK"}, nil
+})
+
+type KosyncHealthcheckRequest struct{}
+type KosyncHealthcheckResponse struct {
+	State string `json:"state"`
+}
+
+var KosyncHealthcheck = request.Handler(func(r *KosyncHealthcheckRequest) (*KosyncHealthcheckResponse, error) {
+	return &KosyncHealthcheckResponse{State: "OK"}, nil
+})
+
+type KosyncProgressRequest struct {
+	Document string `path:"document"`
+
+	Ctx context.Context `inject:""`
+}
+type KosyncProgressResponse struct {
+	Document   string  `json:"document,omitempty"`
+	Progress   string  `json:"progress,omitempty"`
+	Percentage float64 `json:"percentage,omitempty"`
+	Device     string  `json:"device,omitempty"`
+	DeviceID   string  `json:"device_id,omitempty"`
+	Timestamp  int64   `json:"timestamp,omitempty"`
+}
+
+// KosyncProgress returns the position of a book for KOReader. Books that
+// aren't in the library or haven't been started return an empty object.
+var KosyncProgress = request.Handler(func(r *KosyncProgressRequest) (*KosyncProgressResponse, error) {
+	resp := &KosyncProgressResponse{}
+	err := database.ReadTx(r.Ctx, func(tx *sqlx.Tx) error {
+		book, err := models.BookQuery(r.Ctx).
+			Where("file_digest", "=", r.Document).
+			With("UserBook").
+			First(tx)
+		if err != nil {
+			return err
+		}
+		if book == nil {
+			return nil
+		}
+		ub, ok := book.UserBook.Value()
+		if !ok || ub == nil {
+			return nil
+		}
+		resp = kosyncProgress(book, ub)
+		resp.Document = r.Document
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+})
+
+type KosyncProgressUpdateRequest struct {
+	Document   string  `json:"document"`
+	Progress   string  `json:"progress"`
+	Percentage float64 `json:"percentage"`
+	Device     string  `json:"device"`
+	DeviceID   string  `json:"device_id"`
+
+	Ctx context.Context `inject:""`
+}
+type KosyncProgressUpdateResponse struct {
+	Document  string `json:"document"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// KosyncProgressUpdate saves the position KOReader is at in a book as the
+// user's current page.
+var KosyncProgressUpdate = request.Handler(func(r *KosyncProgressUpdateRequest) (*KosyncProgressUpdateResponse, error) {
+	uid, ok := auth.UserID(r.Ctx)
+	if !ok {
+		return nil, kosync.ErrUnauthorized
+	}
+	if r.Document == "" {
+		return nil, kosync.ErrNoDocument
+	}
+	if r.Progress == "" || r.Device == "" {
+		return nil, kosync.ErrInvalidRequest
+	}
+
+	var resp *KosyncProgressUpdateResponse
+	err := database.UpdateTx(r.Ctx, func(tx *sqlx.Tx) error {
+		book, err := models.BookQuery(r.Ctx).Where("file_digest", "=", r.Document).First(tx)
+		if err != nil {
+			return err
+		}
+		if book == nil {
+			return kosync.ErrUnknownDocument
+		}
+
+		ub, err := models.FindUserBook(r.Ctx, tx, uid, book.ID)
+		if err != nil {
+			return err
+		}
+
+		ub.SetCurrentPage(kosyncCurrentPage(book, r.Progress, r.Percentage))
+		ub.Kosync = &models.KosyncPosition{
+			Progress:    r.Progress,
+			Percentage:  r.Percentage,
+			Device:      r.Device,
+			DeviceID:    r.DeviceID,
+			CurrentPage: ub.CurrentPage,
+		}
+		err = model.SaveContext(r.Ctx, tx, ub)
+		if err != nil {
+			return err
+		}
+
+		resp = &KosyncProgressUpdateResponse{
+			Document:  r.Document,
+			Timestamp: ub.UpdatedAt.Time().Unix(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+})
+
+// kosyncCurrentPage converts KOReader's position to a current page. For
+// comic archives KOReader's progress is the 1 based page number in the
+// archive, the percentage is used if it isn't.
+func kosyncCurrentPage(book *models.Book, progress string, percentage float64) int {
+	page, err := strconv.Atoi(progress)
+	if err == nil {
+		page--
+	} else {
+		page = int(math.Floor(percentage * float64(len(book.Pages))))
+	}
+	return archiveCurrentPage(book, page)
+}
+
+// archiveCurrentPage converts the 0 based index of a page in the archive to a
+// current page, readers that open the archive themselves count pages this
+// way.
+func archiveCurrentPage(book *models.Book, page int) int {
+	refs := book.PageRefs()
+	for i, ref := range refs {
+		if ref.Index >= page {
+			return i
+		}
+	}
+	return max(len(refs)-1, 0)
+}
+
+// kosyncProgress converts a user's current page to a KOReader position. The
+// position KOReader sent is returned as is until the page is changed by
+// another reader.
+func kosyncProgress(book *models.Book, ub *models.UserBook) *KosyncProgressResponse {
+	timestamp := ub.UpdatedAt.Time().Unix()
+	if p := ub.Kosync; p != nil && p.CurrentPage == ub.CurrentPage {
+		return &KosyncProgressResponse{
+			Progress:   p.Progress,
+			Percentage: p.Percentage,
+			Device:     p.Device,
+			DeviceID:   p.DeviceID,
+			Timestamp:  timestamp,
+		}
+	}
+
+	page := 0
+	if refs := book.PageRefs(); len(refs) > 0 {
+		page = refs[min(max(ub.CurrentPage, 0), len(refs)-1)].Index
+	}
+	percentage := 0.0
+	if len(book.Pages) > 0 {
+		percentage = float64(page+1) / float64(len(book.Pages))
+	}
+	return &KosyncProgressResponse{
+		Progress:   strconv.Itoa(page + 1),
+		Percentage: math.Round(percentage*10000) / 10000,
+		Device:     kosyncDevice,
+		DeviceID:   kosyncDevice,
+		Timestamp:  timestamp,
+	}
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// testBook has a deleted second page and a spread split into two pages, its
+// reading layout is 0, 1, 2 left, 2 right, 3.
+func testBook() *models.Book {
+	page := func(typ models.PageType) *models.Page {
+		return &models.Page{BasePage: models.BasePage{Type: typ}}
+	}
+	return &models.Book{
+		Pages: []*models.Page{
+			page(models.PageTypeStory),
+			page(models.PageTypeDeleted),
+			page(models.PageTypeSpread),
+			page(models.PageTypeStory),
+		},
+		SplitSpreads: true,
+	}
+}
+
+func TestKosyncCurrentPage(t *testing.T) {
+	testCases := []struct {
+		name       string
+		progress   string
+		percentage float64
+		page       int
+	}{
+		{name: "first page", progress: "1", page: 0},
+		{name: "deleted page", progress: "2", page: 1},
+		{name: "spread shows its first half", progress: "3", page: 2},
+		{name: "page after a spread", progress: "4", page: 4},
+		{name: "past the end", progress: "99", page: 4},
+		{name: "before the start", progress: "0", page: 0},
+		{name: "percentage", progress: "/body/DocFragment[3]", percentage: 0.5, page: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.page, kosyncCurrentPage(testBook(), tc.progress, tc.percentage))
+		})
+	}
+}
+
+func TestKosyncProgress(t *testing.T) {
+	updatedAt := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	sent := &models.KosyncPosition{
+		Progress:    "/body/DocFragment[3]",
+		Percentage:  0.5,
+		Device:      "kobo",
+		DeviceID:    "abc",
+		CurrentPage: 2,
+	}
+
+	testCases := []struct {
+		name        string
+		currentPage int
+		kosync      *models.KosyncPosition
+		progress    *KosyncProgressResponse
+	}{
+		{
+			name:        "returns the position koreader sent",
+			currentPage: 2,
+			kosync:      sent,
+			progress:    &KosyncProgressResponse{Progress: "/body/DocFragment[3]", Percentage: 0.5, Device: "kobo", DeviceID: "abc"},
+		},
+		{
+			name:        "page changed by another reader",
+			currentPage: 3,
+			kosync:      sent,
+			progress:    &KosyncProgressResponse{Progress: "3", Percentage: 0.75, Device: kosyncDevice, DeviceID: kosyncDevice},
+		},
+		{
+			name:        "no koreader position",
+			currentPage: 4,
+			progress:    &KosyncProgressResponse{Progress: "4", Percentage: 1, Device: kosyncDevice, DeviceID: kosyncDevice},
+		},
+		{
+			name:        "past the end",
+			currentPage: 99,
+			progress:    &KosyncProgressResponse{Progress: "4", Percentage: 1, Device: kosyncDevice, DeviceID: kosyncDevice},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ub := &models.UserBook{CurrentPage: tc.currentPage, Kosync: tc.kosync}
+			ub.UpdatedAt = database.TimeFrom(updatedAt)
+			tc.progress.Timestamp = updatedAt.Unix()
+			assert.Equal(t, tc.progress, kosyncProgress(testBook(), ub))
+		})
+	}
+}
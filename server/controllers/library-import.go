@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	"github.com/abibby/comicbox-3/server/importer"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/request"
+	"github.com/jmoiron/sqlx"
+)
+
+type LibraryImportRequest struct {
+	Source importer.Source `json:"source"`
+	// Path is where the server can read the other server's SQLite database
+	// or a JSON export.
+	Path string `json:"path"`
+	// Commit saves the import, without it the report of what would be
+	// imported is returned and nothing is changed.
+	Commit bool `json:"commit"`
+
+	Read   salusadb.Read   `inject:""`
+	Update salusadb.Update `inject:""`
+	Ctx    context.Context `inject:""`
+}
+
+type LibraryImportResponse struct {
+	Committed bool                 `json:"committed"`
+	Users     []*LibraryImportUser `json:"users"`
+	Books     int                  `json:"books"`
+	// Progress is the number of books with progress to import.
+	Progress int                  `json:"progress"`
+	Lists    []*LibraryImportList `json:"lists"`
+
+	UnmatchedUsers  []string             `json:"unmatched_users"`
+	UnmatchedSeries []string             `json:"unmatched_series"`
+	UnmatchedBooks  []string             `json:"unmatched_books"`
+	UnmatchedLists  []*LibraryImportList `json:"unmatched_lists"`
+}
+
+type LibraryImportUser struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type LibraryImportList struct {
+	Kind importer.ListKind `json:"kind"`
+	Name string            `json:"name"`
+	// List is the list the series are added to.
+	List   models.List `json:"list"`
+	Series int         `json:"series"`
+}
+
+// LibraryImport imports reading progress from Komga or Kavita. Users are
+// matched by username and books and series by their path in the library.
+// Collections and reading lists are imported as lists when their names match
+// one, Kavita's want to read list is imported as planning.
+var LibraryImport = request.Handler(func(r *LibraryImportRequest) (*LibraryImportResponse, error) {
+	if r.Source != importer.SourceKomga && r.Source != importer.SourceKavita {
+		return nil, NewHttpError(422, importer.ErrUnknownSource)
+	}
+	export, err := importer.Read(r.Source, r.Path)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, importer.ErrNotSQLite) {
+		return nil, NewHttpError(422, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	run := r.Read.Run
+	if r.Commit {
+		run = r.Update.Run
+	}
+	resp := &LibraryImportResponse{
+		Committed:       r.Commit,
+		Users:           []*LibraryImportUser{},
+		Lists:           []*LibraryImportList{},
+		UnmatchedUsers:  []string{},
+		UnmatchedSeries: []string{},
+		UnmatchedBooks:  []string{},
+		UnmatchedLists:  []*LibraryImportList{},
+	}
+	err = run(func(tx *sqlx.Tx) error {
+		users, err := models.UserQuery(r.Ctx).Get(tx)
+		if err != nil {
+			return err
+		}
+		series, err := models.SeriesQuery(r.Ctx).Get(tx)
+		if err != nil {
+			return err
+		}
+		books, err := models.BookQuery(r.Ctx).Get(tx)
+		if err != nil {
+			return err
+		}
+
+		userMap := map[string]*models.User{}
+		for _, from := range export.Users {
+			u := libraryImportUser(from.Username, users)
+			if u == nil {
+				resp.UnmatchedUsers = append(resp.UnmatchedUsers, from.Username)
+				continue
+			}
+			userMap[from.ID] = u
+			resp.Users = append(resp.Users, &LibraryImportUser{From: from.Username, To: u.Username})
+		}
+
+		bookIndex := newPathIndex[*models.Book](2)
+		for _, b := range books {
+			bookIndex.add(b.File, b)
+		}
+		bookMap := map[string]*models.Book{}
+		// seriesVotes counts the series the books of each series matched
+		// to, for series whose directory doesn't match.
+		seriesVotes := map[string]map[string]int{}
+		for _, from := range export.Books {
+			b := bookIndex.find(from.Path)
+			if b == nil {
+				resp.UnmatchedBooks = append(resp.UnmatchedBooks, from.Path)
+				continue
+			}
+			bookMap[from.ID] = b
+			if seriesVotes[from.SeriesID] == nil {
+				seriesVotes[from.SeriesID] = map[string]int{}
+			}
+			seriesVotes[from.SeriesID][b.SeriesSlug]++
+		}
+		resp.Books = len(bookMap)
+
+		seriesIndex := newPathIndex[*models.Series](1)
+		for _, s := range series {
+			seriesIndex.add(s.Directory, s)
+		}
+		seriesMap := map[string]string{}
+		for _, from := range export.Series {
+			if from.Path != "" {
+				if s := seriesIndex.find(from.Path); s != nil {
+					seriesMap[from.ID] = s.Slug
+					continue
+				}
+			}
+			votes := 0
+			for slug, n := range seriesVotes[from.ID] {
+				if n > votes {
+					seriesMap[from.ID], votes = slug, n
+				}
+			}
+			if votes == 0 {
+				resp.UnmatchedSeries = append(resp.UnmatchedSeries, from.Name)
+			}
+		}
+
+		progress := []*libraryImportProgress{}
+		for _, p := range export.Progress {
+			u, b := userMap[p.UserID], bookMap[p.BookID]
+			if u == nil || b == nil {
+				continue
+			}
+			progress = append(progress, &libraryImportProgress{user: u, book: b, progress: p})
+		}
+		resp.Progress = len(progress)
+
+		lists := []*libraryImportList{}
+		for _, from := range export.Lists {
+			l := &LibraryImportList{Kind: from.Kind, Name: from.Name}
+			if from.Kind == importer.KindWantToRead {
+				l.List = models.ListPlanning
+			} else {
+				l.List = listFromNames([]string{from.Name})
+			}
+			slugs := []string{}
+			for _, id := range from.SeriesIDs {
+				if slug, ok := seriesMap[id]; ok {
+					slugs = append(slugs, slug)
+				}
+			}
+			l.Series = len(slugs)
+
+			listUsers := users
+			if from.UserID != "" {
+				listUsers = nil
+				if u, ok := userMap[from.UserID]; ok {
+					listUsers = []*models.User{u}
+				}
+			}
+			if l.List == models.ListNone || l.Series == 0 || len(listUsers) == 0 {
+				resp.UnmatchedLists = append(resp.UnmatchedLists, l)
+				continue
+			}
+			resp.Lists = append(resp.Lists, l)
+			lists = append(lists, &libraryImportList{list: l.List, users: listUsers, slugs: slugs})
+		}
+
+		if !r.Commit {
+			return nil
+		}
+		return libraryImportSave(r.Ctx, tx, progress, lists)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+})
+
+type libraryImportProgress struct {
+	user     *models.User
+	book     *models.Book
+	progress *importer.Progress
+}
+
+type libraryImportList struct {
+	list  models.List
+	users []*models.User
+	slugs []string
+}
+
+// libraryImportUser finds the user with username, Komga uses email
+// addresses as usernames so the part before the @ is tried as well.
+func libraryImportUser(username string, users []*models.User) *models.User {
+	for _, name := range []string{username, strings.SplitN(username, "@", 2)[0]} {
+		for _, u := range users {
+			if strings.EqualFold(u.Username, name) {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+// libraryImportSave saves the imported progress and lists. Progress is never
+// moved backwards.
+func libraryImportSave(ctx context.Context, tx *sqlx.Tx, progress []*libraryImportProgress, lists []*libraryImportList) error {
+	for _, p := range progress {
+		page := archiveCurrentPage(p.book, p.progress.Page)
+		if p.progress.Completed {
+			page = max(p.book.PageCount-1, 0)
+		}
+
+		err := models.AdvanceUserBook(auth.ActAs(ctx, p.user.ID), tx, p.user.ID, p.book.ID, page)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, l := range lists {
+		for _, u := range l.users {
+			userCtx := auth.ActAs(ctx, u.ID)
+			for _, slug := range l.slugs {
+				us, err := models.UserSeriesQuery(userCtx).Where("series_name", "=", slug).First(tx)
+				if err != nil {
+					return err
+				}
+				if us == nil {
+					us = &models.UserSeries{UserID: u.ID, SeriesSlug: slug}
+				}
+				if us.UpdateMap == nil {
+					us.UpdateMap = map[string]string{}
+				}
+				us.List = l.list
+				us.UpdateField("list")
+				err = model.SaveContext(userCtx, tx, us)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pathIndex finds values by path, paths from other servers can have a
+// different library root so they are matched by their last minParts parts
+// or more when that is unique.
+type pathIndex[T comparable] struct {
+	minParts int
+	values   map[string]T
+	// ambiguous holds suffixes shared by more than one value.
+	ambiguous map[string]bool
+}
+
+func newPathIndex[T comparable](minParts int) *pathIndex[T] {
+	return &pathIndex[T]{
+		minParts:  minParts,
+		values:    map[string]T{},
+		ambiguous: map[string]bool{},
+	}
+}
+
+func (i *pathIndex[T]) add(p string, v T) {
+	for _, suffix := range pathSuffixes(p, i.minParts) {
+		if _, ok := i.values[suffix]; ok {
+			i.ambiguous[suffix] = true
+		}
+		i.values[suffix] = v
+	}
+}
+
+func (i *pathIndex[T]) find(p string) T {
+	var zero T
+	for _, suffix := range pathSuffixes(p, i.minParts) {
+		if i.ambiguous[suffix] {
+			return zero
+		}
+		if v, ok := i.values[suffix]; ok {
+			return v
+		}
+	}
+	return zero
+}
+
+// pathSuffixes returns the suffixes of p with at least minParts parts,
+// longest first.
+func pathSuffixes(p string, minParts int) []string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	suffixes := []string{}
+	for i := 0; i <= len(parts)-minParts || i == 0; i++ {
+		suffixes = append(suffixes, "/"+strings.Join(parts[i:], "/"))
+	}
+	return suffixes
+}
@@ -0,0 +1,454 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/opds"
+	"github.com/abibby/comicbox-3/server/router"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/builder"
+	"github.com/abibby/salusa/request"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// opdsLists are the reading lists offered in the catalog, in the order they
+// are shown.
+var opdsLists = []struct {
+	list  models.List
+	title string
+}{
+	{models.ListReading, "Reading"},
+	{models.ListPlanning, "Planning"},
+	{models.ListPaused, "Paused"},
+	{models.ListCompleted, "Completed"},
+	{models.ListDropped, "Dropped"},
+}
+
+// opdsURL resolves a route and adds query to it.
+func opdsURL(ctx context.Context, name string, query url.Values, pairs ...string) string {
+	u := router.MustURL(ctx, name, pairs...)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// newOPDSFeed creates a feed with the links every feed shares.
+func newOPDSFeed(ctx context.Context, kind, id, title, self string) *opds.Feed {
+	return &opds.Feed{
+		ID:      "urn:comicbox:" + id,
+		Title:   title,
+		Updated: time.Now().UTC(),
+		Author:  &opds.Author{Name: "comicbox"},
+		Kind:    kind,
+		Links: []*opds.Link{
+			{Rel: opds.RelSelf, Href: self, Type: kind},
+			{Rel: opds.RelStart, Href: router.MustURL(ctx, "opds.root"), Type: opds.NavigationType},
+			{Rel: opds.RelSearch, Href: router.MustURL(ctx, "opds.search-description"), Type: opds.SearchType},
+		},
+	}
+}
+
+// opdsPageLinks returns the URLs of the first, previous and next pages of a
+// paginated feed, keyed by their link relation. Links that don't apply are
+// left out.
+func opdsPageLinks[T any](ctx context.Context, resp *PaginatedResponse[T], name string, query url.Values, pairs ...string) map[string]string {
+	pageURL := func(page int) string {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("page", fmt.Sprint(page))
+		q.Set("page_size", fmt.Sprint(resp.PageSize))
+		return opdsURL(ctx, name, q, pairs...)
+	}
+	links := map[string]string{}
+	if resp.Page > 1 {
+		links[opds.RelFirst] = pageURL(1)
+		links[opds.RelPrevious] = pageURL(resp.Page - 1)
+	}
+	if resp.Page*resp.PageSize < resp.Total {
+		links[opds.RelNext] = pageURL(resp.Page + 1)
+	}
+	return links
+}
+
+// addOPDSPagination adds the OpenSearch counts and the links to the
+// neighbouring pages of a paginated feed.
+func addOPDSPagination[T any](ctx context.Context, feed *opds.Feed, resp *PaginatedResponse[T], name string, query url.Values, pairs ...string) {
+	feed.TotalResults = resp.Total
+	feed.ItemsPerPage = resp.PageSize
+	feed.StartIndex = (resp.Page-1)*resp.PageSize + 1
+
+	links := opdsPageLinks(ctx, resp, name, query, pairs...)
+	for _, rel := range []string{opds.RelFirst, opds.RelPrevious, opds.RelNext} {
+		if href, ok := links[rel]; ok {
+			feed.Links = append(feed.Links, &opds.Link{Rel: rel, Href: href, Type: feed.Kind})
+		}
+	}
+}
+
+func opdsNavigationEntry(id, title, content string, link *opds.Link) *opds.Entry {
+	return &opds.Entry{
+		ID:      "urn:comicbox:" + id,
+		Title:   title,
+		Updated: time.Now().UTC(),
+		Content: opds.TextContent(content),
+		Links:   []*opds.Link{link},
+	}
+}
+
+func opdsSubsection(href string) *opds.Link {
+	return &opds.Link{Rel: opds.RelSubsection, Href: href, Type: opds.NavigationType}
+}
+
+func opdsSeriesEntry(ctx context.Context, s *models.Series) *opds.Entry {
+	entry := &opds.Entry{
+		ID:      "urn:comicbox:series:" + s.Slug,
+		Title:   s.Name,
+		Updated: s.UpdatedAt.Time().UTC(),
+		Content: opds.TextContent(s.Description),
+		Links: []*opds.Link{
+			{Rel: opds.RelSubsection, Href: router.MustURL(ctx, "opds.series.books", "slug", s.Slug), Type: opds.AcquisitionType},
+		},
+	}
+	for _, genre := range s.Genres {
+		entry.Categories = append(entry.Categories, &opds.Category{Term: genre, Label: genre})
+	}
+	if s.CoverImage != "" {
+		cover := router.MustURL(ctx, "opds.series.thumbnail", "slug", s.Slug)
+		entry.Links = append(entry.Links,
+			&opds.Link{Rel: opds.RelImage, Href: cover},
+			&opds.Link{Rel: opds.RelThumbnail, Href: cover},
+		)
+	}
+	return entry
+}
+
+// opdsBookQuery loads books with what catalog entries need.
+func opdsBookQuery(ctx context.Context) *builder.ModelBuilder[*models.Book] {
+	return models.BookQuery(ctx).
+		With("UserBook").
+		With("Series")
+}
+
+func opdsRecentQuery(ctx context.Context) *builder.ModelBuilder[*models.Book] {
+	return opdsBookQuery(ctx).
+		OrderByDesc("created_at").
+		OrderBy("sort")
+}
+
+// opdsSearchQuery finds books by their title or the name of their series.
+func opdsSearchQuery(ctx context.Context, query string) *builder.ModelBuilder[*models.Book] {
+	pattern := "%" + strings.TrimSpace(query) + "%"
+	return opdsBookQuery(ctx).
+		And(func(q *builder.Conditions) {
+			q.Where("title", "like", pattern).
+				OrWhereHas("Series", func(q *builder.Builder) *builder.Builder {
+					return q.Where("display_name", "like", pattern)
+				})
+		}).
+		OrderBy("sort")
+}
+
+// opdsSeriesQuery lists series, only those on a reading list if list is set.
+func opdsSeriesQuery(ctx context.Context, list models.List) *builder.ModelBuilder[*models.Series] {
+	query := models.SeriesQuery(ctx).OrderBy("name")
+	if list != "" {
+		query = query.WhereHas("UserSeries", func(q *builder.Builder) *builder.Builder {
+			return q.Where("list", "=", list)
+		})
+	}
+	return query
+}
+
+// opdsListTitle returns the name shown for a reading list.
+func opdsListTitle(list models.List) string {
+	for _, l := range opdsLists {
+		if l.list == list {
+			return l.title
+		}
+	}
+	return "Series"
+}
+
+// opdsBookTitle names a book by its volume, chapter and title, falling back
+// to the file name.
+func opdsBookTitle(book *models.Book) string {
+	parts := []string{}
+	if v, ok := book.Volume.Ok(); ok {
+		parts = append(parts, fmt.Sprintf("Vol. %g", v))
+	}
+	if c, ok := book.Chapter.Ok(); ok {
+		parts = append(parts, fmt.Sprintf("#%g", c))
+	}
+	if book.Title != "" {
+		parts = append(parts, book.Title)
+	}
+	if len(parts) == 0 {
+		return strings.TrimSuffix(path.Base(book.File), path.Ext(book.File))
+	}
+	return strings.Join(parts, " ")
+}
+
+// opdsPages returns the pages streamed to page streaming clients. They are
+// the pages shown in the reader, in reading order with deleted pages left
+// out.
+func opdsPages(book *models.Book) []models.PageRef {
+	refs := []models.PageRef{}
+	for _, ref := range book.PageRefs() {
+		if ref.Index < len(book.Pages) && book.Pages[ref.Index].Type == models.PageTypeDeleted {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// opdsStreamType returns the content type shared by every streamed page, or
+// image/jpeg if the pages are sent in different formats.
+func opdsStreamType(book *models.Book, refs []models.PageRef) string {
+	contentType := "image/jpeg"
+	for i, ref := range refs {
+		t := opdsPageType(book, ref)
+		if i == 0 {
+			contentType = t
+		} else if t != contentType {
+			return "image/jpeg"
+		}
+	}
+	return contentType
+}
+
+// opdsLastRead converts a page number in the book's reading layout to the
+// streamed page that shows it or the next one.
+func opdsLastRead(book *models.Book, currentPage int) int {
+	streamed := 0
+	for i, ref := range book.PageRefs() {
+		if i >= currentPage {
+			break
+		}
+		if ref.Index >= len(book.Pages) || book.Pages[ref.Index].Type != models.PageTypeDeleted {
+			streamed++
+		}
+	}
+	return streamed
+}
+
+func opdsBookEntry(ctx context.Context, book *models.Book) *opds.Entry {
+	id := book.ID.String()
+	cover := router.MustURL(ctx, "opds.book.thumbnail", "id", id, "page", fmt.Sprint(book.CoverPage()))
+	refs := opdsPages(book)
+	stream := &opds.Link{
+		Rel:   opds.RelStream,
+		Href:  router.MustURL(ctx, "opds.book.stream", "id", id) + "?page={pageNumber}",
+		Type:  opdsStreamType(book, refs),
+		Count: len(refs),
+	}
+	if ub, ok := book.UserBook.Value(); ok && ub != nil {
+		lastRead := opdsLastRead(book, ub.CurrentPage)
+		lastReadDate := ub.UpdatedAt.Time().UTC()
+		stream.LastRead = &lastRead
+		stream.LastReadDate = &lastReadDate
+	}
+
+	entry := &opds.Entry{
+		ID:      "urn:uuid:" + id,
+		Title:   opdsBookTitle(book),
+		Updated: book.UpdatedAt.Time().UTC(),
+		Links: []*opds.Link{
+			{Rel: opds.RelImage, Href: cover, Type: "image/jpeg"},
+			{Rel: opds.RelThumbnail, Href: cover, Type: "image/jpeg"},
+			{Rel: opds.RelAcquisition, Href: router.MustURL(ctx, "opds.book.download", "id", id), Type: opds.ComicBookType},
+			stream,
+		},
+	}
+	for _, author := range book.Authors {
+		entry.Authors = append(entry.Authors, &opds.Author{Name: author})
+	}
+	if series, ok := book.Series.Value(); ok && series != nil {
+		entry.Content = opds.TextContent(series.Name)
+		if y, ok := series.Year.Ok(); ok {
+			entry.Issued = fmt.Sprint(y)
+		}
+	}
+	return entry
+}
+
+func opdsBookFeed(ctx context.Context, feed *opds.Feed, books []*models.Book) *opds.Feed {
+	feed.Entries = make([]*opds.Entry, len(books))
+	for i, book := range books {
+		feed.Entries[i] = opdsBookEntry(ctx, book)
+	}
+	return feed
+}
+
+type OPDSRootRequest struct {
+	Ctx context.Context `inject:""`
+}
+
+// OPDSRoot is the start of the OPDS catalog.
+var OPDSRoot = request.Handler(func(r *OPDSRootRequest) (*opds.Feed, error) {
+	feed := newOPDSFeed(r.Ctx, opds.NavigationType, "root", "comicbox", router.MustURL(r.Ctx, "opds.root"))
+	feed.Entries = []*opds.Entry{
+		opdsNavigationEntry("series", "Series", "Every series in the library",
+			opdsSubsection(router.MustURL(r.Ctx, "opds.series"))),
+		opdsNavigationEntry("lists", "Reading Lists", "Series on your reading lists",
+			opdsSubsection(router.MustURL(r.Ctx, "opds.lists"))),
+		opdsNavigationEntry("recent", "Recently Added", "The newest books in the library",
+			&opds.Link{Rel: opds.RelSortNew, Href: router.MustURL(r.Ctx, "opds.recent"), Type: opds.AcquisitionType}),
+	}
+	return feed, nil
+})
+
+type OPDSListsRequest struct {
+	Ctx context.Context `inject:""`
+}
+
+var OPDSLists = request.Handler(func(r *OPDSListsRequest) (*opds.Feed, error) {
+	feed := newOPDSFeed(r.Ctx, opds.NavigationType, "lists", "Reading Lists", router.MustURL(r.Ctx, "opds.lists"))
+	for _, l := range opdsLists {
+		href := opdsURL(r.Ctx, "opds.series", url.Values{"list": {string(l.list)}})
+		feed.Entries = append(feed.Entries, opdsNavigationEntry("lists:"+string(l.list), l.title, "", opdsSubsection(href)))
+	}
+	return feed, nil
+})
+
+type OPDSSeriesRequest struct {
+	PaginatedRequest
+	List models.List `query:"list"`
+}
+
+var OPDSSeries = request.Handler(func(r *OPDSSeriesRequest) (*opds.Feed, error) {
+	params := url.Values{}
+	if r.List != "" {
+		params.Set("list", string(r.List))
+	}
+
+	resp, err := paginatedList(&r.PaginatedRequest, opdsSeriesQuery(r.Ctx, r.List))
+	if err != nil {
+		return nil, err
+	}
+
+	feed := newOPDSFeed(r.Ctx, opds.NavigationType, "series", opdsListTitle(r.List), opdsURL(r.Ctx, "opds.series", params))
+	addOPDSPagination(r.Ctx, feed, resp, "opds.series", params)
+	feed.Entries = make([]*opds.Entry, len(resp.Data))
+	for i, s := range resp.Data {
+		feed.Entries[i] = opdsSeriesEntry(r.Ctx, s)
+	}
+	return feed, nil
+})
+
+type OPDSSeriesBooksRequest struct {
+	PaginatedRequest
+	Slug string `path:"slug"`
+}
+
+var OPDSSeriesBooks = request.Handler(func(r *OPDSSeriesBooksRequest) (*opds.Feed, error) {
+	series, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Series, error) {
+		return models.SeriesQuery(r.Ctx).Find(tx, r.Slug)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if series == nil {
+		return nil, Err404
+	}
+
+	resp, err := paginatedList(&r.PaginatedRequest, opdsBookQuery(r.Ctx).
+		Where("series", "=", series.Slug).
+		OrderBy("sort"))
+	if err != nil {
+		return nil, err
+	}
+
+	self := router.MustURL(r.Ctx, "opds.series.books", "slug", series.Slug)
+	feed := newOPDSFeed(r.Ctx, opds.AcquisitionType, "series:"+series.Slug, series.Name, self)
+	feed.Links = append(feed.Links, &opds.Link{Rel: opds.RelUp, Href: router.MustURL(r.Ctx, "opds.series"), Type: opds.NavigationType})
+	addOPDSPagination(r.Ctx, feed, resp, "opds.series.books", nil, "slug", series.Slug)
+	return opdsBookFeed(r.Ctx, feed, resp.Data), nil
+})
+
+type OPDSRecentRequest struct {
+	PaginatedRequest
+}
+
+var OPDSRecent = request.Handler(func(r *OPDSRecentRequest) (*opds.Feed, error) {
+	resp, err := paginatedList(&r.PaginatedRequest, opdsRecentQuery(r.Ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	feed := newOPDSFeed(r.Ctx, opds.AcquisitionType, "recent", "Recently Added", router.MustURL(r.Ctx, "opds.recent"))
+	addOPDSPagination(r.Ctx, feed, resp, "opds.recent", nil)
+	return opdsBookFeed(r.Ctx, feed, resp.Data), nil
+})
+
+type OPDSSearchDescriptionRequest struct {
+	Ctx context.Context `inject:""`
+}
+
+var OPDSSearchDescription = request.Handler(func(r *OPDSSearchDescriptionRequest) (*opds.SearchDescription, error) {
+	return opds.NewSearchDescription("comicbox", router.MustURL(r.Ctx, "opds.search")+"?q={searchTerms}"), nil
+})
+
+type OPDSSearchRequest struct {
+	PaginatedRequest
+	Query string `query:"q"`
+}
+
+var OPDSSearch = request.Handler(func(r *OPDSSearchRequest) (*opds.Feed, error) {
+	resp, err := paginatedList(&r.PaginatedRequest, opdsSearchQuery(r.Ctx, r.Query))
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{"q": {r.Query}}
+	feed := newOPDSFeed(r.Ctx, opds.AcquisitionType, "search", fmt.Sprintf("Search: %s", r.Query), opdsURL(r.Ctx, "opds.search", params))
+	addOPDSPagination(r.Ctx, feed, resp, "opds.search", params)
+	return opdsBookFeed(r.Ctx, feed, resp.Data), nil
+})
+
+type OPDSPageRequest struct {
+	ID   uuid.UUID `path:"id"`
+	Page int       `query:"page" validate:"min:0"`
+
+	Request *http.Request   `inject:""`
+	Ctx     context.Context `inject:""`
+}
+
+// OPDSPage serves pages to page streaming clients, which count pages from 0
+// without knowing about split spreads or deleted pages.
+var OPDSPage = request.Handler(opdsPage)
+
+func opdsPage(r *OPDSPageRequest) (http.Handler, error) {
+	// The archive is held until the page is served so bookPage finds it in
+	// the cache.
+	a, err := openBookArchive(r.Ctx, r.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer a.Release()
+
+	refs := opdsPages(a.Book())
+	if r.Page >= len(refs) {
+		return nil, Err404
+	}
+	ref := refs[r.Page]
+
+	return bookPage(&BookPageRequest{
+		ID:      r.ID.String(),
+		Page:    ref.Index,
+		Half:    string(ref.Half),
+		Request: r.Request,
+		Ctx:     r.Ctx,
+	})
+}
@@ -0,0 +1,449 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/abibby/comicbox-3/server/opds2"
+	"github.com/abibby/comicbox-3/server/router"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/request"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrStaleProgression = errors.New("the progression is older than the saved progression")
+	ErrNoLocator        = errors.New("the progression has no locator")
+)
+
+// newOPDS2Feed creates a feed with the links every feed shares.
+func newOPDS2Feed(ctx context.Context, title, self string) *opds2.Feed {
+	return &opds2.Feed{
+		Metadata: &opds2.FeedMetadata{Title: title},
+		Links: []*opds2.Link{
+			{Rel: opds2.RelSelf, Href: self, Type: opds2.FeedType},
+			{Rel: opds2.RelStart, Href: router.MustURL(ctx, "opds2.root"), Type: opds2.FeedType},
+			{Rel: opds2.RelSearch, Href: router.MustURL(ctx, "opds2.search") + "{?query}", Type: opds2.FeedType, Templated: true},
+		},
+	}
+}
+
+func addOPDS2Pagination[T any](ctx context.Context, feed *opds2.Feed, resp *PaginatedResponse[T], name string, query url.Values, pairs ...string) {
+	feed.Metadata.NumberOfItems = resp.Total
+	feed.Metadata.ItemsPerPage = resp.PageSize
+	feed.Metadata.CurrentPage = resp.Page
+
+	links := opdsPageLinks(ctx, resp, name, query, pairs...)
+	for _, rel := range []string{opds2.RelFirst, opds2.RelPrevious, opds2.RelNext} {
+		if href, ok := links[rel]; ok {
+			feed.Links = append(feed.Links, &opds2.Link{Rel: rel, Href: href, Type: opds2.FeedType})
+		}
+	}
+}
+
+// opdsPageSize returns the size of a streamed page image after it has been
+// split and cropped.
+func opdsPageSize(book *models.Book, ref models.PageRef) (int, int) {
+	page := book.Pages[ref.Index]
+	if crop := pageCrop(book, ref, nil); crop != nil {
+		return crop.Width, crop.Height
+	}
+	if ref.Half != "" {
+		r := ref.Half.Rect(image.Rect(0, 0, page.Width, page.Height))
+		return r.Dx(), r.Dy()
+	}
+	return page.Width, page.Height
+}
+
+// opdsPageType returns the content type a streamed page is most likely sent
+// as. Split and cropped pages are encoded as JPEG.
+func opdsPageType(book *models.Book, ref models.PageRef) string {
+	if ref.Half != "" || pageCrop(book, ref, nil) != nil || ref.Index >= len(book.PageEntries) {
+		return "image/jpeg"
+	}
+	contentType := imaging.ContentType(book.PageEntries[ref.Index].Name)
+	if contentType == "" || imaging.Negotiated(contentType) {
+		return "image/jpeg"
+	}
+	return contentType
+}
+
+// opdsCurrentPage converts a streamed page to a page number in the book's
+// reading layout. It is the reverse of opdsLastRead.
+func opdsCurrentPage(book *models.Book, streamed int) int {
+	refs := book.PageRefs()
+	for i, ref := range refs {
+		if ref.Index < len(book.Pages) && book.Pages[ref.Index].Type == models.PageTypeDeleted {
+			continue
+		}
+		if streamed <= 0 {
+			return i
+		}
+		streamed--
+	}
+	return max(len(refs)-1, 0)
+}
+
+func opdsStreamURL(ctx context.Context, book *models.Book, page int) string {
+	return opdsURL(ctx, "opds.book.stream", url.Values{"page": {fmt.Sprint(page)}}, "id", book.ID.String())
+}
+
+func opds2Metadata(book *models.Book) *opds2.Metadata {
+	modified := book.UpdatedAt.Time().UTC()
+	metadata := &opds2.Metadata{
+		Type:          "http://schema.org/ComicStory",
+		ConformsTo:    opds2.DivinaProfile,
+		Identifier:    "urn:uuid:" + book.ID.String(),
+		Title:         opdsBookTitle(book),
+		Author:        book.Authors,
+		Modified:      &modified,
+		NumberOfPages: len(opdsPages(book)),
+		Presentation:  &opds2.Presentation{Overflow: "paginated"},
+	}
+
+	switch {
+	case book.LongStrip:
+		metadata.ReadingProgression = opds2.TopToBottom
+		metadata.Presentation = &opds2.Presentation{Overflow: "scrolled", Continuous: true}
+	case book.RightToLeft:
+		metadata.ReadingProgression = opds2.RightToLeft
+	default:
+		metadata.ReadingProgression = opds2.LeftToRight
+	}
+
+	if series, ok := book.Series.Value(); ok && series != nil {
+		collection := &opds2.Collection{Name: series.Name}
+		if v, ok := book.Chapter.Ok(); ok {
+			collection.Position = &v
+		} else if v, ok := book.Volume.Ok(); ok {
+			collection.Position = &v
+		}
+		metadata.BelongsTo = &opds2.BelongsTo{Series: []*opds2.Collection{collection}}
+		metadata.Description = series.Description
+		metadata.Subject = series.Genres
+		if y, ok := series.Year.Ok(); ok {
+			metadata.Published = fmt.Sprint(y)
+		}
+	}
+	return metadata
+}
+
+func opds2Publication(ctx context.Context, book *models.Book) *opds2.Publication {
+	id := book.ID.String()
+	cover := router.MustURL(ctx, "opds.book.thumbnail", "id", id, "page", fmt.Sprint(book.CoverPage()))
+	return &opds2.Publication{
+		Metadata: opds2Metadata(book),
+		Links: []*opds2.Link{
+			{Rel: opds2.RelSelf, Href: router.MustURL(ctx, "opds2.book.manifest", "id", id), Type: opds2.DivinaType},
+			{Rel: opds2.RelAcquisition, Href: router.MustURL(ctx, "opds.book.download", "id", id), Type: "application/vnd.comicbook+zip"},
+		},
+		Images: []*opds2.Link{
+			{Href: cover, Type: "image/jpeg"},
+		},
+	}
+}
+
+func opds2BookFeed(ctx context.Context, feed *opds2.Feed, books []*models.Book) *opds2.Feed {
+	feed.Publications = make([]*opds2.Publication, len(books))
+	for i, book := range books {
+		feed.Publications[i] = opds2Publication(ctx, book)
+	}
+	return feed
+}
+
+type OPDS2RootRequest struct {
+	Ctx context.Context `inject:""`
+}
+
+// OPDS2Root is the start of the OPDS 2.0 catalog.
+var OPDS2Root = request.Handler(func(r *OPDS2RootRequest) (*opds2.Feed, error) {
+	feed := newOPDS2Feed(r.Ctx, "comicbox", router.MustURL(r.Ctx, "opds2.root"))
+	feed.Navigation = []*opds2.Link{
+		{Title: "Series", Href: router.MustURL(r.Ctx, "opds2.series"), Type: opds2.FeedType, Rel: opds2.RelSubsection},
+		{Title: "Recently Added", Href: router.MustURL(r.Ctx, "opds2.recent"), Type: opds2.FeedType, Rel: opds2.RelSortNew},
+	}
+	for _, l := range opdsLists {
+		feed.Navigation = append(feed.Navigation, &opds2.Link{
+			Title: l.title,
+			Href:  opdsURL(r.Ctx, "opds2.series", url.Values{"list": {string(l.list)}}),
+			Type:  opds2.FeedType,
+			Rel:   opds2.RelSubsection,
+		})
+	}
+	return feed, nil
+})
+
+type OPDS2SeriesRequest struct {
+	PaginatedRequest
+	List models.List `query:"list"`
+}
+
+var OPDS2Series = request.Handler(func(r *OPDS2SeriesRequest) (*opds2.Feed, error) {
+	params := url.Values{}
+	if r.List != "" {
+		params.Set("list", string(r.List))
+	}
+
+	resp, err := paginatedList(&r.PaginatedRequest, opdsSeriesQuery(r.Ctx, r.List))
+	if err != nil {
+		return nil, err
+	}
+
+	feed := newOPDS2Feed(r.Ctx, opdsListTitle(r.List), opdsURL(r.Ctx, "opds2.series", params))
+	addOPDS2Pagination(r.Ctx, feed, resp, "opds2.series", params)
+	feed.Navigation = make([]*opds2.Link, len(resp.Data))
+	for i, s := range resp.Data {
+		feed.Navigation[i] = &opds2.Link{
+			Title: s.Name,
+			Href:  router.MustURL(r.Ctx, "opds2.series.books", "slug", s.Slug),
+			Type:  opds2.FeedType,
+			Rel:   opds2.RelSubsection,
+		}
+	}
+	return feed, nil
+})
+
+type OPDS2SeriesBooksRequest struct {
+	PaginatedRequest
+	Slug string `path:"slug"`
+}
+
+var OPDS2SeriesBooks = request.Handler(func(r *OPDS2SeriesBooksRequest) (*opds2.Feed, error) {
+	series, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Series, error) {
+		return models.SeriesQuery(r.Ctx).Find(tx, r.Slug)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if series == nil {
+		return nil, Err404
+	}
+
+	resp, err := paginatedList(&r.PaginatedRequest, opdsBookQuery(r.Ctx).
+		Where("series", "=", series.Slug).
+		OrderBy("sort"))
+	if err != nil {
+		return nil, err
+	}
+
+	feed := newOPDS2Feed(r.Ctx, series.Name, router.MustURL(r.Ctx, "opds2.series.books", "slug", series.Slug))
+	feed.Links = append(feed.Links, &opds2.Link{Rel: opds2.RelUp, Href: router.MustURL(r.Ctx, "opds2.series"), Type: opds2.FeedType})
+	addOPDS2Pagination(r.Ctx, feed, resp, "opds2.series.books", nil, "slug", series.Slug)
+	return opds2BookFeed(r.Ctx, feed, resp.Data), nil
+})
+
+type OPDS2RecentRequest struct {
+	PaginatedRequest
+}
+
+var OPDS2Recent = request.Handler(func(r *OPDS2RecentRequest) (*opds2.Feed, error) {
+	resp, err := paginatedList(&r.PaginatedRequest, opdsRecentQuery(r.Ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	feed := newOPDS2Feed(r.Ctx, "Recently Added", router.MustURL(r.Ctx, "opds2.recent"))
+	addOPDS2Pagination(r.Ctx, feed, resp, "opds2.recent", nil)
+	return opds2BookFeed(r.Ctx, feed, resp.Data), nil
+})
+
+type OPDS2SearchRequest struct {
+	PaginatedRequest
+	Query string `query:"query"`
+}
+
+var OPDS2Search = request.Handler(func(r *OPDS2SearchRequest) (*opds2.Feed, error) {
+	resp, err := paginatedList(&r.PaginatedRequest, opdsSearchQuery(r.Ctx, r.Query))
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{"query": {r.Query}}
+	feed := newOPDS2Feed(r.Ctx, fmt.Sprintf("Search: %s", r.Query), opdsURL(r.Ctx, "opds2.search", params))
+	addOPDS2Pagination(r.Ctx, feed, resp, "opds2.search", params)
+	return opds2BookFeed(r.Ctx, feed, resp.Data), nil
+})
+
+type BookManifestRequest struct {
+	ID uuid.UUID `path:"id"`
+
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+
+// BookManifest returns a Divina manifest listing the pages of a book in the
+// same order they are streamed to OPDS clients.
+var BookManifest = request.Handler(func(r *BookManifestRequest) (*opds2.Manifest, error) {
+	book, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Book, error) {
+		return models.BookQuery(r.Ctx).With("Series").Find(tx, r.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if book == nil {
+		return nil, Err404
+	}
+
+	id := book.ID.String()
+	refs := opdsPages(book)
+	manifest := &opds2.Manifest{
+		Context:  opds2.ManifestContext,
+		Metadata: opds2Metadata(book),
+		Links: []*opds2.Link{
+			{Rel: opds2.RelSelf, Href: router.MustURL(r.Ctx, "opds2.book.manifest", "id", id), Type: opds2.DivinaType},
+			{Rel: opds2.RelProgression, Href: router.MustURL(r.Ctx, "opds2.book.progression", "id", id), Type: opds2.ProgressionType},
+			{Rel: opds2.RelAcquisition, Href: router.MustURL(r.Ctx, "opds.book.download", "id", id), Type: "application/vnd.comicbook+zip"},
+		},
+		ReadingOrder: make([]*opds2.Link, len(refs)),
+	}
+	for i, ref := range refs {
+		width, height := opdsPageSize(book, ref)
+		manifest.ReadingOrder[i] = &opds2.Link{
+			Href:   opdsStreamURL(r.Ctx, book, i),
+			Type:   opdsPageType(book, ref),
+			Width:  width,
+			Height: height,
+		}
+	}
+	return manifest, nil
+})
+
+// bookProgression converts a user's current page to a locator in the book's
+// manifest.
+func bookProgression(ctx context.Context, book *models.Book, ub *models.UserBook) *opds2.Progression {
+	count := len(opdsPages(book))
+	page := min(opdsLastRead(book, ub.CurrentPage), max(count-1, 0))
+	total := 0.0
+	if count > 0 {
+		total = float64(page) / float64(count)
+	}
+	var contentType string
+	if refs := opdsPages(book); page < len(refs) {
+		contentType = opdsPageType(book, refs[page])
+	}
+	return &opds2.Progression{
+		Modified: ub.UpdatedAt.Time().UTC(),
+		Locator: &opds2.Locator{
+			Href: opdsStreamURL(ctx, book, page),
+			Type: contentType,
+			Locations: &opds2.Locations{
+				Position:         page + 1,
+				TotalProgression: total,
+			},
+		},
+	}
+}
+
+// locatorPage finds the streamed page a locator points to, by its href,
+// position or total progression.
+func locatorPage(ctx context.Context, book *models.Book, locator *opds2.Locator) int {
+	count := len(opdsPages(book))
+	if href, err := url.Parse(locator.Href); err == nil && locator.Href != "" {
+		for i := 0; i < count; i++ {
+			page, err := url.Parse(opdsStreamURL(ctx, book, i))
+			if err == nil && page.Path == href.Path && page.RawQuery == href.RawQuery {
+				return i
+			}
+		}
+	}
+	if locator.Locations == nil {
+		return 0
+	}
+	if locator.Locations.Position > 0 {
+		return min(locator.Locations.Position-1, max(count-1, 0))
+	}
+	return min(int(math.Floor(locator.Locations.TotalProgression*float64(count))), max(count-1, 0))
+}
+
+type BookProgressionRequest struct {
+	ID uuid.UUID `path:"id"`
+
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+
+// BookProgression returns how far the user has read a book as a Readium
+// progression document.
+var BookProgression = request.Handler(func(r *BookProgressionRequest) (*opds2.Progression, error) {
+	book, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Book, error) {
+		return models.BookQuery(r.Ctx).With("Series").With("UserBook").Find(tx, r.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if book == nil {
+		return nil, Err404
+	}
+	ub, ok := book.UserBook.Value()
+	if !ok || ub == nil {
+		return nil, Err404
+	}
+	return bookProgression(r.Ctx, book, ub), nil
+})
+
+type BookProgressionUpdateRequest struct {
+	ID       uuid.UUID      `path:"id"`
+	Modified *time.Time     `json:"modified"`
+	Device   *opds2.Device  `json:"device"`
+	Locator  *opds2.Locator `json:"locator"`
+
+	Ctx context.Context `inject:""`
+}
+
+// BookProgressionUpdate saves the position a Readium client has read to as
+// the user's current page. Progressions older than the saved one are
+// rejected so a reader that was offline doesn't move the user back.
+var BookProgressionUpdate = request.Handler(func(r *BookProgressionUpdateRequest) (*opds2.Progression, error) {
+	uid, ok := auth.UserID(r.Ctx)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if r.Locator == nil {
+		return nil, NewHttpError(422, ErrNoLocator)
+	}
+
+	var progression *opds2.Progression
+	err := database.UpdateTx(r.Ctx, func(tx *sqlx.Tx) error {
+		book, err := models.BookQuery(r.Ctx).With("Series").Find(tx, r.ID)
+		if err != nil {
+			return err
+		}
+		if book == nil {
+			return Err404
+		}
+
+		ub, err := models.FindUserBook(r.Ctx, tx, uid, book.ID)
+		if err != nil {
+			return err
+		}
+		if r.Modified != nil && r.Modified.Before(ub.UpdatedAt.Time()) && ub.DeletedAt == nil {
+			return NewHttpError(http.StatusConflict, ErrStaleProgression)
+		}
+
+		ub.SetCurrentPage(opdsCurrentPage(book, locatorPage(r.Ctx, book, r.Locator)))
+		err = model.SaveContext(r.Ctx, tx, ub)
+		if err != nil {
+			return err
+		}
+
+		progression = bookProgression(r.Ctx, book, ub)
+		progression.Device = r.Device
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return progression, nil
+})
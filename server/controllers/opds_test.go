@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOPDSLastRead(t *testing.T) {
+	testCases := []struct {
+		name        string
+		currentPage int
+		streamed    int
+	}{
+		{name: "first page", currentPage: 0, streamed: 0},
+		{name: "deleted page", currentPage: 1, streamed: 1},
+		{name: "page after a deleted page", currentPage: 2, streamed: 1},
+		{name: "second half of a spread", currentPage: 3, streamed: 2},
+		{name: "last page", currentPage: 4, streamed: 3},
+		{name: "finished", currentPage: 5, streamed: 4},
+		{name: "past the end", currentPage: 99, streamed: 4},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.streamed, opdsLastRead(testBook(), tc.currentPage))
+		})
+	}
+}
+
+func TestOPDSCurrentPage(t *testing.T) {
+	testCases := []struct {
+		name        string
+		streamed    int
+		currentPage int
+	}{
+		{name: "first page", streamed: 0, currentPage: 0},
+		{name: "skips deleted pages", streamed: 1, currentPage: 2},
+		{name: "second half of a spread", streamed: 2, currentPage: 3},
+		{name: "last page", streamed: 3, currentPage: 4},
+		{name: "past the end", streamed: 9, currentPage: 4},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.currentPage, opdsCurrentPage(testBook(), tc.streamed))
+		})
+	}
+}
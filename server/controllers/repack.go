@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/abibby/comicbox-3/app/events"
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/abibby/comicbox-3/server/repack"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/event"
+	"github.com/abibby/salusa/request"
+	"github.com/jmoiron/sqlx"
+)
+
+// repackOptions fills in the default options and checks that books can be
+// converted with them.
+func repackOptions(format string, quality int) (repack.Options, error) {
+	opts := repack.Options{Format: format, Quality: quality}.WithDefaults()
+	err := opts.Validate()
+	if err != nil {
+		return opts, NewHttpError(422, err)
+	}
+	if config.ImageEncoder == "" {
+		return opts, NewHttpError(422, imaging.ErrNoEncoder)
+	}
+	return opts, nil
+}
+
+type SeriesRepackEstimateRequest struct {
+	Slug    string `path:"slug"`
+	Format  string `query:"format"`
+	Quality int    `query:"quality"`
+
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+
+type SeriesRepackEstimateResponse struct {
+	repack.Options
+	CurrentSize   int64                  `json:"current_size"`
+	EstimatedSize int64                  `json:"estimated_size"`
+	Books         []*repack.BookEstimate `json:"books"`
+}
+
+// SeriesRepackEstimate converts a sample of each book's pages to estimate how
+// much space repacking the series would save. Nothing is written.
+var SeriesRepackEstimate = request.Handler(func(r *SeriesRepackEstimateRequest) (*SeriesRepackEstimateResponse, error) {
+	opts, err := repackOptions(r.Format, r.Quality)
+	if err != nil {
+		return nil, err
+	}
+
+	books, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) ([]*models.Book, error) {
+		s, err := models.SeriesQuery(r.Ctx).Find(tx, r.Slug)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			return nil, Err404
+		}
+		return models.BookQuery(r.Ctx).Where("series", "=", s.Slug).OrderBy("sort").Get(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SeriesRepackEstimateResponse{
+		Options: opts,
+		Books:   make([]*repack.BookEstimate, 0, len(books)),
+	}
+	for _, book := range books {
+		estimate, err := repack.EstimateBook(r.Ctx, book, opts)
+		if errors.Is(err, imaging.ErrNoEncoder) {
+			return nil, NewHttpError(422, err)
+		} else if err != nil {
+			return nil, err
+		}
+		resp.CurrentSize += estimate.CurrentSize
+		resp.EstimatedSize += estimate.EstimatedSize
+		resp.Books = append(resp.Books, estimate)
+	}
+	return resp, nil
+})
+
+type SeriesRepackRequest struct {
+	Slug    string `path:"slug"`
+	Format  string `json:"format"`
+	Quality int    `json:"quality"`
+
+	Read  salusadb.Read   `inject:""`
+	Queue event.Queue     `inject:""`
+	Ctx   context.Context `inject:""`
+}
+
+type SeriesRepackResponse struct {
+	Success bool `json:"success"`
+}
+
+// SeriesRepack queues a job that rewrites every book in the series with its
+// pages converted to format at the given quality.
+var SeriesRepack = request.Handler(func(r *SeriesRepackRequest) (*SeriesRepackResponse, error) {
+	opts, err := repackOptions(r.Format, r.Quality)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Series, error) {
+		return models.SeriesQuery(r.Ctx).Find(tx, r.Slug)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, Err404
+	}
+
+	err = r.Queue.Push(&events.RepackEvent{
+		SeriesSlug: s.Slug,
+		Options:    opts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SeriesRepackResponse{Success: true}, nil
+})
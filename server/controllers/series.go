@@ -3,15 +3,19 @@ package controllers
 import (
 	"context"
 	"os"
+	"slices"
 
 	"github.com/abibby/comicbox-3/database"
 	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/archive"
 	"github.com/abibby/comicbox-3/server/auth"
+	"github.com/abibby/comicbox-3/server/pagerules"
 	"github.com/abibby/nulls"
 	salusadb "github.com/abibby/salusa/database"
 	"github.com/abibby/salusa/database/builder"
 	"github.com/abibby/salusa/database/model"
 	"github.com/abibby/salusa/request"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
@@ -104,13 +108,25 @@ type SeriesUpdateRequest struct {
 	Year         *nulls.Int         `json:"year"`
 	MetadataID   *models.MetadataID `json:"metadata_id"`
 	LockedFields []string           `json:"locked_fields"`
-	UpdateMap    map[string]string  `json:"update_map" validate:"require"`
+	AutoCrop     bool               `json:"auto_crop"`
+
+	AutoDeleteRecurring bool `json:"auto_delete_recurring"`
+	AutoDeleteBlank     bool `json:"auto_delete_blank"`
+
+	RightToLeft  *bool `json:"rtl"`
+	LongStrip    *bool `json:"long_strip"`
+	SplitSpreads *bool `json:"split_spreads"`
+
+	TrackerIDs map[models.TrackerService]string `json:"tracker_ids"`
+
+	UpdateMap map[string]string `json:"update_map" validate:"require"`
 
 	Ctx context.Context `inject:""`
 }
 
 var SeriesUpdate = request.Handler(func(r *SeriesUpdateRequest) (*models.Series, error) {
 	s := &models.Series{}
+	croppedBooks := []uuid.UUID{}
 
 	err := database.UpdateTx(r.Ctx, func(tx *sqlx.Tx) error {
 		var err error
@@ -156,15 +172,105 @@ var SeriesUpdate = request.Handler(func(r *SeriesUpdateRequest) (*models.Series,
 			s.LockedFields = r.LockedFields
 		}
 
-		return model.SaveContext(r.Ctx, tx, s)
+		if shouldUpdate(s.UpdateMap, r.UpdateMap, "auto_crop") {
+			if s.AutoCrop != r.AutoCrop {
+				err = models.BookQuery(r.Ctx).Select("id").Where("series", "=", s.Slug).Load(tx, &croppedBooks)
+				if err != nil {
+					return err
+				}
+			}
+			s.AutoCrop = r.AutoCrop
+		}
+
+		rulesEnabled := false
+		if shouldUpdate(s.UpdateMap, r.UpdateMap, "auto_delete_recurring") {
+			rulesEnabled = rulesEnabled || (!s.AutoDeleteRecurring && r.AutoDeleteRecurring)
+			s.AutoDeleteRecurring = r.AutoDeleteRecurring
+		}
+		if shouldUpdate(s.UpdateMap, r.UpdateMap, "auto_delete_blank") {
+			rulesEnabled = rulesEnabled || (!s.AutoDeleteBlank && r.AutoDeleteBlank)
+			s.AutoDeleteBlank = r.AutoDeleteBlank
+		}
+
+		if shouldUpdate(s.UpdateMap, r.UpdateMap, "rtl") {
+			s.RightToLeft = r.RightToLeft
+		}
+		if shouldUpdate(s.UpdateMap, r.UpdateMap, "long_strip") {
+			s.LongStrip = r.LongStrip
+		}
+		if shouldUpdate(s.UpdateMap, r.UpdateMap, "split_spreads") {
+			s.SplitSpreads = r.SplitSpreads
+		}
+
+		if shouldUpdate(s.UpdateMap, r.UpdateMap, "tracker_ids") {
+			s.TrackerIDs = r.TrackerIDs
+		}
+
+		err = model.SaveContext(r.Ctx, tx, s)
+		if err != nil {
+			return err
+		}
+
+		if rulesEnabled {
+			_, err = pagerules.Apply(r.Ctx, tx, s)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	clearBookCache(r.Ctx, croppedBooks...)
+	// The cached books are read with their series to serve pages.
+	archive.InvalidateSeries(s.Slug)
+
 	return s, nil
 })
 
+type SeriesAutoDeleteRequest struct {
+	Slug      string `path:"slug"`
+	Recurring *bool  `query:"recurring"`
+	Blank     *bool  `query:"blank"`
+
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+
+type SeriesAutoDeleteResponse struct {
+	Pages []*pagerules.DeletedPage `json:"pages"`
+}
+
+// SeriesAutoDelete lists the pages the series' auto delete rules would mark
+// deleted. The rules can be overridden to preview them before turning them
+// on.
+var SeriesAutoDelete = request.Handler(func(r *SeriesAutoDeleteRequest) (*SeriesAutoDeleteResponse, error) {
+	changes, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) ([]*pagerules.DeletedPage, error) {
+		series, err := models.SeriesQuery(r.Ctx).Find(tx, r.Slug)
+		if err != nil {
+			return nil, err
+		}
+		if series == nil {
+			return nil, Err404
+		}
+
+		opts := pagerules.SeriesOptions(series)
+		if r.Recurring != nil {
+			opts.Recurring = *r.Recurring
+		}
+		if r.Blank != nil {
+			opts.Blank = *r.Blank
+		}
+		return pagerules.Preview(r.Ctx, tx, series, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SeriesAutoDeleteResponse{Pages: changes}, nil
+})
+
 type SeriesThumbnailRequest struct {
 	Slug string        `path:"slug"`
 	Read salusadb.Read `inject:""`
@@ -185,3 +291,68 @@ var SeriesThumbnail = request.Handler(func(r *SeriesThumbnailRequest) (any, erro
 	}
 	return request.NewResponse(f), nil
 })
+
+type SeriesApplyDefaultsRequest struct {
+	Slug string `path:"slug"`
+
+	Ctx context.Context `inject:""`
+}
+
+type SeriesApplyDefaultsResponse struct {
+	Books int `json:"books"`
+}
+
+// SeriesApplyDefaults writes the series' reading settings to every book in the
+// series. The changes are recorded in each book's update map so offline
+// clients take the new values over their older edits.
+var SeriesApplyDefaults = request.Handler(func(r *SeriesApplyDefaultsRequest) (*SeriesApplyDefaultsResponse, error) {
+	changed := 0
+	splitChanged := []uuid.UUID{}
+
+	err := database.UpdateTx(r.Ctx, func(tx *sqlx.Tx) error {
+		s, err := models.SeriesQuery(r.Ctx).Find(tx, r.Slug)
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			return Err404
+		}
+
+		books, err := models.BookQuery(r.Ctx).Where("series", "=", s.Slug).Get(tx)
+		if err != nil {
+			return err
+		}
+		for _, book := range books {
+			oldLayout := book.PageRefs()
+			fields := s.ApplyDefaults(book)
+			if len(fields) == 0 {
+				continue
+			}
+			for _, field := range fields {
+				book.UpdateField(field)
+			}
+			err = model.SaveContext(r.Ctx, tx, book)
+			if err != nil {
+				return err
+			}
+			changed++
+
+			if slices.Contains(fields, "split_spreads") {
+				splitChanged = append(splitChanged, book.ID)
+				err = book.TranslateProgress(r.Ctx, tx, oldLayout)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clearBookCache(r.Ctx, splitChanged...)
+	archive.InvalidateSeries(r.Slug)
+
+	return &SeriesApplyDefaultsResponse{Books: changed}, nil
+})
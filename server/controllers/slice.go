@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"fmt"
+	"image"
+	"net/url"
+	"time"
+
+	"github.com/abibby/comicbox-3/server/router"
+	"github.com/abibby/salusa/request"
+)
+
+// sliceHeight is the height of the tiles tall pages are cut into. It keeps
+// each tile small enough to decode quickly on a phone.
+const sliceHeight = 1024
+
+type PageSlice struct {
+	Y      int    `json:"y"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+type SliceManifest struct {
+	Width      int          `json:"width"`
+	Height     int          `json:"height"`
+	TileHeight int          `json:"tile_height"`
+	Tiles      []*PageSlice `json:"tiles"`
+}
+
+// sliceRect returns the part of a page with the given height covered by a
+// slice, or false if the page doesn't reach the slice.
+func sliceRect(width, height, slice int) (image.Rectangle, bool) {
+	y := slice * sliceHeight
+	if slice < 0 || y >= height {
+		return image.Rectangle{}, false
+	}
+	return image.Rect(0, y, width, min(y+sliceHeight, height)), true
+}
+
+// sliceQuery keeps the view settings of the manifest request on the tile urls
+// so the tiles match the manifest.
+func (r *BookPageRequest) sliceQuery() string {
+	q := url.Values{}
+	if r.Half != "" {
+		q.Set("half", r.Half)
+	}
+	if r.Crop != nil {
+		q.Set("crop", fmt.Sprint(*r.Crop))
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// BookPageSlices returns the tiles a page is cut into so a reader can load a
+// long strip a piece at a time instead of decoding the whole image.
+var BookPageSlices = request.Handler(func(r *BookPageRequest) (*SliceManifest, error) {
+	a, view, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	defer a.Release()
+
+	book := a.Book()
+	if r.Page >= len(book.Pages) {
+		return nil, Err404
+	}
+
+	w, h := view.size(book.Pages[r.Page])
+	m := &SliceManifest{
+		Width:      w,
+		Height:     h,
+		TileHeight: sliceHeight,
+		Tiles:      []*PageSlice{},
+	}
+	query := r.sliceQuery()
+	for i := 0; ; i++ {
+		rect, ok := sliceRect(w, h, i)
+		if !ok {
+			break
+		}
+		u, err := router.URL(r.Ctx, "book.page.slice",
+			"id", book.ID.String(),
+			"page", fmt.Sprint(r.Page),
+			"slice", fmt.Sprint(i),
+		)
+		if err != nil {
+			return nil, err
+		}
+		m.Tiles = append(m.Tiles, &PageSlice{
+			Y:      rect.Min.Y,
+			Height: rect.Dy(),
+			URL:    u + query,
+		})
+	}
+	return m, nil
+})
+
+type BookPageSliceRequest struct {
+	BookPageRequest
+
+	Slice int `path:"slice" validate:"min:0"`
+}
+
+var BookPageSlice = request.Handler(func(r *BookPageSliceRequest) (*JpegHandler, error) {
+	a, view, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	defer a.Release()
+
+	img, err := decodePage(r.Ctx, a, r.Page)
+	if err != nil {
+		return nil, err
+	}
+	img, err = view.apply(img)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	rect, ok := sliceRect(b.Dx(), b.Dy(), r.Slice)
+	if !ok {
+		return nil, Err404
+	}
+	img, err = cropImage(img, rect.Add(b.Min))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJpegHandler(img, time.Hour), nil
+})
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"time"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/router"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/request"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/image/draw"
+)
+
+const (
+	spriteTileHeight = 200
+	spriteMaxWidth   = 4096
+)
+
+type SpriteTile struct {
+	Page   int `json:"page"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type SpriteManifest struct {
+	URL        string        `json:"url"`
+	Width      int           `json:"width"`
+	Height     int           `json:"height"`
+	TileHeight int           `json:"tile_height"`
+	Tiles      []*SpriteTile `json:"tiles"`
+}
+
+// The sprite version includes the settings that change its layout so toggling
+// them doesn't serve a cached sheet with the old layout.
+const (
+	spriteCropSuffix  = "-crop"
+	spriteSplitSuffix = "-split"
+)
+
+// spriteView returns the part of the archive page shown for a page of the book.
+func spriteView(book *models.Book, ref models.PageRef, crop bool) *pageView {
+	view := &pageView{half: ref.Half}
+	if crop {
+		view.crop = pageCrop(book, ref, &crop)
+	}
+	return view
+}
+
+// spriteLayout packs the pages from start to end inclusive into rows of tiles
+// with a fixed height. It only uses the page sizes stored on the book so the
+// manifest can be built without opening the archive.
+func spriteLayout(book *models.Book, start, end int, crop bool) *SpriteManifest {
+	m := &SpriteManifest{
+		TileHeight: spriteTileHeight,
+		Tiles:      make([]*SpriteTile, 0, end-start+1),
+	}
+	refs := book.PageRefs()
+	x, y := 0, 0
+	for i := start; i <= end; i++ {
+		p := book.Pages[refs[i].Index]
+		pw, ph := spriteView(book, refs[i], crop).size(p)
+		w := spriteTileHeight * 2 / 3
+		if pw > 0 && ph > 0 {
+			bw, bh := thumbnailBounds(pw, ph)
+			w = thumbnailWidth(bw, bh, spriteTileHeight)
+		}
+		w = min(max(w, 1), spriteMaxWidth)
+
+		if x > 0 && x+w > spriteMaxWidth {
+			x = 0
+			y += spriteTileHeight
+		}
+		m.Tiles = append(m.Tiles, &SpriteTile{
+			Page:   i,
+			X:      x,
+			Y:      y,
+			Width:  w,
+			Height: spriteTileHeight,
+		})
+		x += w
+		m.Width = max(m.Width, x)
+	}
+	m.Height = y + spriteTileHeight
+	return m
+}
+
+type BookSpriteRequest struct {
+	ID    string `path:"id"     validate:"uuid"`
+	Start *int   `query:"start" validate:"min:0"`
+	End   *int   `query:"end"   validate:"min:0"`
+
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+
+func spriteRange(book *models.Book, start, end *int) (int, int, error) {
+	count := len(book.PageRefs())
+	s, e := 0, count-1
+	if start != nil {
+		s = *start
+	}
+	if end != nil {
+		e = *end
+	}
+	if count == 0 || s > e || e >= count {
+		return 0, 0, Err404
+	}
+	return s, e, nil
+}
+
+func spriteVersion(book *models.Book, crop bool) string {
+	v := fmt.Sprint(book.FileModTime.Time().Unix())
+	if crop {
+		v += spriteCropSuffix
+	}
+	if book.SplitSpreads {
+		v += spriteSplitSuffix
+	}
+	return v
+}
+
+// BookSprite returns the layout of a sprite sheet of page thumbnails. The
+// sprite url includes the archive modification time so a changed book is
+// rendered again instead of being served from the thumbnail cache.
+var BookSprite = request.Handler(func(r *BookSpriteRequest) (*SpriteManifest, error) {
+	book, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Book, error) {
+		return models.BookQuery(r.Ctx).With("Series").Find(tx, r.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if book == nil {
+		return nil, Err404
+	}
+
+	start, end, err := spriteRange(book, r.Start, r.End)
+	if err != nil {
+		return nil, err
+	}
+
+	crop := autoCrop(book, nil)
+	m := spriteLayout(book, start, end, crop)
+	m.URL, err = router.URL(r.Ctx, "book.sprite.image",
+		"id", book.ID.String(),
+		"version", spriteVersion(book, crop),
+		"start", fmt.Sprint(start),
+		"end", fmt.Sprint(end),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+})
+
+type BookSpriteImageRequest struct {
+	ID      string `path:"id"      validate:"uuid"`
+	Version string `path:"version"`
+	Start   int    `path:"start"   validate:"min:0"`
+	End     int    `path:"end"     validate:"min:0"`
+
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+
+var BookSpriteImage = request.Handler(func(r *BookSpriteImageRequest) (*JpegHandler, error) {
+	book, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (*models.Book, error) {
+		return models.BookQuery(r.Ctx).Find(tx, r.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if book == nil {
+		return nil, Err404
+	}
+
+	// The settings come from the url so the image always matches the manifest
+	// it was requested from.
+	crop := strings.Contains(r.Version, spriteCropSuffix)
+	book.SplitSpreads = strings.Contains(r.Version, spriteSplitSuffix)
+
+	start, end, err := spriteRange(book, &r.Start, &r.End)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := openBookArchive(r.Ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Release()
+
+	m := spriteLayout(book, start, end, crop)
+	dst := image.NewRGBA(image.Rect(0, 0, m.Width, m.Height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	refs := book.PageRefs()
+	for _, tile := range m.Tiles {
+		ref := refs[tile.Page]
+		img, err := decodePage(r.Ctx, a, ref.Index)
+		if err != nil {
+			return nil, err
+		}
+		img, err = spriteView(book, ref, crop).apply(img)
+		if err != nil {
+			return nil, err
+		}
+		img, err = cropThumbnail(img)
+		if err != nil {
+			return nil, err
+		}
+		rect := image.Rect(tile.X, tile.Y, tile.X+tile.Width, tile.Y+tile.Height)
+		draw.BiLinear.Scale(dst, rect, img, img.Bounds(), draw.Over, nil)
+	}
+
+	return NewJpegHandler(dst, time.Hour), nil
+})
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	"github.com/abibby/comicbox-3/server/metadata"
+	"github.com/abibby/comicbox-3/server/tachibk"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/request"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrNoBackup = errors.New("no backup was uploaded")
+
+// TachibkMaxBodySize limits the size of an import request. Backups are sent
+// base64 encoded, a third larger than the file.
+const TachibkMaxBodySize = 32 << 20
+
+type TachibkImportRequest struct {
+	// Backup is the .tachibk file.
+	Backup []byte `json:"backup"`
+	// Commit saves the import, without it the report of what would be
+	// imported is returned and nothing is changed.
+	Commit bool `json:"commit"`
+	// Series picks the series for entries by their key, for entries that
+	// are ambiguous or matched to the wrong series. An empty slug skips the
+	// entry.
+	Series map[string]string `json:"series"`
+
+	Read   salusadb.Read   `inject:""`
+	Update salusadb.Update `inject:""`
+	Ctx    context.Context `inject:""`
+}
+
+type TachibkImportResponse struct {
+	Committed bool            `json:"committed"`
+	Matched   []*TachibkEntry `json:"matched"`
+	Ambiguous []*TachibkEntry `json:"ambiguous"`
+	Unmatched []*TachibkEntry `json:"unmatched"`
+}
+
+type TachibkEntry struct {
+	// Key identifies the manga in the backup, it is used to pick a series
+	// in TachibkImportRequest.Series.
+	Key        string      `json:"key"`
+	Title      string      `json:"title"`
+	Series     string      `json:"series,omitempty"`
+	Candidates []string    `json:"candidates,omitempty"`
+	List       models.List `json:"list"`
+	// Chapters is the number of chapters that were read or started.
+	Chapters int `json:"chapters"`
+	// Books is the number of books those chapters were matched to.
+	Books             int       `json:"books"`
+	UnmatchedChapters []float64 `json:"unmatched_chapters"`
+
+	manga *tachibk.Manga
+	books []*tachibkBook
+}
+
+type tachibkBook struct {
+	book    *models.Book
+	chapter *tachibk.Chapter
+}
+
+// TachibkImport imports reading progress from a Mihon or Tachiyomi backup.
+// Manga are matched to series by title and chapters to books by chapter
+// number. Read chapters are marked as read, started chapters are set to the
+// page they were left on and series are added to the list matching their
+// categories. Progress is never moved backwards.
+var TachibkImport = request.Handler(func(r *TachibkImportRequest) (*TachibkImportResponse, error) {
+	uid, ok := auth.UserID(r.Ctx)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if len(r.Backup) == 0 {
+		return nil, NewHttpError(422, ErrNoBackup)
+	}
+	backup, err := tachibk.Read(bytes.NewReader(r.Backup))
+	if err != nil {
+		return nil, NewHttpError(422, err)
+	}
+
+	run := r.Read.Run
+	if r.Commit {
+		run = r.Update.Run
+	}
+	resp := &TachibkImportResponse{
+		Committed: r.Commit,
+		Matched:   []*TachibkEntry{},
+		Ambiguous: []*TachibkEntry{},
+		Unmatched: []*TachibkEntry{},
+	}
+	err = run(func(tx *sqlx.Tx) error {
+		series, err := models.SeriesQuery(r.Ctx).Get(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range backup.Manga {
+			entry := &TachibkEntry{
+				Key:               strconv.FormatInt(m.Source, 10) + ":" + m.URL,
+				Title:             m.Title,
+				List:              listFromNames(backup.CategoryNames(m)),
+				UnmatchedChapters: []float64{},
+				manga:             m,
+			}
+			for _, c := range m.Chapters {
+				if c.Read || c.LastPageRead > 0 {
+					entry.Chapters++
+				}
+			}
+			if entry.Chapters == 0 && !m.Favorite {
+				continue
+			}
+
+			if slug, ok := r.Series[entry.Key]; ok {
+				if slug != "" && !slices.ContainsFunc(series, func(s *models.Series) bool { return s.Slug == slug }) {
+					return NewHttpError(422, fmt.Errorf("no series with the slug %s", slug))
+				}
+				entry.Series = slug
+			} else {
+				match, candidates := metadata.MatchSeries(series, m.Title)
+				if match != nil {
+					entry.Series = match.Slug
+				} else {
+					entry.Candidates = []string{}
+				}
+				for _, c := range candidates[:min(len(candidates), 5)] {
+					entry.Candidates = append(entry.Candidates, c.Slug)
+				}
+			}
+
+			switch {
+			case entry.Series != "":
+				err = tachibkMatchBooks(r.Ctx, tx, entry)
+				if err != nil {
+					return err
+				}
+				resp.Matched = append(resp.Matched, entry)
+			case len(entry.Candidates) > 0:
+				resp.Ambiguous = append(resp.Ambiguous, entry)
+			default:
+				resp.Unmatched = append(resp.Unmatched, entry)
+			}
+		}
+
+		if !r.Commit {
+			return nil
+		}
+		for _, entry := range resp.Matched {
+			err = tachibkSave(r.Ctx, tx, uid, entry)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+})
+
+// tachibkMatchBooks matches the chapters of an entry that were read or
+// started to the books in its series with the same chapter number.
+func tachibkMatchBooks(ctx context.Context, tx *sqlx.Tx, entry *TachibkEntry) error {
+	books, err := models.BookQuery(ctx).Where("series", "=", entry.Series).Get(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range entry.manga.Chapters {
+		if !c.Read && c.LastPageRead == 0 {
+			continue
+		}
+		matched := false
+		for _, b := range books {
+			number, ok := b.Chapter.Ok()
+			if ok && c.ChapterNumber >= 0 && math.Abs(number-c.ChapterNumber) < 0.001 {
+				entry.books = append(entry.books, &tachibkBook{book: b, chapter: c})
+				matched = true
+			}
+		}
+		if !matched {
+			entry.UnmatchedChapters = append(entry.UnmatchedChapters, c.ChapterNumber)
+		}
+	}
+	entry.Books = len(entry.books)
+	return nil
+}
+
+func tachibkSave(ctx context.Context, tx *sqlx.Tx, uid uuid.UUID, entry *TachibkEntry) error {
+	for _, b := range entry.books {
+		page := archiveCurrentPage(b.book, int(b.chapter.LastPageRead))
+		if b.chapter.Read {
+			page = max(b.book.PageCount-1, 0)
+		}
+
+		err := models.AdvanceUserBook(ctx, tx, uid, b.book.ID, page)
+		if err != nil {
+			return err
+		}
+	}
+
+	if entry.List == models.ListNone {
+		return nil
+	}
+	us, err := models.UserSeriesQuery(ctx).Where("series_name", "=", entry.Series).First(tx)
+	if err != nil {
+		return err
+	}
+	if us == nil {
+		us = &models.UserSeries{UserID: uid, SeriesSlug: entry.Series}
+	}
+	if us.UpdateMap == nil {
+		us.UpdateMap = map[string]string{}
+	}
+	us.List = entry.List
+	us.UpdateField("list")
+	return model.SaveContext(ctx, tx, us)
+}
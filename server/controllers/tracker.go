@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/abibby/comicbox-3/app/events"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	"github.com/abibby/comicbox-3/server/tracker"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/event"
+	"github.com/abibby/salusa/request"
+	"github.com/jmoiron/sqlx"
+)
+
+type TrackerResponse struct {
+	Service models.TrackerService `json:"service"`
+	// Password is true for trackers that log in with a username and
+	// password instead of redirecting to their site.
+	Password bool   `json:"password"`
+	Linked   bool   `json:"linked"`
+	Username string `json:"username"`
+}
+
+func newTrackerResponse(t tracker.Tracker, account *models.UserTracker) *TrackerResponse {
+	resp := &TrackerResponse{
+		Service:  t.Service(),
+		Password: tracker.PasswordLogin(t),
+	}
+	if account != nil && account.Linked() {
+		resp.Linked = true
+		resp.Username = account.Username
+	}
+	return resp
+}
+
+// findTracker returns the tracker for service along with the user's account
+// on it. The account is new if the user hasn't started logging in.
+func findTracker(ctx context.Context, tx *sqlx.Tx, service models.TrackerService) (tracker.Tracker, *models.UserTracker, error) {
+	uid, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, nil, ErrUnauthorized
+	}
+	t := tracker.Find(service)
+	if t == nil {
+		return nil, nil, Err404
+	}
+	account, err := models.UserTrackerQuery(ctx).Where("service", "=", service).First(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if account == nil {
+		account = &models.UserTracker{UserID: uid, Service: service}
+	}
+	return t, account, nil
+}
+
+type TrackerListRequest struct {
+	Read salusadb.Read   `inject:""`
+	Ctx  context.Context `inject:""`
+}
+
+// TrackerList lists the reading trackers set up on the server and whether
+// the user has linked them.
+var TrackerList = request.Handler(func(r *TrackerListRequest) ([]*TrackerResponse, error) {
+	accounts, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) ([]*models.UserTracker, error) {
+		return models.UserTrackerQuery(r.Ctx).Get(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	trackers := tracker.Trackers()
+	resp := make([]*TrackerResponse, len(trackers))
+	for i, t := range trackers {
+		var account *models.UserTracker
+		for _, a := range accounts {
+			if a.Service == t.Service() {
+				account = a
+			}
+		}
+		resp[i] = newTrackerResponse(t, account)
+	}
+	return resp, nil
+})
+
+type TrackerAuthorizeRequest struct {
+	Service     models.TrackerService `path:"service"`
+	RedirectURI string                `query:"redirect_uri" validate:"require"`
+
+	Update salusadb.Update `inject:""`
+	Ctx    context.Context `inject:""`
+}
+
+type TrackerAuthorizeResponse struct {
+	URL string `json:"url"`
+}
+
+// TrackerAuthorize returns the page the user logs in to the tracker on.
+var TrackerAuthorize = request.Handler(func(r *TrackerAuthorizeRequest) (*TrackerAuthorizeResponse, error) {
+	return salusadb.Value(r.Update, func(tx *sqlx.Tx) (*TrackerAuthorizeResponse, error) {
+		t, account, err := findTracker(r.Ctx, tx, r.Service)
+		if err != nil {
+			return nil, err
+		}
+		authorizeURL, err := t.AuthorizeURL(account, r.RedirectURI)
+		if err != nil {
+			return nil, NewHttpError(422, err)
+		}
+		err = model.SaveContext(r.Ctx, tx, account)
+		if err != nil {
+			return nil, err
+		}
+		return &TrackerAuthorizeResponse{URL: authorizeURL}, nil
+	})
+})
+
+type TrackerLoginRequest struct {
+	Service models.TrackerService `path:"service"`
+	// Code and RedirectURI are used by trackers that redirect back after
+	// logging in, RedirectURI must match the one the code was requested
+	// with.
+	Code        string `json:"code"`
+	RedirectURI string `json:"redirect_uri"`
+	// Username and Password are used by trackers that don't redirect.
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	Read   salusadb.Read   `inject:""`
+	Update salusadb.Update `inject:""`
+	Queue  event.Queue     `inject:""`
+	Ctx    context.Context `inject:""`
+}
+
+type TrackerLoginResponse struct {
+	*TrackerResponse
+	Import *tracker.ImportResult `json:"import"`
+}
+
+// TrackerLogin links the user's account on the tracker, imports their lists
+// and progress from it and starts syncing with it.
+var TrackerLogin = request.Handler(func(r *TrackerLoginRequest) (*TrackerLoginResponse, error) {
+	var t tracker.Tracker
+	var account *models.UserTracker
+	err := r.Update(func(tx *sqlx.Tx) error {
+		var err error
+		t, account, err = findTracker(r.Ctx, tx, r.Service)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Login(r.Ctx, account, &tracker.LoginRequest{
+		Code:        r.Code,
+		RedirectURI: r.RedirectURI,
+		Username:    r.Username,
+		Password:    r.Password,
+	})
+	if err != nil {
+		return nil, NewHttpError(422, err)
+	}
+
+	err = r.Update(func(tx *sqlx.Tx) error {
+		return model.SaveContext(r.Ctx, tx, account)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tracker.Import(r.Ctx, r.Read, r.Update, t, account)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Queue.Push(&events.TrackerSyncEvent{UserID: account.UserID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrackerLoginResponse{
+		TrackerResponse: newTrackerResponse(t, account),
+		Import:          result,
+	}, nil
+})
+
+type TrackerLogoutRequest struct {
+	Service models.TrackerService `path:"service"`
+
+	Update salusadb.Update `inject:""`
+	Ctx    context.Context `inject:""`
+}
+
+type TrackerLogoutResponse struct {
+	Success bool `json:"success"`
+}
+
+// TrackerLogout unlinks the user's account on the tracker.
+var TrackerLogout = request.Handler(func(r *TrackerLogoutRequest) (*TrackerLogoutResponse, error) {
+	err := r.Update(func(tx *sqlx.Tx) error {
+		return models.UserTrackerQuery(r.Ctx).Where("service", "=", r.Service).Delete(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TrackerLogoutResponse{
+		Success: true,
+	}, nil
+})
+
+type TrackerSyncRequest struct {
+	Read  salusadb.Read   `inject:""`
+	Queue event.Queue     `inject:""`
+	Ctx   context.Context `inject:""`
+}
+
+type TrackerSyncResponse struct {
+	Success bool `json:"success"`
+}
+
+// TrackerSync starts syncing the user's lists and progress with their
+// trackers without waiting for the next scheduled sync.
+var TrackerSync = request.Handler(func(r *TrackerSyncRequest) (*TrackerSyncResponse, error) {
+	uid, ok := auth.UserID(r.Ctx)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	linked, err := salusadb.Value(r.Read, func(tx *sqlx.Tx) (int, error) {
+		return models.UserTrackerQuery(r.Ctx).Where("access_token", "!=", "").Count(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if linked == 0 {
+		return nil, NewHttpError(422, tracker.ErrNotLinked)
+	}
+
+	err = r.Queue.Push(&events.TrackerSyncEvent{UserID: uid})
+	if err != nil {
+		return nil, err
+	}
+	return &TrackerSyncResponse{
+		Success: true,
+	}, nil
+})
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/abibby/comicbox-3/database"
@@ -67,3 +68,25 @@ var UserSeriesUpdate = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Req
 
 	sendJSON(rw, us)
 })
+
+// listFromNames picks the list matching the names of categories or
+// collections from other apps. They aren't fixed so common names are
+// recognised.
+func listFromNames(names []string) models.List {
+	for _, n := range names {
+		name := strings.ToLower(n)
+		switch {
+		case strings.Contains(name, "hold"), strings.Contains(name, "pause"):
+			return models.ListPaused
+		case strings.Contains(name, "drop"):
+			return models.ListDropped
+		case strings.Contains(name, "complete"), strings.Contains(name, "finish"):
+			return models.ListCompleted
+		case strings.Contains(name, "plan"), strings.Contains(name, "to read"), strings.Contains(name, "later"):
+			return models.ListPlanning
+		case strings.Contains(name, "reading"), strings.Contains(name, "current"):
+			return models.ListReading
+		}
+	}
+	return models.ListNone
+}
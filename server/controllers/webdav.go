@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/davfs"
+	"github.com/abibby/salusa/router"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/net/webdav"
+)
+
+// webdavMethods are the methods needed to browse and download, the view is
+// read only.
+var webdavMethods = []string{http.MethodOptions, http.MethodGet, http.MethodHead, "PROPFIND"}
+
+// WebDAVMiddleware sends requests under config.WebDAVPath to h. Routes are
+// registered before the config is loaded so the path is checked on each
+// request.
+func WebDAVMiddleware(h http.Handler) router.Middleware {
+	return router.InlineMiddlewareFunc(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		prefix := strings.TrimSuffix(config.WebDAVPath, "/")
+		if prefix != "" && (r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WebDAV serves the library at config.WebDAVPath as a read-only WebDAV share
+// with a directory per series and a file per book, both named by their
+// display titles.
+func WebDAV() http.Handler {
+	fsys := davfs.New(time.Minute, webdavTree)
+	handler := sync.OnceValue(func() *webdav.Handler {
+		return &webdav.Handler{
+			Prefix:     strings.TrimSuffix(config.WebDAVPath, "/"),
+			FileSystem: fsys,
+			LockSystem: webdav.NewMemLS(),
+		}
+	})
+	allow := strings.Join(webdavMethods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(webdavMethods, r.Method) {
+			w.Header().Set("Allow", allow)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Method == http.MethodOptions {
+			// The webdav handler would advertise the write methods too.
+			w.Header().Set("Allow", allow)
+			w.Header().Set("DAV", "1")
+			return
+		}
+		handler().ServeHTTP(w, r)
+	})
+}
+
+func webdavTree(ctx context.Context) (*davfs.Entry, error) {
+	root := &davfs.Entry{}
+	err := database.ReadTx(ctx, func(tx *sqlx.Tx) error {
+		series, err := models.SeriesQuery(ctx).OrderBy("display_name").Get(tx)
+		if err != nil {
+			return err
+		}
+		books, err := models.BookQuery(ctx).OrderBy("sort").Get(tx)
+		if err != nil {
+			return err
+		}
+
+		dirs := make(map[string]*davfs.Entry, len(series))
+		for _, s := range series {
+			dirs[s.Slug] = &davfs.Entry{Name: davfs.SanitizeName(s.Name)}
+		}
+		for _, b := range books {
+			dir, ok := dirs[b.SeriesSlug]
+			if !ok {
+				continue
+			}
+			name := davfs.SanitizeName(dir.Name + " - " + opdsBookTitle(b))
+			dir.Add(&davfs.Entry{
+				Name:    name + path.Ext(b.File),
+				Path:    b.FilePath(),
+				Size:    b.FileSize,
+				ModTime: b.FileModTime.Time(),
+			})
+		}
+		// Series are added once their books are so the root's modified time
+		// covers them.
+		for _, s := range series {
+			root.Add(dirs[s.Slug])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
@@ -0,0 +1,255 @@
+// Package davfs serves a virtual, read-only directory tree over WebDAV. The
+// tree is built from the database so it can be organised differently from
+// the files on disk.
+package davfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/webdav"
+)
+
+// Entry is a file or directory in the tree. Files are read from Path.
+type Entry struct {
+	Name     string
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	Children []*Entry
+}
+
+func (e *Entry) IsDir() bool {
+	return e.Path == ""
+}
+
+// Add adds a child, numbering its name before the extension if another child
+// already has it.
+func (e *Entry) Add(child *Entry) {
+	base := child.Name
+	ext := ""
+	if !child.IsDir() {
+		ext = path.Ext(base)
+		base = strings.TrimSuffix(base, ext)
+	}
+	name := base + ext
+	for i := 2; e.hasChild(name); i++ {
+		name = base + " (" + strconv.Itoa(i) + ")" + ext
+	}
+	child.Name = name
+	e.Children = append(e.Children, child)
+	if child.ModTime.After(e.ModTime) {
+		e.ModTime = child.ModTime
+	}
+}
+
+// hasChild reports whether a child has name, ignoring case since some
+// clients can't tell names apart by case.
+func (e *Entry) hasChild(name string) bool {
+	for _, c := range e.Children {
+		if strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Entry) child(name string) *Entry {
+	for _, c := range e.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// SanitizeName makes a title safe to use as a file name on any platform.
+func SanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case r < 0x20, r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// FileSystem is a webdav.FileSystem over the tree returned by load. Clients
+// make many requests while browsing, the tree is reused for ttl.
+type FileSystem struct {
+	load func(ctx context.Context) (*Entry, error)
+	ttl  time.Duration
+
+	mtx     sync.Mutex
+	root    *Entry
+	expires time.Time
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+func New(ttl time.Duration, load func(ctx context.Context) (*Entry, error)) *FileSystem {
+	return &FileSystem{load: load, ttl: ttl}
+}
+
+func (fsys *FileSystem) tree(ctx context.Context) (*Entry, error) {
+	fsys.mtx.Lock()
+	defer fsys.mtx.Unlock()
+	if fsys.root != nil && time.Now().Before(fsys.expires) {
+		return fsys.root, nil
+	}
+	root, err := fsys.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fsys.root = root
+	fsys.expires = time.Now().Add(fsys.ttl)
+	return root, nil
+}
+
+func (fsys *FileSystem) find(ctx context.Context, name string) (*Entry, error) {
+	root, err := fsys.tree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e := root
+	for _, part := range strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		e = e.child(part)
+		if e == nil {
+			return nil, os.ErrNotExist
+		}
+	}
+	return e, nil
+}
+
+func (fsys *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+func (fsys *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+func (fsys *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (fsys *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	e, err := fsys.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsDir() {
+		return &dir{entry: e}, nil
+	}
+	f, err := os.Open(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &file{File: f, entry: e}, nil
+}
+
+func (fsys *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	e, err := fsys.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return info{e}, nil
+}
+
+// info describes an entry by its name in the tree rather than on disk.
+type info struct {
+	entry *Entry
+}
+
+func (i info) Name() string       { return i.entry.Name }
+func (i info) Size() int64        { return i.entry.Size }
+func (i info) ModTime() time.Time { return i.entry.ModTime }
+func (i info) IsDir() bool        { return i.entry.IsDir() }
+func (i info) Sys() any           { return nil }
+func (i info) Mode() fs.FileMode {
+	if i.entry.IsDir() {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+type file struct {
+	*os.File
+	entry *Entry
+}
+
+func (f *file) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+func (f *file) Stat() (fs.FileInfo, error) {
+	return info{f.entry}, nil
+}
+func (f *file) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+type dir struct {
+	entry *Entry
+	pos   int
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+func (d *dir) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+func (d *dir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.pos = 0
+		return 0, nil
+	}
+	return 0, os.ErrInvalid
+}
+func (d *dir) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return info{d.entry}, nil
+}
+
+// Readdir follows os.File.Readdir, with count <= 0 it returns every
+// remaining entry.
+func (d *dir) Readdir(count int) ([]fs.FileInfo, error) {
+	children := d.entry.Children[d.pos:]
+	if count > 0 {
+		if len(children) == 0 {
+			return nil, io.EOF
+		}
+		children = children[:min(count, len(children))]
+	}
+	d.pos += len(children)
+
+	infos := make([]fs.FileInfo, len(children))
+	for i, c := range children {
+		infos[i] = info{c}
+	}
+	return infos, nil
+}
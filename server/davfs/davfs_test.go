@@ -0,0 +1,103 @@
+package davfs_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/server/davfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeName(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Expected string
+	}{
+		{"Saga", "Saga"},
+		{"What If?: Part 1/2", "What If__ Part 1_2"},
+		{"  lots   of\tspace ", "lots of space"},
+		{"Vol. 1...", "Vol. 1"},
+		{"\x00\x1f", "_"},
+		{"", "_"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, davfs.SanitizeName(tc.Name))
+		})
+	}
+}
+
+func TestEntry_Add(t *testing.T) {
+	root := &davfs.Entry{}
+	root.Add(&davfs.Entry{Name: "Saga"})
+	root.Add(&davfs.Entry{Name: "saga"})
+	root.Add(&davfs.Entry{Name: "Saga #1.cbz", Path: "a.cbz"})
+	root.Add(&davfs.Entry{Name: "Saga #1.cbz", Path: "b.cbz"})
+
+	names := []string{}
+	for _, c := range root.Children {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"Saga", "saga (2)", "Saga #1.cbz", "Saga #1 (2).cbz"}, names)
+}
+
+func TestFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "book.cbz")
+	assert.NoError(t, os.WriteFile(file, []byte("comic"), 0o644))
+
+	loads := 0
+	fsys := davfs.New(time.Minute, func(ctx context.Context) (*davfs.Entry, error) {
+		loads++
+		root := &davfs.Entry{}
+		series := &davfs.Entry{Name: "Saga"}
+		series.Add(&davfs.Entry{Name: "Saga - #1.cbz", Path: file, Size: 5})
+		root.Add(series)
+		return root, nil
+	})
+	ctx := context.Background()
+
+	t.Run("readdir", func(t *testing.T) {
+		f, err := fsys.OpenFile(ctx, "/Saga/", os.O_RDONLY, 0)
+		assert.NoError(t, err)
+		defer f.Close()
+
+		infos, err := f.Readdir(0)
+		assert.NoError(t, err)
+		assert.Len(t, infos, 1)
+		assert.Equal(t, "Saga - #1.cbz", infos[0].Name())
+		assert.Equal(t, int64(5), infos[0].Size())
+	})
+
+	t.Run("read", func(t *testing.T) {
+		f, err := fsys.OpenFile(ctx, "/Saga/Saga - #1.cbz", os.O_RDONLY, 0)
+		assert.NoError(t, err)
+		defer f.Close()
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, "comic", string(b))
+
+		info, err := f.Stat()
+		assert.NoError(t, err)
+		assert.Equal(t, "Saga - #1.cbz", info.Name())
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := fsys.Stat(ctx, "/Saga/book.cbz")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		_, err := fsys.OpenFile(ctx, "/Saga/new.cbz", os.O_WRONLY|os.O_CREATE, 0o644)
+		assert.ErrorIs(t, err, os.ErrPermission)
+		assert.ErrorIs(t, fsys.Mkdir(ctx, "/new", 0o755), os.ErrPermission)
+		assert.ErrorIs(t, fsys.RemoveAll(ctx, "/Saga"), os.ErrPermission)
+	})
+
+	assert.Equal(t, 1, loads)
+}
@@ -0,0 +1,133 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurHashSampleSize is the width of the image the hash is calculated from.
+// BlurHash only keeps a few low frequency components so a larger sample
+// doesn't change the result meaningfully.
+const blurHashSampleSize = 32
+
+// BlurHash returns a BlurHash (https://blurha.sh) placeholder for img. Portrait
+// images use 3x4 components and landscape images 4x3.
+func BlurHash(img image.Image) string {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return ""
+	}
+
+	xComponents, yComponents := 3, 4
+	if b.Dx() > b.Dy() {
+		xComponents, yComponents = 4, 3
+	}
+
+	w := blurHashSampleSize
+	h := max(1, b.Dy()*w/b.Dx())
+	if b.Dx() > b.Dy() {
+		h = blurHashSampleSize
+		w = max(1, b.Dx()*h/b.Dy())
+	}
+	sample := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(sample, sample.Bounds(), img, b, draw.Src, nil)
+
+	return encodeBlurHash(sample, xComponents, yComponents)
+}
+
+func encodeBlurHash(img *image.RGBA, xComponents, yComponents int) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for y := range yComponents {
+		for x := range xComponents {
+			factors = append(factors, blurHashFactor(img, width, height, x, y))
+		}
+	}
+
+	sb := &strings.Builder{}
+	writeBase83(sb, (xComponents-1)+(yComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, f := range ac {
+			actualMaximum = max(actualMaximum, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2]))
+		}
+		quantisedMaximum := int(max(0, min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		writeBase83(sb, quantisedMaximum, 1)
+	} else {
+		writeBase83(sb, 0, 1)
+	}
+
+	writeBase83(sb, linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+
+	for _, f := range ac {
+		quantR := quantiseAC(f[0], maximumValue)
+		quantG := quantiseAC(f[1], maximumValue)
+		quantB := quantiseAC(f[2], maximumValue)
+		writeBase83(sb, quantR*19*19+quantG*19+quantB, 2)
+	}
+
+	return sb.String()
+}
+
+func blurHashFactor(img *image.RGBA, width, height, xComponent, yComponent int) [3]float64 {
+	var r, g, b float64
+	for y := range height {
+		for x := range width {
+			basis := math.Cos(math.Pi*float64(xComponent)*float64(x)/float64(width)) *
+				math.Cos(math.Pi*float64(yComponent)*float64(y)/float64(height))
+			c := img.RGBAAt(x, y)
+			r += basis * sRGBToLinear(c.R)
+			g += basis * sRGBToLinear(c.G)
+			b += basis * sRGBToLinear(c.B)
+		}
+	}
+
+	normalisation := 2.0
+	if xComponent == 0 && yComponent == 0 {
+		normalisation = 1
+	}
+	scale := normalisation / float64(width*height)
+	return [3]float64{r * scale, g * scale, b * scale}
+}
+
+func quantiseAC(value, maximumValue float64) int {
+	return int(max(0, min(18, math.Floor(signPow(value/maximumValue, 0.5)*9+9.5))))
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+func sRGBToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := max(0, min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func writeBase83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		sb.WriteByte(base83Chars[digit])
+	}
+}
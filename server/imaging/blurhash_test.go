@@ -0,0 +1,48 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/draw"
+)
+
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestBlurHash(t *testing.T) {
+	t.Run("solid colour", func(t *testing.T) {
+		hash := encodeBlurHash(solid(8, 8, color.RGBA{255, 0, 0, 255}), 4, 3)
+		assert.Equal(t, "LfTI:j|cfQ|c|csUfQsUfQfQfQfQ", hash)
+	})
+
+	t.Run("gradient", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 6, 9))
+		for y := range 9 {
+			for x := range 6 {
+				img.Set(x, y, color.RGBA{uint8(x * 40), uint8(y * 25), uint8((x + y) * 10), 255})
+			}
+		}
+		assert.Equal(t, "TZEMEV3NN@uoRTa}f$fkfRxsSxa{", encodeBlurHash(img, 3, 4))
+	})
+
+	t.Run("length matches components", func(t *testing.T) {
+		img := solid(60, 90, color.RGBA{10, 200, 30, 255})
+		draw.Draw(img, image.Rect(0, 0, 30, 45), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+		hash := BlurHash(img)
+		assert.Len(t, hash, 4+2*3*4)
+
+		hash = BlurHash(solid(90, 60, color.Black))
+		assert.Len(t, hash, 4+2*4*3)
+	})
+
+	t.Run("empty image", func(t *testing.T) {
+		assert.Equal(t, "", BlurHash(image.NewRGBA(image.Rectangle{})))
+	})
+}
@@ -0,0 +1,76 @@
+package imaging
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// edgeSamples is the number of points read along each side of an image.
+	edgeSamples = 64
+	// edgeDepth is the fraction of the image width averaged into each point.
+	edgeDepth = 0.01
+	// edgeMinContrast is the smallest standard deviation of brightness an edge
+	// needs to be compared. Flat edges, like a white gutter, match anything.
+	edgeMinContrast = 12
+)
+
+// Edge is the brightness along one side of an image, top to bottom.
+type Edge []uint8
+
+// Edges returns the brightness along the left and right sides of img.
+func Edges(img image.Image) (left, right Edge) {
+	b := img.Bounds()
+	depth := max(1, int(float64(b.Dx())*edgeDepth))
+	left = edge(img, image.Rect(b.Min.X, b.Min.Y, b.Min.X+depth, b.Max.Y))
+	right = edge(img, image.Rect(b.Max.X-depth, b.Min.Y, b.Max.X, b.Max.Y))
+	return left, right
+}
+
+func edge(img image.Image, r image.Rectangle) Edge {
+	small := image.NewGray(image.Rect(0, 0, 1, edgeSamples))
+	draw.CatmullRom.Scale(small, small.Bounds(), img, r, draw.Src, nil)
+	return Edge(small.Pix)
+}
+
+// Continuity scores how well edge a continues into edge b, from -1 to 1. The
+// facing sides of the two halves of a spread score close to 1. Edges without
+// enough detail to tell score 0.
+func Continuity(a, b Edge) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	meanA, sdA := stats(a)
+	meanB, sdB := stats(b)
+	if sdA < edgeMinContrast || sdB < edgeMinContrast {
+		return 0
+	}
+
+	cov := 0.0
+	diff := 0.0
+	for i := range a {
+		cov += (float64(a[i]) - meanA) * (float64(b[i]) - meanB)
+		diff += float64(absDiff(a[i], b[i]))
+	}
+	n := float64(len(a))
+	corr := cov / n / (sdA * sdB)
+
+	// Correlation ignores brightness, penalise edges that line up but don't
+	// match in tone.
+	return math.Max(-1, math.Min(1, corr-diff/n/128))
+}
+
+func stats(e Edge) (mean, sd float64) {
+	for _, v := range e {
+		mean += float64(v)
+	}
+	mean /= float64(len(e))
+	for _, v := range e {
+		d := float64(v) - mean
+		sd += d * d
+	}
+	return mean, math.Sqrt(sd / float64(len(e)))
+}
@@ -0,0 +1,32 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContinuity(t *testing.T) {
+	spread := solid(800, 600, color.White)
+	for y := range 600 {
+		for x := range 800 {
+			spread.Set(x, y, color.Gray{Y: uint8((y/10)%2*160 + x/20)})
+		}
+	}
+	left := spread.SubImage(image.Rect(0, 0, 400, 600))
+	right := spread.SubImage(image.Rect(400, 0, 800, 600))
+
+	_, leftEdge := Edges(left)
+	rightEdge, _ := Edges(right)
+	assert.Greater(t, Continuity(leftEdge, rightEdge), 0.9)
+
+	other := solid(400, 600, color.White)
+	artwork(other, other.Bounds())
+	otherEdge, _ := Edges(other)
+	assert.Less(t, Continuity(leftEdge, otherEdge), 0.5)
+
+	blank, _ := Edges(solid(400, 600, color.White))
+	assert.Equal(t, 0.0, Continuity(blank, blank))
+}
@@ -0,0 +1,188 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "image/gif"
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"github.com/abibby/comicbox-3/config"
+)
+
+// ErrNoEncoder is returned when encoding without an IMAGE_ENCODER command.
+var ErrNoEncoder = errors.New("no image encoder configured, set IMAGE_ENCODER")
+
+// ErrNoDecoder is returned when decoding a format without a Go decoder through
+// image.Decode, or through Decode without an IMAGE_DECODER command.
+var ErrNoDecoder = errors.New("no decoder available for this image format, set IMAGE_DECODER")
+
+// commandTimeout limits how long the IMAGE_DECODER and IMAGE_ENCODER commands
+// may take for one image.
+const commandTimeout = time.Minute
+
+// externalFormats are the formats decoded by the IMAGE_DECODER command.
+var externalFormats = map[string]bool{
+	"avif": true,
+	"heic": true,
+	"jxl":  true,
+}
+
+// contentTypes maps the extensions of supported page images to their MIME
+// types.
+var contentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".avif": "image/avif",
+	".jxl":  "image/jxl",
+	".heic": "image/heic",
+	".heif": "image/heif",
+}
+
+// universalTypes are the formats every supported browser displays. Other
+// formats are only sent to clients that list them in their Accept header.
+var universalTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+func init() {
+	// Go has no decoders for these formats. Their sizes are read from the
+	// headers and Decode gets the pixels from the external decoder.
+	for _, brand := range []string{"avif", "avis"} {
+		image.RegisterFormat("avif", "????ftyp"+brand, decodeExternal, isobmffConfig)
+	}
+	for _, brand := range []string{"heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1"} {
+		image.RegisterFormat("heic", "????ftyp"+brand, decodeExternal, isobmffConfig)
+	}
+	image.RegisterFormat("jxl", jxlCodestreamSignature, decodeExternal, jxlConfig)
+	image.RegisterFormat("jxl", jxlContainerSignature, decodeExternal, jxlConfig)
+}
+
+// IsImage reports whether a file name has the extension of a supported image
+// format.
+func IsImage(name string) bool {
+	_, ok := contentTypes[strings.ToLower(path.Ext(name))]
+	return ok
+}
+
+// ContentType returns the MIME type of an image from its file name.
+func ContentType(name string) string {
+	return contentTypes[strings.ToLower(path.Ext(name))]
+}
+
+// Negotiated reports whether images of contentType are only sent as they are
+// to clients that accept them.
+func Negotiated(contentType string) bool {
+	return contentType != "" && !universalTypes[contentType]
+}
+
+// NeedsTranscode reports whether an image of contentType has to be converted
+// before it is sent to a client with the given Accept header. Wildcards don't
+// count for formats outside universalTypes, browsers send image/* whether or
+// not they can display TIFF or HEIC.
+func NeedsTranscode(contentType, accept string) bool {
+	if !Negotiated(contentType) {
+		return false
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), contentType) {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0"
+	}
+	return true
+}
+
+// Decode decodes an image like image.Decode, formats that go through the
+// IMAGE_DECODER command are stopped when ctx is done.
+func Decode(ctx context.Context, r io.Reader) (image.Image, string, error) {
+	header := &bytes.Buffer{}
+	_, format, err := image.DecodeConfig(io.TeeReader(r, header))
+	if err != nil {
+		return nil, "", err
+	}
+	r = io.MultiReader(header, r)
+	if !externalFormats[format] {
+		return image.Decode(r)
+	}
+	img, err := runDecoder(ctx, r)
+	return img, format, err
+}
+
+// decodeExternal is registered with image.Decode for formats without a Go
+// decoder. It never runs the IMAGE_DECODER command, which is only run by
+// Decode so it stops with the caller's context.
+func decodeExternal(r io.Reader) (image.Image, error) {
+	return nil, ErrNoDecoder
+}
+
+// runDecoder decodes an image by piping it through the IMAGE_DECODER command,
+// which must write a PNG to stdout.
+func runDecoder(ctx context.Context, r io.Reader) (image.Image, error) {
+	args := strings.Fields(config.ImageDecoder)
+	if len(args) == 0 {
+		return nil, ErrNoDecoder
+	}
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = r
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("image decoder: %w: %s", errors.Join(err, ctx.Err()), strings.TrimSpace(stderr.String()))
+	}
+	return png.Decode(bytes.NewReader(out))
+}
+
+// Encode converts an image in any format the IMAGE_ENCODER command reads to
+// format, "webp" or "avif", at a quality from 1 to 100.
+func Encode(ctx context.Context, data []byte, format string, quality int) ([]byte, error) {
+	args := strings.Fields(config.ImageEncoder)
+	if len(args) == 0 {
+		return nil, ErrNoEncoder
+	}
+	replacer := strings.NewReplacer("{format}", format, "{quality}", strconv.Itoa(quality))
+	for i, arg := range args {
+		args[i] = replacer.Replace(arg)
+	}
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("image encoder: %w: %s", errors.Join(err, ctx.Err()), strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
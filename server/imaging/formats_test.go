@@ -0,0 +1,169 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+func TestNeedsTranscode(t *testing.T) {
+	chrome := "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8"
+	assert.False(t, NeedsTranscode("image/jpeg", ""))
+	assert.False(t, NeedsTranscode("image/avif", chrome))
+	assert.True(t, NeedsTranscode("image/tiff", chrome), "wildcards don't count")
+	assert.True(t, NeedsTranscode("image/jxl", chrome))
+	assert.False(t, NeedsTranscode("image/jxl", "image/jxl;q=0.9, image/*"))
+	assert.True(t, NeedsTranscode("image/heic", "image/heic; q=0"))
+}
+
+func TestIsImage(t *testing.T) {
+	assert.True(t, IsImage("01.JPG"))
+	assert.True(t, IsImage("dir/02.avif"))
+	assert.True(t, IsImage("03.jxl"))
+	assert.False(t, IsImage("book.json"))
+	assert.Equal(t, "image/heic", ContentType("04.HEIC"))
+}
+
+func TestDecodeConfig_bmp_tiff(t *testing.T) {
+	img := solid(30, 20, color.White)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, bmp.Encode(buf, img))
+	cfg, format, err := image.DecodeConfig(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "bmp", format)
+	assert.Equal(t, 30, cfg.Width)
+
+	buf.Reset()
+	assert.NoError(t, tiff.Encode(buf, img, nil))
+	cfg, format, err = image.DecodeConfig(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "tiff", format)
+	assert.Equal(t, 20, cfg.Height)
+}
+
+func testBox(typ string, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)+8))
+	return append(append(b, typ...), data...)
+}
+
+func ispe(w, h uint32) []byte {
+	body := binary.BigEndian.AppendUint32(make([]byte, 4), w)
+	return testBox("ispe", binary.BigEndian.AppendUint32(body, h))
+}
+
+func TestDecodeConfig_avif(t *testing.T) {
+	file := bytes.Join([][]byte{
+		testBox("ftyp", []byte("avif\x00\x00\x00\x00mif1")),
+		testBox("meta", make([]byte, 4),
+			testBox("hdlr", make([]byte, 24)),
+			testBox("iprp", testBox("ipco",
+				ispe(160, 240),
+				ispe(1600, 2400),
+			)),
+		),
+		testBox("mdat", make([]byte, 100)),
+	}, nil)
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, "avif", format)
+	assert.Equal(t, 1600, cfg.Width)
+	assert.Equal(t, 2400, cfg.Height)
+
+	_, _, err = image.Decode(bytes.NewReader(file))
+	assert.ErrorIs(t, err, ErrNoDecoder)
+
+	oldDecoder := config.ImageDecoder
+	config.ImageDecoder = "sleep 10"
+	defer func() { config.ImageDecoder = oldDecoder }()
+
+	_, _, err = image.Decode(bytes.NewReader(file))
+	assert.ErrorIs(t, err, ErrNoDecoder, "image.Decode never runs the decoder")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	_, format, err = Decode(ctx, bytes.NewReader(file))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, "avif", format)
+	assert.Less(t, time.Since(start), time.Second*5)
+}
+
+func TestDecodeConfig_heic_rotated(t *testing.T) {
+	file := bytes.Join([][]byte{
+		testBox("ftyp", []byte("heic\x00\x00\x00\x00")),
+		testBox("meta", make([]byte, 4),
+			testBox("iprp", testBox("ipco",
+				ispe(4032, 3024),
+				testBox("irot", []byte{1}),
+			)),
+		),
+	}, nil)
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, "heic", format)
+	assert.Equal(t, 3024, cfg.Width)
+	assert.Equal(t, 4032, cfg.Height)
+}
+
+type bitWriter struct {
+	data []byte
+	pos  int
+}
+
+func (b *bitWriter) write(n int, v uint64) *bitWriter {
+	for i := 0; i < n; i++ {
+		if b.pos/8 >= len(b.data) {
+			b.data = append(b.data, 0)
+		}
+		b.data[b.pos/8] |= byte(v>>i&1) << (b.pos % 8)
+		b.pos++
+	}
+	return b
+}
+
+func TestDecodeConfig_jxl(t *testing.T) {
+	// 1920x1080 using a 16:9 ratio.
+	header := (&bitWriter{}).
+		write(1, 0).write(2, 1).write(13, 1079).
+		write(3, 5).
+		write(1, 1).data
+	file := append([]byte(jxlCodestreamSignature), header...)
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, "jxl", format)
+	assert.Equal(t, 1920, cfg.Width)
+	assert.Equal(t, 1080, cfg.Height)
+}
+
+func TestDecodeConfig_jxl_container(t *testing.T) {
+	// 128x64 stored in multiples of 8 and rotated by its orientation.
+	header := (&bitWriter{}).
+		write(1, 1).write(5, 7).
+		write(3, 0).write(5, 15).
+		write(1, 0).write(1, 1).write(3, 5).data
+	file := bytes.Join([][]byte{
+		[]byte(jxlContainerSignature),
+		testBox("ftyp", []byte("jxl \x00\x00\x00\x00jxl ")),
+		testBox("jxlp", make([]byte, 4), []byte(jxlCodestreamSignature), header),
+	}, nil)
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, "jxl", format)
+	assert.Equal(t, 64, cfg.Width)
+	assert.Equal(t, 128, cfg.Height)
+}
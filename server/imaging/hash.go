@@ -0,0 +1,92 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// Hash is a perceptual hash of an image. Similar images have hashes with a
+// small Hamming distance.
+type Hash uint64
+
+// DHash calculates the difference hash of img. Each bit records whether a
+// pixel of a 9x8 greyscale copy of the image is brighter than its right
+// neighbour.
+func DHash(img image.Image) Hash {
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var h Hash
+	for y := range 8 {
+		for x := range 8 {
+			h <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// Distance returns the number of bits that differ between two hashes.
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// ParseHash reads a hash formatted by Hash.String.
+func ParseHash(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return Hash(v), nil
+}
+
+const (
+	// blankSampleSize is the width of the copy of the image blank detection
+	// runs on.
+	blankSampleSize = 128
+	// blankTolerance is how far a pixel's brightness may be from the average
+	// brightness of the page.
+	blankTolerance = 24
+	// blankCoverage is the fraction of pixels that must be close to the
+	// average for a page to be blank. It leaves room for a page number or a
+	// short note.
+	blankCoverage = 0.995
+)
+
+// IsBlank reports whether img is a single colour, allowing for scan noise and
+// a few lines of small text.
+func IsBlank(img image.Image) bool {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return true
+	}
+
+	w := min(blankSampleSize, b.Dx())
+	h := max(1, b.Dy()*w/b.Dx())
+	small := image.NewGray(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, b, draw.Src, nil)
+
+	total := 0
+	for _, p := range small.Pix {
+		total += int(p)
+	}
+	avg := uint8(total / len(small.Pix))
+
+	near := 0
+	for _, p := range small.Pix {
+		if absDiff(p, avg) <= blankTolerance {
+			near++
+		}
+	}
+	return float64(near) >= float64(len(small.Pix))*blankCoverage
+}
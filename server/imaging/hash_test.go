@@ -0,0 +1,45 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/draw"
+)
+
+func TestDHash(t *testing.T) {
+	img := solid(300, 450, color.White)
+	artwork(img, image.Rect(20, 20, 280, 430))
+
+	scaled := image.NewRGBA(image.Rect(0, 0, 200, 300))
+	draw.BiLinear.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	other := solid(300, 450, color.White)
+	for y := range 450 {
+		for x := range 300 {
+			other.Set(x, y, color.Gray{Y: uint8((x*x + y) % 256)})
+		}
+	}
+
+	h := DHash(img)
+	assert.LessOrEqual(t, h.Distance(DHash(scaled)), 4)
+	assert.Greater(t, h.Distance(DHash(other)), 10)
+
+	parsed, err := ParseHash(h.String())
+	assert.NoError(t, err)
+	assert.Equal(t, h, parsed)
+}
+
+func TestIsBlank(t *testing.T) {
+	img := solid(400, 600, color.White)
+	assert.True(t, IsBlank(img))
+
+	// a page number doesn't stop a page from being blank
+	draw.Draw(img, image.Rect(195, 580, 205, 590), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	assert.True(t, IsBlank(img))
+
+	artwork(img, image.Rect(40, 40, 360, 560))
+	assert.False(t, IsBlank(img))
+}
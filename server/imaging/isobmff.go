@@ -0,0 +1,139 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// maxMetaSize is the largest meta box read when looking for the size of an
+// AVIF or HEIC image. Real meta boxes are a few kilobytes.
+const maxMetaSize = 1 << 20
+
+var errNoImageSize = errors.New("isobmff: no image size found")
+
+type box struct {
+	typ  string
+	body []byte
+}
+
+// isobmffConfig reads the size of an AVIF or HEIC image from the image
+// spatial extents property of its meta box. Images store several extents for
+// thumbnails and grid tiles, the largest is the full image.
+func isobmffConfig(r io.Reader) (image.Config, error) {
+	for {
+		typ, size, err := readBoxHeader(r)
+		if err != nil {
+			return image.Config{}, err
+		}
+		if typ != "meta" {
+			if size < 0 {
+				return image.Config{}, errNoImageSize
+			}
+			_, err = io.CopyN(io.Discard, r, size)
+			if err != nil {
+				return image.Config{}, err
+			}
+			continue
+		}
+		if size < 4 || size > maxMetaSize {
+			return image.Config{}, errNoImageSize
+		}
+		body := make([]byte, size)
+		_, err = io.ReadFull(r, body)
+		if err != nil {
+			return image.Config{}, err
+		}
+		return metaConfig(body[4:])
+	}
+}
+
+func metaConfig(meta []byte) (image.Config, error) {
+	iprp, ok := findBox(meta, "iprp")
+	if !ok {
+		return image.Config{}, errNoImageSize
+	}
+	ipco, ok := findBox(iprp, "ipco")
+	if !ok {
+		return image.Config{}, errNoImageSize
+	}
+
+	width, height, rotated := 0, 0, false
+	for _, b := range boxes(ipco) {
+		switch b.typ {
+		case "ispe":
+			if len(b.body) < 12 {
+				continue
+			}
+			w := int(binary.BigEndian.Uint32(b.body[4:8]))
+			h := int(binary.BigEndian.Uint32(b.body[8:12]))
+			if w*h > width*height {
+				width, height = w, h
+			}
+		case "irot":
+			if len(b.body) > 0 && b.body[0]&1 == 1 {
+				rotated = true
+			}
+		}
+	}
+	if width == 0 || height == 0 {
+		return image.Config{}, errNoImageSize
+	}
+	if rotated {
+		width, height = height, width
+	}
+	return image.Config{
+		ColorModel: color.RGBAModel,
+		Width:      width,
+		Height:     height,
+	}, nil
+}
+
+// readBoxHeader reads the type and body size of the next box. A size of -1
+// means the box runs to the end of the file.
+func readBoxHeader(r io.Reader) (string, int64, error) {
+	var header [8]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return "", 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	typ := string(header[4:])
+	switch size {
+	case 0:
+		return typ, -1, nil
+	case 1:
+		var large [8]byte
+		_, err = io.ReadFull(r, large[:])
+		if err != nil {
+			return "", 0, err
+		}
+		return typ, int64(binary.BigEndian.Uint64(large[:])) - 16, nil
+	}
+	return typ, size - 8, nil
+}
+
+// boxes splits data into the boxes it contains.
+func boxes(data []byte) []box {
+	result := []box{}
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data[:4]))
+		if size < 8 || size > len(data) {
+			break
+		}
+		result = append(result, box{typ: string(data[4:8]), body: data[8:size]})
+		data = data[size:]
+	}
+	return result
+}
+
+func findBox(data []byte, typ string) ([]byte, bool) {
+	for _, b := range boxes(data) {
+		if b.typ == typ {
+			return b.body, true
+		}
+	}
+	return nil, false
+}
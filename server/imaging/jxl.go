@@ -0,0 +1,166 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	jxlCodestreamSignature = "\xff\x0a"
+	jxlContainerSignature  = "\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"
+	// jxlHeaderSize is enough of a codestream to hold the size header and
+	// the start of the image metadata.
+	jxlHeaderSize = 32
+)
+
+var errInvalidJXL = errors.New("jxl: invalid header")
+
+// jxlRatios are the aspect ratios a JPEG XL size header can use instead of
+// storing the width.
+var jxlRatios = [8][2]uint64{{}, {1, 1}, {12, 10}, {4, 3}, {3, 2}, {16, 9}, {5, 4}, {2, 1}}
+
+// jxlConfig reads the size of a JPEG XL image from the size header at the
+// start of its codestream.
+func jxlConfig(r io.Reader) (image.Config, error) {
+	head := make([]byte, len(jxlContainerSignature))
+	_, err := io.ReadFull(r, head[:2])
+	if err != nil {
+		return image.Config{}, err
+	}
+	var codestream []byte
+	if string(head[:2]) == jxlCodestreamSignature {
+		codestream = make([]byte, jxlHeaderSize)
+		n, err := io.ReadFull(r, codestream)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return image.Config{}, err
+		}
+		codestream = codestream[:n]
+	} else {
+		_, err = io.ReadFull(r, head[2:])
+		if err != nil {
+			return image.Config{}, err
+		}
+		if string(head) != jxlContainerSignature {
+			return image.Config{}, errInvalidJXL
+		}
+		codestream, err = jxlContainerCodestream(r)
+		if err != nil {
+			return image.Config{}, err
+		}
+	}
+
+	width, height, err := jxlSize(&bitReader{data: codestream})
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: color.RGBAModel,
+		Width:      width,
+		Height:     height,
+	}, nil
+}
+
+// jxlContainerCodestream returns the start of the codestream, after its
+// signature, from the boxes of a JPEG XL container.
+func jxlContainerCodestream(r io.Reader) ([]byte, error) {
+	for {
+		typ, size, err := readBoxHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		if typ != "jxlc" && typ != "jxlp" {
+			if size < 0 {
+				return nil, errInvalidJXL
+			}
+			_, err = io.CopyN(io.Discard, r, size)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		n := int64(jxlHeaderSize + 2)
+		if typ == "jxlp" {
+			// Partial codestream boxes start with their index.
+			n += 4
+		}
+		if size >= 0 {
+			n = min(n, size)
+		}
+		data := make([]byte, n)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return nil, err
+		}
+		if typ == "jxlp" {
+			if len(data) < 4 {
+				return nil, errInvalidJXL
+			}
+			data = data[4:]
+		}
+		if !bytes.HasPrefix(data, []byte(jxlCodestreamSignature)) {
+			return nil, errInvalidJXL
+		}
+		return data[2:], nil
+	}
+}
+
+// jxlSize decodes the SizeHeader of a codestream and the orientation from the
+// image metadata that follows it.
+func jxlSize(br *bitReader) (int, int, error) {
+	readSize := func(small bool) uint64 {
+		if small {
+			return (br.bits(5) + 1) * 8
+		}
+		return br.bits([4]int{9, 13, 18, 30}[br.bits(2)]) + 1
+	}
+
+	small := br.bits(1) == 1
+	height := readSize(small)
+	ratio := br.bits(3)
+	var width uint64
+	if ratio == 0 {
+		width = readSize(small)
+	} else {
+		width = height * jxlRatios[ratio][0] / jxlRatios[ratio][1]
+	}
+
+	orientation := uint64(1)
+	if allDefault := br.bits(1) == 1; !allDefault {
+		if extraFields := br.bits(1) == 1; extraFields {
+			orientation = br.bits(3) + 1
+		}
+	}
+	if br.err != nil {
+		return 0, 0, br.err
+	}
+	if orientation > 4 {
+		width, height = height, width
+	}
+	return int(width), int(height), nil
+}
+
+// bitReader reads the least significant bit first, as JPEG XL headers are
+// packed.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (b *bitReader) bits(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if b.pos/8 >= len(b.data) {
+			b.err = errInvalidJXL
+			return 0
+		}
+		bit := b.data[b.pos/8] >> (b.pos % 8) & 1
+		v |= uint64(bit) << i
+		b.pos++
+	}
+	return v
+}
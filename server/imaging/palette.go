@@ -0,0 +1,140 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// paletteSampleSize is the width of the image colours are counted in.
+	paletteSampleSize = 64
+	// paletteMinShare is the smallest fraction of the image a colour must
+	// cover to be picked as the vibrant or muted colour, so a few stray
+	// pixels don't theme the page.
+	paletteMinShare = 0.005
+)
+
+// swatch is a group of similar colours in an image.
+type swatch struct {
+	r, g, b, n int
+}
+
+func (s *swatch) color() color.RGBA {
+	return color.RGBA{
+		R: uint8(s.r / s.n),
+		G: uint8(s.g / s.n),
+		B: uint8(s.b / s.n),
+		A: 255,
+	}
+}
+
+// target describes the saturation and lightness a palette colour should have,
+// in the style of Android's Palette.
+type target struct {
+	saturation, minSaturation, maxSaturation float64
+	lightness, minLightness, maxLightness    float64
+}
+
+var (
+	vibrantTarget = target{
+		saturation: 1, minSaturation: 0.35, maxSaturation: 1,
+		lightness: 0.5, minLightness: 0.3, maxLightness: 0.7,
+	}
+	mutedTarget = target{
+		saturation: 0.3, minSaturation: 0, maxSaturation: 0.4,
+		lightness: 0.5, minLightness: 0.3, maxLightness: 0.7,
+	}
+)
+
+// Palette returns the most common colour of img, and its most prominent
+// vibrant and muted colours. Images without a vibrant or muted colour use the
+// dominant colour in its place.
+func Palette(img image.Image) (dominant, vibrant, muted color.RGBA) {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return
+	}
+
+	w := min(paletteSampleSize, b.Dx())
+	h := max(1, b.Dy()*w/b.Dx())
+	sample := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(sample, sample.Bounds(), img, b, draw.Src, nil)
+
+	// Colours are grouped by their top 4 bits per channel.
+	swatches := map[int]*swatch{}
+	for i := 0; i < len(sample.Pix); i += 4 {
+		r, g, bl := int(sample.Pix[i]), int(sample.Pix[i+1]), int(sample.Pix[i+2])
+		key := r>>4<<8 | g>>4<<4 | bl>>4
+		s, ok := swatches[key]
+		if !ok {
+			s = &swatch{}
+			swatches[key] = s
+		}
+		s.r += r
+		s.g += g
+		s.b += bl
+		s.n++
+	}
+
+	var top *swatch
+	for _, s := range swatches {
+		if top == nil || s.n > top.n {
+			top = s
+		}
+	}
+	dominant = top.color()
+
+	minCount := int(math.Ceil(float64(w*h) * paletteMinShare))
+	vibrant = pick(swatches, vibrantTarget, top.n, minCount, dominant)
+	muted = pick(swatches, mutedTarget, top.n, minCount, dominant)
+	return dominant, vibrant, muted
+}
+
+// pick returns the colour that best matches t, weighing how close it is to
+// the target against how much of the image it covers.
+func pick(swatches map[int]*swatch, t target, maxCount, minCount int, fallback color.RGBA) color.RGBA {
+	best, bestScore := fallback, -1.0
+	for _, s := range swatches {
+		if s.n < minCount {
+			continue
+		}
+		c := s.color()
+		sat, light := saturationLightness(c)
+		if sat < t.minSaturation || sat > t.maxSaturation || light < t.minLightness || light > t.maxLightness {
+			continue
+		}
+		score := (1-math.Abs(sat-t.saturation))*0.24 +
+			(1-math.Abs(light-t.lightness))*0.52 +
+			float64(s.n)/float64(maxCount)*0.24
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+// saturationLightness returns the HSL saturation and lightness of c from 0 to
+// 1.
+func saturationLightness(c color.RGBA) (float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := max(r, g, b), min(r, g, b)
+	light := (hi + lo) / 2
+	if hi == lo {
+		return 0, light
+	}
+	d := hi - lo
+	if light > 0.5 {
+		return d / (2 - hi - lo), light
+	}
+	return d / (hi + lo), light
+}
+
+// Hex formats c as a CSS hex colour.
+func Hex(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
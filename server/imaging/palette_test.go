@@ -0,0 +1,33 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPalette(t *testing.T) {
+	img := solid(100, 100, color.RGBA{240, 240, 240, 255})
+	// A strong red accent and a greyish blue area.
+	draw.Draw(img, image.Rect(0, 0, 20, 100), image.NewUniform(color.RGBA{220, 20, 30, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(20, 0, 50, 100), image.NewUniform(color.RGBA{100, 110, 140, 255}), image.Point{}, draw.Src)
+
+	dominant, vibrant, muted := Palette(img)
+	assert.Equal(t, "#f0f0f0", Hex(dominant))
+	assert.Equal(t, "#dc141e", Hex(vibrant))
+	assert.Equal(t, "#646e8c", Hex(muted))
+}
+
+func TestPalette_grey(t *testing.T) {
+	dominant, vibrant, muted := Palette(solid(40, 60, color.RGBA{30, 30, 30, 255}))
+	assert.Equal(t, "#1e1e1e", Hex(dominant))
+	assert.Equal(t, dominant, vibrant, "no vibrant colour falls back to the dominant colour")
+	assert.Equal(t, dominant, muted, "too dark to be muted")
+}
+
+func TestHex(t *testing.T) {
+	assert.Equal(t, "#0a80ff", Hex(color.RGBA{10, 128, 255, 255}))
+}
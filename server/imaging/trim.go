@@ -0,0 +1,128 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+const (
+	// trimTolerance is how far each channel of a pixel may be from the border
+	// colour and still count as part of the border.
+	trimTolerance = 0x28
+	// trimNoise is the fraction of pixels in a line that may differ from the
+	// border colour, so specks of dust or scan noise don't stop the trim.
+	trimNoise = 0.01
+	// trimMinContent is the smallest fraction of each dimension that is kept.
+	// A border any larger is most likely part of the artwork or a blank page
+	// and the image isn't trimmed at all.
+	trimMinContent = 0.5
+	// trimSamples is the most pixels checked along a single line.
+	trimSamples = 512
+)
+
+// TrimBox detects uniform borders around img and returns the rectangle inside
+// them. It returns false if no border was found.
+func TrimBox(img image.Image) (image.Rectangle, bool) {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return b, false
+	}
+
+	maxY := int(float64(b.Dy()) * (1 - trimMinContent) / 2)
+	maxX := int(float64(b.Dx()) * (1 - trimMinContent) / 2)
+
+	row := func(y int) line { return line{img, b.Min.X, y, b.Max.X, y + 1} }
+	col := func(x, minY, maxY int) line { return line{img, x, minY, x + 1, maxY} }
+
+	top := 0
+	if ref, ok := row(b.Min.Y).border(); ok {
+		for top < maxY && row(b.Min.Y+top).matches(ref) {
+			top++
+		}
+	}
+	bottom := 0
+	if ref, ok := row(b.Max.Y - 1).border(); ok {
+		for bottom < maxY && row(b.Max.Y-1-bottom).matches(ref) {
+			bottom++
+		}
+	}
+
+	minY, maxYContent := b.Min.Y+top, b.Max.Y-bottom
+	left := 0
+	if ref, ok := col(b.Min.X, minY, maxYContent).border(); ok {
+		for left < maxX && col(b.Min.X+left, minY, maxYContent).matches(ref) {
+			left++
+		}
+	}
+	right := 0
+	if ref, ok := col(b.Max.X-1, minY, maxYContent).border(); ok {
+		for right < maxX && col(b.Max.X-1-right, minY, maxYContent).matches(ref) {
+			right++
+		}
+	}
+
+	if top >= maxY || bottom >= maxY || left >= maxX || right >= maxX {
+		return b, false
+	}
+
+	box := image.Rect(b.Min.X+left, minY, b.Max.X-right, maxYContent)
+	return box, box != b
+}
+
+// line is a single row or column of pixels.
+type line struct {
+	img                    image.Image
+	minX, minY, maxX, maxY int
+}
+
+func (l line) each(cb func(c color.RGBA)) int {
+	length := max(l.maxX-l.minX, l.maxY-l.minY)
+	step := max(1, length/trimSamples)
+	count := 0
+	for i := 0; i < length; i += step {
+		x, y := l.minX, l.minY
+		if l.maxX-l.minX > 1 {
+			x += i
+		} else {
+			y += i
+		}
+		cb(color.RGBAModel.Convert(l.img.At(x, y)).(color.RGBA))
+		count++
+	}
+	return count
+}
+
+// border returns the average colour of the line and whether the line is
+// uniform enough to be part of a border.
+func (l line) border() (color.RGBA, bool) {
+	var r, g, b int
+	count := l.each(func(c color.RGBA) {
+		r += int(c.R)
+		g += int(c.G)
+		b += int(c.B)
+	})
+	if count == 0 {
+		return color.RGBA{}, false
+	}
+	ref := color.RGBA{uint8(r / count), uint8(g / count), uint8(b / count), 0xff}
+	return ref, l.matches(ref)
+}
+
+func (l line) matches(ref color.RGBA) bool {
+	misses := 0
+	count := l.each(func(c color.RGBA) {
+		if absDiff(c.R, ref.R) > trimTolerance ||
+			absDiff(c.G, ref.G) > trimTolerance ||
+			absDiff(c.B, ref.B) > trimTolerance {
+			misses++
+		}
+	})
+	return float64(misses) <= float64(count)*trimNoise
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,54 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// artwork fills r with a gradient so no row or column of it is uniform.
+func artwork(img *image.RGBA, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 5), uint8(y * 3), 128, 255})
+		}
+	}
+}
+
+func TestTrimBox(t *testing.T) {
+	t.Run("white border", func(t *testing.T) {
+		img := solid(100, 150, color.White)
+		artwork(img, image.Rect(10, 20, 90, 140))
+
+		box, ok := TrimBox(img)
+		assert.True(t, ok)
+		assert.Equal(t, image.Rect(10, 20, 90, 140), box)
+	})
+
+	t.Run("black border with noise", func(t *testing.T) {
+		img := solid(200, 300, color.Black)
+		artwork(img, image.Rect(0, 30, 200, 270))
+		img.Set(100, 5, color.White)
+		img.Set(2, 150, color.White)
+
+		box, ok := TrimBox(img)
+		assert.True(t, ok)
+		assert.Equal(t, image.Rect(0, 30, 200, 270), box)
+	})
+
+	t.Run("no border", func(t *testing.T) {
+		img := solid(100, 150, color.White)
+		artwork(img, img.Bounds())
+
+		box, ok := TrimBox(img)
+		assert.False(t, ok)
+		assert.Equal(t, img.Bounds(), box)
+	})
+
+	t.Run("blank page", func(t *testing.T) {
+		_, ok := TrimBox(solid(100, 200, color.White))
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,139 @@
+// Package importer reads users, reading progress and lists from other comic
+// servers so they can be imported. Each server's database is read into an
+// Export, which is also the format of JSON exports.
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrUnknownSource = errors.New("unknown source")
+	ErrNotSQLite     = errors.New("not an SQLite database")
+)
+
+type Source string
+
+const (
+	SourceKomga  = Source("komga")
+	SourceKavita = Source("kavita")
+)
+
+// Export is everything read from another server. Paths are relative to the
+// root of the library they are in and start with a /, like Book.File.
+type Export struct {
+	Users    []*User     `json:"users"`
+	Series   []*Series   `json:"series"`
+	Books    []*Book     `json:"books"`
+	Progress []*Progress `json:"progress"`
+	Lists    []*List     `json:"lists"`
+}
+
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type Series struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type Book struct {
+	ID       string `json:"id"`
+	SeriesID string `json:"series_id"`
+	Path     string `json:"path"`
+}
+
+type Progress struct {
+	UserID string `json:"user_id"`
+	BookID string `json:"book_id"`
+	// Page is the 0 based page in the archive.
+	Page      int  `json:"page"`
+	Completed bool `json:"completed"`
+}
+
+type ListKind string
+
+const (
+	KindCollection  = ListKind("collection")
+	KindReadingList = ListKind("reading_list")
+	KindWantToRead  = ListKind("want_to_read")
+)
+
+// List is a collection, reading list or want to read list. Lists without a
+// user are shared by everyone.
+type List struct {
+	Kind      ListKind `json:"kind"`
+	Name      string   `json:"name"`
+	UserID    string   `json:"user_id,omitempty"`
+	SeriesIDs []string `json:"series_ids"`
+}
+
+// Read reads the export at path, either the server's SQLite database or a
+// JSON export.
+func Read(source Source, p string) (*Export, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	_, err = io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	if !bytes.Equal(header, []byte("SQLite format 3\x00")) {
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		e := &Export{}
+		err = json.NewDecoder(f).Decode(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w or JSON export: %w", ErrNotSQLite, err)
+		}
+		return e, nil
+	}
+
+	db, err := sqlx.Open("sqlite3", "file:"+p+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	switch source {
+	case SourceKomga:
+		return ReadKomga(db)
+	case SourceKavita:
+		return ReadKavita(db)
+	default:
+		return nil, fmt.Errorf("%w %s", ErrUnknownSource, source)
+	}
+}
+
+// relativePath returns p relative to the root it is under, with / as the
+// separator.
+func relativePath(p string, roots ...string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, `\`, "/"))
+	best := ""
+	for _, root := range roots {
+		root = path.Clean("/" + strings.ReplaceAll(root, `\`, "/"))
+		if (p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/")) && len(root) > len(best) {
+			best = root
+		}
+	}
+	return path.Clean("/" + strings.TrimPrefix(p, best))
+}
@@ -0,0 +1,142 @@
+package importer_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abibby/comicbox-3/server/importer"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func createDB(t *testing.T, schema string) string {
+	p := filepath.Join(t.TempDir(), "database.sqlite")
+	db, err := sqlx.Open("sqlite3", p)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(schema)
+	assert.NoError(t, err)
+	return p
+}
+
+func TestReadKomga(t *testing.T) {
+	p := createDB(t, `
+		CREATE TABLE "USER" (ID TEXT, EMAIL TEXT);
+		CREATE TABLE LIBRARY (ID TEXT, ROOT TEXT);
+		CREATE TABLE SERIES (ID TEXT, NAME TEXT, URL TEXT, LIBRARY_ID TEXT);
+		CREATE TABLE BOOK (ID TEXT, SERIES_ID TEXT, URL TEXT, LIBRARY_ID TEXT);
+		CREATE TABLE READ_PROGRESS (USER_ID TEXT, BOOK_ID TEXT, PAGE INTEGER, COMPLETED BOOLEAN);
+		CREATE TABLE COLLECTION (ID TEXT, NAME TEXT);
+		CREATE TABLE COLLECTION_SERIES (COLLECTION_ID TEXT, SERIES_ID TEXT, NUMBER INTEGER);
+		CREATE TABLE READLIST (ID TEXT, NAME TEXT);
+		CREATE TABLE READLIST_BOOK (READLIST_ID TEXT, BOOK_ID TEXT, NUMBER INTEGER);
+
+		INSERT INTO "USER" VALUES ('u1', 'adam@example.com');
+		INSERT INTO LIBRARY VALUES ('l1', 'file:/books/manga/');
+		INSERT INTO SERIES VALUES ('s1', 'Saga', 'file:/books/manga/Saga', 'l1');
+		INSERT INTO BOOK VALUES ('b1', 's1', 'file:/books/manga/Saga/Saga%20%231.cbz', 'l1');
+		INSERT INTO BOOK VALUES ('b2', 's1', 'file:/books/manga/Saga/Saga%20%232.cbz', 'l1');
+		INSERT INTO READ_PROGRESS VALUES ('u1', 'b1', 20, 1);
+		INSERT INTO READ_PROGRESS VALUES ('u1', 'b2', 3, 0);
+		INSERT INTO COLLECTION VALUES ('c1', 'Favourites');
+		INSERT INTO COLLECTION_SERIES VALUES ('c1', 's1', 0);
+		INSERT INTO READLIST VALUES ('r1', 'Plan to Read');
+		INSERT INTO READLIST_BOOK VALUES ('r1', 'b1', 0);
+		INSERT INTO READLIST_BOOK VALUES ('r1', 'b2', 1);
+	`)
+
+	e, err := importer.Read(importer.SourceKomga, p)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []*importer.User{{ID: "u1", Username: "adam@example.com"}}, e.Users)
+	assert.Equal(t, []*importer.Series{{ID: "s1", Name: "Saga", Path: "/Saga"}}, e.Series)
+	assert.Equal(t, []*importer.Book{
+		{ID: "b1", SeriesID: "s1", Path: "/Saga/Saga #1.cbz"},
+		{ID: "b2", SeriesID: "s1", Path: "/Saga/Saga #2.cbz"},
+	}, e.Books)
+	assert.Equal(t, []*importer.Progress{
+		{UserID: "u1", BookID: "b1", Page: 19, Completed: true},
+		{UserID: "u1", BookID: "b2", Page: 2},
+	}, e.Progress)
+	assert.Equal(t, []*importer.List{
+		{Kind: importer.KindCollection, Name: "Favourites", SeriesIDs: []string{"s1"}},
+		{Kind: importer.KindReadingList, Name: "Plan to Read", SeriesIDs: []string{"s1"}},
+	}, e.Lists)
+}
+
+func TestReadKavita(t *testing.T) {
+	p := createDB(t, `
+		CREATE TABLE AspNetUsers (Id INTEGER, UserName TEXT);
+		CREATE TABLE FolderPath (Id INTEGER, Path TEXT, LibraryId INTEGER);
+		CREATE TABLE Series (Id INTEGER, Name TEXT, FolderPath TEXT, LibraryId INTEGER);
+		CREATE TABLE Volume (Id INTEGER, SeriesId INTEGER);
+		CREATE TABLE Chapter (Id INTEGER, VolumeId INTEGER, Pages INTEGER);
+		CREATE TABLE MangaFile (Id INTEGER, FilePath TEXT, ChapterId INTEGER);
+		CREATE TABLE AppUserProgresses (AppUserId INTEGER, ChapterId INTEGER, PagesRead INTEGER);
+		CREATE TABLE ReadingList (Id INTEGER, Title TEXT, AppUserId INTEGER);
+		CREATE TABLE ReadingListItem (ReadingListId INTEGER, SeriesId INTEGER, "Order" INTEGER);
+		CREATE TABLE AppUserWantToRead (Id INTEGER, SeriesId INTEGER, AppUserId INTEGER);
+
+		INSERT INTO AspNetUsers VALUES (1, 'adam');
+		INSERT INTO FolderPath VALUES (1, '/manga', 1);
+		INSERT INTO FolderPath VALUES (2, '/comics', 1);
+		INSERT INTO Series VALUES (1, 'Saga', '/comics/Saga', 1);
+		INSERT INTO Series VALUES (2, 'Monster', NULL, 1);
+		INSERT INTO Volume VALUES (1, 1);
+		INSERT INTO Chapter VALUES (1, 1, 20);
+		INSERT INTO Chapter VALUES (2, 1, 22);
+		INSERT INTO MangaFile VALUES (1, '/comics/Saga/Saga 1.cbz', 1);
+		INSERT INTO MangaFile VALUES (2, '/comics/Saga/Saga 2.cbz', 2);
+		INSERT INTO AppUserProgresses VALUES (1, 1, 20);
+		INSERT INTO AppUserProgresses VALUES (1, 2, 5);
+		INSERT INTO ReadingList VALUES (1, 'Currently Reading', 1);
+		INSERT INTO ReadingListItem VALUES (1, 1, 0);
+		INSERT INTO AppUserWantToRead VALUES (1, 2, 1);
+	`)
+
+	e, err := importer.Read(importer.SourceKavita, p)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []*importer.User{{ID: "1", Username: "adam"}}, e.Users)
+	assert.Equal(t, []*importer.Series{
+		{ID: "1", Name: "Saga", Path: "/Saga"},
+		{ID: "2", Name: "Monster"},
+	}, e.Series)
+	assert.Equal(t, []*importer.Book{
+		{ID: "1", SeriesID: "1", Path: "/Saga/Saga 1.cbz"},
+		{ID: "2", SeriesID: "1", Path: "/Saga/Saga 2.cbz"},
+	}, e.Books)
+	assert.Equal(t, []*importer.Progress{
+		{UserID: "1", BookID: "1", Page: 20, Completed: true},
+		{UserID: "1", BookID: "2", Page: 5},
+	}, e.Progress)
+	assert.Equal(t, []*importer.List{
+		{Kind: importer.KindReadingList, Name: "Currently Reading", UserID: "1", SeriesIDs: []string{"1"}},
+		{Kind: importer.KindWantToRead, Name: "Want to Read", UserID: "1", SeriesIDs: []string{"2"}},
+	}, e.Lists)
+}
+
+func TestRead_json(t *testing.T) {
+	export := &importer.Export{
+		Users: []*importer.User{{ID: "1", Username: "adam"}},
+		Books: []*importer.Book{{ID: "1", SeriesID: "1", Path: "/Saga/Saga 1.cbz"}},
+	}
+	b, err := json.Marshal(export)
+	assert.NoError(t, err)
+	p := filepath.Join(t.TempDir(), "export.json")
+	assert.NoError(t, os.WriteFile(p, b, 0o644))
+
+	e, err := importer.Read(importer.SourceKomga, p)
+	assert.NoError(t, err)
+	assert.Equal(t, export, e)
+}
+
+func TestRead_invalid(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "export.json")
+	assert.NoError(t, os.WriteFile(p, []byte("not json"), 0o644))
+
+	_, err := importer.Read(importer.SourceKomga, p)
+	assert.ErrorIs(t, err, importer.ErrNotSQLite)
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// ReadKavita reads a Kavita database. Kavita tracks progress by chapter, it
+// is given to every file in the chapter. Collections and want to read lists
+// are read from the tables used since Kavita 0.8 and skipped in older
+// databases.
+func ReadKavita(db *sqlx.DB) (*Export, error) {
+	e := &Export{}
+
+	err := db.Select(&e.Users, `SELECT CAST(Id AS TEXT) AS id, UserName AS username FROM AspNetUsers`)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := map[string][]string{}
+	rows := []struct {
+		LibraryID string `db:"LibraryId"`
+		Path      string `db:"Path"`
+	}{}
+	err = db.Select(&rows, `SELECT CAST(LibraryId AS TEXT) AS LibraryId, Path FROM FolderPath`)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		folders[r.LibraryID] = append(folders[r.LibraryID], r.Path)
+	}
+
+	series := []struct {
+		ID        string `db:"Id"`
+		Name      string `db:"Name"`
+		Path      string `db:"FolderPath"`
+		LibraryID string `db:"LibraryId"`
+	}{}
+	err = db.Select(&series, `
+		SELECT CAST(Id AS TEXT) AS Id, Name, COALESCE(FolderPath, '') AS FolderPath, CAST(LibraryId AS TEXT) AS LibraryId
+		FROM Series`)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range series {
+		p := ""
+		if s.Path != "" {
+			p = relativePath(s.Path, folders[s.LibraryID]...)
+		}
+		e.Series = append(e.Series, &Series{ID: s.ID, Name: s.Name, Path: p})
+	}
+
+	files := []struct {
+		ID        string `db:"Id"`
+		ChapterID string `db:"ChapterId"`
+		SeriesID  string `db:"SeriesId"`
+		LibraryID string `db:"LibraryId"`
+		Path      string `db:"FilePath"`
+	}{}
+	err = db.Select(&files, `
+		SELECT CAST(f.Id AS TEXT) AS Id, CAST(f.ChapterId AS TEXT) AS ChapterId, CAST(v.SeriesId AS TEXT) AS SeriesId, CAST(s.LibraryId AS TEXT) AS LibraryId, f.FilePath
+		FROM MangaFile f
+		JOIN Chapter c ON c.Id = f.ChapterId
+		JOIN Volume v ON v.Id = c.VolumeId
+		JOIN Series s ON s.Id = v.SeriesId`)
+	if err != nil {
+		return nil, err
+	}
+	chapterFiles := map[string][]string{}
+	for _, f := range files {
+		e.Books = append(e.Books, &Book{
+			ID:       f.ID,
+			SeriesID: f.SeriesID,
+			Path:     relativePath(f.Path, folders[f.LibraryID]...),
+		})
+		chapterFiles[f.ChapterID] = append(chapterFiles[f.ChapterID], f.ID)
+	}
+
+	progress := []struct {
+		UserID    string `db:"AppUserId"`
+		ChapterID string `db:"ChapterId"`
+		PagesRead int    `db:"PagesRead"`
+		Pages     int    `db:"Pages"`
+	}{}
+	err = db.Select(&progress, `
+		SELECT CAST(p.AppUserId AS TEXT) AS AppUserId, CAST(p.ChapterId AS TEXT) AS ChapterId, p.PagesRead, c.Pages
+		FROM AppUserProgresses p
+		JOIN Chapter c ON c.Id = p.ChapterId`)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range progress {
+		for _, fileID := range chapterFiles[p.ChapterID] {
+			e.Progress = append(e.Progress, &Progress{
+				UserID:    p.UserID,
+				BookID:    fileID,
+				Page:      p.PagesRead,
+				Completed: p.Pages > 0 && p.PagesRead >= p.Pages,
+			})
+		}
+	}
+
+	type listRow struct {
+		ID       string `db:"Id"`
+		Name     string `db:"Name"`
+		UserID   string `db:"AppUserId"`
+		SeriesID string `db:"SeriesId"`
+	}
+	queries := []struct {
+		kind  ListKind
+		table string
+		query string
+	}{
+		{KindCollection, "AppUserCollection", `
+			SELECT CAST(c.Id AS TEXT) AS Id, c.Title AS Name, CAST(c.AppUserId AS TEXT) AS AppUserId, CAST(cs.ItemsId AS TEXT) AS SeriesId
+			FROM AppUserCollection c
+			JOIN AppUserCollectionSeries cs ON cs.CollectionsId = c.Id
+			ORDER BY c.Id`},
+		{KindReadingList, "ReadingList", `
+			SELECT CAST(r.Id AS TEXT) AS Id, r.Title AS Name, CAST(r.AppUserId AS TEXT) AS AppUserId, CAST(ri.SeriesId AS TEXT) AS SeriesId
+			FROM ReadingList r
+			JOIN ReadingListItem ri ON ri.ReadingListId = r.Id
+			ORDER BY r.Id, ri."Order"`},
+		{KindWantToRead, "AppUserWantToRead", `
+			SELECT CAST(AppUserId AS TEXT) AS Id, 'Want to Read' AS Name, CAST(AppUserId AS TEXT) AS AppUserId, CAST(SeriesId AS TEXT) AS SeriesId
+			FROM AppUserWantToRead
+			ORDER BY AppUserId`},
+	}
+	for _, q := range queries {
+		ok, err := hasTable(db, q.table)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		listRows := []listRow{}
+		err = db.Select(&listRows, q.query)
+		if err != nil {
+			return nil, err
+		}
+		lists := map[string]*List{}
+		for _, r := range listRows {
+			l, ok := lists[r.ID]
+			if !ok {
+				l = &List{Kind: q.kind, Name: r.Name, UserID: r.UserID, SeriesIDs: []string{}}
+				lists[r.ID] = l
+				e.Lists = append(e.Lists, l)
+			}
+			l.SeriesIDs = appendUnique(l.SeriesIDs, r.SeriesID)
+		}
+	}
+
+	return e, nil
+}
+
+func hasTable(db *sqlx.DB, name string) (bool, error) {
+	count := 0
+	err := db.Get(&count, `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name)
+	return count > 0, err
+}
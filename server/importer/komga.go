@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReadKomga reads a Komga database. Komga stores paths as file URLs,
+// collections and read lists are shared by all users.
+func ReadKomga(db *sqlx.DB) (*Export, error) {
+	e := &Export{}
+
+	err := db.Select(&e.Users, `SELECT ID AS id, EMAIL AS username FROM "USER"`)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := map[string]string{}
+	libraries := []struct {
+		ID   string `db:"ID"`
+		Root string `db:"ROOT"`
+	}{}
+	err = db.Select(&libraries, `SELECT ID, ROOT FROM LIBRARY`)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range libraries {
+		roots[l.ID] = komgaPath(l.Root)
+	}
+
+	series := []struct {
+		ID        string `db:"ID"`
+		Name      string `db:"NAME"`
+		URL       string `db:"URL"`
+		LibraryID string `db:"LIBRARY_ID"`
+	}{}
+	err = db.Select(&series, `SELECT ID, NAME, URL, LIBRARY_ID FROM SERIES`)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range series {
+		e.Series = append(e.Series, &Series{
+			ID:   s.ID,
+			Name: s.Name,
+			Path: relativePath(komgaPath(s.URL), roots[s.LibraryID]),
+		})
+	}
+
+	books := []struct {
+		ID        string `db:"ID"`
+		SeriesID  string `db:"SERIES_ID"`
+		URL       string `db:"URL"`
+		LibraryID string `db:"LIBRARY_ID"`
+	}{}
+	err = db.Select(&books, `SELECT ID, SERIES_ID, URL, LIBRARY_ID FROM BOOK`)
+	if err != nil {
+		return nil, err
+	}
+	bookSeries := map[string]string{}
+	for _, b := range books {
+		e.Books = append(e.Books, &Book{
+			ID:       b.ID,
+			SeriesID: b.SeriesID,
+			Path:     relativePath(komgaPath(b.URL), roots[b.LibraryID]),
+		})
+		bookSeries[b.ID] = b.SeriesID
+	}
+
+	progress := []struct {
+		UserID    string `db:"USER_ID"`
+		BookID    string `db:"BOOK_ID"`
+		Page      int    `db:"PAGE"`
+		Completed bool   `db:"COMPLETED"`
+	}{}
+	err = db.Select(&progress, `SELECT USER_ID, BOOK_ID, PAGE, COMPLETED FROM READ_PROGRESS`)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range progress {
+		e.Progress = append(e.Progress, &Progress{
+			UserID:    p.UserID,
+			BookID:    p.BookID,
+			Page:      max(p.Page-1, 0),
+			Completed: p.Completed,
+		})
+	}
+
+	collections := []struct {
+		ID       string `db:"ID"`
+		Name     string `db:"NAME"`
+		SeriesID string `db:"SERIES_ID"`
+	}{}
+	err = db.Select(&collections, `
+		SELECT c.ID, c.NAME, cs.SERIES_ID
+		FROM COLLECTION c
+		JOIN COLLECTION_SERIES cs ON cs.COLLECTION_ID = c.ID
+		ORDER BY c.ID, cs.NUMBER`)
+	if err != nil {
+		return nil, err
+	}
+	lists := map[string]*List{}
+	for _, c := range collections {
+		l, ok := lists[c.ID]
+		if !ok {
+			l = &List{Kind: KindCollection, Name: c.Name, SeriesIDs: []string{}}
+			lists[c.ID] = l
+			e.Lists = append(e.Lists, l)
+		}
+		l.SeriesIDs = appendUnique(l.SeriesIDs, c.SeriesID)
+	}
+
+	readLists := []struct {
+		ID     string `db:"ID"`
+		Name   string `db:"NAME"`
+		BookID string `db:"BOOK_ID"`
+	}{}
+	err = db.Select(&readLists, `
+		SELECT r.ID, r.NAME, rb.BOOK_ID
+		FROM READLIST r
+		JOIN READLIST_BOOK rb ON rb.READLIST_ID = r.ID
+		ORDER BY r.ID, rb.NUMBER`)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range readLists {
+		l, ok := lists[r.ID]
+		if !ok {
+			l = &List{Kind: KindReadingList, Name: r.Name, SeriesIDs: []string{}}
+			lists[r.ID] = l
+			e.Lists = append(e.Lists, l)
+		}
+		if seriesID, ok := bookSeries[r.BookID]; ok {
+			l.SeriesIDs = appendUnique(l.SeriesIDs, seriesID)
+		}
+	}
+
+	return e, nil
+}
+
+// komgaPath returns the path of a file URL like file:/books/Saga%201.cbz.
+func komgaPath(fileURL string) string {
+	u, err := url.Parse(fileURL)
+	if err != nil || u.Scheme != "file" {
+		return strings.TrimPrefix(fileURL, "file:")
+	}
+	if u.Path == "" {
+		return u.Opaque
+	}
+	return u.Path
+}
+
+func appendUnique(s []string, v string) []string {
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
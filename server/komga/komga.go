@@ -0,0 +1,224 @@
+// Package komga holds the response types of the subset of the Komga REST API
+// that manga readers like Mihon and Paperback use.
+//
+// https://komga.org/docs/openapi/komga-api
+package komga
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reading directions.
+const (
+	LeftToRight = "LEFT_TO_RIGHT"
+	RightToLeft = "RIGHT_TO_LEFT"
+	Vertical    = "VERTICAL"
+	Webtoon     = "WEBTOON"
+)
+
+// Time is a timestamp without fractional seconds, clients parse dates with
+// fixed formats.
+type Time time.Time
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + time.Time(t).UTC().Format("2006-01-02T15:04:05Z") + `"`), nil
+}
+
+// Page is a page of results. Page numbers start at 0.
+type Page[T any] struct {
+	Content          []T      `json:"content"`
+	Pageable         Pageable `json:"pageable"`
+	TotalElements    int      `json:"totalElements"`
+	TotalPages       int      `json:"totalPages"`
+	Last             bool     `json:"last"`
+	First            bool     `json:"first"`
+	Number           int      `json:"number"`
+	Size             int      `json:"size"`
+	NumberOfElements int      `json:"numberOfElements"`
+	Empty            bool     `json:"empty"`
+}
+
+type Pageable struct {
+	PageNumber int  `json:"pageNumber"`
+	PageSize   int  `json:"pageSize"`
+	Offset     int  `json:"offset"`
+	Paged      bool `json:"paged"`
+	Unpaged    bool `json:"unpaged"`
+}
+
+// NewPage wraps page number of the results of size, out of total results.
+func NewPage[T any](content []T, number, size, total int) *Page[T] {
+	if content == nil {
+		content = []T{}
+	}
+	totalPages := 1
+	if size > 0 {
+		totalPages = max((total+size-1)/size, 1)
+	}
+	return &Page[T]{
+		Content: content,
+		Pageable: Pageable{
+			PageNumber: number,
+			PageSize:   size,
+			Offset:     number * size,
+			Paged:      true,
+		},
+		TotalElements:    total,
+		TotalPages:       totalPages,
+		Last:             number >= totalPages-1,
+		First:            number == 0,
+		Number:           number,
+		Size:             size,
+		NumberOfElements: len(content),
+		Empty:            len(content) == 0,
+	}
+}
+
+type Library struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Unavailable bool   `json:"unavailable"`
+}
+
+type Series struct {
+	ID                   string                   `json:"id"`
+	LibraryID            string                   `json:"libraryId"`
+	Name                 string                   `json:"name"`
+	URL                  string                   `json:"url"`
+	Created              Time                     `json:"created"`
+	LastModified         Time                     `json:"lastModified"`
+	FileLastModified     Time                     `json:"fileLastModified"`
+	BooksCount           int                      `json:"booksCount"`
+	BooksReadCount       int                      `json:"booksReadCount"`
+	BooksUnreadCount     int                      `json:"booksUnreadCount"`
+	BooksInProgressCount int                      `json:"booksInProgressCount"`
+	Metadata             *SeriesMetadata          `json:"metadata"`
+	BooksMetadata        *BookMetadataAggregation `json:"booksMetadata"`
+	Deleted              bool                     `json:"deleted"`
+	Oneshot              bool                     `json:"oneshot"`
+}
+
+// SeriesMetadata describes a series. Komga lets users lock fields against
+// automatic changes, the locks are always reported as unlocked.
+type SeriesMetadata struct {
+	Status               string   `json:"status"`
+	StatusLock           bool     `json:"statusLock"`
+	Title                string   `json:"title"`
+	TitleLock            bool     `json:"titleLock"`
+	TitleSort            string   `json:"titleSort"`
+	TitleSortLock        bool     `json:"titleSortLock"`
+	Summary              string   `json:"summary"`
+	SummaryLock          bool     `json:"summaryLock"`
+	ReadingDirection     string   `json:"readingDirection"`
+	ReadingDirectionLock bool     `json:"readingDirectionLock"`
+	Publisher            string   `json:"publisher"`
+	PublisherLock        bool     `json:"publisherLock"`
+	AgeRating            *int     `json:"ageRating"`
+	AgeRatingLock        bool     `json:"ageRatingLock"`
+	Language             string   `json:"language"`
+	LanguageLock         bool     `json:"languageLock"`
+	Genres               []string `json:"genres"`
+	GenresLock           bool     `json:"genresLock"`
+	Tags                 []string `json:"tags"`
+	TagsLock             bool     `json:"tagsLock"`
+	TotalBookCount       *int     `json:"totalBookCount"`
+	TotalBookCountLock   bool     `json:"totalBookCountLock"`
+	Created              Time     `json:"created"`
+	LastModified         Time     `json:"lastModified"`
+}
+
+type BookMetadataAggregation struct {
+	Authors       []*Author `json:"authors"`
+	Tags          []string  `json:"tags"`
+	ReleaseDate   *string   `json:"releaseDate"`
+	Summary       string    `json:"summary"`
+	SummaryNumber string    `json:"summaryNumber"`
+	Created       Time      `json:"created"`
+	LastModified  Time      `json:"lastModified"`
+}
+
+type Author struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type Book struct {
+	ID               string        `json:"id"`
+	SeriesID         string        `json:"seriesId"`
+	SeriesTitle      string        `json:"seriesTitle"`
+	LibraryID        string        `json:"libraryId"`
+	Name             string        `json:"name"`
+	URL              string        `json:"url"`
+	Number           float64       `json:"number"`
+	Created          Time          `json:"created"`
+	LastModified     Time          `json:"lastModified"`
+	FileLastModified Time          `json:"fileLastModified"`
+	SizeBytes        int64         `json:"sizeBytes"`
+	Size             string        `json:"size"`
+	Media            *Media        `json:"media"`
+	Metadata         *BookMetadata `json:"metadata"`
+	ReadProgress     *ReadProgress `json:"readProgress"`
+	Deleted          bool          `json:"deleted"`
+	FileHash         string        `json:"fileHash"`
+	Oneshot          bool          `json:"oneshot"`
+}
+
+type Media struct {
+	Status       string `json:"status"`
+	MediaType    string `json:"mediaType"`
+	MediaProfile string `json:"mediaProfile"`
+	PagesCount   int    `json:"pagesCount"`
+	Comment      string `json:"comment"`
+}
+
+type BookMetadata struct {
+	Title           string    `json:"title"`
+	TitleLock       bool      `json:"titleLock"`
+	Summary         string    `json:"summary"`
+	SummaryLock     bool      `json:"summaryLock"`
+	Number          string    `json:"number"`
+	NumberLock      bool      `json:"numberLock"`
+	NumberSort      float64   `json:"numberSort"`
+	NumberSortLock  bool      `json:"numberSortLock"`
+	ReleaseDate     *string   `json:"releaseDate"`
+	ReleaseDateLock bool      `json:"releaseDateLock"`
+	Authors         []*Author `json:"authors"`
+	AuthorsLock     bool      `json:"authorsLock"`
+	Tags            []string  `json:"tags"`
+	TagsLock        bool      `json:"tagsLock"`
+	Created         Time      `json:"created"`
+	LastModified    Time      `json:"lastModified"`
+}
+
+type ReadProgress struct {
+	Page         int  `json:"page"`
+	Completed    bool `json:"completed"`
+	ReadDate     Time `json:"readDate"`
+	Created      Time `json:"created"`
+	LastModified Time `json:"lastModified"`
+}
+
+// BookPage is a page of a book. Page numbers start at 1.
+type BookPage struct {
+	Number    int    `json:"number"`
+	FileName  string `json:"fileName"`
+	MediaType string `json:"mediaType"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	SizeBytes int64  `json:"sizeBytes,omitempty"`
+}
+
+// FormatSize formats a file size the way Komga shows it, like "12.3 MiB".
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
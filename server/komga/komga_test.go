@@ -0,0 +1,40 @@
+package komga_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/server/komga"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPage(t *testing.T) {
+	page := komga.NewPage([]string{"c", "d"}, 1, 2, 5)
+
+	assert.Equal(t, 3, page.TotalPages)
+	assert.False(t, page.First)
+	assert.False(t, page.Last)
+	assert.Equal(t, 2, page.Pageable.Offset)
+	assert.Equal(t, 2, page.NumberOfElements)
+
+	last := komga.NewPage([]string{"e"}, 2, 2, 5)
+	assert.True(t, last.Last)
+
+	empty := komga.NewPage[string](nil, 0, 20, 0)
+	assert.True(t, empty.Empty)
+	assert.True(t, empty.Last)
+	assert.Equal(t, []string{}, empty.Content)
+}
+
+func TestTime_MarshalJSON(t *testing.T) {
+	b, err := json.Marshal(komga.Time(time.Date(2026, 1, 2, 3, 4, 5, 600, time.FixedZone("", 3600))))
+	assert.NoError(t, err)
+	assert.Equal(t, `"2026-01-02T02:04:05Z"`, string(b))
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", komga.FormatSize(512))
+	assert.Equal(t, "1.5 KiB", komga.FormatSize(1536))
+	assert.Equal(t, "12.3 MiB", komga.FormatSize(12_900_000))
+}
@@ -0,0 +1,96 @@
+// Package kosync implements the parts of the KOReader sync server protocol
+// that don't depend on the database, the document digest and the error
+// responses.
+//
+// https://github.com/koreader/koreader-sync-server
+package kosync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+)
+
+// ContentType is sent by KOReader in the Accept header of every request.
+const ContentType = "application/vnd.koreader.v1+json"
+
+// Error is an error response in the format KOReader shows to the user.
+type Error struct {
+	status  int
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+var (
+	ErrUnauthorized         = &Error{status: http.StatusUnauthorized, Code: 2001, Message: "Unauthorized"}
+	ErrUserExists           = &Error{status: http.StatusPaymentRequired, Code: 2002, Message: "Username is already registered."}
+	ErrInvalidRequest       = &Error{status: http.StatusForbidden, Code: 2003, Message: "Invalid request"}
+	ErrNoDocument           = &Error{status: http.StatusForbidden, Code: 2004, Message: "Field 'document' not provided."}
+	ErrRegistrationDisabled = &Error{status: http.StatusPaymentRequired, Code: 2005, Message: "User registration is disabled."}
+	ErrUnknownDocument      = &Error{status: http.StatusNotFound, Code: 2006, Message: "Document is not in the library."}
+)
+
+func (e *Error) Error() string {
+	return e.Message
+}
+func (e *Error) Status() int {
+	return e.status
+}
+func (e *Error) Send(rw http.ResponseWriter) error {
+	return json.NewEncoder(rw).Encode(e)
+}
+func (e *Error) Respond(rw http.ResponseWriter, r *http.Request) error {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(e.Status())
+	return e.Send(rw)
+}
+
+// Digest returns KOReader's partial MD5 of a document. It hashes 1 KiB
+// samples starting at 0 and then at 1 KiB, 4 KiB, 16 KiB and so on up to
+// 1 GiB, stopping at the end of the file. Reading a small sample of the file
+// is enough to tell books apart without reading whole archives.
+func Digest(r io.ReaderAt) (string, error) {
+	const step, size = 1024, 1024
+
+	h := md5.New()
+	buf := make([]byte, size)
+	for i := -1; i <= 10; i++ {
+		offset := int64(0)
+		if i >= 0 {
+			offset = step << (2 * i)
+		}
+		n, err := r.ReadAt(buf, offset)
+		if n == 0 {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return "", err
+			}
+			break
+		}
+		h.Write(buf[:n])
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DigestFile returns the partial MD5 of the file at path.
+func DigestFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Digest(f)
+}
+
+// Key returns the key KOReader sends in place of a password, the hex encoded
+// MD5 of the password.
+func Key(password string) string {
+	sum := md5.Sum([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
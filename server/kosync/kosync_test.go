@@ -0,0 +1,43 @@
+package kosync_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"testing"
+
+	"github.com/abibby/comicbox-3/server/kosync"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigest(t *testing.T) {
+	data := make([]byte, 17000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	// Samples start at 0, 1 KiB, 4 KiB and 16 KiB, the last one is cut
+	// short by the end of the file.
+	expected := md5.New()
+	expected.Write(data[0:1024])
+	expected.Write(data[1024:2048])
+	expected.Write(data[4096:5120])
+	expected.Write(data[16384:])
+
+	digest, err := kosync.Digest(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(expected.Sum(nil)), digest)
+}
+
+func TestDigest_small(t *testing.T) {
+	data := []byte("not much of a comic")
+
+	digest, err := kosync.Digest(bytes.NewReader(data))
+	assert.NoError(t, err)
+	sum := md5.Sum(data)
+	assert.Equal(t, hex.EncodeToString(sum[:]), digest)
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "5f4dcc3b5aa765d61d8327deb882cf99", kosync.Key("password"))
+}
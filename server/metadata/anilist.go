@@ -123,5 +123,6 @@ func anilistSeriesMetadata(media *anilist.SearchPageMedia, name string) SeriesMe
 		Genres:        media.Genres,
 		Tags:          tags,
 		Staff:         staff,
+		Country:       media.CountryOfOrigin,
 	}
 }
@@ -1,9 +1,13 @@
 package metadata
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"math"
+	"slices"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/abibby/comicbox-3/models"
 	"github.com/agnivade/levenshtein"
@@ -52,6 +56,7 @@ type SeriesMetadata struct {
 	Genres        []string               `json:"genres"`
 	Tags          []string               `json:"tags"`
 	Publisher     string                 `json:"publisher"`
+	Country       string                 `json:"country"`
 }
 
 type DistanceMetadata struct {
@@ -60,19 +65,66 @@ type DistanceMetadata struct {
 }
 
 func (s SeriesMetadata) WithDistance(str string) DistanceMetadata {
+	return DistanceMetadata{
+		SeriesMetadata: s,
+		MatchDistance:  Distance(str, append([]string{s.Title}, s.Aliases...)...),
+	}
+}
+
+// Distance returns the smallest Levenshtein distance between str and any of
+// titles, ignoring case.
+func Distance(str string, titles ...string) int {
 	normalStr := normalize(str)
-	minDistance := levenshtein.ComputeDistance(normalStr, normalize(s.Title))
-	for _, alias := range s.Aliases {
-		dist := levenshtein.ComputeDistance(normalStr, normalize(alias))
+	minDistance := math.MaxInt
+	for _, title := range titles {
+		dist := levenshtein.ComputeDistance(normalStr, normalize(title))
 		if dist < minDistance {
 			minDistance = dist
 		}
 	}
-	return DistanceMetadata{
-		SeriesMetadata: s,
-		MatchDistance:  minDistance,
+	return minDistance
+}
+
+// MatchSeries finds the series closest to any of titles. When more than one
+// series is close and none of them is the only exact match, no series is
+// returned and the close ones are returned as candidates, closest first.
+func MatchSeries(series []*models.Series, titles ...string) (*models.Series, []*models.Series) {
+	type candidate struct {
+		series   *models.Series
+		distance int
 	}
+
+	candidates := []candidate{}
+	for _, s := range series {
+		names := append([]string{s.Name, s.Slug}, s.Aliases...)
+		distance := -1
+		for _, title := range titles {
+			// Allow for small differences in punctuation and spelling
+			// between sources.
+			d := Distance(title, names...)
+			if d <= utf8.RuneCountInString(title)/5 && (distance == -1 || d < distance) {
+				distance = d
+			}
+		}
+		if distance != -1 {
+			candidates = append(candidates, candidate{series: s, distance: distance})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return cmp.Compare(a.distance, b.distance)
+	})
+
+	if len(candidates) == 1 ||
+		(len(candidates) > 1 && candidates[0].distance == 0 && candidates[1].distance > 0) {
+		return candidates[0].series, nil
+	}
+	matches := make([]*models.Series, len(candidates))
+	for i, c := range candidates {
+		matches[i] = c.series
+	}
+	return nil, matches
 }
+
 func normalize(s string) string {
 	return strings.ToLower(norm.NFC.String(s))
 }
@@ -15,7 +15,9 @@ import (
 	"github.com/abibby/comicbox-3/config"
 	"github.com/abibby/comicbox-3/database"
 	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/bookrules"
 	"github.com/abibby/nulls"
+	"github.com/abibby/salusa/clog"
 	salusadb "github.com/abibby/salusa/database"
 	"github.com/abibby/salusa/di"
 	"github.com/abibby/salusa/extra/sets"
@@ -97,14 +99,36 @@ func ApplyMetadata(ctx context.Context, tx salusadb.DB, series *models.Series, m
 		series.Year = nulls.NewInt(metadata.Year)
 	}
 
+	if metadata.Publisher != "" && !lockedFields.Has("publisher") {
+		series.UpdateField("publisher")
+		series.Publisher = metadata.Publisher
+	}
+
+	if metadata.Country != "" && !lockedFields.Has("country") {
+		series.UpdateField("country")
+		series.Country = metadata.Country
+	}
+
 	coverPath, err := downloadFile(ctx, metadata.CoverImageURL, path.Join(series.DirectoryPath(), ".comicbox/cover"))
 	if err != nil {
 		return fmt.Errorf("AnilistMetaProvider.UpdateMetadata: downloading cover: %w", err)
 	}
 	series.CoverImage = strings.Replace(coverPath, config.LibraryPath, "", 1)
 
+	series.Palette, err = models.DecodePalette(ctx, coverPath)
+	if err != nil {
+		clog.Use(ctx).Warn("failed to extract series palette", "series", series.Slug, "err", err)
+		series.Palette = &models.Palette{}
+	}
+
 	series.MetadataUpdatedAt = database.TimePtr(time.Now())
 
+	// Rules can depend on the new metadata, like the country of origin.
+	_, err = bookrules.ApplySeries(ctx, tx, series)
+	if err != nil {
+		return fmt.Errorf("applying book rules: %w", err)
+	}
+
 	return nil
 }
 
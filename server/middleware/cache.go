@@ -8,6 +8,7 @@ import (
 	"log"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 
@@ -17,11 +18,12 @@ import (
 )
 
 type cachedResponseWriter struct {
-	cachePath  string
-	cacheFile  *os.File
-	statusCode int
-	rw         http.ResponseWriter
-	logger     *slog.Logger
+	cachePath   string
+	cacheFile   *os.File
+	contentType string
+	statusCode  int
+	rw          http.ResponseWriter
+	logger      *slog.Logger
 }
 
 var _ http.ResponseWriter = &cachedResponseWriter{}
@@ -55,6 +57,12 @@ func (rw *cachedResponseWriter) fileWrite(b []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if rw.contentType == "" {
+		rw.contentType = rw.Header().Get("Content-Type")
+		if rw.contentType == "" {
+			rw.contentType = http.DetectContentType(b)
+		}
+	}
 	return f.Write(b)
 }
 
@@ -74,7 +82,7 @@ func (rw *cachedResponseWriter) file() (*os.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	cacheFile, err := os.OpenFile(rw.cachePathTmp(), os.O_CREATE|os.O_RDWR, 0644)
+	cacheFile, err := os.OpenFile(rw.cachePathTmp(), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
 	if err != nil {
 		return nil, err
 	}
@@ -85,16 +93,26 @@ func (rw *cachedResponseWriter) file() (*os.File, error) {
 }
 
 func (rw *cachedResponseWriter) Close() error {
-	if rw.cacheFile != nil {
-		return rw.cacheFile.Close()
+	if rw.cacheFile == nil {
+		return nil
 	}
 
+	err := rw.cacheFile.Close()
+	if err != nil {
+		return err
+	}
+	// The content type is written first so a cached response is never
+	// served without it.
+	err = os.WriteFile(contentTypePath(rw.cachePath), []byte(rw.contentType), 0644)
+	if err != nil {
+		return err
+	}
 	return os.Rename(rw.cachePathTmp(), rw.cachePath)
 }
 
 func CacheMiddleware() router.Middleware {
 	return router.InlineMiddlewareFunc(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
-		cachePath := path.Join(config.CachePath, r.URL.Path)
+		cachePath := cacheKey(r)
 		err := serveFromCache(w, cachePath)
 		if err == nil {
 			return
@@ -111,13 +129,45 @@ func CacheMiddleware() router.Middleware {
 	})
 }
 
-func serveFromCache(rw http.ResponseWriter, cachePath string) error {
+// cacheParams are the query parameters that change a cached response, any
+// others are left out of the key so they can't be used to fill the cache.
+var cacheParams = []string{"crop", "encode", "half"}
+
+// cacheKey returns the file a response is cached in.
+func cacheKey(r *http.Request) string {
+	p := path.Join(config.CachePath, r.URL.Path)
+	q := url.Values{}
+	for _, param := range cacheParams {
+		if v, ok := r.URL.Query()[param]; ok {
+			q[param] = v
+		}
+	}
+	if len(q) == 0 {
+		return p
+	}
+	return p + "@" + url.QueryEscape(q.Encode())
+}
 
+func contentTypePath(cachePath string) string {
+	return cachePath + ".type"
+}
+
+// ClearCache removes every cached response under urlPath.
+func ClearCache(urlPath string) error {
+	return os.RemoveAll(path.Join(config.CachePath, urlPath))
+}
+
+func serveFromCache(rw http.ResponseWriter, cachePath string) error {
+	contentType, err := os.ReadFile(contentTypePath(cachePath))
+	if err != nil {
+		return err
+	}
 	f, err := os.Open(cachePath)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	rw.Header().Set("Content-Type", string(contentType))
 	rw.Header().Add("Cache-Control", "max-age=3600")
 	_, err = io.Copy(rw, f)
 	if err != nil {
@@ -0,0 +1,175 @@
+// Package opds builds OPDS 1.2 catalog feeds with the OPDS Page Streaming
+// Extension.
+//
+// https://specs.opds.io/opds-1.2
+// https://github.com/anansi-project/opds-pse
+package opds
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	SearchType      = "application/opensearchdescription+xml"
+	ComicBookType   = "application/vnd.comicbook+zip"
+
+	RelSelf        = "self"
+	RelStart       = "start"
+	RelUp          = "up"
+	RelNext        = "next"
+	RelPrevious    = "previous"
+	RelFirst       = "first"
+	RelSearch      = "search"
+	RelSubsection  = "subsection"
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelImage       = "http://opds-spec.org/image"
+	RelThumbnail   = "http://opds-spec.org/image/thumbnail"
+	RelSortNew     = "http://opds-spec.org/sort/new"
+	RelStream      = "http://vaemendis.net/opds-pse/stream"
+)
+
+const (
+	atomNS       = "http://www.w3.org/2005/Atom"
+	opdsNS       = "http://opds-spec.org/2010/catalog"
+	openSearchNS = "http://a9.com/-/spec/opensearch/1.1/"
+	pseNS        = "http://vaemendis.net/opds-pse/ns"
+	dcNS         = "http://purl.org/dc/terms/"
+)
+
+// Feed is an Atom feed. Navigation feeds link to other feeds, acquisition
+// feeds list books.
+type Feed struct {
+	XMLName      xml.Name  `xml:"feed"`
+	ID           string    `xml:"id"`
+	Title        string    `xml:"title"`
+	Updated      time.Time `xml:"updated"`
+	Author       *Author   `xml:"author,omitempty"`
+	TotalResults int       `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage int       `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   int       `xml:"opensearch:startIndex,omitempty"`
+	Links        []*Link   `xml:"link"`
+	Entries      []*Entry  `xml:"entry"`
+
+	// Kind is the content type the feed is served with, NavigationType or
+	// AcquisitionType.
+	Kind string `xml:"-"`
+}
+
+type Author struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type Entry struct {
+	ID         string      `xml:"id"`
+	Title      string      `xml:"title"`
+	Updated    time.Time   `xml:"updated"`
+	Authors    []*Author   `xml:"author"`
+	Issued     string      `xml:"dc:issued,omitempty"`
+	Content    *Content    `xml:"content,omitempty"`
+	Categories []*Category `xml:"category"`
+	Links      []*Link     `xml:"link"`
+}
+
+type Content struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type Link struct {
+	Rel   string `xml:"rel,attr"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+
+	// Page streaming attributes, only set on RelStream links.
+	Count        int        `xml:"pse:count,attr,omitempty"`
+	LastRead     *int       `xml:"pse:lastRead,attr,omitempty"`
+	LastReadDate *time.Time `xml:"pse:lastReadDate,attr,omitempty"`
+}
+
+// TextContent returns plain text entry content, or nil if text is empty.
+func TextContent(text string) *Content {
+	if text == "" {
+		return nil
+	}
+	return &Content{Type: "text", Body: text}
+}
+
+// MarshalXML declares the namespaces used by the feed's elements, which
+// encoding/xml doesn't do for prefixed names.
+func (f *Feed) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type plain Feed
+	start.Name.Local = "feed"
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: atomNS},
+		xml.Attr{Name: xml.Name{Local: "xmlns:opds"}, Value: opdsNS},
+		xml.Attr{Name: xml.Name{Local: "xmlns:opensearch"}, Value: openSearchNS},
+		xml.Attr{Name: xml.Name{Local: "xmlns:pse"}, Value: pseNS},
+		xml.Attr{Name: xml.Name{Local: "xmlns:dc"}, Value: dcNS},
+	)
+	return e.EncodeElement((*plain)(f), start)
+}
+
+func (f *Feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeXML(w, f.Kind, f)
+}
+
+// SearchDescription is an OpenSearch description document telling clients
+// how to build search URLs.
+type SearchDescription struct {
+	XMLName        xml.Name    `xml:"OpenSearchDescription"`
+	Xmlns          string      `xml:"xmlns,attr"`
+	ShortName      string      `xml:"ShortName"`
+	Description    string      `xml:"Description"`
+	InputEncoding  string      `xml:"InputEncoding"`
+	OutputEncoding string      `xml:"OutputEncoding"`
+	URL            []SearchURL `xml:"Url"`
+}
+
+type SearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// NewSearchDescription describes a search returning acquisition feeds from
+// template, which must contain {searchTerms}.
+func NewSearchDescription(name, template string) *SearchDescription {
+	return &SearchDescription{
+		Xmlns:          openSearchNS,
+		ShortName:      name,
+		Description:    "Search " + name,
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URL: []SearchURL{
+			{Type: AcquisitionType, Template: template},
+		},
+	}
+}
+
+func (d *SearchDescription) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeXML(w, SearchType, d)
+}
+
+func writeXML(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType+";charset=utf-8")
+	_, err := w.Write([]byte(xml.Header))
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	err = xml.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,57 @@
+package opds_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/server/opds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeed_ServeHTTP(t *testing.T) {
+	lastRead := 3
+	feed := &opds.Feed{
+		ID:           "urn:test",
+		Title:        "Books & Comics",
+		Updated:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Kind:         opds.AcquisitionType,
+		TotalResults: 12,
+		Entries: []*opds.Entry{{
+			ID:    "urn:uuid:1",
+			Title: "Vol. 1",
+			Links: []*opds.Link{{
+				Rel:      opds.RelStream,
+				Href:     "/opds/books/1/stream?page={pageNumber}",
+				Type:     "image/jpeg",
+				Count:    20,
+				LastRead: &lastRead,
+			}},
+		}},
+	}
+
+	w := httptest.NewRecorder()
+	feed.ServeHTTP(w, httptest.NewRequest("GET", "/opds", nil))
+	body := w.Body.String()
+
+	assert.Equal(t, opds.AcquisitionType+";charset=utf-8", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(body, `<?xml version="1.0" encoding="UTF-8"?>`))
+	assert.Contains(t, body, `<feed xmlns="http://www.w3.org/2005/Atom"`)
+	assert.Contains(t, body, `xmlns:pse="http://vaemendis.net/opds-pse/ns"`)
+	assert.Contains(t, body, `<title>Books &amp; Comics</title>`)
+	assert.Contains(t, body, `<updated>2026-01-02T03:04:05Z</updated>`)
+	assert.Contains(t, body, `<opensearch:totalResults>12</opensearch:totalResults>`)
+	assert.Contains(t, body, `href="/opds/books/1/stream?page={pageNumber}" type="image/jpeg" pse:count="20" pse:lastRead="3"`)
+	assert.NotContains(t, body, "pse:lastReadDate")
+	assert.NotContains(t, body, "<content")
+}
+
+func TestSearchDescription_ServeHTTP(t *testing.T) {
+	w := httptest.NewRecorder()
+	opds.NewSearchDescription("comicbox", "/opds/search?q={searchTerms}").
+		ServeHTTP(w, httptest.NewRequest("GET", "/opds/opensearch.xml", nil))
+
+	assert.Equal(t, opds.SearchType+";charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `<Url type="`+opds.AcquisitionType+`" template="/opds/search?q={searchTerms}">`)
+}
@@ -0,0 +1,165 @@
+// Package opds2 builds OPDS 2.0 feeds, Readium Divina manifests for comics
+// and Readium progression documents.
+//
+// https://drafts.opds.io/opds-2.0
+// https://readium.org/webpub-manifest/profiles/divina
+package opds2
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	FeedType        = "application/opds+json"
+	DivinaType      = "application/divina+json"
+	ProgressionType = "application/vnd.readium.progression+json"
+
+	RelSelf        = "self"
+	RelStart       = "start"
+	RelUp          = "up"
+	RelNext        = "next"
+	RelPrevious    = "previous"
+	RelFirst       = "first"
+	RelSearch      = "search"
+	RelSubsection  = "subsection"
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelSortNew     = "http://opds-spec.org/sort/new"
+	RelProgression = "http://www.cantook.com/api/progression"
+
+	DivinaProfile   = "https://readium.org/webpub-manifest/profiles/divina"
+	ManifestContext = "https://readium.org/webpub-manifest/context.jsonld"
+)
+
+// Reading progressions.
+const (
+	LeftToRight = "ltr"
+	RightToLeft = "rtl"
+	TopToBottom = "ttb"
+)
+
+type Feed struct {
+	Metadata     *FeedMetadata  `json:"metadata"`
+	Links        []*Link        `json:"links"`
+	Navigation   []*Link        `json:"navigation,omitempty"`
+	Publications []*Publication `json:"publications,omitempty"`
+}
+
+type FeedMetadata struct {
+	Title         string     `json:"title"`
+	Modified      *time.Time `json:"modified,omitempty"`
+	NumberOfItems int        `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int        `json:"itemsPerPage,omitempty"`
+	CurrentPage   int        `json:"currentPage,omitempty"`
+}
+
+type Link struct {
+	Href      string `json:"href"`
+	Type      string `json:"type,omitempty"`
+	Rel       string `json:"rel,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+}
+
+// Publication is a book in a feed. Its self link points to the full
+// manifest.
+type Publication struct {
+	Metadata *Metadata `json:"metadata"`
+	Links    []*Link   `json:"links"`
+	Images   []*Link   `json:"images,omitempty"`
+}
+
+type Metadata struct {
+	Type               string        `json:"@type,omitempty"`
+	ConformsTo         string        `json:"conformsTo,omitempty"`
+	Identifier         string        `json:"identifier"`
+	Title              string        `json:"title"`
+	Author             []string      `json:"author,omitempty"`
+	Description        string        `json:"description,omitempty"`
+	Subject            []string      `json:"subject,omitempty"`
+	Published          string        `json:"published,omitempty"`
+	Modified           *time.Time    `json:"modified,omitempty"`
+	NumberOfPages      int           `json:"numberOfPages,omitempty"`
+	ReadingProgression string        `json:"readingProgression,omitempty"`
+	Presentation       *Presentation `json:"presentation,omitempty"`
+	BelongsTo          *BelongsTo    `json:"belongsTo,omitempty"`
+}
+
+// Presentation hints how a reader should lay out the reading order.
+type Presentation struct {
+	// Overflow is "paginated" to show one page at a time or "scrolled" to
+	// show pages one after another.
+	Overflow   string `json:"overflow,omitempty"`
+	Continuous bool   `json:"continuous,omitempty"`
+}
+
+type BelongsTo struct {
+	Series []*Collection `json:"series,omitempty"`
+}
+
+type Collection struct {
+	Name     string   `json:"name"`
+	Position *float64 `json:"position,omitempty"`
+}
+
+// Manifest is a Readium web publication manifest. With the Divina profile
+// its reading order lists the page images of a comic.
+type Manifest struct {
+	Context      string    `json:"@context"`
+	Metadata     *Metadata `json:"metadata"`
+	Links        []*Link   `json:"links"`
+	ReadingOrder []*Link   `json:"readingOrder"`
+}
+
+// Progression is the last position a user read to, shared between readers.
+type Progression struct {
+	Modified time.Time `json:"modified"`
+	Device   *Device   `json:"device,omitempty"`
+	Locator  *Locator  `json:"locator"`
+}
+
+type Device struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Locator points to a location in a publication.
+//
+// https://readium.org/architecture/models/locators/
+type Locator struct {
+	Href      string     `json:"href"`
+	Type      string     `json:"type"`
+	Title     string     `json:"title,omitempty"`
+	Locations *Locations `json:"locations,omitempty"`
+}
+
+type Locations struct {
+	// Position is the 1 based index of the resource in the reading order.
+	Position         int     `json:"position,omitempty"`
+	Progression      float64 `json:"progression"`
+	TotalProgression float64 `json:"totalProgression"`
+}
+
+func (f *Feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, FeedType, f)
+}
+
+func (m *Manifest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, DivinaType, m)
+}
+
+func (p *Progression) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, ProgressionType, p)
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,69 @@
+package opds2_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/server/opds2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest_ServeHTTP(t *testing.T) {
+	manifest := &opds2.Manifest{
+		Context: opds2.ManifestContext,
+		Metadata: &opds2.Metadata{
+			ConformsTo:         opds2.DivinaProfile,
+			Identifier:         "urn:uuid:1",
+			Title:              "Vol. 1",
+			ReadingProgression: opds2.RightToLeft,
+		},
+		Links: []*opds2.Link{},
+		ReadingOrder: []*opds2.Link{
+			{Href: "/opds/books/1/stream?page=0", Type: "image/jpeg", Width: 800, Height: 1200},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	manifest.ServeHTTP(w, httptest.NewRequest("GET", "/manifest.json", nil))
+
+	assert.Equal(t, opds2.DivinaType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"@context": "https://readium.org/webpub-manifest/context.jsonld",
+		"metadata": {
+			"conformsTo": "https://readium.org/webpub-manifest/profiles/divina",
+			"identifier": "urn:uuid:1",
+			"title": "Vol. 1",
+			"readingProgression": "rtl"
+		},
+		"links": [],
+		"readingOrder": [
+			{"href": "/opds/books/1/stream?page=0", "type": "image/jpeg", "width": 800, "height": 1200}
+		]
+	}`, w.Body.String())
+}
+
+func TestProgression_JSON(t *testing.T) {
+	src := `{
+		"modified": "2026-01-02T03:04:05Z",
+		"device": {"id": "d1", "name": "Reader"},
+		"locator": {
+			"href": "/opds/books/1/stream?page=4",
+			"type": "image/jpeg",
+			"locations": {"position": 5, "progression": 0, "totalProgression": 0.25}
+		}
+	}`
+
+	p := &opds2.Progression{}
+	err := json.Unmarshal([]byte(src), p)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), p.Modified)
+	assert.Equal(t, 5, p.Locator.Locations.Position)
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/progression", nil))
+
+	assert.Equal(t, opds2.ProgressionType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, src, w.Body.String())
+}
@@ -0,0 +1,229 @@
+// Package pagerules finds pages that don't belong to the story, like the
+// credit and recruitment pages scanlation groups add to every chapter, and
+// marks them deleted.
+package pagerules
+
+import (
+	"context"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/imaging"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxDistance is the largest Hamming distance between two page hashes
+	// that are considered the same page.
+	maxDistance = 6
+	// minRecurrence is the number of books in a series a page must appear in
+	// before it is considered a recurring page.
+	minRecurrence = 3
+	// minDetail is the fewest set or unset bits a hash may have to be
+	// compared. Flat pages all have hashes close to 0 and would match each
+	// other.
+	minDetail = 8
+)
+
+type DeleteReason string
+
+func (r DeleteReason) Options() map[string]string {
+	return map[string]string{
+		"Recurring": string(ReasonRecurring),
+		"Blank":     string(ReasonBlank),
+	}
+}
+
+const (
+	ReasonRecurring = DeleteReason("recurring")
+	ReasonBlank     = DeleteReason("blank")
+)
+
+// Options selects the kinds of pages to mark deleted.
+type Options struct {
+	Recurring bool
+	Blank     bool
+}
+
+// SeriesOptions returns the rules enabled on a series.
+func SeriesOptions(series *models.Series) Options {
+	return Options{
+		Recurring: series.AutoDeleteRecurring,
+		Blank:     series.AutoDeleteBlank,
+	}
+}
+
+func (o Options) any() bool {
+	return o.Recurring || o.Blank
+}
+
+// DeletedPage is a page a rule marks deleted.
+type DeletedPage struct {
+	BookID       uuid.UUID    `json:"book_id"`
+	Page         int          `json:"page"`
+	Reason       DeleteReason `json:"reason"`
+	ThumbnailURL string       `json:"thumbnail_url"`
+
+	book *models.Book
+}
+
+// Preview returns the pages of a series that would be marked deleted with
+// opts.
+func Preview(ctx context.Context, tx salusadb.DB, series *models.Series, opts Options) ([]*DeletedPage, error) {
+	if !opts.any() {
+		return []*DeletedPage{}, nil
+	}
+
+	books, err := models.BookQuery(ctx).
+		Where("series", "=", series.Slug).
+		OrderBy("sort").
+		Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	return plan(books, opts), nil
+}
+
+// Apply marks the pages matching the series' rules deleted and returns the
+// number of pages changed.
+func Apply(ctx context.Context, tx salusadb.DB, series *models.Series) (int, error) {
+	changes, err := Preview(ctx, tx, series, SeriesOptions(series))
+	if err != nil {
+		return 0, err
+	}
+
+	changed := map[*models.Book]struct{}{}
+	for _, c := range changes {
+		c.book.Pages[c.Page].Type = models.PageTypeDeleted
+		changed[c.book] = struct{}{}
+	}
+	for book := range changed {
+		book.UpdateField("pages")
+		err = model.SaveContext(ctx, tx, book)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(changes), nil
+}
+
+type hashedPage struct {
+	book int
+	hash imaging.Hash
+}
+
+func seriesHashes(books []*models.Book) []hashedPage {
+	hashes := []hashedPage{}
+	for i, book := range books {
+		for _, page := range book.Pages {
+			if h, ok := PageHash(page); ok {
+				hashes = append(hashes, hashedPage{book: i, hash: h})
+			}
+		}
+	}
+	return hashes
+}
+
+func plan(books []*models.Book, opts Options) []*DeletedPage {
+	hashes := seriesHashes(books)
+
+	changes := []*DeletedPage{}
+	for i, book := range books {
+		// Manual page edits always win over the rules.
+		if book.UpdatedByUser("pages") {
+			continue
+		}
+		for p, page := range book.Pages {
+			if page.Type == models.PageTypeDeleted || page.Type == models.PageTypeFrontCover {
+				continue
+			}
+
+			var reason DeleteReason
+			if opts.Blank && page.Blank {
+				reason = ReasonBlank
+			} else if opts.Recurring && recurs(hashes, i, page) {
+				reason = ReasonRecurring
+			}
+			if reason == "" {
+				continue
+			}
+
+			changes = append(changes, &DeletedPage{
+				BookID:       book.ID,
+				Page:         p,
+				Reason:       reason,
+				ThumbnailURL: page.ThumbnailURL,
+				book:         book,
+			})
+		}
+	}
+	return changes
+}
+
+// recurs reports whether a page appears in at least minRecurrence books,
+// including its own.
+func recurs(hashes []hashedPage, book int, page *models.Page) bool {
+	h, ok := PageHash(page)
+	if !ok {
+		return false
+	}
+	return countBooks(hashes, book, h) >= minRecurrence
+}
+
+// countBooks returns the number of books h appears in, counting book even if
+// it doesn't.
+func countBooks(hashes []hashedPage, book int, h imaging.Hash) int {
+	books := map[int]struct{}{book: {}}
+	for _, other := range hashes {
+		if other.hash.Distance(h) <= maxDistance {
+			books[other.book] = struct{}{}
+			if len(books) >= minRecurrence {
+				break
+			}
+		}
+	}
+	return len(books)
+}
+
+// Recurring returns the hashes of the pages that appear in at least
+// minRecurrence of books, usually scanlation credits.
+func Recurring(books []*models.Book) []imaging.Hash {
+	hashes := seriesHashes(books)
+	recurring := []imaging.Hash{}
+	for _, p := range hashes {
+		if _, ok := Match(recurring, p.hash); ok {
+			continue
+		}
+		if countBooks(hashes, p.book, p.hash) >= minRecurrence {
+			recurring = append(recurring, p.hash)
+		}
+	}
+	return recurring
+}
+
+// Match returns the distance to the closest of hashes to the page hash h, and
+// whether it is close enough to be the same page.
+func Match(hashes []imaging.Hash, h imaging.Hash) (int, bool) {
+	best := 64
+	for _, other := range hashes {
+		best = min(best, other.Distance(h))
+	}
+	return best, best <= maxDistance
+}
+
+// PageHash returns the hash of a page if it has enough detail to be compared
+// with other pages.
+func PageHash(page *models.Page) (imaging.Hash, bool) {
+	if page.Hash == "" || page.Blank {
+		return 0, false
+	}
+	h, err := imaging.ParseHash(page.Hash)
+	if err != nil {
+		return 0, false
+	}
+	if bits := h.Distance(0); bits < minDetail || bits > 64-minDetail {
+		return 0, false
+	}
+	return h, true
+}
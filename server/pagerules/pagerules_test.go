@@ -0,0 +1,78 @@
+package pagerules
+
+import (
+	"testing"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	creditHash = "f0f0f0f00f0f0f0f"
+	artHash    = "0123456789abcdef"
+)
+
+func hashedBook(hashes ...string) *models.Book {
+	b := &models.Book{}
+	for _, h := range hashes {
+		b.Pages = append(b.Pages, &models.Page{
+			BasePage: models.BasePage{Type: models.PageTypeStory, Hash: h},
+		})
+	}
+	return b
+}
+
+func TestPlan(t *testing.T) {
+	books := []*models.Book{
+		hashedBook(artHash, creditHash),
+		hashedBook("fedcba9876543210", creditHash),
+		hashedBook("00ff00ff00ff00ff", "f0f0f0f00f0f0f0e"),
+	}
+	books[1].Pages = append(books[1].Pages, &models.Page{
+		BasePage: models.BasePage{Type: models.PageTypeStory, Blank: true},
+	})
+
+	changes := plan(books, Options{Recurring: true})
+	assert.Len(t, changes, 3)
+	for _, c := range changes {
+		assert.Equal(t, ReasonRecurring, c.Reason)
+		assert.Equal(t, 1, c.Page)
+	}
+
+	changes = plan(books, Options{Blank: true})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, ReasonBlank, changes[0].Reason)
+	assert.Equal(t, 2, changes[0].Page)
+}
+
+func TestPlan_two_books(t *testing.T) {
+	books := []*models.Book{
+		hashedBook(artHash, creditHash),
+		hashedBook("fedcba9876543210", creditHash),
+	}
+	assert.Empty(t, plan(books, Options{Recurring: true}))
+}
+
+func TestPlan_flat_pages(t *testing.T) {
+	books := []*models.Book{
+		hashedBook("0000000000000000"),
+		hashedBook("0000000000000000"),
+		hashedBook("0000000000000001"),
+	}
+	assert.Empty(t, plan(books, Options{Recurring: true}))
+}
+
+func TestPlan_user_edits(t *testing.T) {
+	books := []*models.Book{
+		hashedBook(artHash, creditHash),
+		hashedBook("fedcba9876543210", creditHash),
+		hashedBook("00ff00ff00ff00ff", creditHash),
+	}
+	books[0].UpdateMap = map[string]string{"pages": "1-user"}
+
+	changes := plan(books, Options{Recurring: true})
+	assert.Len(t, changes, 2)
+	for _, c := range changes {
+		assert.NotSame(t, books[0], c.book)
+	}
+}
@@ -0,0 +1,92 @@
+package repack
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/google/uuid"
+)
+
+// samplePages is how many pages of each book are converted when estimating
+// the size of a repacked book.
+const samplePages = 4
+
+// BookEstimate is the expected size of a book after it is repacked.
+type BookEstimate struct {
+	BookID        uuid.UUID `json:"book_id"`
+	File          string    `json:"file"`
+	CurrentSize   int64     `json:"current_size"`
+	EstimatedSize int64     `json:"estimated_size"`
+	SampledPages  int       `json:"sampled_pages"`
+}
+
+// EstimateBook converts a few evenly spaced pages of a book and extrapolates
+// the size of the archive if every page were converted.
+func EstimateBook(ctx context.Context, book *models.Book, opts Options) (*BookEstimate, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(book.FilePath())
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.OpenReader(book.FilePath())
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	pages := []*zip.File{}
+	var convertibleSize int64
+	for _, f := range reader.File {
+		if opts.convertible(f.Name) {
+			pages = append(pages, f)
+			convertibleSize += int64(f.CompressedSize64)
+		}
+	}
+
+	estimate := &BookEstimate{
+		BookID:        book.ID,
+		File:          book.File,
+		CurrentSize:   info.Size(),
+		EstimatedSize: info.Size(),
+	}
+
+	var sampledSize, sampledSaved int64
+	for _, f := range sample(pages, samplePages) {
+		data, err := readAll(f)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := imaging.Encode(ctx, data, opts.Format, opts.Quality)
+		if err != nil {
+			return nil, err
+		}
+		// Converted pages are stored uncompressed and only replace the
+		// original entry if they are smaller.
+		sampledSize += int64(f.CompressedSize64)
+		sampledSaved += max(int64(f.CompressedSize64)-int64(len(encoded)), 0)
+		estimate.SampledPages++
+	}
+	if sampledSize > 0 {
+		estimate.EstimatedSize -= convertibleSize * sampledSaved / sampledSize
+	}
+	return estimate, nil
+}
+
+// sample returns up to n evenly spaced items from s.
+func sample[T any](s []T, n int) []T {
+	if len(s) <= n {
+		return s
+	}
+	result := make([]T, n)
+	for i := range result {
+		result[i] = s[i*len(s)/n]
+	}
+	return result
+}
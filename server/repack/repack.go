@@ -0,0 +1,291 @@
+// Package repack rewrites book archives with their pages converted to a
+// smaller image format.
+package repack
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/imaging"
+	"github.com/abibby/comicbox-3/server/kosync"
+)
+
+var (
+	ErrInvalidFormat  = errors.New("format must be webp or avif")
+	ErrInvalidQuality = errors.New("quality must be between 1 and 100")
+	ErrPageOrder      = errors.New("renaming the pages would change their order")
+)
+
+// Options controls how pages are converted.
+type Options struct {
+	Format  string `json:"format"`
+	Quality int    `json:"quality"`
+}
+
+// DefaultOptions are used when a repack doesn't set a format or quality.
+var DefaultOptions = Options{
+	Format:  "webp",
+	Quality: 80,
+}
+
+// WithDefaults returns o with unset fields taken from DefaultOptions.
+func (o Options) WithDefaults() Options {
+	if o.Format == "" {
+		o.Format = DefaultOptions.Format
+	}
+	if o.Quality == 0 {
+		o.Quality = DefaultOptions.Quality
+	}
+	return o
+}
+
+func (o Options) Validate() error {
+	if o.Format != "webp" && o.Format != "avif" {
+		return ErrInvalidFormat
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		return ErrInvalidQuality
+	}
+	return nil
+}
+
+// Result describes a rewritten archive.
+type Result struct {
+	OriginalSize int64 `json:"original_size"`
+	Size         int64 `json:"size"`
+	Converted    int   `json:"converted"`
+}
+
+// convertible reports whether a page should be converted. Animated GIFs would
+// lose their animation and pages already in the target format have nothing to
+// gain.
+func (o Options) convertible(name string) bool {
+	if !imaging.IsImage(name) {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(name))
+	return ext != ".gif" && ext != "."+o.Format
+}
+
+// Rewrite converts the pages of the archive at file and replaces it. Every
+// other entry, including ComicInfo.xml, is copied unchanged and entries stay
+// in their original order. A page keeps its original bytes if the converted
+// image isn't smaller. The new archive is written next to the old one and
+// renamed over it, so the book is never left half written.
+func Rewrite(ctx context.Context, file string, opts Options) (*Result, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".repack-*"+filepath.Ext(file))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	result := &Result{OriginalSize: info.Size()}
+	names := make(map[string]bool, len(reader.File))
+	for _, f := range reader.File {
+		names[f.Name] = true
+	}
+
+	// Page order comes from sorting page names, renamed pages must sort the
+	// same way as the originals.
+	oldPages := []string{}
+	newPages := []string{}
+
+	zw := zip.NewWriter(tmp)
+	for _, f := range reader.File {
+		name := f.Name
+		if opts.convertible(f.Name) {
+			name, err = convert(ctx, zw, f, opts, names)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert %s: %w", f.Name, err)
+			}
+		}
+		if name == f.Name {
+			err = zw.Copy(f)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			result.Converted++
+		}
+		if imaging.IsImage(f.Name) {
+			oldPages = append(oldPages, f.Name)
+			newPages = append(newPages, name)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Converted == 0 {
+		result.Size = result.OriginalSize
+		return result, nil
+	}
+	if !sameOrder(oldPages, newPages) {
+		return nil, ErrPageOrder
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return nil, err
+	}
+	newInfo, err := tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	result.Size = newInfo.Size()
+	err = tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(tmp.Name(), file)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// convert encodes a page and writes it to zw if it is smaller than the
+// original. It returns the name the page was written under, or the original
+// name if the caller should copy it instead.
+func convert(ctx context.Context, zw *zip.Writer, f *zip.File, opts Options, names map[string]bool) (string, error) {
+	name := strings.TrimSuffix(f.Name, path.Ext(f.Name)) + "." + opts.Format
+	if names[name] {
+		return f.Name, nil
+	}
+
+	data, err := readAll(f)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := imaging.Encode(ctx, data, opts.Format, opts.Quality)
+	if err != nil {
+		return "", err
+	}
+	if uint64(len(encoded)) >= f.CompressedSize64 {
+		return f.Name, nil
+	}
+
+	header := f.FileHeader
+	header.Name = name
+	header.Method = zip.Store
+	header.Extra = nil
+	w, err := zw.CreateHeader(&header)
+	if err != nil {
+		return "", err
+	}
+	_, err = w.Write(encoded)
+	if err != nil {
+		return "", err
+	}
+	names[name] = true
+	return name, nil
+}
+
+func readAll(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func sameOrder(oldNames, newNames []string) bool {
+	order := func(names []string) []int {
+		idx := make([]int, len(names))
+		for i := range idx {
+			idx[i] = i
+		}
+		slices.SortStableFunc(idx, func(a, b int) int {
+			return strings.Compare(names[a], names[b])
+		})
+		return idx
+	}
+	return slices.Equal(order(oldNames), order(newNames))
+}
+
+// Refresh updates the download size, page entries, page dimensions and file
+// digest of a book from its archive after it has been rewritten. The rest of
+// the page analysis still applies, the pages are the same images.
+func Refresh(book *models.Book) error {
+	reader, err := zip.OpenReader(book.FilePath())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	imgs, err := models.ZippedImages(&reader.Reader)
+	if err != nil {
+		return err
+	}
+	if len(imgs) != len(book.Pages) {
+		return fmt.Errorf("archive has %d pages, expected %d", len(imgs), len(book.Pages))
+	}
+
+	info, err := os.Stat(book.FilePath())
+	if err != nil {
+		return err
+	}
+	err = book.SetPageEntries(imgs, info)
+	if err != nil {
+		return err
+	}
+	book.FileDigest, err = kosync.DigestFile(book.FilePath())
+	if err != nil {
+		return err
+	}
+
+	book.DownloadSize = 0
+	for i, img := range imgs {
+		book.DownloadSize += int(img.FileInfo().Size())
+
+		cfg, err := decodeConfig(img)
+		if err != nil {
+			return fmt.Errorf("failed to read the size of %s: %w", img.Name, err)
+		}
+		book.Pages[i].Width = cfg.Width
+		book.Pages[i].Height = cfg.Height
+	}
+	return nil
+}
+
+func decodeConfig(f *zip.File) (image.Config, error) {
+	r, err := f.Open()
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer r.Close()
+	cfg, _, err := image.DecodeConfig(r)
+	return cfg, err
+}
@@ -0,0 +1,171 @@
+package repack
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+)
+
+// TestMain lets the test binary stand in for the IMAGE_ENCODER command. It
+// writes a blank PNG the size of the image on stdin, which is much smaller
+// than the noisy BMP pages used in the tests.
+func TestMain(m *testing.M) {
+	if os.Getenv("REPACK_TEST_ENCODER") == "1" {
+		img, _, err := image.Decode(os.Stdin)
+		if err != nil {
+			os.Exit(1)
+		}
+		err = png.Encode(os.Stdout, image.NewGray(img.Bounds()))
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Setenv("REPACK_TEST_ENCODER", "1")
+	config.ImageEncoder = os.Args[0]
+	os.Exit(m.Run())
+}
+
+func encoded(t *testing.T, encode func(io.Writer, image.Image) error) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 60))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	buf := &bytes.Buffer{}
+	assert.NoError(t, encode(buf, img))
+	return buf.Bytes()
+}
+
+func writeZip(t *testing.T, file string, entries map[string][]byte, order ...string) {
+	f, err := os.Create(file)
+	assert.NoError(t, err)
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, name := range order {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, err = w.Write(entries[name])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+}
+
+func entryNames(t *testing.T, file string) []string {
+	r, err := zip.OpenReader(file)
+	assert.NoError(t, err)
+	defer r.Close()
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "book.cbz")
+	bmpPage := encoded(t, bmp.Encode)
+	gifPage := encoded(t, func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) })
+	comicInfo := []byte("<ComicInfo><Title>Test</Title></ComicInfo>")
+	writeZip(t, file, map[string][]byte{
+		"02.bmp":        bmpPage,
+		"ComicInfo.xml": comicInfo,
+		"01.bmp":        bmpPage,
+		"03.gif":        gifPage,
+	}, "02.bmp", "ComicInfo.xml", "01.bmp", "03.gif")
+
+	result, err := Rewrite(context.Background(), file, Options{Format: "webp", Quality: 80})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Converted)
+	assert.Less(t, result.Size, result.OriginalSize)
+
+	assert.Equal(t, []string{"02.webp", "ComicInfo.xml", "01.webp", "03.gif"}, entryNames(t, file))
+
+	r, err := zip.OpenReader(file)
+	assert.NoError(t, err)
+	defer r.Close()
+	f, err := r.Open("ComicInfo.xml")
+	assert.NoError(t, err)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, comicInfo, data)
+
+	tmps, err := filepath.Glob(filepath.Join(dir, ".repack-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, tmps)
+}
+
+func TestRewrite_page_order(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "book.cbz")
+	page := encoded(t, bmp.Encode)
+	// a.bmp sorts before a.k.bmp but a.webp would sort after a.k.webp.
+	writeZip(t, file, map[string][]byte{"a.bmp": page, "a.k.bmp": page}, "a.bmp", "a.k.bmp")
+
+	_, err := Rewrite(context.Background(), file, Options{Format: "webp", Quality: 80})
+	assert.ErrorIs(t, err, ErrPageOrder)
+	assert.Equal(t, []string{"a.bmp", "a.k.bmp"}, entryNames(t, file), "the book is left unchanged")
+}
+
+func TestRewrite_invalid_options(t *testing.T) {
+	_, err := Rewrite(context.Background(), "missing.cbz", Options{Format: "jxl", Quality: 80})
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+	_, err = Rewrite(context.Background(), "missing.cbz", Options{Format: "avif", Quality: 101})
+	assert.ErrorIs(t, err, ErrInvalidQuality)
+}
+
+func TestRefresh(t *testing.T) {
+	config.LibraryPath = t.TempDir()
+	page := encoded(t, bmp.Encode)
+	writeZip(t, filepath.Join(config.LibraryPath, "book.cbz"), map[string][]byte{"01.bmp": page, "02.bmp": page}, "01.bmp", "02.bmp")
+	book := &models.Book{
+		File: "book.cbz",
+		Pages: []*models.Page{
+			{BasePage: models.BasePage{Type: models.PageTypeFrontCover}},
+			{BasePage: models.BasePage{Type: models.PageTypeStory}},
+		},
+	}
+
+	_, err := Rewrite(context.Background(), book.FilePath(), Options{Format: "webp", Quality: 80})
+	assert.NoError(t, err)
+	assert.NoError(t, Refresh(book))
+
+	assert.Equal(t, "02.webp", book.PageEntries[1].Name)
+	assert.Equal(t, 40, book.Pages[1].Width)
+	assert.Equal(t, 60, book.Pages[1].Height)
+	assert.Equal(t, models.PageTypeFrontCover, book.Pages[0].Type)
+	assert.Less(t, book.DownloadSize, 2*len(page))
+
+	info, err := os.Stat(book.FilePath())
+	assert.NoError(t, err)
+	_, ok := book.PageEntry(0, info)
+	assert.True(t, ok)
+}
+
+func TestEstimateBook(t *testing.T) {
+	config.LibraryPath = t.TempDir()
+	page := encoded(t, bmp.Encode)
+	writeZip(t, filepath.Join(config.LibraryPath, "book.cbz"), map[string][]byte{"01.bmp": page, "02.bmp": page}, "01.bmp", "02.bmp")
+
+	estimate, err := EstimateBook(context.Background(), &models.Book{File: "book.cbz"}, Options{Format: "webp", Quality: 80})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, estimate.SampledPages)
+	assert.Less(t, estimate.EstimatedSize, estimate.CurrentSize)
+	assert.Equal(t, []string{"01.bmp", "02.bmp"}, entryNames(t, filepath.Join(config.LibraryPath, "book.cbz")), "nothing is written")
+}
+
+func TestSample(t *testing.T) {
+	assert.Equal(t, []int{1, 2}, sample([]int{1, 2}, 4))
+	assert.Equal(t, []int{0, 2, 5, 7}, sample([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 4))
+}
@@ -85,23 +85,38 @@ func InitRouter(r *router.Router) {
 		return nil
 	}))
 
+	r.Use(controllers.WebDAVMiddleware(
+		controllers.BasicAuthMiddleware().Middleware(scoped(controllers.WebDAV(), auth.ScopeBookDownload)),
+	))
+
 	r.Group("/api", func(r *router.Router) {
 		r.Group("", func(r *router.Router) {
 			// r.Use(controllers.HasScope(auth.ScopeAPI))
 
 			r.Get("/series", scoped(controllers.SeriesIndex, auth.ScopeBookIndex)).Name("series.index")
 			r.Post("/series/{slug}", scoped(controllers.SeriesUpdate, auth.ScopeSeriesWrite)).Name("series.update")
+			r.Get("/series/{slug}/auto-delete", scoped(controllers.SeriesAutoDelete, auth.ScopeSeriesWrite)).Name("series.auto-delete")
+			r.Post("/series/{slug}/apply-defaults", scoped(controllers.SeriesApplyDefaults, auth.ScopeBookWrite)).Name("series.apply-defaults")
 			r.Post("/series/{slug}/user-series", scoped(controllers.UserSeriesUpdate, auth.ScopeUserSeriesWrite)).Name("user-series.update")
 
 			r.Get("/books", scoped(controllers.BookIndex, auth.ScopeBookIndex)).Name("book.index")
+			r.Get("/books/review", scoped(controllers.BookReview, auth.ScopeBookWrite)).Name("book.review")
 			r.Post("/books/{id}", scoped(controllers.BookUpdate, auth.ScopeBookWrite)).Name("book.update")
 			r.Delete("/books/{id}", scoped(controllers.BookDelete, auth.ScopeBookDelete)).Name("book.delete")
+			r.Get("/books/{id}/download", scoped(controllers.BookDownload, auth.ScopeBookDownload)).Name("book.download")
+			r.Get("/books/{id}/sprite", scoped(controllers.BookSprite, auth.ScopeBookRead)).Name("book.sprite")
+			r.Get("/books/{id}/page/{page}/slices", scoped(controllers.BookPageSlices, auth.ScopeBookRead)).Name("book.page.slices")
 			r.Post("/books/{id}/user-book", scoped(controllers.UserBookUpdate, auth.ScopeUserBookWrite)).Name("user-book.update")
 
 			r.Post("/sync", scoped(controllers.Sync, auth.ScopeBookSync)).Name("sync")
 
-			// r.Post("/anilist/update", scoped(controllers.AnilistUpdate)).Name("anilist.update")
-			// r.Post("/anilist/login", scoped(controllers.AnilistLogin)).Name("anilist.login")
+			r.Post("/import/tachibk", scoped(controllers.MaxBodySize(controllers.TachibkMaxBodySize).Middleware(controllers.TachibkImport), auth.ScopeUserBookWrite, auth.ScopeUserSeriesWrite)).Name("import.tachibk")
+
+			r.Get("/trackers", scoped(controllers.TrackerList, auth.ScopeUserBookWrite, auth.ScopeUserSeriesWrite)).Name("tracker.index")
+			r.Post("/trackers/sync", scoped(controllers.TrackerSync, auth.ScopeUserBookWrite, auth.ScopeUserSeriesWrite)).Name("tracker.sync")
+			r.Get("/trackers/{service}/authorize", scoped(controllers.TrackerAuthorize, auth.ScopeUserBookWrite, auth.ScopeUserSeriesWrite)).Name("tracker.authorize")
+			r.Post("/trackers/{service}/login", scoped(controllers.TrackerLogin, auth.ScopeUserBookWrite, auth.ScopeUserSeriesWrite)).Name("tracker.login")
+			r.Delete("/trackers/{service}/login", scoped(controllers.TrackerLogout, auth.ScopeUserBookWrite, auth.ScopeUserSeriesWrite)).Name("tracker.logout")
 
 			r.Get("/users/create-token", scoped(controllers.UserCreateToken, auth.ScopeUserWrite)).Name("user-create-token")
 			r.Get("/users/current", scoped(controllers.UserCurrent, auth.ScopeUserRead)).Name("user.current")
@@ -121,6 +136,17 @@ func InitRouter(r *router.Router) {
 				r.Put("/users/{id}", controllers.UserUpdate).Name("user.update")
 
 				r.Get("/roles", controllers.RoleList).Name("role.list")
+
+				r.Get("/book-rules", controllers.BookRuleList).Name("book-rule.list")
+				r.Post("/book-rules", controllers.BookRuleCreate).Name("book-rule.create")
+				r.Post("/book-rules/dry-run", controllers.BookRuleDryRun).Name("book-rule.dry-run")
+				r.Put("/book-rules/{id}", controllers.BookRuleUpdate).Name("book-rule.update")
+				r.Delete("/book-rules/{id}", controllers.BookRuleDelete).Name("book-rule.delete")
+
+				r.Get("/series/{slug}/repack", controllers.SeriesRepackEstimate).Name("series.repack-estimate")
+				r.Post("/series/{slug}/repack", controllers.SeriesRepack).Name("series.repack")
+
+				r.Post("/import/library", controllers.LibraryImport).Name("import.library")
 			})
 		})
 
@@ -132,6 +158,8 @@ func InitRouter(r *router.Router) {
 			r.Group("", func(r *router.Router) {
 				r.Use(middleware.CacheMiddleware())
 				r.Get("/books/{id}/page/{page}/thumbnail", controllers.BookThumbnail).Name("book.thumbnail")
+				r.Get("/books/{id}/sprite/{version}/{start}/{end}", controllers.BookSpriteImage).Name("book.sprite.image")
+				r.Get("/books/{id}/page/{page}/slice/{slice}", controllers.BookPageSlice).Name("book.page.slice")
 			})
 		})
 		r.PostFunc("/users", controllers.UserCreate).Name("user.create")
@@ -151,6 +179,64 @@ func InitRouter(r *router.Router) {
 		r.Handle("/", http.HandlerFunc(controllers.API404)).Name("404")
 	})
 
+	r.Group("/opds", func(r *router.Router) {
+		r.Use(controllers.BasicAuthMiddleware())
+
+		r.Get("", scoped(controllers.OPDSRoot, auth.ScopeBookIndex)).Name("opds.root")
+		r.Get("/opensearch.xml", scoped(controllers.OPDSSearchDescription, auth.ScopeBookIndex)).Name("opds.search-description")
+		r.Get("/search", scoped(controllers.OPDSSearch, auth.ScopeBookIndex)).Name("opds.search")
+		r.Get("/lists", scoped(controllers.OPDSLists, auth.ScopeBookIndex)).Name("opds.lists")
+		r.Get("/recent", scoped(controllers.OPDSRecent, auth.ScopeBookIndex)).Name("opds.recent")
+		r.Get("/series", scoped(controllers.OPDSSeries, auth.ScopeBookIndex)).Name("opds.series")
+		r.Get("/series/{slug}", scoped(controllers.OPDSSeriesBooks, auth.ScopeBookIndex)).Name("opds.series.books")
+		r.Get("/series/{slug}/thumbnail", scoped(controllers.SeriesThumbnail, auth.ScopeBookRead)).Name("opds.series.thumbnail")
+		r.Get("/books/{id}/download", scoped(controllers.BookDownload, auth.ScopeBookDownload)).Name("opds.book.download")
+		r.Get("/books/{id}/stream", scoped(controllers.OPDSPage, auth.ScopeBookRead)).Name("opds.book.stream")
+		r.Get("/books/{id}/page/{page}/thumbnail", scoped(controllers.BookThumbnail, auth.ScopeBookRead)).Name("opds.book.thumbnail")
+
+		r.Group("/v2", func(r *router.Router) {
+			r.Get("", scoped(controllers.OPDS2Root, auth.ScopeBookIndex)).Name("opds2.root")
+			r.Get("/search", scoped(controllers.OPDS2Search, auth.ScopeBookIndex)).Name("opds2.search")
+			r.Get("/recent", scoped(controllers.OPDS2Recent, auth.ScopeBookIndex)).Name("opds2.recent")
+			r.Get("/series", scoped(controllers.OPDS2Series, auth.ScopeBookIndex)).Name("opds2.series")
+			r.Get("/series/{slug}", scoped(controllers.OPDS2SeriesBooks, auth.ScopeBookIndex)).Name("opds2.series.books")
+			r.Get("/books/{id}/manifest.json", scoped(controllers.BookManifest, auth.ScopeBookRead)).Name("opds2.book.manifest")
+			r.Get("/books/{id}/progression", scoped(controllers.BookProgression, auth.ScopeBookRead)).Name("opds2.book.progression")
+			r.Put("/books/{id}/progression", scoped(controllers.BookProgressionUpdate, auth.ScopeUserBookWrite)).Name("opds2.book.progression.update")
+		})
+	})
+
+	r.Group("/komga/api/v1", func(r *router.Router) {
+		r.Use(controllers.BasicAuthMiddleware())
+
+		r.Get("/libraries", scoped(controllers.KomgaLibraries, auth.ScopeBookIndex)).Name("komga.libraries")
+		r.Get("/series", scoped(controllers.KomgaSeriesIndex, auth.ScopeBookIndex)).Name("komga.series.index")
+		r.Get("/series/new", scoped(controllers.KomgaSeriesNew, auth.ScopeBookIndex)).Name("komga.series.new")
+		r.Get("/series/latest", scoped(controllers.KomgaSeriesUpdated, auth.ScopeBookIndex)).Name("komga.series.latest")
+		r.Get("/series/updated", scoped(controllers.KomgaSeriesUpdated, auth.ScopeBookIndex)).Name("komga.series.updated")
+		r.Get("/series/{seriesId}", scoped(controllers.KomgaSeries, auth.ScopeBookIndex)).Name("komga.series.show")
+		r.Get("/series/{seriesId}/books", scoped(controllers.KomgaSeriesBooks, auth.ScopeBookIndex)).Name("komga.series.books")
+		r.Get("/series/{seriesId}/thumbnail", scoped(controllers.KomgaSeriesThumbnail, auth.ScopeBookRead)).Name("komga.series.thumbnail")
+		r.Get("/books/{bookId}", scoped(controllers.KomgaBook, auth.ScopeBookIndex)).Name("komga.book.show")
+		r.Get("/books/{bookId}/pages", scoped(controllers.KomgaBookPages, auth.ScopeBookRead)).Name("komga.book.pages")
+		r.Get("/books/{bookId}/pages/{pageNumber}", scoped(controllers.KomgaBookPage, auth.ScopeBookRead)).Name("komga.book.page")
+		r.Get("/books/{bookId}/thumbnail", scoped(controllers.KomgaBookThumbnail, auth.ScopeBookRead)).Name("komga.book.thumbnail")
+		r.Patch("/books/{bookId}/read-progress", scoped(controllers.KomgaReadProgressUpdate, auth.ScopeUserBookWrite)).Name("komga.book.read-progress")
+	})
+
+	r.Group("/kosync", func(r *router.Router) {
+		r.Get("/healthcheck", controllers.KosyncHealthcheck).Name("kosync.healthcheck")
+		r.Post("/users/create", controllers.KosyncRegister).Name("kosync.register")
+
+		r.Group("", func(r *router.Router) {
+			r.Use(controllers.KosyncAuthMiddleware())
+
+			r.Get("/users/auth", controllers.KosyncAuth).Name("kosync.auth")
+			r.Get("/syncs/progress/{document}", scoped(controllers.KosyncProgress, auth.ScopeBookRead)).Name("kosync.progress")
+			r.Put("/syncs/progress", scoped(controllers.KosyncProgressUpdate, auth.ScopeUserBookWrite)).Name("kosync.progress.update")
+		})
+	})
+
 	r.GetFunc("/static-files", controllers.StaticFiles)
 
 	r.Handle("/", FileServerDefault(ui.Content, "dist", "index.html")).Name("static.files")
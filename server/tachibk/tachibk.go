@@ -0,0 +1,238 @@
+// Package tachibk reads the parts of Mihon and Tachiyomi backups needed to
+// import reading progress. Backups are gzipped protobuf, only the fields used
+// here are decoded and everything else is skipped.
+//
+// https://github.com/mihonapp/mihon/tree/main/app/src/main/java/eu/kanade/tachiyomi/data/backup/models
+package tachibk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// maxBackupSize limits the uncompressed size of a backup, a small gzip can
+// expand to far more than the server should hold in memory.
+const maxBackupSize = 64 << 20
+
+type Backup struct {
+	Manga      []*Manga
+	Categories []*Category
+}
+
+type Manga struct {
+	Source   int64
+	URL      string
+	Title    string
+	Chapters []*Chapter
+	// Categories holds the Order of the manga's categories.
+	Categories []int64
+	Favorite   bool
+}
+
+type Chapter struct {
+	URL  string
+	Name string
+	Read bool
+	// LastPageRead is the 0 based page the reader stopped at in a chapter
+	// that hasn't been finished.
+	LastPageRead int64
+	// ChapterNumber is negative when the source doesn't know it.
+	ChapterNumber float64
+}
+
+type Category struct {
+	Name  string
+	Order int64
+}
+
+// CategoryNames returns the names of the categories m is in.
+func (b *Backup) CategoryNames(m *Manga) []string {
+	names := []string{}
+	for _, c := range b.Categories {
+		for _, order := range m.Categories {
+			if c.Order == order {
+				names = append(names, c.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// Read reads a backup, gzipped or not.
+func Read(r io.Reader) (*Backup, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+	r = br
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	b, err := io.ReadAll(io.LimitReader(r, maxBackupSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+	if len(b) > maxBackupSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidBackup, maxBackupSize)
+	}
+	return Parse(b)
+}
+
+// Parse parses an uncompressed backup.
+func Parse(b []byte) (*Backup, error) {
+	backup := &Backup{}
+	err := fields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m, err := parseManga(v)
+			if err != nil {
+				return err
+			}
+			backup.Manga = append(backup.Manga, m)
+		case 2:
+			c, err := parseCategory(v)
+			if err != nil {
+				return err
+			}
+			backup.Categories = append(backup.Categories, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+func parseManga(b []byte) (*Manga, error) {
+	// Mihon leaves fields with default values out, favorite defaults to true.
+	m := &Manga{Favorite: true}
+	err := fields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.Source = int64(n)
+		case 2:
+			m.URL = string(v)
+		case 3:
+			m.Title = string(v)
+		case 16:
+			c, err := parseChapter(v)
+			if err != nil {
+				return err
+			}
+			m.Chapters = append(m.Chapters, c)
+		case 17:
+			if typ != protowire.BytesType {
+				m.Categories = append(m.Categories, int64(n))
+				return nil
+			}
+			// packed
+			for len(v) > 0 {
+				order, l := protowire.ConsumeVarint(v)
+				if l < 0 {
+					return ErrInvalidBackup
+				}
+				m.Categories = append(m.Categories, int64(order))
+				v = v[l:]
+			}
+		case 100:
+			m.Favorite = n != 0
+		}
+		return nil
+	})
+	return m, err
+}
+
+func parseChapter(b []byte) (*Chapter, error) {
+	c := &Chapter{}
+	err := fields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			c.URL = string(v)
+		case 2:
+			c.Name = string(v)
+		case 4:
+			c.Read = n != 0
+		case 6:
+			c.LastPageRead = int64(n)
+		case 9:
+			switch typ {
+			case protowire.Fixed32Type:
+				c.ChapterNumber = float64(math.Float32frombits(uint32(n)))
+			case protowire.Fixed64Type:
+				c.ChapterNumber = math.Float64frombits(n)
+			}
+		}
+		return nil
+	})
+	return c, err
+}
+
+func parseCategory(b []byte) (*Category, error) {
+	c := &Category{}
+	err := fields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			c.Name = string(v)
+		case 2:
+			c.Order = int64(n)
+		}
+		return nil
+	})
+	return c, err
+}
+
+// fields calls cb with each field in a message. Length delimited values are
+// passed in v, all other values in n.
+func fields(b []byte, cb func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return fmt.Errorf("%w: %w", ErrInvalidBackup, protowire.ParseError(l))
+		}
+		b = b[l:]
+
+		var v []byte
+		var n uint64
+		switch typ {
+		case protowire.VarintType:
+			n, l = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var n32 uint32
+			n32, l = protowire.ConsumeFixed32(b)
+			n = uint64(n32)
+		case protowire.Fixed64Type:
+			n, l = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, l = protowire.ConsumeBytes(b)
+		default:
+			l = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if l < 0 {
+			return fmt.Errorf("%w: %w", ErrInvalidBackup, protowire.ParseError(l))
+		}
+		b = b[l:]
+
+		err := cb(num, typ, v, n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
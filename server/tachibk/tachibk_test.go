@@ -0,0 +1,128 @@
+package tachibk_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"testing"
+
+	"github.com/abibby/comicbox-3/server/tachibk"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func message(fields ...func([]byte) []byte) []byte {
+	b := []byte{}
+	for _, f := range fields {
+		b = f(b)
+	}
+	return b
+}
+func str(num protowire.Number, s string) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, s)
+	}
+}
+func bytesField(num protowire.Number, v []byte) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, v)
+	}
+}
+func varint(num protowire.Number, v uint64) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, v)
+	}
+}
+func float(num protowire.Number, v float32) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, math.Float32bits(v))
+	}
+}
+
+func testBackup() []byte {
+	return message(
+		bytesField(1, message(
+			varint(1, 2499283573021220255),
+			str(2, "/manga/saga"),
+			str(3, "Saga"),
+			str(7, "ignored"),
+			bytesField(16, message(str(1, "/c/1"), str(2, "Chapter 1"), varint(4, 1), float(9, 1))),
+			bytesField(16, message(str(1, "/c/2"), str(2, "Chapter 2"), varint(6, 7), float(9, 2.5))),
+			varint(17, 1),
+			varint(17, 3),
+		)),
+		bytesField(1, message(
+			str(3, "Not In Library"),
+			varint(100, 0),
+		)),
+		bytesField(2, message(str(1, "Reading"), varint(2, 1))),
+		bytesField(2, message(str(1, "Plan to Read"), varint(2, 2))),
+		bytesField(2, message(str(1, "Favourites"), varint(2, 3))),
+		bytesField(101, []byte("preferences")),
+	)
+}
+
+func TestParse(t *testing.T) {
+	b, err := tachibk.Parse(testBackup())
+	assert.NoError(t, err)
+
+	assert.Len(t, b.Manga, 2)
+	saga := b.Manga[0]
+	assert.Equal(t, &tachibk.Manga{
+		Source: 2499283573021220255,
+		URL:    "/manga/saga",
+		Title:  "Saga",
+		Chapters: []*tachibk.Chapter{
+			{URL: "/c/1", Name: "Chapter 1", Read: true, ChapterNumber: 1},
+			{URL: "/c/2", Name: "Chapter 2", LastPageRead: 7, ChapterNumber: 2.5},
+		},
+		Categories: []int64{1, 3},
+		Favorite:   true,
+	}, saga)
+	assert.False(t, b.Manga[1].Favorite)
+
+	assert.Equal(t, []string{"Reading", "Favourites"}, b.CategoryNames(saga))
+}
+
+func TestParse_packed(t *testing.T) {
+	packed := protowire.AppendVarint(protowire.AppendVarint(nil, 4), 5)
+	b, err := tachibk.Parse(message(bytesField(1, message(bytesField(17, packed)))))
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{4, 5}, b.Manga[0].Categories)
+}
+
+func TestParse_invalid(t *testing.T) {
+	_, err := tachibk.Parse([]byte{0x0a, 0xff})
+	assert.ErrorIs(t, err, tachibk.ErrInvalidBackup)
+}
+
+func TestRead(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write(testBackup())
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+
+	b, err := tachibk.Read(buf)
+	assert.NoError(t, err)
+	assert.Len(t, b.Manga, 2)
+
+	b, err = tachibk.Read(bytes.NewReader(testBackup()))
+	assert.NoError(t, err)
+	assert.Len(t, b.Manga, 2)
+}
+
+func TestRead_too_large(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write(make([]byte, 65<<20))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+
+	_, err = tachibk.Read(buf)
+	assert.ErrorIs(t, err, tachibk.ErrInvalidBackup)
+}
@@ -0,0 +1,128 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/services/anilist"
+)
+
+var anilistLists = map[anilist.MediaListStatus]models.List{
+	anilist.MediaListStatusCurrent:   models.ListReading,
+	anilist.MediaListStatusRepeating: models.ListReading,
+	anilist.MediaListStatusCompleted: models.ListCompleted,
+	anilist.MediaListStatusPaused:    models.ListPaused,
+	anilist.MediaListStatusDropped:   models.ListDropped,
+	anilist.MediaListStatusPlanning:  models.ListPlanning,
+}
+
+var anilistStatuses = map[models.List]anilist.MediaListStatus{
+	models.ListReading:   anilist.MediaListStatusCurrent,
+	models.ListCompleted: anilist.MediaListStatusCompleted,
+	models.ListPaused:    anilist.MediaListStatusPaused,
+	models.ListDropped:   anilist.MediaListStatusDropped,
+	models.ListPlanning:  anilist.MediaListStatusPlanning,
+}
+
+type AnilistTracker struct {
+	httpClient *http.Client
+}
+
+var _ Tracker = (*AnilistTracker)(nil)
+
+func NewAnilistTracker(httpClient *http.Client) *AnilistTracker {
+	return &AnilistTracker{
+		httpClient: httpClient,
+	}
+}
+
+// Service implements Tracker.
+func (a *AnilistTracker) Service() models.TrackerService {
+	return models.TrackerAnilist
+}
+
+// AuthorizeURL implements Tracker.
+func (a *AnilistTracker) AuthorizeURL(account *models.UserTracker, redirectURI string) (string, error) {
+	return anilist.AuthorizeURL(redirectURI), nil
+}
+
+// Login implements Tracker.
+func (a *AnilistTracker) Login(ctx context.Context, account *models.UserTracker, r *LoginRequest) error {
+	if r.Code == "" {
+		return ErrRedirectLogin
+	}
+	token, err := anilist.Exchange(ctx, a.httpClient, r.Code, r.RedirectURI)
+	if err != nil {
+		return err
+	}
+	viewer, err := anilist.NewUserClient(a.httpClient, token.AccessToken).Viewer(ctx)
+	if err != nil {
+		return err
+	}
+	account.RemoteUserID = strconv.Itoa(viewer.Viewer.Id)
+	account.Username = viewer.Viewer.Name
+	setToken(account, token.AccessToken, "", token.ExpiresAt)
+	return nil
+}
+
+// Refresh implements Tracker. Anilist tokens can't be refreshed.
+func (a *AnilistTracker) Refresh(ctx context.Context, account *models.UserTracker) error {
+	return ErrTokenExpired
+}
+
+// Entries implements Tracker.
+func (a *AnilistTracker) Entries(ctx context.Context, account *models.UserTracker) (map[string]*Entry, error) {
+	userID, err := strconv.Atoi(account.RemoteUserID)
+	if err != nil {
+		return nil, errors.Join(ErrNotLinked, err)
+	}
+	resp, err := a.client(account).MediaListCollection(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]*Entry{}
+	for _, l := range resp.MediaListCollection.Lists {
+		for _, e := range l.Entries {
+			updatedAt := time.Unix(int64(e.UpdatedAt), 0)
+			entries[strconv.Itoa(e.MediaId)] = &Entry{
+				List:              anilistLists[e.Status],
+				Chapters:          e.Progress,
+				Volumes:           e.ProgressVolumes,
+				ListUpdatedAt:     updatedAt,
+				ProgressUpdatedAt: updatedAt,
+				titles:            anilistTitles(e.Media.Title.English, e.Media.Title.Romaji, e.Media.Title.Native, e.Media.Synonyms),
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Save implements Tracker.
+func (a *AnilistTracker) Save(ctx context.Context, account *models.UserTracker, id string, e *Entry) error {
+	mediaID, err := strconv.Atoi(id)
+	if err != nil {
+		return err
+	}
+	_, err = a.client(account).SaveMediaListEntry(ctx, mediaID, anilistStatuses[e.List], e.Chapters, e.Volumes)
+	return err
+}
+
+// anilistTitles returns the titles that are set, Anilist leaves titles empty
+// when a series doesn't have one in that language.
+func anilistTitles(english, romaji, native string, synonyms []string) []string {
+	titles := []string{}
+	for _, title := range append([]string{english, romaji, native}, synonyms...) {
+		if title != "" {
+			titles = append(titles, title)
+		}
+	}
+	return titles
+}
+
+func (a *AnilistTracker) client(account *models.UserTracker) *anilist.Client {
+	return anilist.NewUserClient(a.httpClient, account.AccessToken)
+}
@@ -0,0 +1,109 @@
+package tracker
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/metadata"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// ImportResult counts the tracker entries applied by an import and lists the
+// titles of the ones that didn't match a series.
+type ImportResult struct {
+	Imported  int      `json:"imported"`
+	Unmatched []string `json:"unmatched"`
+}
+
+// Import fills in the user's lists and progress from the tracker, it is run
+// when an account is linked. Entries are matched to series by their ID on
+// the tracker first and by title second, titles are only matched to series
+// that don't have an ID on the tracker. Unlike Sync the tracker's list always
+// wins, progress is still never moved backwards.
+func Import(ctx context.Context, read salusadb.Read, update salusadb.Update, t Tracker, account *models.UserTracker) (*ImportResult, error) {
+	if !account.Linked() {
+		return nil, ErrNotLinked
+	}
+	err := refresh(ctx, update, t, account)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := t.Entries(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := salusadb.Value(read, func(tx *sqlx.Tx) ([]*models.Series, error) {
+		return models.SeriesQuery(ctx).Get(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	identified := map[string]*models.Series{}
+	unidentified := []*models.Series{}
+	for _, s := range series {
+		if id := s.TrackerID(t.Service()); id != "" {
+			identified[id] = s
+		} else {
+			unidentified = append(unidentified, s)
+		}
+	}
+
+	result := &ImportResult{
+		Unmatched: []string{},
+	}
+	for _, id := range slices.Sorted(maps.Keys(remote)) {
+		e := remote[id]
+		s, identifiedByID := identified[id]
+		if !identifiedByID {
+			s, _ = metadata.MatchSeries(unidentified, e.titles...)
+		}
+		if s == nil {
+			title := id
+			if len(e.titles) > 0 {
+				title = e.titles[0]
+			}
+			result.Unmatched = append(result.Unmatched, title)
+			continue
+		}
+		err = update(func(tx *sqlx.Tx) error {
+			if !identifiedByID {
+				// Sync only follows series with an ID on the tracker.
+				err := setTrackerID(ctx, tx, s, t.Service(), id)
+				if err != nil {
+					return err
+				}
+			}
+			return Apply(ctx, tx, account.UserID, s, e)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !identifiedByID {
+			unidentified = slices.DeleteFunc(unidentified, func(other *models.Series) bool {
+				return other.Slug == s.Slug
+			})
+		}
+		result.Imported++
+	}
+	return result, nil
+}
+
+// setTrackerID saves the series' ID on a tracker.
+func setTrackerID(ctx context.Context, tx *sqlx.Tx, s *models.Series, service models.TrackerService, id string) error {
+	s, err := models.SeriesQuery(ctx).Find(tx, s.Slug)
+	if err != nil || s == nil {
+		return err
+	}
+	if s.TrackerIDs == nil {
+		s.TrackerIDs = map[models.TrackerService]string{}
+	}
+	s.TrackerIDs[service] = id
+	s.UpdateField("tracker_ids")
+	return model.SaveContext(ctx, tx, s)
+}
@@ -0,0 +1,106 @@
+package tracker_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/models/factory"
+	"github.com/abibby/comicbox-3/server/tracker"
+	"github.com/abibby/comicbox-3/test"
+	"github.com/abibby/salusa/di"
+	"github.com/abibby/salusa/router"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) {
+	test.Run(t, "matches entries by id and title", func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+		di.RegisterSingleton(ctx, func() router.URLResolver {
+			return router.NewTestResolver()
+		})
+
+		updatedAt := time.Now()
+		fuzzyStatus := "PLANNING"
+		entry := func(id int, status string, progress int, titles ...string) map[string]any {
+			return map[string]any{
+				"mediaId": id, "status": status, "progress": progress, "updatedAt": updatedAt.Unix(),
+				"media": map[string]any{"title": map[string]any{"english": titles[0]}, "synonyms": titles[1:]},
+			}
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+				"MediaListCollection": map[string]any{"lists": []any{map[string]any{
+					"name": "Manga",
+					"entries": []any{
+						entry(1, "COMPLETED", 2, "Something Else"),
+						entry(3, fuzzyStatus, 0, "Shingeki no Kyojin", "Fuzzy Series!"),
+						entry(4, "CURRENT", 1, "Not In The Library"),
+					},
+				}}},
+			}})
+		})
+		s := httptest.NewServer(mux)
+		defer s.Close()
+		oldURL := config.AnilistAPIURL
+		config.AnilistAPIURL = s.URL + "/graphql"
+		defer func() { config.AnilistAPIURL = oldURL }()
+
+		account, pulled, _ := fixtures(ctx, tx, models.TrackerAnilist, time.Now().Add(time.Hour*24))
+		fuzzy := factory.Series.State(func(s *models.Series) {
+			s.Slug = "fuzzy"
+			s.Name = "Fuzzy Series"
+		}).Create(tx)
+		factory.Book.State(func(b *models.Book) {
+			b.SeriesSlug = fuzzy.Slug
+		}).Create(tx)
+
+		run := func(cb func(tx *sqlx.Tx) error) error {
+			return cb(tx)
+		}
+		result, err := tracker.Import(ctx, run, run, tracker.NewAnilistTracker(http.DefaultClient), account)
+		assert.NoError(t, err)
+		assert.Equal(t, &tracker.ImportResult{
+			Imported:  2,
+			Unmatched: []string{"Not In The Library"},
+		}, result)
+
+		userCtx := test.WithUser(ctx, &models.User{ID: account.UserID})
+		lists := map[string]models.List{}
+		for _, slug := range []string{pulled.Slug, fuzzy.Slug} {
+			us, err := models.UserSeriesQuery(userCtx).Where("series_name", "=", slug).First(tx)
+			assert.NoError(t, err)
+			if us != nil {
+				lists[slug] = us.List
+			}
+		}
+		assert.Equal(t, map[string]models.List{
+			pulled.Slug: models.ListCompleted,
+			fuzzy.Slug:  models.ListPlanning,
+		}, lists)
+
+		series, err := models.SeriesQuery(ctx).Find(tx, fuzzy.Slug)
+		assert.NoError(t, err)
+		if assert.NotNil(t, series) {
+			assert.Equal(t, "3", series.TrackerID(models.TrackerAnilist))
+		}
+
+		updatedAt = updatedAt.Add(time.Hour)
+		fuzzyStatus = "CURRENT"
+		syncResult, err := tracker.Sync(ctx, run, run, tracker.NewAnilistTracker(http.DefaultClient), account, []string{fuzzy.Slug})
+		assert.NoError(t, err)
+		assert.Equal(t, &tracker.Result{Pulled: 1}, syncResult)
+
+		us, err := models.UserSeriesQuery(userCtx).Where("series_name", "=", fuzzy.Slug).First(tx)
+		assert.NoError(t, err)
+		if assert.NotNil(t, us) {
+			assert.Equal(t, models.ListReading, us.List)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/services/kitsu"
+)
+
+var kitsuLists = map[kitsu.Status]models.List{
+	kitsu.StatusCurrent:   models.ListReading,
+	kitsu.StatusCompleted: models.ListCompleted,
+	kitsu.StatusOnHold:    models.ListPaused,
+	kitsu.StatusDropped:   models.ListDropped,
+	kitsu.StatusPlanned:   models.ListPlanning,
+}
+
+var kitsuStatuses = map[models.List]kitsu.Status{
+	models.ListReading:   kitsu.StatusCurrent,
+	models.ListCompleted: kitsu.StatusCompleted,
+	models.ListPaused:    kitsu.StatusOnHold,
+	models.ListDropped:   kitsu.StatusDropped,
+	models.ListPlanning:  kitsu.StatusPlanned,
+}
+
+type KitsuTracker struct {
+	httpClient *http.Client
+}
+
+var _ Tracker = (*KitsuTracker)(nil)
+var _ chapterTracker = (*KitsuTracker)(nil)
+var _ passwordTracker = (*KitsuTracker)(nil)
+
+func NewKitsuTracker(httpClient *http.Client) *KitsuTracker {
+	return &KitsuTracker{
+		httpClient: httpClient,
+	}
+}
+
+// Service implements Tracker.
+func (k *KitsuTracker) Service() models.TrackerService {
+	return models.TrackerKitsu
+}
+
+// AuthorizeURL implements Tracker. Kitsu logs in with a password instead.
+func (k *KitsuTracker) AuthorizeURL(account *models.UserTracker, redirectURI string) (string, error) {
+	return "", ErrPasswordLogin
+}
+
+// Login implements Tracker.
+func (k *KitsuTracker) Login(ctx context.Context, account *models.UserTracker, r *LoginRequest) error {
+	if r.Username == "" || r.Password == "" {
+		return ErrPasswordLogin
+	}
+	token, err := kitsu.Login(ctx, k.httpClient, r.Username, r.Password)
+	if err != nil {
+		return err
+	}
+	self, err := kitsu.NewClient(k.httpClient, token.AccessToken).Self(ctx)
+	if err != nil {
+		return err
+	}
+	account.RemoteUserID = self.ID
+	account.Username = self.Name
+	setToken(account, token.AccessToken, token.RefreshToken, token.ExpiresAt)
+	return nil
+}
+
+// Refresh implements Tracker.
+func (k *KitsuTracker) Refresh(ctx context.Context, account *models.UserTracker) error {
+	if account.RefreshToken == "" {
+		return ErrTokenExpired
+	}
+	token, err := kitsu.Refresh(ctx, k.httpClient, account.RefreshToken)
+	if err != nil {
+		return errors.Join(ErrTokenExpired, err)
+	}
+	setToken(account, token.AccessToken, token.RefreshToken, token.ExpiresAt)
+	return nil
+}
+
+// Entries implements Tracker.
+func (k *KitsuTracker) Entries(ctx context.Context, account *models.UserTracker) (map[string]*Entry, error) {
+	list, err := k.client(account).LibraryEntries(ctx, account.RemoteUserID)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*Entry, len(list))
+	for _, e := range list {
+		entries[e.MangaID] = &Entry{
+			List:              kitsuLists[e.Status],
+			Chapters:          e.Progress,
+			ListUpdatedAt:     e.UpdatedAt,
+			ProgressUpdatedAt: e.UpdatedAt,
+			remoteID:          e.ID,
+		}
+	}
+	return entries, nil
+}
+
+// Save implements Tracker.
+func (k *KitsuTracker) Save(ctx context.Context, account *models.UserTracker, id string, e *Entry) error {
+	return k.client(account).SaveLibraryEntry(ctx, account.RemoteUserID, &kitsu.LibraryEntry{
+		ID:       e.remoteID,
+		MangaID:  id,
+		Status:   kitsuStatuses[e.List],
+		Progress: e.Chapters,
+	})
+}
+
+func (k *KitsuTracker) chaptersOnly()  {}
+func (k *KitsuTracker) passwordLogin() {}
+
+func (k *KitsuTracker) client(account *models.UserTracker) *kitsu.Client {
+	return kitsu.NewClient(k.httpClient, account.AccessToken)
+}
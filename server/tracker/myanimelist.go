@@ -0,0 +1,128 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/services/myanimelist"
+)
+
+var myAnimeListLists = map[myanimelist.Status]models.List{
+	myanimelist.StatusReading:    models.ListReading,
+	myanimelist.StatusCompleted:  models.ListCompleted,
+	myanimelist.StatusOnHold:     models.ListPaused,
+	myanimelist.StatusDropped:    models.ListDropped,
+	myanimelist.StatusPlanToRead: models.ListPlanning,
+}
+
+var myAnimeListStatuses = map[models.List]myanimelist.Status{
+	models.ListReading:   myanimelist.StatusReading,
+	models.ListCompleted: myanimelist.StatusCompleted,
+	models.ListPaused:    myanimelist.StatusOnHold,
+	models.ListDropped:   myanimelist.StatusDropped,
+	models.ListPlanning:  myanimelist.StatusPlanToRead,
+}
+
+type MyAnimeListTracker struct {
+	httpClient *http.Client
+}
+
+var _ Tracker = (*MyAnimeListTracker)(nil)
+
+func NewMyAnimeListTracker(httpClient *http.Client) *MyAnimeListTracker {
+	return &MyAnimeListTracker{
+		httpClient: httpClient,
+	}
+}
+
+// Service implements Tracker.
+func (m *MyAnimeListTracker) Service() models.TrackerService {
+	return models.TrackerMyAnimeList
+}
+
+// AuthorizeURL implements Tracker. The PKCE verifier is kept on the account
+// until the user logs in.
+func (m *MyAnimeListTracker) AuthorizeURL(account *models.UserTracker, redirectURI string) (string, error) {
+	verifier, err := myanimelist.NewVerifier()
+	if err != nil {
+		return "", err
+	}
+	account.Verifier = verifier
+	return myanimelist.AuthorizeURL(verifier, redirectURI), nil
+}
+
+// Login implements Tracker.
+func (m *MyAnimeListTracker) Login(ctx context.Context, account *models.UserTracker, r *LoginRequest) error {
+	if r.Code == "" {
+		return ErrRedirectLogin
+	}
+	if account.Verifier == "" {
+		return errors.New("myanimelist login was not started")
+	}
+	token, err := myanimelist.Exchange(ctx, m.httpClient, r.Code, account.Verifier, r.RedirectURI)
+	if err != nil {
+		return err
+	}
+	me, err := myanimelist.NewClient(m.httpClient, token.AccessToken).Me(ctx)
+	if err != nil {
+		return err
+	}
+	account.RemoteUserID = strconv.Itoa(me.ID)
+	account.Username = me.Name
+	account.Verifier = ""
+	setToken(account, token.AccessToken, token.RefreshToken, token.ExpiresAt)
+	return nil
+}
+
+// Refresh implements Tracker.
+func (m *MyAnimeListTracker) Refresh(ctx context.Context, account *models.UserTracker) error {
+	if account.RefreshToken == "" {
+		return ErrTokenExpired
+	}
+	token, err := myanimelist.Refresh(ctx, m.httpClient, account.RefreshToken)
+	if err != nil {
+		return errors.Join(ErrTokenExpired, err)
+	}
+	setToken(account, token.AccessToken, token.RefreshToken, token.ExpiresAt)
+	return nil
+}
+
+// Entries implements Tracker.
+func (m *MyAnimeListTracker) Entries(ctx context.Context, account *models.UserTracker) (map[string]*Entry, error) {
+	list, err := m.client(account).MangaList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*Entry, len(list))
+	for _, e := range list {
+		entries[strconv.Itoa(e.Node.ID)] = &Entry{
+			List:              myAnimeListLists[e.ListStatus.Status],
+			Chapters:          e.ListStatus.NumChaptersRead,
+			Volumes:           e.ListStatus.NumVolumesRead,
+			ListUpdatedAt:     e.ListStatus.UpdatedAt,
+			ProgressUpdatedAt: e.ListStatus.UpdatedAt,
+			titles:            []string{e.Node.Title},
+		}
+	}
+	return entries, nil
+}
+
+// Save implements Tracker.
+func (m *MyAnimeListTracker) Save(ctx context.Context, account *models.UserTracker, id string, e *Entry) error {
+	mangaID, err := strconv.Atoi(id)
+	if err != nil {
+		return err
+	}
+	return m.client(account).UpdateListStatus(ctx, mangaID, &myanimelist.ListStatus{
+		Status:          myAnimeListStatuses[e.List],
+		NumChaptersRead: e.Chapters,
+		NumVolumesRead:  e.Volumes,
+	})
+}
+
+func (m *MyAnimeListTracker) client(account *models.UserTracker) *myanimelist.Client {
+	return myanimelist.NewClient(m.httpClient, account.AccessToken)
+}
@@ -0,0 +1,201 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrNotLinked     = errors.New("tracker account not linked")
+	ErrTokenExpired  = errors.New("tracker login expired, link the account again")
+	ErrPasswordLogin = errors.New("tracker logs in with a username and password")
+	ErrRedirectLogin = errors.New("tracker logs in by redirecting to its site")
+)
+
+// Result counts the series changed by a sync.
+type Result struct {
+	Pushed int `json:"pushed"`
+	Pulled int `json:"pulled"`
+}
+
+// LoginRequest is what the user logged in to a tracker with. Trackers that
+// redirect to their site use Code and RedirectURI, the others use Username
+// and Password.
+type LoginRequest struct {
+	Code        string
+	RedirectURI string
+	Username    string
+	Password    string
+}
+
+// Tracker is a reading tracker that users can sync their lists and progress
+// with. Series are identified by their ID on the tracker.
+type Tracker interface {
+	Service() models.TrackerService
+	// AuthorizeURL returns the page the user logs in on, it may save state
+	// for Login on the account.
+	AuthorizeURL(account *models.UserTracker, redirectURI string) (string, error)
+	// Login links the account to the user's account on the tracker.
+	Login(ctx context.Context, account *models.UserTracker, r *LoginRequest) error
+	// Refresh replaces the account's expired access token.
+	Refresh(ctx context.Context, account *models.UserTracker) error
+	// Entries returns the user's entries on the tracker by series ID.
+	Entries(ctx context.Context, account *models.UserTracker) (map[string]*Entry, error)
+	// Save adds or updates the series' entry on the tracker.
+	Save(ctx context.Context, account *models.UserTracker, id string, e *Entry) error
+}
+
+// chapterTracker is implemented by trackers that don't keep volume
+// progress.
+type chapterTracker interface {
+	chaptersOnly()
+}
+
+// Trackers returns the trackers set up on this server. Kitsu doesn't need a
+// client ID so it is always available.
+func Trackers() []Tracker {
+	trackers := []Tracker{}
+	if config.AnilistClientID != "" {
+		trackers = append(trackers, NewAnilistTracker(http.DefaultClient))
+	}
+	if config.MyAnimeListClientID != "" {
+		trackers = append(trackers, NewMyAnimeListTracker(http.DefaultClient))
+	}
+	trackers = append(trackers, NewKitsuTracker(http.DefaultClient))
+	return trackers
+}
+
+// Find returns the tracker for service, or nil if it isn't set up.
+func Find(service models.TrackerService) Tracker {
+	for _, t := range Trackers() {
+		if t.Service() == service {
+			return t
+		}
+	}
+	return nil
+}
+
+// Sync syncs the account's lists and progress with the tracker. Only the
+// series in slugs are synced, every series with an ID on the tracker is
+// synced when slugs is nil.
+func Sync(ctx context.Context, read salusadb.Read, update salusadb.Update, t Tracker, account *models.UserTracker, slugs []string) (*Result, error) {
+	if !account.Linked() {
+		return nil, ErrNotLinked
+	}
+	if slugs != nil && len(slugs) == 0 {
+		return &Result{}, nil
+	}
+	err := refresh(ctx, update, t, account)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := t.Entries(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	type syncSeries struct {
+		series *models.Series
+		local  *Entry
+		id     string
+	}
+	seriesList := []*syncSeries{}
+	err = read(func(tx *sqlx.Tx) error {
+		q := models.SeriesQuery(ctx)
+		if slugs != nil {
+			names := make([]any, len(slugs))
+			for i, slug := range slugs {
+				names[i] = slug
+			}
+			q = q.WhereIn("name", names)
+		}
+		series, err := q.Get(tx)
+		if err != nil {
+			return err
+		}
+		for _, s := range series {
+			id := s.TrackerID(t.Service())
+			if id == "" {
+				continue
+			}
+			local, err := Local(ctx, tx, account.UserID, s)
+			if err != nil {
+				return err
+			}
+			if _, ok := t.(chapterTracker); ok {
+				local.Volumes = 0
+			}
+			seriesList = append(seriesList, &syncSeries{series: s, local: local, id: id})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, s := range seriesList {
+		push, pull := Merge(s.local, remote[s.id])
+		if push != nil {
+			err = t.Save(ctx, account, s.id, push)
+			if err != nil {
+				return nil, err
+			}
+			result.Pushed++
+		}
+		if pull != nil {
+			err = update(func(tx *sqlx.Tx) error {
+				return Apply(ctx, tx, account.UserID, s.series, pull)
+			})
+			if err != nil {
+				return nil, err
+			}
+			result.Pulled++
+		}
+	}
+	return result, nil
+}
+
+// refresh replaces the account's access token when it is about to expire.
+func refresh(ctx context.Context, update salusadb.Update, t Tracker, account *models.UserTracker) error {
+	if account.ExpiresAt == nil || time.Now().Add(time.Minute).Before(account.ExpiresAt.Time()) {
+		return nil
+	}
+	err := t.Refresh(ctx, account)
+	if err != nil {
+		return err
+	}
+	return update(func(tx *sqlx.Tx) error {
+		return model.SaveContext(auth.ActAs(ctx, account.UserID), tx, account)
+	})
+}
+
+func setToken(account *models.UserTracker, accessToken, refreshToken string, expiresAt time.Time) {
+	account.AccessToken = accessToken
+	account.RefreshToken = refreshToken
+	account.ExpiresAt = (*database.Time)(&expiresAt)
+}
+
+// passwordTracker is implemented by trackers that log in with a username and
+// password instead of redirecting to their site.
+type passwordTracker interface {
+	passwordLogin()
+}
+
+// PasswordLogin reports whether the tracker logs in with a username and
+// password.
+func PasswordLogin(t Tracker) bool {
+	_, ok := t.(passwordTracker)
+	return ok
+}
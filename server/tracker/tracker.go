@@ -0,0 +1,193 @@
+// Package tracker syncs users' lists and reading progress with reading
+// trackers like Anilist, MyAnimeList and Kitsu. Each side's entry for a
+// series is compared and the most recently updated one wins, progress is
+// never moved backwards.
+package tracker
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/server/auth"
+	salusadb "github.com/abibby/salusa/database"
+	"github.com/abibby/salusa/database/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Entry is a user's list and progress for a series, either here or on a
+// tracker.
+type Entry struct {
+	List models.List
+	// Chapters and Volumes are the highest chapter and volume read.
+	Chapters int
+	Volumes  int
+
+	// ListUpdatedAt and ProgressUpdatedAt are when the list and progress
+	// last changed. Trackers only keep one time for the whole entry.
+	ListUpdatedAt     time.Time
+	ProgressUpdatedAt time.Time
+
+	// remoteID is the tracker's ID for the entry when it differs from the
+	// series' ID.
+	remoteID string
+	// titles are the series' titles on the tracker, they are used to match
+	// entries to series without a tracker ID when importing.
+	titles []string
+}
+
+// Local reads the user's entry for series. Only books read to the last page
+// count towards their progress, books without a chapter count as volumes.
+func Local(ctx context.Context, tx salusadb.DB, uid uuid.UUID, series *models.Series) (*Entry, error) {
+	ctx = auth.ActAs(ctx, uid)
+	e := &Entry{}
+
+	us, err := models.UserSeriesQuery(ctx).Where("series_name", "=", series.Slug).First(tx)
+	if err != nil {
+		return nil, err
+	}
+	if us != nil {
+		e.List = us.List
+		e.ListUpdatedAt = fieldUpdatedAt(&us.BaseModel, "list")
+	}
+
+	books, err := models.BookQuery(ctx).
+		Where("series", "=", series.Slug).
+		With("UserBook").
+		Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range books {
+		ub, _ := b.UserBook.Value()
+		if ub == nil {
+			continue
+		}
+		if t := fieldUpdatedAt(&ub.BaseModel, "current_page"); t.After(e.ProgressUpdatedAt) {
+			e.ProgressUpdatedAt = t
+		}
+		if !isRead(b, ub) {
+			continue
+		}
+		if chapter, ok := b.Chapter.Ok(); ok {
+			e.Chapters = max(e.Chapters, int(math.Floor(chapter)))
+		} else if volume, ok := b.Volume.Ok(); ok {
+			e.Volumes = max(e.Volumes, int(math.Floor(volume)))
+		}
+	}
+	return e, nil
+}
+
+// Merge compares the local entry with the tracker's, remote is nil when the
+// series isn't on the user's tracker list. It returns the entry to push to
+// the tracker and the entry to apply locally, either is nil when nothing
+// needs to change. The newer list wins, progress is only taken from the
+// newer side when it is further along. Series that aren't in a list here are
+// not added to the tracker.
+func Merge(local, remote *Entry) (push, pull *Entry) {
+	if remote == nil {
+		if local.List == models.ListNone {
+			return nil, nil
+		}
+		return local, nil
+	}
+
+	push = &Entry{List: remote.List, Chapters: remote.Chapters, Volumes: remote.Volumes, remoteID: remote.remoteID}
+	pull = &Entry{List: local.List, Chapters: local.Chapters, Volumes: local.Volumes}
+	pushed, pulled := false, false
+
+	if local.List != remote.List {
+		if remote.ListUpdatedAt.After(local.ListUpdatedAt) {
+			pull.List, pulled = remote.List, true
+		} else if local.List != models.ListNone {
+			push.List, pushed = local.List, true
+		}
+	}
+
+	localNewer := local.ProgressUpdatedAt.After(remote.ProgressUpdatedAt)
+	if local.Chapters > remote.Chapters && localNewer {
+		push.Chapters, pushed = local.Chapters, true
+	} else if remote.Chapters > local.Chapters && !localNewer {
+		pull.Chapters, pulled = remote.Chapters, true
+	}
+	if local.Volumes > remote.Volumes && localNewer {
+		push.Volumes, pushed = local.Volumes, true
+	} else if remote.Volumes > local.Volumes && !localNewer {
+		pull.Volumes, pulled = remote.Volumes, true
+	}
+
+	if !pushed {
+		push = nil
+	}
+	if !pulled {
+		pull = nil
+	}
+	return push, pull
+}
+
+// Apply saves an entry pulled from a tracker for the user. Books up to the
+// entry's chapter or volume are marked as read, books are never marked as
+// unread.
+func Apply(ctx context.Context, tx *sqlx.Tx, uid uuid.UUID, series *models.Series, e *Entry) error {
+	ctx = auth.ActAs(ctx, uid)
+
+	books, err := models.BookQuery(ctx).Where("series", "=", series.Slug).Get(tx)
+	if err != nil {
+		return err
+	}
+	for _, b := range books {
+		if !includes(e, b) {
+			continue
+		}
+		err = models.AdvanceUserBook(ctx, tx, uid, b.ID, max(b.PageCount-1, 0))
+		if err != nil {
+			return err
+		}
+	}
+
+	us, err := models.UserSeriesQuery(ctx).Where("series_name", "=", series.Slug).First(tx)
+	if err != nil {
+		return err
+	}
+	if us == nil {
+		us = &models.UserSeries{UserID: uid, SeriesSlug: series.Slug}
+	}
+	if us.List == e.List {
+		return nil
+	}
+	if us.UpdateMap == nil {
+		us.UpdateMap = map[string]string{}
+	}
+	us.List = e.List
+	us.UpdateField("list")
+	return model.SaveContext(ctx, tx, us)
+}
+
+// includes reports whether the book is covered by the entry's progress.
+func includes(e *Entry, b *models.Book) bool {
+	if chapter, ok := b.Chapter.Ok(); ok {
+		return e.Chapters > 0 && chapter <= float64(e.Chapters)
+	}
+	if volume, ok := b.Volume.Ok(); ok {
+		return e.Volumes > 0 && volume <= float64(e.Volumes)
+	}
+	return false
+}
+
+func isRead(b *models.Book, ub *models.UserBook) bool {
+	return ub.CurrentPage >= b.PageCount-1
+}
+
+// fieldUpdatedAt returns when the field was last changed from the model's
+// update map, falling back to when the model was saved.
+func fieldUpdatedAt(m *models.BaseModel, field string) time.Time {
+	ms, err := strconv.ParseInt(strings.Split(m.UpdateMap[field], "-")[0], 10, 64)
+	if err != nil {
+		return m.UpdatedAt.Time()
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,400 @@
+package tracker_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/database"
+	"github.com/abibby/comicbox-3/models"
+	"github.com/abibby/comicbox-3/models/factory"
+	"github.com/abibby/comicbox-3/server/tracker"
+	"github.com/abibby/comicbox-3/test"
+	"github.com/abibby/nulls"
+	"github.com/abibby/salusa/database/model"
+	"github.com/abibby/salusa/di"
+	"github.com/abibby/salusa/router"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	older := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	testCases := []struct {
+		name   string
+		local  *tracker.Entry
+		remote *tracker.Entry
+		push   *tracker.Entry
+		pull   *tracker.Entry
+	}{
+		{
+			name:  "adds listed series",
+			local: &tracker.Entry{List: models.ListReading, Chapters: 3},
+			push:  &tracker.Entry{List: models.ListReading, Chapters: 3},
+		},
+		{
+			name:  "skips unlisted series",
+			local: &tracker.Entry{Chapters: 3},
+		},
+		{
+			name:   "newer local list is pushed",
+			local:  &tracker.Entry{List: models.ListCompleted, Chapters: 3, ListUpdatedAt: newer},
+			remote: &tracker.Entry{List: models.ListReading, Chapters: 3, ListUpdatedAt: older, ProgressUpdatedAt: older},
+			push:   &tracker.Entry{List: models.ListCompleted, Chapters: 3},
+		},
+		{
+			name:   "newer remote list is pulled",
+			local:  &tracker.Entry{List: models.ListReading, Chapters: 3, ListUpdatedAt: older},
+			remote: &tracker.Entry{List: models.ListPaused, Chapters: 3, ListUpdatedAt: newer, ProgressUpdatedAt: newer},
+			pull:   &tracker.Entry{List: models.ListPaused, Chapters: 3},
+		},
+		{
+			name:   "newer local progress is pushed",
+			local:  &tracker.Entry{List: models.ListReading, Chapters: 5, Volumes: 1, ProgressUpdatedAt: newer},
+			remote: &tracker.Entry{List: models.ListReading, Chapters: 3, ListUpdatedAt: older, ProgressUpdatedAt: older},
+			push:   &tracker.Entry{List: models.ListReading, Chapters: 5, Volumes: 1},
+		},
+		{
+			name:   "newer remote progress is pulled",
+			local:  &tracker.Entry{List: models.ListReading, Chapters: 3, ProgressUpdatedAt: older},
+			remote: &tracker.Entry{List: models.ListReading, Chapters: 8, ListUpdatedAt: newer, ProgressUpdatedAt: newer},
+			pull:   &tracker.Entry{List: models.ListReading, Chapters: 8},
+		},
+		{
+			name:   "progress is not moved backwards",
+			local:  &tracker.Entry{List: models.ListReading, Chapters: 3, ProgressUpdatedAt: newer},
+			remote: &tracker.Entry{List: models.ListReading, Chapters: 8, ListUpdatedAt: older, ProgressUpdatedAt: older},
+		},
+		{
+			name:   "local list without a list is not pushed",
+			local:  &tracker.Entry{ListUpdatedAt: newer},
+			remote: &tracker.Entry{List: models.ListReading, ListUpdatedAt: older, ProgressUpdatedAt: older},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			push, pull := tracker.Merge(tc.local, tc.remote)
+			if tc.push == nil {
+				assert.Nil(t, push)
+			} else if assert.NotNil(t, push) {
+				assert.Equal(t, tc.push.List, push.List)
+				assert.Equal(t, tc.push.Chapters, push.Chapters)
+				assert.Equal(t, tc.push.Volumes, push.Volumes)
+			}
+			if tc.pull == nil {
+				assert.Nil(t, pull)
+			} else if assert.NotNil(t, pull) {
+				assert.Equal(t, tc.pull.List, pull.List)
+				assert.Equal(t, tc.pull.Chapters, pull.Chapters)
+				assert.Equal(t, tc.pull.Volumes, pull.Volumes)
+			}
+		})
+	}
+}
+
+// fixtures creates a user linked to the tracker with two series on it. The
+// tracker has the first series completed to chapter 2 and the user has read
+// the first volume of the second.
+func fixtures(ctx context.Context, tx *sqlx.Tx, service models.TrackerService, expiresAt time.Time) (*models.UserTracker, *models.Series, *models.Series) {
+	user := factory.User.Create(tx)
+	account := &models.UserTracker{
+		UserID:       user.ID,
+		Service:      service,
+		RemoteUserID: "7",
+		AccessToken:  "token",
+		RefreshToken: "refresh",
+		ExpiresAt:    (*database.Time)(&expiresAt),
+	}
+	model.MustSaveContext(test.WithUser(ctx, user), tx, account)
+
+	trackerID := func(s *models.Series, id int) {
+		if service == models.TrackerAnilist {
+			s.MetadataID = models.NewAnilistID(id)
+		} else {
+			s.TrackerIDs = map[models.TrackerService]string{service: strconv.Itoa(id)}
+		}
+	}
+
+	// Series without books are deleted when a book is saved, so each
+	// series' books are created with it.
+	pulled := factory.Series.State(func(s *models.Series) {
+		s.Slug = "pulled"
+		trackerID(s, 1)
+	}).Create(tx)
+	chapter := float64(0)
+	factory.Book.State(func(b *models.Book) {
+		chapter++
+		b.SeriesSlug = pulled.Slug
+		b.Chapter = nulls.NewFloat64(chapter)
+		b.Pages = []*models.Page{{}, {}}
+	}).Count(3).Create(tx)
+
+	pushed := factory.Series.State(func(s *models.Series) {
+		s.Slug = "pushed"
+		trackerID(s, 2)
+	}).Create(tx)
+	factory.Book.State(func(b *models.Book) {
+		b.SeriesSlug = pushed.Slug
+		b.Chapter = nil
+		b.Volume = nulls.NewFloat64(1)
+		b.Pages = []*models.Page{{}, {}}
+		factory.UserBook.State(func(ub *models.UserBook) {
+			ub.BookID = b.ID
+			ub.UserID = user.ID
+			ub.CurrentPage = 1
+		}).Create(tx)
+	}).Create(tx)
+	model.MustSaveContext(test.WithUser(ctx, user), tx, &models.UserSeries{
+		SeriesSlug: pushed.Slug,
+		UserID:     user.ID,
+		List:       models.ListReading,
+	})
+
+	// Unrelated series are left alone.
+	factory.Series.State(func(s *models.Series) {
+		s.Slug = "unrelated"
+	}).Create(tx)
+
+	return account, pulled, pushed
+}
+
+func TestSync(t *testing.T) {
+	updatedAt := time.Now().Add(time.Hour)
+
+	testCases := []struct {
+		name      string
+		tracker   tracker.Tracker
+		standIn   func(t *testing.T, saved *[]any) *http.ServeMux
+		configure func(url string) func()
+		saved     []any
+	}{
+		{
+			name:    "anilist",
+			tracker: tracker.NewAnilistTracker(http.DefaultClient),
+			standIn: func(t *testing.T, saved *[]any) *http.ServeMux {
+				mux := http.NewServeMux()
+				mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+					req := struct {
+						OperationName string         `json:"operationName"`
+						Variables     map[string]any `json:"variables"`
+					}{}
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+					var data any
+					switch req.OperationName {
+					case "MediaListCollection":
+						data = map[string]any{"MediaListCollection": map[string]any{
+							"lists": []any{map[string]any{
+								"name": "Completed",
+								"entries": []any{map[string]any{
+									"mediaId": 1, "status": "COMPLETED", "progress": 2, "updatedAt": updatedAt.Unix(),
+								}},
+							}},
+						}}
+					case "SaveMediaListEntry":
+						*saved = append(*saved, req.Variables)
+						data = map[string]any{"SaveMediaListEntry": req.Variables}
+					}
+					_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+				})
+				return mux
+			},
+			configure: func(url string) func() {
+				old := config.AnilistAPIURL
+				config.AnilistAPIURL = url + "/graphql"
+				return func() { config.AnilistAPIURL = old }
+			},
+			saved: []any{
+				map[string]any{"mediaId": float64(2), "status": "CURRENT", "progressVolumes": float64(1)},
+			},
+		},
+		{
+			name:    "myanimelist",
+			tracker: tracker.NewMyAnimeListTracker(http.DefaultClient),
+			standIn: func(t *testing.T, saved *[]any) *http.ServeMux {
+				mux := http.NewServeMux()
+				mux.HandleFunc("GET /v2/users/@me/mangalist", func(w http.ResponseWriter, r *http.Request) {
+					_ = json.NewEncoder(w).Encode(map[string]any{
+						"data": []any{map[string]any{
+							"node":        map[string]any{"id": 1, "title": "Pulled"},
+							"list_status": map[string]any{"status": "completed", "num_chapters_read": 2, "updated_at": updatedAt.Format(time.RFC3339)},
+						}},
+					})
+				})
+				mux.HandleFunc("PATCH /v2/manga/{id}/my_list_status", func(w http.ResponseWriter, r *http.Request) {
+					assert.NoError(t, r.ParseForm())
+					*saved = append(*saved, r.PathValue("id")+"?"+r.PostForm.Encode())
+					_, _ = w.Write([]byte(`{}`))
+				})
+				return mux
+			},
+			configure: func(url string) func() {
+				old := config.MyAnimeListAPIURL
+				config.MyAnimeListAPIURL = url
+				return func() { config.MyAnimeListAPIURL = old }
+			},
+			saved: []any{"2?num_chapters_read=0&num_volumes_read=1&status=reading"},
+		},
+		{
+			name:    "kitsu",
+			tracker: tracker.NewKitsuTracker(http.DefaultClient),
+			standIn: func(t *testing.T, saved *[]any) *http.ServeMux {
+				mux := http.NewServeMux()
+				mux.HandleFunc("GET /api/edge/library-entries", func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, "7", r.URL.Query().Get("filter[userId]"))
+					_ = json.NewEncoder(w).Encode(map[string]any{
+						"data": []any{map[string]any{
+							"id":            "100",
+							"type":          "libraryEntries",
+							"attributes":    map[string]any{"status": "completed", "progress": 2, "updatedAt": updatedAt.Format(time.RFC3339)},
+							"relationships": map[string]any{"manga": map[string]any{"data": map[string]any{"id": "1", "type": "manga"}}},
+						}},
+					})
+				})
+				mux.HandleFunc("POST /api/edge/library-entries", func(w http.ResponseWriter, r *http.Request) {
+					body := map[string]any{}
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					*saved = append(*saved, body["data"])
+					_, _ = w.Write([]byte(`{"data":{"id":"101","type":"libraryEntries","attributes":{}}}`))
+				})
+				return mux
+			},
+			configure: func(url string) func() {
+				old := config.KitsuURL
+				config.KitsuURL = url
+				return func() { config.KitsuURL = old }
+			},
+			saved: []any{
+				map[string]any{
+					"type":       "libraryEntries",
+					"attributes": map[string]any{"status": "current", "progress": float64(0)},
+					"relationships": map[string]any{
+						"user":  map[string]any{"data": map[string]any{"id": "7", "type": "users"}},
+						"manga": map[string]any{"data": map[string]any{"id": "2", "type": "manga"}},
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		test.Run(t, tc.name, func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+			di.RegisterSingleton(ctx, func() router.URLResolver {
+				return router.NewTestResolver()
+			})
+
+			saved := []any{}
+			s := httptest.NewServer(tc.standIn(t, &saved))
+			defer s.Close()
+			defer tc.configure(s.URL)()
+
+			account, pulled, _ := fixtures(ctx, tx, tc.tracker.Service(), time.Now().Add(time.Hour*24))
+
+			run := func(cb func(tx *sqlx.Tx) error) error {
+				return cb(tx)
+			}
+			result, err := tracker.Sync(ctx, run, run, tc.tracker, account, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, &tracker.Result{Pushed: 1, Pulled: 1}, result)
+			assert.Equal(t, tc.saved, saved)
+
+			userCtx := test.WithUser(ctx, &models.User{ID: account.UserID})
+			us, err := models.UserSeriesQuery(userCtx).Where("series_name", "=", pulled.Slug).First(tx)
+			assert.NoError(t, err)
+			if assert.NotNil(t, us) {
+				assert.Equal(t, models.ListCompleted, us.List)
+			}
+
+			books, err := models.BookQuery(userCtx).Where("series", "=", pulled.Slug).With("UserBook").OrderBy("chapter").Get(tx)
+			assert.NoError(t, err)
+			read := []bool{}
+			for _, b := range books {
+				ub, _ := b.UserBook.Value()
+				read = append(read, ub != nil && ub.CurrentPage == 1)
+			}
+			assert.Equal(t, []bool{true, true, false}, read)
+		})
+	}
+}
+
+func TestSync_series(t *testing.T) {
+	test.Run(t, "only syncs the given series", func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+		di.RegisterSingleton(ctx, func() router.URLResolver {
+			return router.NewTestResolver()
+		})
+
+		saved := []string{}
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2/users/@me/mangalist", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"data":[{"node":{"id":1},"list_status":{"status":"completed","num_chapters_read":2,"updated_at":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}}]}`))
+		})
+		mux.HandleFunc("PATCH /v2/manga/{id}/my_list_status", func(w http.ResponseWriter, r *http.Request) {
+			saved = append(saved, r.PathValue("id"))
+			_, _ = w.Write([]byte(`{}`))
+		})
+		s := httptest.NewServer(mux)
+		defer s.Close()
+		oldURL := config.MyAnimeListAPIURL
+		config.MyAnimeListAPIURL = s.URL
+		defer func() { config.MyAnimeListAPIURL = oldURL }()
+
+		account, _, pushed := fixtures(ctx, tx, models.TrackerMyAnimeList, time.Now().Add(time.Hour*24))
+
+		run := func(cb func(tx *sqlx.Tx) error) error {
+			return cb(tx)
+		}
+		result, err := tracker.Sync(ctx, run, run, tracker.NewMyAnimeListTracker(http.DefaultClient), account, []string{pushed.Slug})
+		assert.NoError(t, err)
+		assert.Equal(t, &tracker.Result{Pushed: 1, Pulled: 0}, result)
+		assert.Equal(t, []string{"2"}, saved)
+	})
+}
+
+func TestSync_refresh(t *testing.T) {
+	test.Run(t, "refreshes expired tokens", func(ctx context.Context, t *testing.T, tx *sqlx.Tx) {
+		di.RegisterSingleton(ctx, func() router.URLResolver {
+			return router.NewTestResolver()
+		})
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "refresh", r.PostForm.Get("refresh_token"))
+			_, _ = w.Write([]byte(`{"expires_in":2592000,"access_token":"new-token","refresh_token":"new-refresh"}`))
+		})
+		mux.HandleFunc("GET /api/edge/library-entries", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer new-token", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"data":[]}`))
+		})
+		mux.HandleFunc("POST /api/edge/library-entries", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"data":{"id":"101","type":"libraryEntries","attributes":{}}}`))
+		})
+		s := httptest.NewServer(mux)
+		defer s.Close()
+		oldURL := config.KitsuURL
+		config.KitsuURL = s.URL
+		defer func() { config.KitsuURL = oldURL }()
+
+		account, _, _ := fixtures(ctx, tx, models.TrackerKitsu, time.Now().Add(-time.Hour))
+
+		run := func(cb func(tx *sqlx.Tx) error) error {
+			return cb(tx)
+		}
+		_, err := tracker.Sync(ctx, run, run, tracker.NewKitsuTracker(http.DefaultClient), account, nil)
+		assert.NoError(t, err)
+
+		userCtx := test.WithUser(ctx, &models.User{ID: account.UserID})
+		saved, err := models.UserTrackerQuery(userCtx).Where("service", "=", models.TrackerKitsu).First(tx)
+		assert.NoError(t, err)
+		if assert.NotNil(t, saved) {
+			assert.Equal(t, "new-token", saved.AccessToken)
+			assert.Equal(t, "new-refresh", saved.RefreshToken)
+			assert.True(t, saved.ExpiresAt.Time().After(time.Now().Add(24*time.Hour)))
+		}
+	})
+}
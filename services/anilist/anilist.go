@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Khan/genqlient/graphql"
+	"github.com/abibby/comicbox-3/config"
 	"golang.org/x/time/rate"
 )
 
@@ -46,12 +47,58 @@ func (d *RateLimitedDoer) Do(r *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
+// TokenDoer authenticates requests as the user the token was issued to.
+type TokenDoer struct {
+	token string
+	doer  graphql.Doer
+}
+
+var _ graphql.Doer = (*TokenDoer)(nil)
+
+func NewTokenDoer(doer graphql.Doer, token string) *TokenDoer {
+	return &TokenDoer{
+		token: token,
+		doer:  doer,
+	}
+}
+
+// Do implements graphql.Doer.
+func (d *TokenDoer) Do(r *http.Request) (*http.Response, error) {
+	r.Header.Set("Authorization", "Bearer "+d.token)
+	return d.doer.Do(r)
+}
+
 func NewClient(httpClient graphql.Doer) *Client {
 	return &Client{
-		client: graphql.NewClient("https://graphql.anilist.co", NewRateLimitedDoer(httpClient)),
+		client: graphql.NewClient(apiURL(), NewRateLimitedDoer(httpClient)),
+	}
+}
+
+// NewUserClient creates a client that acts as the user the access token
+// belongs to.
+func NewUserClient(httpClient graphql.Doer, token string) *Client {
+	return NewClient(NewTokenDoer(httpClient, token))
+}
+
+func apiURL() string {
+	if config.AnilistAPIURL != "" {
+		return config.AnilistAPIURL
 	}
+	return "https://graphql.anilist.co"
 }
 
 func (c *Client) Search(ctx context.Context, search string, id int) (*SearchResponse, error) {
 	return Search(ctx, c.client, search, id)
 }
+
+func (c *Client) Viewer(ctx context.Context) (*ViewerResponse, error) {
+	return Viewer(ctx, c.client)
+}
+
+func (c *Client) MediaListCollection(ctx context.Context, userID int) (*MediaListCollectionResponse, error) {
+	return MediaListCollection(ctx, c.client, userID)
+}
+
+func (c *Client) SaveMediaListEntry(ctx context.Context, mediaID int, status MediaListStatus, progress, progressVolumes int) (*SaveMediaListEntryResponse, error) {
+	return SaveMediaListEntry(ctx, c.client, mediaID, status, progress, progressVolumes)
+}
@@ -0,0 +1,105 @@
+package anilist_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/services/anilist"
+	"github.com/stretchr/testify/assert"
+)
+
+type gqlRequest struct {
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// standIn starts a server that answers like Anilist's OAuth and GraphQL
+// APIs and points the client at it.
+func standIn(t *testing.T, gql func(r *gqlRequest) any) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v2/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if body["code"] != "good-code" || body["redirect_uri"] != "http://comicbox/anilist/login" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_request","message":"The authorization code is invalid"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3600,"access_token":"token"}`))
+	})
+	mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		req := &gqlRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": gql(req)})
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	oldURL, oldAPIURL := config.AnilistURL, config.AnilistAPIURL
+	config.AnilistURL, config.AnilistAPIURL = s.URL, s.URL+"/graphql"
+	t.Cleanup(func() {
+		config.AnilistURL, config.AnilistAPIURL = oldURL, oldAPIURL
+	})
+}
+
+func TestExchange(t *testing.T) {
+	standIn(t, nil)
+
+	token, err := anilist.Exchange(context.Background(), http.DefaultClient, "good-code", "http://comicbox/anilist/login")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresAt, time.Minute)
+
+	_, err = anilist.Exchange(context.Background(), http.DefaultClient, "bad-code", "http://comicbox/anilist/login")
+	assert.ErrorContains(t, err, "The authorization code is invalid")
+}
+
+func TestClient(t *testing.T) {
+	var saved map[string]any
+	standIn(t, func(r *gqlRequest) any {
+		switch r.OperationName {
+		case "Viewer":
+			return map[string]any{"Viewer": map[string]any{"id": 7, "name": "adam"}}
+		case "MediaListCollection":
+			assert.Equal(t, float64(7), r.Variables["userId"])
+			return map[string]any{"MediaListCollection": map[string]any{
+				"lists": []any{map[string]any{
+					"name": "Reading",
+					"entries": []any{map[string]any{
+						"mediaId": 30013, "status": "CURRENT", "progress": 12, "progressVolumes": nil, "updatedAt": 1700000000,
+					}},
+				}},
+			}}
+		case "SaveMediaListEntry":
+			saved = r.Variables
+			return map[string]any{"SaveMediaListEntry": map[string]any{"mediaId": 30013, "status": "COMPLETED", "progress": 20}}
+		}
+		t.Fatalf("unexpected operation %s", r.OperationName)
+		return nil
+	})
+
+	c := anilist.NewUserClient(http.DefaultClient, "token")
+
+	viewer, err := c.Viewer(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 7, viewer.Viewer.Id)
+
+	lists, err := c.MediaListCollection(context.Background(), 7)
+	assert.NoError(t, err)
+	entries := lists.MediaListCollection.Lists[0].Entries
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 30013, entries[0].MediaId)
+	assert.Equal(t, anilist.MediaListStatusCurrent, entries[0].Status)
+	assert.Equal(t, 12, entries[0].Progress)
+	assert.Equal(t, 1700000000, entries[0].UpdatedAt)
+
+	_, err = c.SaveMediaListEntry(context.Background(), 30013, anilist.MediaListStatusCompleted, 20, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"mediaId": float64(30013), "status": "COMPLETED", "progress": float64(20)}, saved)
+}
@@ -8,6 +8,218 @@ import (
 	"github.com/Khan/genqlient/graphql"
 )
 
+// MediaListCollectionMediaListCollection includes the requested fields of the GraphQL type MediaListCollection.
+// The GraphQL type's documentation follows.
+//
+// List of anime or manga
+type MediaListCollectionMediaListCollection struct {
+	// Grouped media list entries
+	Lists []MediaListCollectionMediaListCollectionListsMediaListGroup `json:"lists"`
+}
+
+// GetLists returns MediaListCollectionMediaListCollection.Lists, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollection) GetLists() []MediaListCollectionMediaListCollectionListsMediaListGroup {
+	return v.Lists
+}
+
+// MediaListCollectionMediaListCollectionListsMediaListGroup includes the requested fields of the GraphQL type MediaListGroup.
+// The GraphQL type's documentation follows.
+//
+// List group of anime or manga entries
+type MediaListCollectionMediaListCollectionListsMediaListGroup struct {
+	Name string `json:"name"`
+	// Media list entries
+	Entries []MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList `json:"entries"`
+}
+
+// GetName returns MediaListCollectionMediaListCollectionListsMediaListGroup.Name, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroup) GetName() string { return v.Name }
+
+// GetEntries returns MediaListCollectionMediaListCollectionListsMediaListGroup.Entries, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroup) GetEntries() []MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList {
+	return v.Entries
+}
+
+// MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList includes the requested fields of the GraphQL type MediaList.
+// The GraphQL type's documentation follows.
+//
+// List of anime or manga
+type MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList struct {
+	// The id of the media
+	MediaId int `json:"mediaId"`
+	// The watching/reading status
+	Status MediaListStatus `json:"status"`
+	// The amount of episodes/chapters consumed by the user
+	Progress int `json:"progress"`
+	// The amount of volumes read by the user
+	ProgressVolumes int `json:"progressVolumes"`
+	// When the entry data was last updated
+	UpdatedAt int                                                                            `json:"updatedAt"`
+	Media     MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMedia `json:"media"`
+}
+
+// GetMediaId returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList.MediaId, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList) GetMediaId() int {
+	return v.MediaId
+}
+
+// GetStatus returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList.Status, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList) GetStatus() MediaListStatus {
+	return v.Status
+}
+
+// GetProgress returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList.Progress, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList) GetProgress() int {
+	return v.Progress
+}
+
+// GetProgressVolumes returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList.ProgressVolumes, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList) GetProgressVolumes() int {
+	return v.ProgressVolumes
+}
+
+// GetUpdatedAt returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList.UpdatedAt, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList) GetUpdatedAt() int {
+	return v.UpdatedAt
+}
+
+// GetMedia returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList.Media, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaList) GetMedia() MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMedia {
+	return v.Media
+}
+
+// MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMedia includes the requested fields of the GraphQL type Media.
+// The GraphQL type's documentation follows.
+//
+// Anime or Manga
+type MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMedia struct {
+	// The official titles of the media in various languages
+	Title MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle `json:"title"`
+	// Alternative titles of the media
+	Synonyms []string `json:"synonyms"`
+}
+
+// GetTitle returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMedia.Title, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMedia) GetTitle() MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle {
+	return v.Title
+}
+
+// GetSynonyms returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMedia.Synonyms, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMedia) GetSynonyms() []string {
+	return v.Synonyms
+}
+
+// MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle includes the requested fields of the GraphQL type MediaTitle.
+// The GraphQL type's documentation follows.
+//
+// The official titles of the media in various languages
+type MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle struct {
+	// The romanization of the native language title
+	Romaji string `json:"romaji"`
+	// The official english title
+	English string `json:"english"`
+	// Official title in it's native language
+	Native string `json:"native"`
+}
+
+// GetRomaji returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle.Romaji, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle) GetRomaji() string {
+	return v.Romaji
+}
+
+// GetEnglish returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle.English, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle) GetEnglish() string {
+	return v.English
+}
+
+// GetNative returns MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle.Native, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionMediaListCollectionListsMediaListGroupEntriesMediaListMediaTitle) GetNative() string {
+	return v.Native
+}
+
+// MediaListCollectionResponse is returned by MediaListCollection on success.
+type MediaListCollectionResponse struct {
+	// Media list collection query, provides list pre-grouped by status & custom lists. User ID and Media Type arguments required.
+	MediaListCollection MediaListCollectionMediaListCollection `json:"MediaListCollection"`
+}
+
+// GetMediaListCollection returns MediaListCollectionResponse.MediaListCollection, and is useful for accessing the field via an interface.
+func (v *MediaListCollectionResponse) GetMediaListCollection() MediaListCollectionMediaListCollection {
+	return v.MediaListCollection
+}
+
+// Media list watching/reading status enum.
+type MediaListStatus string
+
+const (
+	// Currently watching/reading
+	MediaListStatusCurrent MediaListStatus = "CURRENT"
+	// Planning to watch/read
+	MediaListStatusPlanning MediaListStatus = "PLANNING"
+	// Finished watching/reading
+	MediaListStatusCompleted MediaListStatus = "COMPLETED"
+	// Stopped watching/reading before completing
+	MediaListStatusDropped MediaListStatus = "DROPPED"
+	// Paused watching/reading
+	MediaListStatusPaused MediaListStatus = "PAUSED"
+	// Re-watching/reading
+	MediaListStatusRepeating MediaListStatus = "REPEATING"
+)
+
+var AllMediaListStatus = []MediaListStatus{
+	MediaListStatusCurrent,
+	MediaListStatusPlanning,
+	MediaListStatusCompleted,
+	MediaListStatusDropped,
+	MediaListStatusPaused,
+	MediaListStatusRepeating,
+}
+
+// SaveMediaListEntryResponse is returned by SaveMediaListEntry on success.
+type SaveMediaListEntryResponse struct {
+	// Create or update a media list entry
+	SaveMediaListEntry SaveMediaListEntrySaveMediaListEntryMediaList `json:"SaveMediaListEntry"`
+}
+
+// GetSaveMediaListEntry returns SaveMediaListEntryResponse.SaveMediaListEntry, and is useful for accessing the field via an interface.
+func (v *SaveMediaListEntryResponse) GetSaveMediaListEntry() SaveMediaListEntrySaveMediaListEntryMediaList {
+	return v.SaveMediaListEntry
+}
+
+// SaveMediaListEntrySaveMediaListEntryMediaList includes the requested fields of the GraphQL type MediaList.
+// The GraphQL type's documentation follows.
+//
+// List of anime or manga
+type SaveMediaListEntrySaveMediaListEntryMediaList struct {
+	// The id of the media
+	MediaId int `json:"mediaId"`
+	// The watching/reading status
+	Status MediaListStatus `json:"status"`
+	// The amount of episodes/chapters consumed by the user
+	Progress int `json:"progress"`
+	// The amount of volumes read by the user
+	ProgressVolumes int `json:"progressVolumes"`
+	// When the entry data was last updated
+	UpdatedAt int `json:"updatedAt"`
+}
+
+// GetMediaId returns SaveMediaListEntrySaveMediaListEntryMediaList.MediaId, and is useful for accessing the field via an interface.
+func (v *SaveMediaListEntrySaveMediaListEntryMediaList) GetMediaId() int { return v.MediaId }
+
+// GetStatus returns SaveMediaListEntrySaveMediaListEntryMediaList.Status, and is useful for accessing the field via an interface.
+func (v *SaveMediaListEntrySaveMediaListEntryMediaList) GetStatus() MediaListStatus { return v.Status }
+
+// GetProgress returns SaveMediaListEntrySaveMediaListEntryMediaList.Progress, and is useful for accessing the field via an interface.
+func (v *SaveMediaListEntrySaveMediaListEntryMediaList) GetProgress() int { return v.Progress }
+
+// GetProgressVolumes returns SaveMediaListEntrySaveMediaListEntryMediaList.ProgressVolumes, and is useful for accessing the field via an interface.
+func (v *SaveMediaListEntrySaveMediaListEntryMediaList) GetProgressVolumes() int {
+	return v.ProgressVolumes
+}
+
+// GetUpdatedAt returns SaveMediaListEntrySaveMediaListEntryMediaList.UpdatedAt, and is useful for accessing the field via an interface.
+func (v *SaveMediaListEntrySaveMediaListEntryMediaList) GetUpdatedAt() int { return v.UpdatedAt }
+
 // SearchPage includes the requested fields of the GraphQL type Page.
 // The GraphQL type's documentation follows.
 //
@@ -35,6 +247,8 @@ type SearchPageMedia struct {
 	Title SearchPageMediaTitle `json:"title"`
 	// Alternative titles of the media
 	Synonyms []string `json:"synonyms"`
+	// Where the media was created. (ISO 3166-1 alpha-2)
+	CountryOfOrigin string `json:"countryOfOrigin"`
 	// The cover images of the media
 	CoverImage SearchPageMediaCoverImage `json:"coverImage"`
 	// The first official release date of the media
@@ -58,6 +272,9 @@ func (v *SearchPageMedia) GetTitle() SearchPageMediaTitle { return v.Title }
 // GetSynonyms returns SearchPageMedia.Synonyms, and is useful for accessing the field via an interface.
 func (v *SearchPageMedia) GetSynonyms() []string { return v.Synonyms }
 
+// GetCountryOfOrigin returns SearchPageMedia.CountryOfOrigin, and is useful for accessing the field via an interface.
+func (v *SearchPageMedia) GetCountryOfOrigin() string { return v.CountryOfOrigin }
+
 // GetCoverImage returns SearchPageMedia.CoverImage, and is useful for accessing the field via an interface.
 func (v *SearchPageMedia) GetCoverImage() SearchPageMediaCoverImage { return v.CoverImage }
 
@@ -199,6 +416,60 @@ type SearchResponse struct {
 // GetPage returns SearchResponse.Page, and is useful for accessing the field via an interface.
 func (v *SearchResponse) GetPage() SearchPage { return v.Page }
 
+// ViewerResponse is returned by Viewer on success.
+type ViewerResponse struct {
+	// Get the currently authenticated user
+	Viewer ViewerViewerUser `json:"Viewer"`
+}
+
+// GetViewer returns ViewerResponse.Viewer, and is useful for accessing the field via an interface.
+func (v *ViewerResponse) GetViewer() ViewerViewerUser { return v.Viewer }
+
+// ViewerViewerUser includes the requested fields of the GraphQL type User.
+// The GraphQL type's documentation follows.
+//
+// A user
+type ViewerViewerUser struct {
+	// The id of the user
+	Id int `json:"id"`
+	// The name of the user
+	Name string `json:"name"`
+}
+
+// GetId returns ViewerViewerUser.Id, and is useful for accessing the field via an interface.
+func (v *ViewerViewerUser) GetId() int { return v.Id }
+
+// GetName returns ViewerViewerUser.Name, and is useful for accessing the field via an interface.
+func (v *ViewerViewerUser) GetName() string { return v.Name }
+
+// __MediaListCollectionInput is used internally by genqlient
+type __MediaListCollectionInput struct {
+	UserId int `json:"userId"`
+}
+
+// GetUserId returns __MediaListCollectionInput.UserId, and is useful for accessing the field via an interface.
+func (v *__MediaListCollectionInput) GetUserId() int { return v.UserId }
+
+// __SaveMediaListEntryInput is used internally by genqlient
+type __SaveMediaListEntryInput struct {
+	MediaId         int             `json:"mediaId,omitempty"`
+	Status          MediaListStatus `json:"status,omitempty"`
+	Progress        int             `json:"progress,omitempty"`
+	ProgressVolumes int             `json:"progressVolumes,omitempty"`
+}
+
+// GetMediaId returns __SaveMediaListEntryInput.MediaId, and is useful for accessing the field via an interface.
+func (v *__SaveMediaListEntryInput) GetMediaId() int { return v.MediaId }
+
+// GetStatus returns __SaveMediaListEntryInput.Status, and is useful for accessing the field via an interface.
+func (v *__SaveMediaListEntryInput) GetStatus() MediaListStatus { return v.Status }
+
+// GetProgress returns __SaveMediaListEntryInput.Progress, and is useful for accessing the field via an interface.
+func (v *__SaveMediaListEntryInput) GetProgress() int { return v.Progress }
+
+// GetProgressVolumes returns __SaveMediaListEntryInput.ProgressVolumes, and is useful for accessing the field via an interface.
+func (v *__SaveMediaListEntryInput) GetProgressVolumes() int { return v.ProgressVolumes }
+
 // __SearchInput is used internally by genqlient
 type __SearchInput struct {
 	Search string `json:"search,omitempty"`
@@ -211,6 +482,101 @@ func (v *__SearchInput) GetSearch() string { return v.Search }
 // GetId returns __SearchInput.Id, and is useful for accessing the field via an interface.
 func (v *__SearchInput) GetId() int { return v.Id }
 
+// The query executed by MediaListCollection.
+const MediaListCollection_Operation = `
+query MediaListCollection ($userId: Int) {
+	MediaListCollection(userId: $userId, type: MANGA) {
+		lists {
+			name
+			entries {
+				mediaId
+				status
+				progress
+				progressVolumes
+				updatedAt
+				media {
+					title {
+						romaji
+						english
+						native
+					}
+					synonyms
+				}
+			}
+		}
+	}
+}
+`
+
+func MediaListCollection(
+	ctx_ context.Context,
+	client_ graphql.Client,
+	userId int,
+) (data_ *MediaListCollectionResponse, err_ error) {
+	req_ := &graphql.Request{
+		OpName: "MediaListCollection",
+		Query:  MediaListCollection_Operation,
+		Variables: &__MediaListCollectionInput{
+			UserId: userId,
+		},
+	}
+
+	data_ = &MediaListCollectionResponse{}
+	resp_ := &graphql.Response{Data: data_}
+
+	err_ = client_.MakeRequest(
+		ctx_,
+		req_,
+		resp_,
+	)
+
+	return data_, err_
+}
+
+// The mutation executed by SaveMediaListEntry.
+const SaveMediaListEntry_Operation = `
+mutation SaveMediaListEntry ($mediaId: Int, $status: MediaListStatus, $progress: Int, $progressVolumes: Int) {
+	SaveMediaListEntry(mediaId: $mediaId, status: $status, progress: $progress, progressVolumes: $progressVolumes) {
+		mediaId
+		status
+		progress
+		progressVolumes
+		updatedAt
+	}
+}
+`
+
+func SaveMediaListEntry(
+	ctx_ context.Context,
+	client_ graphql.Client,
+	mediaId int,
+	status MediaListStatus,
+	progress int,
+	progressVolumes int,
+) (data_ *SaveMediaListEntryResponse, err_ error) {
+	req_ := &graphql.Request{
+		OpName: "SaveMediaListEntry",
+		Query:  SaveMediaListEntry_Operation,
+		Variables: &__SaveMediaListEntryInput{
+			MediaId:         mediaId,
+			Status:          status,
+			Progress:        progress,
+			ProgressVolumes: progressVolumes,
+		},
+	}
+
+	data_ = &SaveMediaListEntryResponse{}
+	resp_ := &graphql.Response{Data: data_}
+
+	err_ = client_.MakeRequest(
+		ctx_,
+		req_,
+		resp_,
+	)
+
+	return data_, err_
+}
+
 // The query executed by Search.
 const Search_Operation = `
 query Search ($search: String, $id: Int) {
@@ -225,6 +591,7 @@ query Search ($search: String, $id: Int) {
 				english
 			}
 			synonyms
+			countryOfOrigin
 			coverImage {
 				extraLarge
 			}
@@ -277,3 +644,34 @@ func Search(
 
 	return data_, err_
 }
+
+// The query executed by Viewer.
+const Viewer_Operation = `
+query Viewer {
+	Viewer {
+		id
+		name
+	}
+}
+`
+
+func Viewer(
+	ctx_ context.Context,
+	client_ graphql.Client,
+) (data_ *ViewerResponse, err_ error) {
+	req_ := &graphql.Request{
+		OpName: "Viewer",
+		Query:  Viewer_Operation,
+	}
+
+	data_ = &ViewerResponse{}
+	resp_ := &graphql.Response{Data: data_}
+
+	err_ = client_.MakeRequest(
+		ctx_,
+		req_,
+		resp_,
+	)
+
+	return data_, err_
+}
@@ -0,0 +1,91 @@
+package anilist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+)
+
+// Token is an access token for a user, Anilist tokens last a year and can't
+// be refreshed so users have to link their account again once it expires.
+type Token struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+type tokenResponse struct {
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	AccessToken string `json:"access_token"`
+	Error       string `json:"error"`
+	Message     string `json:"message"`
+}
+
+// AuthorizeURL is the page users log in to Anilist on, they are redirected
+// back to redirectURI with a code for Exchange.
+func AuthorizeURL(redirectURI string) string {
+	q := url.Values{}
+	q.Set("client_id", config.AnilistClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	return oauthURL() + "/api/v2/oauth/authorize?" + q.Encode()
+}
+
+// Exchange trades the code Anilist redirects back with for an access token.
+// redirectURI must match the one the code was requested with.
+func Exchange(ctx context.Context, httpClient *http.Client, code, redirectURI string) (*Token, error) {
+	body, err := json.Marshal(map[string]string{
+		"grant_type":    "authorization_code",
+		"client_id":     config.AnilistClientID,
+		"client_secret": config.AnilistClientSecret,
+		"redirect_uri":  redirectURI,
+		"code":          code,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oauthURL()+"/api/v2/oauth/token", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tokenResp := &tokenResponse{}
+	err = json.NewDecoder(resp.Body).Decode(tokenResp)
+	if err != nil {
+		return nil, fmt.Errorf("anilist token request failed %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || tokenResp.AccessToken == "" {
+		message := tokenResp.Message
+		if message == "" {
+			message = tokenResp.Error
+		}
+		return nil, fmt.Errorf("anilist token request failed %s: %s", resp.Status, message)
+	}
+
+	return &Token{
+		AccessToken: tokenResp.AccessToken,
+		ExpiresAt:   time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+func oauthURL() string {
+	if config.AnilistURL != "" {
+		return config.AnilistURL
+	}
+	return "https://anilist.co"
+}
@@ -0,0 +1,220 @@
+package kitsu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const contentType = "application/vnd.api+json"
+
+type Status string
+
+const (
+	StatusCurrent   = Status("current")
+	StatusPlanned   = Status("planned")
+	StatusCompleted = Status("completed")
+	StatusOnHold    = Status("on_hold")
+	StatusDropped   = Status("dropped")
+)
+
+type User struct {
+	ID   string
+	Name string
+}
+
+// LibraryEntry is a manga on the user's library. Kitsu only tracks chapter
+// progress for manga.
+type LibraryEntry struct {
+	ID        string
+	MangaID   string
+	Status    Status
+	Progress  int
+	UpdatedAt time.Time
+}
+
+type resource[T any] struct {
+	ID            string                  `json:"id,omitempty"`
+	Type          string                  `json:"type"`
+	Attributes    T                       `json:"attributes"`
+	Relationships map[string]relationship `json:"relationships,omitempty"`
+}
+
+type relationship struct {
+	Data *resourceID `json:"data"`
+}
+
+type resourceID struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type userAttributes struct {
+	Name string `json:"name"`
+}
+
+type libraryEntryAttributes struct {
+	Status    Status     `json:"status"`
+	Progress  int        `json:"progress"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+type document[T any] struct {
+	Data  T `json:"data"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+type errorResponse struct {
+	Errors []struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+// Client acts as the user the access token was issued to.
+type Client struct {
+	httpClient *http.Client
+	token      string
+}
+
+func NewClient(httpClient *http.Client, token string) *Client {
+	return &Client{
+		httpClient: httpClient,
+		token:      token,
+	}
+}
+
+// Self returns the user the client acts as.
+func (c *Client) Self(ctx context.Context) (*User, error) {
+	doc := &document[[]*resource[userAttributes]]{}
+	err := c.do(ctx, http.MethodGet, baseURL()+"/api/edge/users?filter[self]=true", nil, doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Data) == 0 {
+		return nil, fmt.Errorf("kitsu user not found")
+	}
+	return &User{
+		ID:   doc.Data[0].ID,
+		Name: doc.Data[0].Attributes.Name,
+	}, nil
+}
+
+// LibraryEntries returns every manga in the user's library.
+func (c *Client) LibraryEntries(ctx context.Context, userID string) ([]*LibraryEntry, error) {
+	q := url.Values{}
+	q.Set("filter[userId]", userID)
+	q.Set("filter[kind]", "manga")
+	q.Set("include", "manga")
+	q.Set("page[limit]", "500")
+
+	entries := []*LibraryEntry{}
+	next := baseURL() + "/api/edge/library-entries?" + q.Encode()
+	for next != "" {
+		doc := &document[[]*resource[libraryEntryAttributes]]{}
+		err := c.do(ctx, http.MethodGet, next, nil, doc)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range doc.Data {
+			manga := r.Relationships["manga"].Data
+			if manga == nil {
+				continue
+			}
+			e := &LibraryEntry{
+				ID:       r.ID,
+				MangaID:  manga.ID,
+				Status:   r.Attributes.Status,
+				Progress: r.Attributes.Progress,
+			}
+			if r.Attributes.UpdatedAt != nil {
+				e.UpdatedAt = *r.Attributes.UpdatedAt
+			}
+			entries = append(entries, e)
+		}
+		next = doc.Links.Next
+	}
+	return entries, nil
+}
+
+// SaveLibraryEntry updates the entry, or adds the manga to the user's
+// library if the entry has no ID.
+func (c *Client) SaveLibraryEntry(ctx context.Context, userID string, e *LibraryEntry) error {
+	r := &resource[libraryEntryAttributes]{
+		ID:   e.ID,
+		Type: "libraryEntries",
+		Attributes: libraryEntryAttributes{
+			Status:   e.Status,
+			Progress: e.Progress,
+		},
+	}
+	if e.ID != "" {
+		return c.do(ctx, http.MethodPatch, baseURL()+"/api/edge/library-entries/"+url.PathEscape(e.ID), map[string]any{"data": r}, nil)
+	}
+
+	r.Relationships = map[string]relationship{
+		"user":  {Data: &resourceID{ID: userID, Type: "users"}},
+		"manga": {Data: &resourceID{ID: e.MangaID, Type: "manga"}},
+	}
+	created := &document[*resource[libraryEntryAttributes]]{}
+	err := c.do(ctx, http.MethodPost, baseURL()+"/api/edge/library-entries", map[string]any{"data": r}, created)
+	if err != nil {
+		return err
+	}
+	e.ID = created.Data.ID
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, body, v any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		errResp := &errorResponse{}
+		_ = json.NewDecoder(resp.Body).Decode(errResp)
+		message := ""
+		if len(errResp.Errors) > 0 {
+			message = errResp.Errors[0].Detail
+			if message == "" {
+				message = errResp.Errors[0].Title
+			}
+		}
+		return fmt.Errorf("kitsu request failed %s: %s", resp.Status, message)
+	}
+	if v == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("kitsu request failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package kitsu_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/services/kitsu"
+	"github.com/stretchr/testify/assert"
+)
+
+// standIn starts a server that answers like Kitsu's OAuth and JSON:API
+// endpoints and points the client at it.
+func standIn(t *testing.T, mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		switch {
+		case r.PostForm.Get("grant_type") == "password" &&
+			r.PostForm.Get("username") == "adam@example.com" &&
+			r.PostForm.Get("password") == "secret":
+		case r.PostForm.Get("grant_type") == "refresh_token" &&
+			r.PostForm.Get("refresh_token") == "refresh":
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"The provided authorization grant is invalid"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":2592000,"access_token":"token","refresh_token":"refresh"}`))
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	oldURL := config.KitsuURL
+	config.KitsuURL = s.URL
+	t.Cleanup(func() {
+		config.KitsuURL = oldURL
+	})
+}
+
+func TestLogin(t *testing.T) {
+	standIn(t, http.NewServeMux())
+
+	token, err := kitsu.Login(context.Background(), http.DefaultClient, "adam@example.com", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+	assert.Equal(t, "refresh", token.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), token.ExpiresAt, time.Minute)
+
+	_, err = kitsu.Login(context.Background(), http.DefaultClient, "adam@example.com", "wrong")
+	assert.ErrorContains(t, err, "The provided authorization grant is invalid")
+
+	token, err = kitsu.Refresh(context.Background(), http.DefaultClient, "refresh")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+}
+
+func TestClient(t *testing.T) {
+	saved := []map[string]any{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/edge/users", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "true", r.URL.Query().Get("filter[self]"))
+		_, _ = w.Write([]byte(`{"data":[{"id":"7","type":"users","attributes":{"name":"adam"}}]}`))
+	})
+	mux.HandleFunc("GET /api/edge/library-entries", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "7", r.URL.Query().Get("filter[userId]"))
+		assert.Equal(t, "manga", r.URL.Query().Get("filter[kind]"))
+		entry := func(id, mangaID, status string, progress int) any {
+			return map[string]any{
+				"id":         id,
+				"type":       "libraryEntries",
+				"attributes": map[string]any{"status": status, "progress": progress, "updatedAt": "2023-11-14T22:13:20.000Z"},
+				"relationships": map[string]any{
+					"manga": map[string]any{"data": map[string]any{"id": mangaID, "type": "manga"}},
+				},
+			}
+		}
+		if r.URL.Query().Get("page[offset]") == "" {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"data":  []any{entry("100", "2", "current", 12)},
+				"links": map[string]any{"next": "http://" + r.Host + r.URL.Path + "?filter[userId]=7&filter[kind]=manga&page[offset]=1"},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data":  []any{entry("101", "3", "planned", 0)},
+			"links": map[string]any{},
+		})
+	})
+	save := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/vnd.api+json", r.Header.Get("Content-Type"))
+		body := map[string]any{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		saved = append(saved, body["data"].(map[string]any))
+		_, _ = w.Write([]byte(`{"data":{"id":"102","type":"libraryEntries","attributes":{"status":"current","progress":3}}}`))
+	}
+	mux.HandleFunc("POST /api/edge/library-entries", save)
+	mux.HandleFunc("PATCH /api/edge/library-entries/{id}", save)
+	standIn(t, mux)
+
+	c := kitsu.NewClient(http.DefaultClient, "token")
+
+	self, err := c.Self(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &kitsu.User{ID: "7", Name: "adam"}, self)
+
+	entries, err := c.LibraryEntries(context.Background(), "7")
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "100", entries[0].ID)
+		assert.Equal(t, "2", entries[0].MangaID)
+		assert.Equal(t, kitsu.StatusCurrent, entries[0].Status)
+		assert.Equal(t, 12, entries[0].Progress)
+		assert.Equal(t, int64(1700000000), entries[0].UpdatedAt.Unix())
+		assert.Equal(t, "3", entries[1].MangaID)
+	}
+
+	err = c.SaveLibraryEntry(context.Background(), "7", &kitsu.LibraryEntry{ID: "100", Status: kitsu.StatusCompleted, Progress: 20})
+	assert.NoError(t, err)
+
+	created := &kitsu.LibraryEntry{MangaID: "4", Status: kitsu.StatusCurrent, Progress: 3}
+	err = c.SaveLibraryEntry(context.Background(), "7", created)
+	assert.NoError(t, err)
+	assert.Equal(t, "102", created.ID)
+
+	assert.Equal(t, []map[string]any{
+		{
+			"id":         "100",
+			"type":       "libraryEntries",
+			"attributes": map[string]any{"status": "completed", "progress": float64(20)},
+		},
+		{
+			"type":       "libraryEntries",
+			"attributes": map[string]any{"status": "current", "progress": float64(3)},
+			"relationships": map[string]any{
+				"user":  map[string]any{"data": map[string]any{"id": "7", "type": "users"}},
+				"manga": map[string]any{"data": map[string]any{"id": "4", "type": "manga"}},
+			},
+		},
+	}, saved)
+}
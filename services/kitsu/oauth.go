@@ -0,0 +1,94 @@
+package kitsu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+)
+
+// Token is an access token for a user, it is refreshed with the refresh
+// token once it expires.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+type tokenResponse struct {
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Login trades the user's Kitsu username and password for an access token.
+// Kitsu doesn't support redirect logins for third party apps.
+func Login(ctx context.Context, httpClient *http.Client, username, password string) (*Token, error) {
+	return token(ctx, httpClient, url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+	})
+}
+
+// Refresh trades a refresh token for a new access token.
+func Refresh(ctx context.Context, httpClient *http.Client, refreshToken string) (*Token, error) {
+	return token(ctx, httpClient, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+func token(ctx context.Context, httpClient *http.Client, form url.Values) (*Token, error) {
+	if config.KitsuClientID != "" {
+		form.Set("client_id", config.KitsuClientID)
+		form.Set("client_secret", config.KitsuClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL()+"/api/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tokenResp := &tokenResponse{}
+	err = json.NewDecoder(resp.Body).Decode(tokenResp)
+	if err != nil {
+		return nil, fmt.Errorf("kitsu token request failed %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || tokenResp.AccessToken == "" {
+		message := tokenResp.ErrorDescription
+		if message == "" {
+			message = tokenResp.Error
+		}
+		return nil, fmt.Errorf("kitsu token request failed %s: %s", resp.Status, message)
+	}
+
+	return &Token{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+func baseURL() string {
+	if config.KitsuURL != "" {
+		return config.KitsuURL
+	}
+	return "https://kitsu.app"
+}
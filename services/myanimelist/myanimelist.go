@@ -0,0 +1,149 @@
+package myanimelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+)
+
+type Status string
+
+const (
+	StatusReading    = Status("reading")
+	StatusCompleted  = Status("completed")
+	StatusOnHold     = Status("on_hold")
+	StatusDropped    = Status("dropped")
+	StatusPlanToRead = Status("plan_to_read")
+)
+
+type User struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Manga struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type ListStatus struct {
+	Status          Status    `json:"status"`
+	NumChaptersRead int       `json:"num_chapters_read"`
+	NumVolumesRead  int       `json:"num_volumes_read"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type ListEntry struct {
+	Node       Manga      `json:"node"`
+	ListStatus ListStatus `json:"list_status"`
+}
+
+type mangaListResponse struct {
+	Data   []*ListEntry `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+type errorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// Client acts as the user the access token was issued to.
+type Client struct {
+	httpClient *http.Client
+	token      string
+}
+
+func NewClient(httpClient *http.Client, token string) *Client {
+	return &Client{
+		httpClient: httpClient,
+		token:      token,
+	}
+}
+
+// Me returns the user the client acts as.
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	u := &User{}
+	err := c.do(ctx, http.MethodGet, apiURL()+"/v2/users/@me", nil, u)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// MangaList returns every entry on the user's manga list.
+func (c *Client) MangaList(ctx context.Context) ([]*ListEntry, error) {
+	entries := []*ListEntry{}
+	next := apiURL() + "/v2/users/@me/mangalist?fields=list_status&limit=1000&nsfw=true"
+	for next != "" {
+		resp := &mangaListResponse{}
+		err := c.do(ctx, http.MethodGet, next, nil, resp)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, resp.Data...)
+		next = resp.Paging.Next
+	}
+	return entries, nil
+}
+
+// UpdateListStatus adds the manga to the user's list or updates its entry.
+func (c *Client) UpdateListStatus(ctx context.Context, mangaID int, status *ListStatus) error {
+	form := url.Values{}
+	form.Set("status", string(status.Status))
+	form.Set("num_chapters_read", strconv.Itoa(status.NumChaptersRead))
+	form.Set("num_volumes_read", strconv.Itoa(status.NumVolumesRead))
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("%s/v2/manga/%d/my_list_status", apiURL(), mangaID), form, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, form url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		errResp := &errorResponse{}
+		_ = json.NewDecoder(resp.Body).Decode(errResp)
+		message := errResp.Message
+		if message == "" {
+			message = errResp.Error
+		}
+		return fmt.Errorf("myanimelist request failed %s: %s", resp.Status, message)
+	}
+	if v == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("myanimelist request failed: %w", err)
+	}
+	return nil
+}
+
+func apiURL() string {
+	if config.MyAnimeListAPIURL != "" {
+		return config.MyAnimeListAPIURL
+	}
+	return "https://api.myanimelist.net"
+}
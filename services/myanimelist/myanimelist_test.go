@@ -0,0 +1,141 @@
+package myanimelist_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+	"github.com/abibby/comicbox-3/services/myanimelist"
+	"github.com/stretchr/testify/assert"
+)
+
+// standIn starts a server that answers like MyAnimeList's OAuth and REST
+// APIs and points the client at it.
+func standIn(t *testing.T, mux *http.ServeMux) *httptest.Server {
+	mux.HandleFunc("POST /v1/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "cid", r.PostForm.Get("client_id"))
+		switch {
+		case r.PostForm.Get("grant_type") == "authorization_code" &&
+			r.PostForm.Get("code") == "good-code" &&
+			r.PostForm.Get("code_verifier") == "verifier":
+		case r.PostForm.Get("grant_type") == "refresh_token" &&
+			r.PostForm.Get("refresh_token") == "refresh":
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","message":"The provided authorization grant is invalid","hint":"Authorization code has expired"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":2678400,"access_token":"token","refresh_token":"refresh"}`))
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	oldID, oldURL, oldAPIURL := config.MyAnimeListClientID, config.MyAnimeListURL, config.MyAnimeListAPIURL
+	config.MyAnimeListClientID, config.MyAnimeListURL, config.MyAnimeListAPIURL = "cid", s.URL, s.URL
+	t.Cleanup(func() {
+		config.MyAnimeListClientID, config.MyAnimeListURL, config.MyAnimeListAPIURL = oldID, oldURL, oldAPIURL
+	})
+	return s
+}
+
+func TestAuthorizeURL(t *testing.T) {
+	s := standIn(t, http.NewServeMux())
+
+	u, err := url.Parse(myanimelist.AuthorizeURL("verifier", "http://comicbox/trackers/myanimelist/login"))
+	assert.NoError(t, err)
+	assert.Equal(t, s.URL+"/v1/oauth2/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"cid"},
+		"code_challenge":        {"verifier"},
+		"code_challenge_method": {"plain"},
+		"redirect_uri":          {"http://comicbox/trackers/myanimelist/login"},
+	}, u.Query())
+}
+
+func TestExchange(t *testing.T) {
+	standIn(t, http.NewServeMux())
+
+	token, err := myanimelist.Exchange(context.Background(), http.DefaultClient, "good-code", "verifier", "http://comicbox/trackers/myanimelist/login")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+	assert.Equal(t, "refresh", token.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(31*24*time.Hour), token.ExpiresAt, time.Minute)
+
+	_, err = myanimelist.Exchange(context.Background(), http.DefaultClient, "bad-code", "verifier", "http://comicbox/trackers/myanimelist/login")
+	assert.ErrorContains(t, err, "Authorization code has expired")
+
+	token, err = myanimelist.Refresh(context.Background(), http.DefaultClient, "refresh")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+}
+
+func TestClient(t *testing.T) {
+	var saved url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/users/@me", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"id":7,"name":"adam"}`))
+	})
+	mux.HandleFunc("GET /v2/users/@me/mangalist", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "list_status", r.URL.Query().Get("fields"))
+		if r.URL.Query().Get("offset") == "" {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"data": []any{map[string]any{
+					"node":        map[string]any{"id": 2, "title": "Monster"},
+					"list_status": map[string]any{"status": "reading", "num_chapters_read": 12, "num_volumes_read": 1, "updated_at": "2023-11-14T22:13:20+00:00"},
+				}},
+				"paging": map[string]any{"next": "http://" + r.Host + r.URL.Path + "?fields=list_status&offset=1"},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data": []any{map[string]any{
+				"node":        map[string]any{"id": 3, "title": "Berserk"},
+				"list_status": map[string]any{"status": "plan_to_read", "updated_at": "2023-11-14T22:13:20+00:00"},
+			}},
+			"paging": map[string]any{},
+		})
+	})
+	mux.HandleFunc("PATCH /v2/manga/{id}/my_list_status", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.PathValue("id"))
+		assert.NoError(t, r.ParseForm())
+		saved = r.PostForm
+		_, _ = w.Write([]byte(`{"status":"completed"}`))
+	})
+	mux.HandleFunc("PATCH /v2/manga/404/my_list_status", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not_found","message":""}`))
+	})
+	standIn(t, mux)
+
+	c := myanimelist.NewClient(http.DefaultClient, "token")
+
+	me, err := c.Me(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &myanimelist.User{ID: 7, Name: "adam"}, me)
+
+	entries, err := c.MangaList(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, 2, entries[0].Node.ID)
+		assert.Equal(t, myanimelist.StatusReading, entries[0].ListStatus.Status)
+		assert.Equal(t, 12, entries[0].ListStatus.NumChaptersRead)
+		assert.Equal(t, 1, entries[0].ListStatus.NumVolumesRead)
+		assert.Equal(t, int64(1700000000), entries[0].ListStatus.UpdatedAt.Unix())
+		assert.Equal(t, 3, entries[1].Node.ID)
+	}
+
+	err = c.UpdateListStatus(context.Background(), 2, &myanimelist.ListStatus{Status: myanimelist.StatusCompleted, NumChaptersRead: 20, NumVolumesRead: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"status": {"completed"}, "num_chapters_read": {"20"}, "num_volumes_read": {"2"}}, saved)
+
+	err = c.UpdateListStatus(context.Background(), 404, &myanimelist.ListStatus{Status: myanimelist.StatusReading})
+	assert.ErrorContains(t, err, "404 Not Found: not_found")
+}
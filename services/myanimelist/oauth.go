@@ -0,0 +1,124 @@
+package myanimelist
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abibby/comicbox-3/config"
+)
+
+// Token is an access token for a user. MyAnimeList tokens last a month and
+// are refreshed with the refresh token.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+type tokenResponse struct {
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+	Message      string `json:"message"`
+	Hint         string `json:"hint"`
+}
+
+// NewVerifier creates a PKCE code verifier. MyAnimeList only supports the
+// plain challenge method so the verifier is also the challenge.
+func NewVerifier() (string, error) {
+	b := make([]byte, 48)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthorizeURL is the page users log in to MyAnimeList on, they are
+// redirected back to redirectURI with a code for Exchange.
+func AuthorizeURL(verifier, redirectURI string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", config.MyAnimeListClientID)
+	q.Set("code_challenge", verifier)
+	q.Set("code_challenge_method", "plain")
+	q.Set("redirect_uri", redirectURI)
+	return oauthURL() + "/v1/oauth2/authorize?" + q.Encode()
+}
+
+// Exchange trades the code MyAnimeList redirects back with for an access
+// token. verifier and redirectURI must match the ones given to AuthorizeURL.
+func Exchange(ctx context.Context, httpClient *http.Client, code, verifier, redirectURI string) (*Token, error) {
+	return token(ctx, httpClient, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	})
+}
+
+// Refresh trades a refresh token for a new access token.
+func Refresh(ctx context.Context, httpClient *http.Client, refreshToken string) (*Token, error) {
+	return token(ctx, httpClient, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+func token(ctx context.Context, httpClient *http.Client, form url.Values) (*Token, error) {
+	form.Set("client_id", config.MyAnimeListClientID)
+	if config.MyAnimeListClientSecret != "" {
+		form.Set("client_secret", config.MyAnimeListClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oauthURL()+"/v1/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tokenResp := &tokenResponse{}
+	err = json.NewDecoder(resp.Body).Decode(tokenResp)
+	if err != nil {
+		return nil, fmt.Errorf("myanimelist token request failed %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || tokenResp.AccessToken == "" {
+		message := tokenResp.Hint
+		if message == "" {
+			message = tokenResp.Message
+		}
+		if message == "" {
+			message = tokenResp.Error
+		}
+		return nil, fmt.Errorf("myanimelist token request failed %s: %s", resp.Status, message)
+	}
+
+	return &Token{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+func oauthURL() string {
+	if config.MyAnimeListURL != "" {
+		return config.MyAnimeListURL
+	}
+	return "https://myanimelist.net"
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/abibby/salusa/database/dbtest"
 	"github.com/abibby/salusa/database/dialects/sqlite"
 	"github.com/abibby/salusa/di"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -47,9 +46,5 @@ func Run(t *testing.T, name string, cb func(ctx context.Context, t *testing.T, t
 var RunBenchmark = r.RunBenchmark
 
 func WithUser(ctx context.Context, user *models.User) context.Context {
-	return auth.ContextWithClaims(ctx, &auth.Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Subject: user.ID.String(),
-		},
-	})
+	return auth.ActAs(ctx, user.ID)
 }
@@ -1,4 +1,3 @@
-import { apiFetch } from 'src/api/internal'
 import slog from 'src/slog'
 
 export interface GraphQLResponseError {
@@ -132,27 +131,3 @@ export async function searchManga(
     const response = await gql(query, variables)
     return response.manga
 }
-
-export interface UpdateMangaRequest {
-    mediaId: number
-    progress: number | null
-    progressVolumes: number | null
-    startedAt?: string | null
-}
-export async function updateManga(r: UpdateMangaRequest): Promise<unknown> {
-    return await apiFetch('/api/anilist/update', {
-        method: 'POST',
-        body: JSON.stringify(r),
-    })
-}
-
-interface LoginRequest {
-    grant: string
-}
-
-export async function login(req: LoginRequest): Promise<unknown> {
-    return await apiFetch('/api/anilist/login', {
-        method: 'POST',
-        body: JSON.stringify(req),
-    })
-}
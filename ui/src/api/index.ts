@@ -8,3 +8,4 @@ export * as userBookAPI from 'src/api/user-book'
 export * as userSeriesAPI from 'src/api/user-series'
 export * as rumAPI from 'src/api/rum'
 export * as roleAPI from 'src/api/role'
+export * as trackerAPI from 'src/api/tracker'
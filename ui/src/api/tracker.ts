@@ -0,0 +1,73 @@
+import { TrackerService } from 'src/models'
+import { apiFetch, encodeParams } from 'src/api/internal'
+
+export interface Tracker {
+    service: TrackerService
+    password: boolean
+    linked: boolean
+    username: string
+}
+
+export interface ImportResult {
+    imported: number
+    unmatched: string[]
+}
+
+export interface LoginResponse extends Tracker {
+    import: ImportResult
+}
+
+export interface LoginRequest {
+    code?: string
+    redirect_uri?: string
+    username?: string
+    password?: string
+}
+
+export const trackerNames: Record<TrackerService, string> = {
+    [TrackerService.Anilist]: 'Anilist',
+    [TrackerService.MyAnimeList]: 'MyAnimeList',
+    [TrackerService.Kitsu]: 'Kitsu',
+}
+
+export function redirectURI(service: TrackerService): string {
+    return `${location.origin}/trackers/${encodeURIComponent(service)}/login`
+}
+
+export async function index(): Promise<Tracker[]> {
+    return await apiFetch('/api/trackers', {})
+}
+
+export async function authorize(service: TrackerService): Promise<string> {
+    const resp: { url: string } = await apiFetch(
+        `/api/trackers/${encodeURIComponent(service)}/authorize?` +
+            encodeParams({ redirect_uri: redirectURI(service) }),
+        {},
+    )
+    return resp.url
+}
+
+export async function login(
+    service: TrackerService,
+    req: LoginRequest,
+): Promise<LoginResponse> {
+    return await apiFetch(
+        `/api/trackers/${encodeURIComponent(service)}/login`,
+        {
+            method: 'POST',
+            body: JSON.stringify(req),
+        },
+    )
+}
+
+export async function logout(service: TrackerService): Promise<void> {
+    await apiFetch(`/api/trackers/${encodeURIComponent(service)}/login`, {
+        method: 'DELETE',
+    })
+}
+
+export async function sync(): Promise<void> {
+    await apiFetch('/api/trackers/sync', {
+        method: 'POST',
+    })
+}
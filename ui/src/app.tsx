@@ -10,6 +10,7 @@ import 'src/error'
 import state from 'src/state'
 import { LocationProvider, Router, Route } from 'preact-iso'
 import { ChangePasswordModal } from 'src/modals/change-password-modal'
+import { TrackerLoginModal } from 'src/modals/tracker-login-modal'
 import { EditSeries } from 'src/modals/series-edit'
 import { EditBook } from 'src/modals/book-edit'
 import { MetadataMatch } from 'src/modals/metadata-match'
@@ -74,6 +75,10 @@ function Main() {
                             path='/metadata/:slug'
                             component={MetadataMatch}
                         />
+                        <Route
+                            path='/tracker-login/:service'
+                            component={TrackerLoginModal}
+                        />
                     </Router>
                 </ModalController>
             </ErrorBoundary>
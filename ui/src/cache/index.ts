@@ -155,6 +155,8 @@ export async function persist(
                         volume: b.volume,
                         rtl: b.rtl,
                         long_strip: b.long_strip,
+                        auto_crop: b.auto_crop,
+                        split_spreads: b.split_spreads,
                         pages: b.pages.map(p => ({
                             type: p.type,
                         })),
@@ -195,6 +197,13 @@ export async function persist(
                         description: s.description,
                         metadata_id: s.metadata_id,
                         locked_fields: s.locked_fields,
+                        auto_crop: s.auto_crop,
+                        auto_delete_recurring: s.auto_delete_recurring,
+                        auto_delete_blank: s.auto_delete_blank,
+                        rtl: s.rtl,
+                        long_strip: s.long_strip,
+                        split_spreads: s.split_spreads,
+                        tracker_ids: s.tracker_ids,
                         update_map: s.update_map,
                     })
                     result.dirty = 0
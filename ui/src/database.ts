@@ -65,8 +65,18 @@ export const emptySeries: Readonly<DBSeries> = {
     genres: [],
     tags: [],
     year: null,
+    publisher: "",
+    country: "",
     directory: '',
     locked_fields: [],
+    auto_crop: false,
+    palette: null,
+    auto_delete_recurring: false,
+    auto_delete_blank: false,
+    rtl: null,
+    long_strip: null,
+    split_spreads: null,
+    tracker_ids: {},
 }
 
 export const emptyUserBook: Readonly<UserBook> = {
@@ -91,9 +101,14 @@ export const emptyBook: Readonly<DBBook> = {
     page_count: 0,
     rtl: false,
     long_strip: false,
+    auto_crop: null,
+    split_spreads: false,
     sort: '',
     file: '',
     cover_url: '',
+    cover_blur_hash: '',
+    palette: null,
+    type_confidence: 1,
     user_book: {
         created_at: '1970-01-01T00:00:00Z',
         updated_at: '1970-01-01T00:00:00Z',
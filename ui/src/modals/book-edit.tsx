@@ -77,6 +77,12 @@ export const EditBook: FunctionalComponent = () => {
                             type: isPageType(type) ? type : PageType.Story,
                             width: book.pages[i]?.height ?? 0,
                             height: book.pages[i]?.width ?? 0,
+                            blur_hash: book.pages[i]?.blur_hash ?? '',
+                            crop: book.pages[i]?.crop ?? null,
+                            hash: book.pages[i]?.hash ?? '',
+                            blank: book.pages[i]?.blank ?? false,
+                            seam: book.pages[i]?.seam ?? null,
+                            confidence: 1,
                         }),
                     ),
                 })
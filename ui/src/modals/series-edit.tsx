@@ -18,6 +18,7 @@ import { encode } from 'src/util'
 import { updateSeriesMetadata } from 'src/services/series-service'
 import { TextArea } from 'src/components/form/textarea'
 import { Locker } from 'src/components/form/locker'
+import { TrackerService } from 'src/models'
 
 export const EditSeries: FunctionalComponent = () => {
     const { close } = useModal()
@@ -59,6 +60,7 @@ export const EditSeries: FunctionalComponent = () => {
                 tags: data.get('tags')?.split('\n') ?? [],
                 description: data.get('description') ?? '',
                 metadata_id: metadataID === '' ? null : metadataID,
+                tracker_ids: trackerIDs(data),
                 locked_fields: data.getAll('locked_fields') ?? [],
             })
             await persist(true)
@@ -145,8 +147,31 @@ export const EditSeries: FunctionalComponent = () => {
                     >
                         <Button onClick={findMeta}>Find Match</Button>
                     </Input>
+                    <Input
+                        title='MyAnimeList ID'
+                        name='tracker_myanimelist'
+                        value={series?.tracker_ids?.myanimelist}
+                    />
+                    <Input
+                        title='Kitsu ID'
+                        name='tracker_kitsu'
+                        value={series?.tracker_ids?.kitsu}
+                    />
                 </ModalBody>
             </Form>
         </Modal>
     )
 }
+
+// trackerIDs reads the series' tracker IDs from the form. The Anilist ID
+// comes from the metadata ID.
+function trackerIDs(data: Data): Partial<Record<TrackerService, string>> {
+    const ids: Partial<Record<TrackerService, string>> = {}
+    for (const service of [TrackerService.MyAnimeList, TrackerService.Kitsu]) {
+        const id = data.get(`tracker_${service}`)?.trim()
+        if (id) {
+            ids[service] = id
+        }
+    }
+    return ids
+}
@@ -0,0 +1,64 @@
+import { h } from 'preact'
+import { useRoute } from 'preact-iso'
+import { useCallback, useState } from 'preact/hooks'
+import { trackerAPI } from 'src/api'
+import { Form, GlobalErrors } from 'src/components/form/form'
+import { Input } from 'src/components/form/input'
+import {
+    Modal,
+    ModalBody,
+    ModalHead,
+    ModalHeadActions,
+} from 'src/components/modal'
+import { useModal } from 'src/components/modal-controller'
+import { openToast } from 'src/components/toast'
+import { TrackerService } from 'src/models'
+
+export function TrackerLoginModal() {
+    const { close } = useModal()
+    const { params } = useRoute()
+    const service = params.service as TrackerService
+
+    const [username, setUsername] = useState('')
+    const [password, setPassword] = useState('')
+
+    const save = useCallback(async () => {
+        const tracker = await trackerAPI.login(service, {
+            username: username,
+            password: password,
+        })
+        close(tracker)
+        await openToast(
+            `Imported ${tracker.import.imported} series, ` +
+                `${tracker.import.unmatched.length} not found`,
+        )
+    }, [close, service, username, password])
+    return (
+        <Modal>
+            <Form onSubmit={save}>
+                <ModalHead>
+                    Link {trackerAPI.trackerNames[service] ?? service}
+                    <ModalHeadActions>
+                        <button type='submit'>link</button>
+                    </ModalHeadActions>
+                </ModalHead>
+                <ModalBody>
+                    <GlobalErrors />
+                    <Input
+                        title='Username'
+                        name='username'
+                        value={username}
+                        onInput={setUsername}
+                    />
+                    <Input
+                        title='Password'
+                        name='password'
+                        type='password'
+                        value={password}
+                        onInput={setPassword}
+                    />
+                </ModalBody>
+            </Form>
+        </Modal>
+    )
+}
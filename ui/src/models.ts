@@ -16,10 +16,15 @@ export interface Book {
     page_count: number
     rtl: boolean
     long_strip: boolean
+    auto_crop: boolean | null
+    split_spreads: boolean
     sort: string
     file: string
     cover_url: string
     download_size: number
+    cover_blur_hash: string
+    palette: Palette | null
+    type_confidence: number
     user_book: UserBook | null
     series: Series | null
 }
@@ -27,9 +32,30 @@ export interface Page {
     type: PageType
     height: number
     width: number
+    blur_hash: string
+    crop: CropBox | null
+    hash: string
+    blank: boolean
+    seam: Seam | null
+    confidence: number
     url: string
     thumbnail_url: string
 }
+export interface CropBox {
+    x: number
+    y: number
+    width: number
+    height: number
+}
+export interface Seam {
+    ltr: number
+    rtl: number
+}
+export interface Palette {
+    dominant: string
+    vibrant: string
+    muted: string
+}
 export interface Series {
     created_at: string
     updated_at: string
@@ -45,7 +71,17 @@ export interface Series {
     genres: Array<string>
     tags: Array<string>
     year: number | null
+    publisher: string
+    country: string
     locked_fields: Array<string>
+    auto_crop: boolean
+    palette: Palette | null
+    auto_delete_recurring: boolean
+    auto_delete_blank: boolean
+    rtl: boolean | null
+    long_strip: boolean | null
+    split_spreads: boolean | null
+    tracker_ids: Partial<Record<TrackerService, string>>
     user_series: UserSeries | null
 }
 export interface User {
@@ -79,6 +115,24 @@ export interface Role {
     name: string
     scopes: Array<string>
 }
+export interface BookRule {
+    id: string
+    name: string
+    priority: number
+    enabled: boolean
+    conditions: Array<RuleCondition>
+    actions: Array<RuleAction>
+}
+export interface RuleCondition {
+    field: RuleField
+    operator: RuleOperator
+    value: string
+    not: boolean
+}
+export interface RuleAction {
+    field: RuleActionField
+    value: boolean
+}
 export interface Staff {
     name: string
     role: StaffRole
@@ -95,6 +149,7 @@ export interface SeriesMetadata {
     genres: Array<string>
     tags: Array<string>
     publisher: string
+    country: string
 }
 export interface DistanceMetadata {
     id: string | null
@@ -108,6 +163,7 @@ export interface DistanceMetadata {
     genres: Array<string>
     tags: Array<string>
     publisher: string
+    country: string
     match_distance: number
 }
 export interface UserSeriesUpdateRequest {
@@ -126,6 +182,8 @@ export interface BookUpdateRequest {
     chapter: number | null
     rtl: boolean
     long_strip: boolean
+    auto_crop: boolean | null
+    split_spreads: boolean
     pages: Array<PageUpdate>
     update_map: Record<string, string>
 }
@@ -138,11 +196,87 @@ export interface SeriesUpdateRequest {
     year: number | null
     metadata_id: string | null
     locked_fields: Array<string>
+    auto_crop: boolean
+    auto_delete_recurring: boolean
+    auto_delete_blank: boolean
+    rtl: boolean | null
+    long_strip: boolean | null
+    split_spreads: boolean | null
+    tracker_ids: Partial<Record<TrackerService, string>>
     update_map: Record<string, string>
 }
 export interface PageUpdate {
     type: string
 }
+export interface SpriteManifest {
+    url: string
+    width: number
+    height: number
+    tile_height: number
+    tiles: Array<SpriteTile>
+}
+export interface SpriteTile {
+    page: number
+    x: number
+    y: number
+    width: number
+    height: number
+}
+export interface SliceManifest {
+    width: number
+    height: number
+    tile_height: number
+    tiles: Array<PageSlice>
+}
+export interface PageSlice {
+    y: number
+    height: number
+    url: string
+}
+export interface SeriesAutoDeleteResponse {
+    pages: Array<DeletedPage>
+}
+export interface SeriesApplyDefaultsResponse {
+    books: number
+}
+export interface DeletedPage {
+    book_id: string
+    page: number
+    reason: DeleteReason
+    thumbnail_url: string
+}
+export interface BookRuleBody {
+    name: string
+    priority: number
+    enabled: boolean | null
+    conditions: Array<RuleCondition>
+    actions: Array<RuleAction>
+}
+export interface BookRuleDryRunResponse {
+    changes: Array<BookChange>
+}
+export interface BookChange {
+    book_id: string
+    series_slug: string
+    file: string
+    field: RuleActionField
+    value: boolean
+    rule_id: string
+}
+export interface SeriesRepackEstimateResponse {
+    format: string
+    quality: number
+    current_size: number
+    estimated_size: number
+    books: Array<BookEstimate>
+}
+export interface BookEstimate {
+    book_id: string
+    file: string
+    current_size: number
+    estimated_size: number
+    sampled_pages: number
+}
 export enum PageType {
     Deleted = "Deleted",
     FrontCover = "FrontCover",
@@ -158,6 +292,11 @@ export enum List {
     Planning = "planning",
     Reading = "reading",
 }
+export enum TrackerService {
+    Anilist = "anilist",
+    Kitsu = "kitsu",
+    MyAnimeList = "myanimelist",
+}
 export enum SeriesOrder {
     CreatedAt = "created_at",
     LastRead = "last-read",
@@ -171,3 +310,34 @@ export enum StaffRole {
     RoleTranslator = "translator",
     RoleWriter = "writer",
 }
+export enum DeleteReason {
+    Blank = "blank",
+    Recurring = "recurring",
+}
+export enum RuleField {
+    BookAuthors = "book.authors",
+    BookPath = "book.path",
+    BookTitle = "book.title",
+    PageCount = "pages.count",
+    PageMaxAspect = "pages.max_aspect",
+    PageMinAspect = "pages.min_aspect",
+    SeriesCountry = "series.country",
+    SeriesGenres = "series.genres",
+    SeriesName = "series.name",
+    SeriesPublisher = "series.publisher",
+    SeriesTags = "series.tags",
+    SeriesYear = "series.year",
+}
+export enum RuleOperator {
+    Contains = "contains",
+    Equals = "equals",
+    GreaterThan = "gt",
+    LessThan = "lt",
+    Matches = "matches",
+}
+export enum RuleActionField {
+    AutoCrop = "auto_crop",
+    LongStrip = "long_strip",
+    RightToLeft = "rtl",
+    SplitSpreads = "split_spreads",
+}
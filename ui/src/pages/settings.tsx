@@ -1,5 +1,5 @@
 import { FunctionalComponent, h } from 'preact'
-import { useCallback } from 'preact/hooks'
+import { useCallback, useEffect, useState } from 'preact/hooks'
 import { logout, useHasScope, userCreateToken } from 'src/api/auth'
 import { bookSync } from 'src/api/sync'
 import { openToast } from 'src/components/toast'
@@ -13,6 +13,9 @@ import { useLocation } from 'preact-iso'
 import { openModal } from 'src/components/modal-controller'
 import { bind } from '@zwzn/spicy'
 import { metadataSync } from 'src/api/metadata'
+import { trackerAPI } from 'src/api'
+import { Tracker } from 'src/api/tracker'
+import { encode } from 'src/util'
 
 function useLogoutAndRoute() {
     const { route } = useLocation()
@@ -41,8 +44,6 @@ export const Settings: FunctionalComponent = () => {
         )
     }, [])
 
-    // const redirectURI = location.origin + '/anilist/login'
-
     const scopeBookSync = useHasScope('book:sync')
     const scopeSeriesWrite = useHasScope('series:write')
     const scopeAdmin = useHasScope('series:write')
@@ -54,7 +55,6 @@ export const Settings: FunctionalComponent = () => {
      generate user create link
      clear database
      logout
-     anilist login
 
      */
     const theme = useSignal(state.theme)
@@ -82,6 +82,7 @@ export const Settings: FunctionalComponent = () => {
                 </RadioButtonGroup>
                 <Button onClick={clearDatabase}>Clear Local Cache</Button>
             </section>
+            <TrackerSettings />
             {(scopeBookSync ||
                 scopeSeriesWrite ||
                 (!PUBLIC_USER_CREATE && scopeAdmin)) && (
@@ -112,6 +113,74 @@ export const Settings: FunctionalComponent = () => {
     )
 }
 
+const TrackerSettings: FunctionalComponent = () => {
+    const [trackers, setTrackers] = useState<Tracker[]>([])
+    const reload = useCallback(() => {
+        trackerAPI
+            .index()
+            .then(setTrackers)
+            .catch(() => setTrackers([]))
+    }, [])
+    useEffect(reload, [reload])
+
+    const link = useCallback(
+        async (t: Tracker) => {
+            if (!t.password) {
+                location.href = await trackerAPI.authorize(t.service)
+                return
+            }
+            await openModal(encode`/tracker-login/${t.service}`).result()
+            reload()
+        },
+        [reload],
+    )
+    const unlink = useCallback(
+        async (t: Tracker) => {
+            await trackerAPI.logout(t.service)
+            await openToast(`Unlinked ${trackerAPI.trackerNames[t.service]}`)
+            reload()
+        },
+        [reload],
+    )
+
+    if (trackers.length === 0) {
+        return null
+    }
+
+    return (
+        <section>
+            <h3>Trackers</h3>
+            {trackers.map(t => {
+                const name = trackerAPI.trackerNames[t.service]
+                if (t.linked) {
+                    return (
+                        <Button key={t.service} onClick={bind(t, unlink)}>
+                            Unlink {name} ({t.username})
+                        </Button>
+                    )
+                }
+                return (
+                    <Button key={t.service} onClick={bind(t, link)}>
+                        Link {name}
+                    </Button>
+                )
+            })}
+            {trackers.some(t => t.linked) && (
+                <Button onClick={trackerSync}>Sync Trackers</Button>
+            )}
+        </section>
+    )
+}
+
+async function trackerSync() {
+    try {
+        await trackerAPI.sync()
+        await openToast('Syncing with trackers')
+    } catch {
+        await openToast('Link a tracker to sync')
+    }
+}
+
 function setTheme(theme: string) {
     if (theme === 'light' || theme === 'dark') {
         state.theme.value = theme
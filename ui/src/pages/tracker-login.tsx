@@ -0,0 +1,64 @@
+import { FunctionalComponent, h } from 'preact'
+import { useLocation } from 'preact-iso'
+import { useEffect, useState } from 'preact/hooks'
+import { trackerAPI } from 'src/api'
+import { ImportResult } from 'src/api/tracker'
+import { Button } from 'src/components/button'
+import { TrackerService } from 'src/models'
+import { route } from 'src/routes'
+
+export interface TrackerLoginProps {
+    service?: string
+    code?: string
+}
+
+export const TrackerLogin: FunctionalComponent<TrackerLoginProps> = props => {
+    const { route: navigate } = useLocation()
+    const [err, setErr] = useState<string>()
+    const [result, setResult] = useState<ImportResult>()
+    const service = props.service as TrackerService | undefined
+    const code = props.code
+    useEffect(() => {
+        if (service === undefined || code === undefined) {
+            return
+        }
+        trackerAPI
+            .login(service, {
+                code: code,
+                redirect_uri: trackerAPI.redirectURI(service),
+            })
+            .then(resp => {
+                if (resp.import.unmatched.length === 0) {
+                    navigate(route('settings', {}))
+                    return
+                }
+                setResult(resp.import)
+            })
+            .catch(err => {
+                if (err instanceof Error) {
+                    setErr(err.message)
+                } else {
+                    setErr('unknown error')
+                }
+            })
+    }, [service, code, navigate])
+
+    if (result !== undefined) {
+        return (
+            <div>
+                <h1>
+                    Imported {result.imported} series from{' '}
+                    {service && trackerAPI.trackerNames[service]}
+                </h1>
+                <p>These series weren't found in the library:</p>
+                <ul>
+                    {result.unmatched.map(title => (
+                        <li key={title}>{title}</li>
+                    ))}
+                </ul>
+                <Button href={route('settings', {})}>Continue</Button>
+            </div>
+        )
+    }
+    return <div>{err}</div>
+}
@@ -4,11 +4,11 @@ import { Profile } from 'src/pages/profile'
 import { SeriesIndex } from 'src/pages/series-index'
 import { SeriesView } from 'src/pages/series-view'
 import { UserCreate } from 'src/pages/user-create'
-import { AnilistLogin } from 'src/pages/anilist-login'
 import { Login } from 'src/pages/login'
 import { List } from 'src/pages/lists'
 import { Search } from 'src/pages/search'
 import { Settings } from 'src/pages/settings'
+import { TrackerLogin } from 'src/pages/tracker-login'
 
 export const routes = {
     home: {
@@ -48,9 +48,9 @@ export const routes = {
         path: '/users/create',
         component: UserCreate,
     },
-    'anilist.login': {
-        path: '/anilist/login',
-        component: AnilistLogin,
+    'tracker.login': {
+        path: '/trackers/:service/login',
+        component: TrackerLogin,
     },
     login: {
         path: '/login',